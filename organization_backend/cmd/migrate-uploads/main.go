@@ -0,0 +1,156 @@
+// Command migrate-uploads copies uploaded files from a local directory into
+// the configured storage backend and rewrites the stored image URLs.
+package main
+
+import (
+	"context"
+	"flag"
+	"log"
+	"mime"
+	"os"
+	"path"
+	"path/filepath"
+
+	"organization_backend/internal/config"
+	"organization_backend/internal/db"
+	"organization_backend/internal/storage"
+)
+
+func main() {
+	from := flag.String("from", "uploads", "local directory holding the existing uploads")
+	dryRun := flag.Bool("dry-run", false, "list the files that would be copied without writing anything")
+	deleteSource := flag.Bool("delete-source", false, "delete local files once the target has a copy of the same size")
+	flag.Parse()
+
+	cfg, err := config.Load(nil)
+	if err != nil {
+		log.Fatalf("config load failed: %v", err)
+	}
+
+	storageCfg := cfg.Uploads.Storage()
+	if root := storageCfg.LocalRoot(); root != "" {
+		same, err := sameDir(*from, root)
+		if err != nil {
+			log.Fatalf("resolve upload directories failed: %v", err)
+		}
+		if same {
+			log.Fatalf("target is the local directory %s itself; configure the s3 driver or another local path", *from)
+		}
+	}
+
+	ctx := context.Background()
+	source, err := storage.NewLocal(*from)
+	if err != nil {
+		log.Fatalf("open source failed: %v", err)
+	}
+	target, err := storage.New(ctx, storageCfg)
+	if err != nil {
+		log.Fatalf("open target failed: %v", err)
+	}
+
+	objects, err := source.List(ctx, "")
+	if err != nil {
+		log.Fatalf("list source failed: %v", err)
+	}
+	log.Printf("found %d files in %s", len(objects), *from)
+
+	for _, obj := range objects {
+		if *dryRun {
+			log.Printf("would copy %s (%d bytes)", obj.Key, obj.Size)
+			continue
+		}
+		if err := copyObject(ctx, source, target, obj); err != nil {
+			log.Fatalf("copy %s failed: %v", obj.Key, err)
+		}
+		log.Printf("copied %s", obj.Key)
+	}
+
+	conn, err := db.Open(cfg.Database.URL, db.PoolConfig{
+		MaxOpenConns:    cfg.Database.MaxOpenConns,
+		MaxIdleConns:    cfg.Database.MaxIdleConns,
+		ConnMaxLifetime: cfg.Database.ConnMaxLifetime,
+	})
+	if err != nil {
+		log.Fatalf("db open failed: %v", err)
+	}
+	defer conn.Close()
+	store := db.NewStore(conn)
+
+	rewrite := func(url string) string {
+		key, ok := source.KeyFromURL(url)
+		if !ok {
+			key, ok = target.KeyFromURL(url)
+		}
+		if !ok {
+			return url
+		}
+		return target.PublicURL(key)
+	}
+
+	if *dryRun {
+		log.Printf("dry run: skipping database URL rewrite")
+		return
+	}
+	changed, err := store.RewriteUploadURLs(ctx, rewrite)
+	if err != nil {
+		log.Fatalf("rewrite image URLs failed: %v", err)
+	}
+	log.Printf("rewrote %d image URL rows", changed)
+
+	if *deleteSource {
+		deleted := 0
+		for _, obj := range objects {
+			info, err := target.Stat(ctx, obj.Key)
+			if err != nil {
+				log.Printf("keeping %s: stat in target failed: %v", obj.Key, err)
+				continue
+			}
+			if info.Size != obj.Size {
+				log.Printf("keeping %s: target has %d bytes, source %d", obj.Key, info.Size, obj.Size)
+				continue
+			}
+			if err := source.Delete(ctx, obj.Key); err != nil {
+				log.Printf("delete %s failed: %v", obj.Key, err)
+				continue
+			}
+			deleted++
+		}
+		log.Printf("deleted %d of %d source files", deleted, len(objects))
+	}
+}
+
+// sameDir reports whether a and b name the same directory, also through
+// symlinks. Directories that do not exist yet are different from any other.
+func sameDir(a, b string) (bool, error) {
+	absA, err := filepath.Abs(a)
+	if err != nil {
+		return false, err
+	}
+	absB, err := filepath.Abs(b)
+	if err != nil {
+		return false, err
+	}
+	if absA == absB {
+		return true, nil
+	}
+	infoA, errA := os.Stat(absA)
+	infoB, errB := os.Stat(absB)
+	if errA != nil || errB != nil {
+		return false, nil
+	}
+	return os.SameFile(infoA, infoB), nil
+}
+
+func copyObject(ctx context.Context, source, target storage.Storage, obj storage.ObjectInfo) error {
+	body, info, err := source.Get(ctx, obj.Key)
+	if err != nil {
+		return err
+	}
+	defer body.Close()
+
+	contentType := info.ContentType
+	if contentType == "" {
+		contentType = mime.TypeByExtension(path.Ext(obj.Key))
+	}
+	return target.Put(ctx, obj.Key, body, info.Size, contentType)
+}
@@ -0,0 +1,238 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"strconv"
+
+	"organization_backend/internal/db"
+	"organization_backend/internal/domain"
+)
+
+// materialTypeCommands archive and restore material types
+var materialTypeCommands = map[string]subcommand{
+	"list":    {usage: "material-types list [-json] [-archived]", run: materialTypesList},
+	"archive": {usage: "material-types archive [-dry-run] [-json] ID", run: setMaterialTypeArchived(true)},
+	"restore": {usage: "material-types restore [-dry-run] [-json] ID", run: setMaterialTypeArchived(false)},
+}
+
+// centerCommands manage distribution centers. CENTER arguments are IDs or
+// names.
+var centerCommands = map[string]subcommand{
+	"list":   {usage: "centers list [-json]", run: centersList},
+	"create": {usage: "centers create [-dry-run] [-json] NAME ADDRESS", run: centersCreate},
+}
+
+// stockCommands manage the stock levels of distribution centers
+var stockCommands = map[string]subcommand{
+	"list":  {usage: "stock list [-json] [-center CENTER]", run: stockList},
+	"set":   {usage: "stock set [-dry-run] [-json] MATERIAL_TYPE CENTER AMOUNT", run: stockSet},
+	"reset": {usage: "stock reset [-dry-run] [-json] CENTER", run: stockReset},
+}
+
+func materialTypesList(ctx context.Context, args []string) error {
+	var archived bool
+	opts, _, err := parseFlags("material-types list", args, 0, false, func(flags *flag.FlagSet) {
+		flags.BoolVar(&archived, "archived", false, "include archived material types")
+	})
+	if err != nil {
+		return err
+	}
+	return withStore(func(store *db.Store) error {
+		all, err := store.ListMaterialTypes(ctx)
+		if err != nil {
+			return err
+		}
+		types := []domain.MaterialType{}
+		for _, mt := range all {
+			if archived || mt.ArchivedAt == nil {
+				types = append(types, mt)
+			}
+		}
+		if opts.JSON {
+			return printJSON(types)
+		}
+		rows := make([][]string, 0, len(types))
+		for _, mt := range types {
+			rows = append(rows, []string{mt.ID, mt.Name, mt.CategoryID, archivedState(mt)})
+		}
+		return printTable("ID\tNAME\tCATEGORY\tSTATE", rows)
+	})
+}
+
+func setMaterialTypeArchived(archived bool) func(context.Context, []string) error {
+	verb := "restore"
+	if archived {
+		verb = "archive"
+	}
+	return func(ctx context.Context, args []string) error {
+		opts, args, err := parseFlags("material-types "+verb, args, 1, true, nil)
+		if err != nil {
+			return err
+		}
+		id := domain.NormalizeID(args[0])
+		return withStore(func(store *db.Store) error {
+			if opts.DryRun {
+				mt, err := store.GetMaterialTypeByID(ctx, id)
+				if err != nil {
+					return err
+				}
+				return reportDryRun(opts, verb, fmt.Sprintf("%s %s (currently %s)", verb, mt.ID, archivedState(mt)), mt)
+			}
+			var mt domain.MaterialType
+			if archived {
+				mt, err = store.ArchiveMaterialType(ctx, id)
+			} else {
+				mt, err = store.RestoreMaterialType(ctx, id)
+			}
+			if err != nil {
+				return err
+			}
+			return report(opts, fmt.Sprintf("%s is %s", mt.ID, archivedState(mt)), mt)
+		})
+	}
+}
+
+func archivedState(mt domain.MaterialType) string {
+	if mt.ArchivedAt != nil {
+		return "archived"
+	}
+	return "active"
+}
+
+func centersList(ctx context.Context, args []string) error {
+	opts, _, err := parseFlags("centers list", args, 0, false, nil)
+	if err != nil {
+		return err
+	}
+	return withStore(func(store *db.Store) error {
+		centers, err := store.ListDistributionCenters(ctx)
+		if err != nil {
+			return err
+		}
+		if opts.JSON {
+			return printJSON(centers)
+		}
+		rows := make([][]string, 0, len(centers))
+		for _, c := range centers {
+			rows = append(rows, []string{c.ID, c.Name, c.Address})
+		}
+		return printTable("ID\tNAME\tADDRESS", rows)
+	})
+}
+
+func centersCreate(ctx context.Context, args []string) error {
+	opts, args, err := parseFlags("centers create", args, 2, true, nil)
+	if err != nil {
+		return err
+	}
+	name, address := args[0], args[1]
+	if name == "" {
+		return usageError{msg: "NAME must not be empty"}
+	}
+	return withStore(func(store *db.Store) error {
+		if opts.DryRun {
+			center := domain.DistributionCenter{Name: name, Address: address}
+			return reportDryRun(opts, "create", fmt.Sprintf("create distribution center %s", name), center)
+		}
+		center, err := store.CreateDistributionCenter(ctx, name, address)
+		if err != nil {
+			return err
+		}
+		return report(opts, fmt.Sprintf("created distribution center %s (%s)", center.Name, center.ID), center)
+	})
+}
+
+func stockList(ctx context.Context, args []string) error {
+	var centerArg string
+	opts, _, err := parseFlags("stock list", args, 0, false, func(flags *flag.FlagSet) {
+		flags.StringVar(&centerArg, "center", "", "only list the stock of this distribution center")
+	})
+	if err != nil {
+		return err
+	}
+	return withStore(func(store *db.Store) error {
+		var centerID string
+		if centerArg != "" {
+			center, err := store.FindDistributionCenter(ctx, centerArg)
+			if err != nil {
+				return err
+			}
+			centerID = center.ID
+		}
+		levels, err := store.ListStock(ctx, centerID)
+		if err != nil {
+			return err
+		}
+		if opts.JSON {
+			return printJSON(levels)
+		}
+		rows := make([][]string, 0, len(levels))
+		for _, level := range levels {
+			rows = append(rows, []string{level.MaterialTypeID, level.DistributionCenterID, strconv.Itoa(level.Amount)})
+		}
+		return printTable("MATERIAL TYPE\tCENTER\tAMOUNT", rows)
+	})
+}
+
+func stockSet(ctx context.Context, args []string) error {
+	opts, args, err := parseFlags("stock set", args, 3, true, nil)
+	if err != nil {
+		return err
+	}
+	materialTypeID := domain.NormalizeID(args[0])
+	amount, err := strconv.Atoi(args[2])
+	if err != nil || amount < 0 {
+		return usageError{msg: "AMOUNT must be a non-negative number"}
+	}
+	return withStore(func(store *db.Store) error {
+		center, err := store.FindDistributionCenter(ctx, args[1])
+		if err != nil {
+			return err
+		}
+		level := domain.StockLevel{MaterialTypeID: materialTypeID, DistributionCenterID: center.ID, Amount: amount}
+		if opts.DryRun {
+			if _, err := store.GetMaterialTypeByID(ctx, materialTypeID); err != nil {
+				return err
+			}
+			return reportDryRun(opts, "set", fmt.Sprintf("set the stock of %s at %s to %d", materialTypeID, center.Name, amount), level)
+		}
+		level, err = store.SetStock(ctx, materialTypeID, center.ID, amount)
+		if err != nil {
+			return err
+		}
+		return report(opts, fmt.Sprintf("%s at %s: %d", level.MaterialTypeID, center.Name, level.Amount), level)
+	})
+}
+
+func stockReset(ctx context.Context, args []string) error {
+	opts, args, err := parseFlags("stock reset", args, 1, true, nil)
+	if err != nil {
+		return err
+	}
+	return withStore(func(store *db.Store) error {
+		center, err := store.FindDistributionCenter(ctx, args[0])
+		if err != nil {
+			return err
+		}
+		if opts.DryRun {
+			levels, err := store.ListStock(ctx, center.ID)
+			if err != nil {
+				return err
+			}
+			nonZero := []domain.StockLevel{}
+			for _, level := range levels {
+				if level.Amount != 0 {
+					nonZero = append(nonZero, level)
+				}
+			}
+			return reportDryRun(opts, "reset", fmt.Sprintf("reset %d stock levels at %s to 0", len(nonZero), center.Name), nonZero)
+		}
+		reset, err := store.ResetStock(ctx, center.ID)
+		if err != nil {
+			return err
+		}
+		return report(opts, fmt.Sprintf("reset %d stock levels at %s to 0", len(reset), center.Name), reset)
+	})
+}
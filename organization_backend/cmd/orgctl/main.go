@@ -0,0 +1,253 @@
+// Command orgctl performs operational tasks against the database of the
+// server, using the same configuration. Changes are recorded in the audit log
+// as made by orgctl and the operating system user running it.
+//
+//	orgctl migrate up|down N|status|create NAME|verify
+//	orgctl users list|show|promote|demote|disable|enable|assign-center
+//	orgctl material-types list|archive|restore
+//	orgctl centers list|create
+//	orgctl stock list|set|reset
+//	orgctl requests show|set-status|notify
+//	orgctl seed FILE
+//
+// Apart from migrate, commands that change data accept -dry-run and all
+// commands accept -json.
+package main
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"os/signal"
+	"os/user"
+	"sort"
+	"strings"
+	"syscall"
+	"text/tabwriter"
+
+	"organization_backend/internal/audit"
+	"organization_backend/internal/config"
+	"organization_backend/internal/db"
+)
+
+// command is a top level command of orgctl
+type command struct {
+	usage string
+	run   func(ctx context.Context, args []string) error
+}
+
+var commands map[string]command
+
+func init() {
+	commands = map[string]command{
+		"migrate":        {usage: "migrate up|down N|status|create NAME|verify", run: runMigrate},
+		"users":          {usage: "users " + subcommandNames(userCommands), run: runGroup(userCommands)},
+		"material-types": {usage: "material-types " + subcommandNames(materialTypeCommands), run: runGroup(materialTypeCommands)},
+		"centers":        {usage: "centers " + subcommandNames(centerCommands), run: runGroup(centerCommands)},
+		"stock":          {usage: "stock " + subcommandNames(stockCommands), run: runGroup(stockCommands)},
+		"requests":       {usage: "requests " + subcommandNames(requestCommands), run: runGroup(requestCommands)},
+		"seed":           {usage: "seed [-dry-run] [-json] FILE", run: runSeed},
+	}
+}
+
+// usageError is returned for invalid arguments and exits with status 2.
+// usage, when set, replaces the usage of the command.
+type usageError struct {
+	msg   string
+	usage string
+}
+
+func (e usageError) Error() string {
+	return e.msg
+}
+
+func main() {
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	if len(os.Args) < 2 {
+		printUsage()
+		os.Exit(2)
+	}
+	cmd, ok := commands[os.Args[1]]
+	if !ok {
+		fmt.Fprintf(os.Stderr, "orgctl: unknown command %q\n", os.Args[1])
+		printUsage()
+		os.Exit(2)
+	}
+	ctx = audit.WithActor(ctx, audit.Actor{Email: "orgctl:" + operator()})
+	if err := cmd.run(ctx, os.Args[2:]); err != nil {
+		fmt.Fprintf(os.Stderr, "orgctl: %v\n", err)
+		var usage usageError
+		if errors.As(err, &usage) {
+			if usage.usage == "" {
+				usage.usage = cmd.usage
+			}
+			fmt.Fprintf(os.Stderr, "usage: orgctl %s\n", usage.usage)
+			os.Exit(2)
+		}
+		os.Exit(1)
+	}
+}
+
+func printUsage() {
+	names := make([]string, 0, len(commands))
+	for name := range commands {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	var b strings.Builder
+	b.WriteString("usage:\n")
+	for _, name := range names {
+		fmt.Fprintf(&b, "  orgctl %s\n", commands[name].usage)
+	}
+	b.WriteString("\nRun orgctl COMMAND SUBCOMMAND -h for the flags of a subcommand.\n")
+	b.WriteString("The configuration is read like the server's: config.yaml, environment and .env.\n")
+	fmt.Fprint(os.Stderr, b.String())
+}
+
+// operator names the operating system user for the audit log
+func operator() string {
+	if u, err := user.Current(); err == nil && u.Username != "" {
+		return u.Username
+	}
+	return "unknown"
+}
+
+// subcommand is a subcommand of a command group like users
+type subcommand struct {
+	usage string
+	run   func(ctx context.Context, args []string) error
+}
+
+func subcommandNames(subs map[string]subcommand) string {
+	names := make([]string, 0, len(subs))
+	for name := range subs {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return strings.Join(names, "|")
+}
+
+// runGroup dispatches to the subcommand named by the first argument
+func runGroup(subs map[string]subcommand) func(context.Context, []string) error {
+	return func(ctx context.Context, args []string) error {
+		if len(args) == 0 {
+			return usageError{msg: "missing subcommand"}
+		}
+		sub, ok := subs[args[0]]
+		if !ok {
+			return usageError{msg: fmt.Sprintf("unknown subcommand %q", args[0])}
+		}
+		if err := sub.run(ctx, args[1:]); err != nil {
+			var usage usageError
+			if errors.As(err, &usage) {
+				return usageError{msg: usage.msg, usage: sub.usage}
+			}
+			return err
+		}
+		return nil
+	}
+}
+
+// options are the flags shared by the subcommands
+type options struct {
+	JSON   bool
+	DryRun bool
+}
+
+// parseFlags parses the flags of a subcommand, which come before its
+// arguments. mutating adds -dry-run; define adds further flags. The number
+// of remaining arguments must be nargs.
+func parseFlags(name string, args []string, nargs int, mutating bool, define func(*flag.FlagSet)) (options, []string, error) {
+	var opts options
+	flags := flag.NewFlagSet(name, flag.ContinueOnError)
+	flags.SetOutput(io.Discard)
+	flags.BoolVar(&opts.JSON, "json", false, "print JSON instead of text")
+	if mutating {
+		flags.BoolVar(&opts.DryRun, "dry-run", false, "show what would change without changing it")
+	}
+	if define != nil {
+		define(flags)
+	}
+	if err := flags.Parse(args); err != nil {
+		if errors.Is(err, flag.ErrHelp) {
+			flags.SetOutput(os.Stderr)
+			flags.PrintDefaults()
+		}
+		return options{}, nil, usageError{msg: err.Error()}
+	}
+	if flags.NArg() != nargs {
+		return options{}, nil, usageError{msg: fmt.Sprintf("expected %d arguments, got %d", nargs, flags.NArg())}
+	}
+	return opts, flags.Args(), nil
+}
+
+// openDB loads the configuration and connects to its database
+func openDB() (*sql.DB, error) {
+	cfg, err := config.Load(nil)
+	if err != nil {
+		return nil, err
+	}
+	conn, err := db.Open(cfg.Database.URL, db.PoolConfig{
+		MaxOpenConns:    cfg.Database.MaxOpenConns,
+		MaxIdleConns:    cfg.Database.MaxIdleConns,
+		ConnMaxLifetime: cfg.Database.ConnMaxLifetime,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("db open failed: %w", err)
+	}
+	return conn, nil
+}
+
+// withStore runs fn with a store on the configured database
+func withStore(fn func(store *db.Store) error) error {
+	conn, err := openDB()
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	return fn(db.NewStore(conn))
+}
+
+func printJSON(v any) error {
+	encoder := json.NewEncoder(os.Stdout)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(v)
+}
+
+// printTable writes tab separated rows aligned in columns
+func printTable(header string, rows [][]string) error {
+	w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(w, header)
+	for _, row := range rows {
+		fmt.Fprintln(w, strings.Join(row, "\t"))
+	}
+	return w.Flush()
+}
+
+// dryRun is printed instead of the result of a change in a dry run
+type dryRun struct {
+	DryRun bool   `json:"dryRun"`
+	Action string `json:"action"`
+	Target any    `json:"target"`
+}
+
+// report prints the outcome of a change as v in JSON or as message in text
+func report(opts options, message string, v any) error {
+	if opts.JSON {
+		return printJSON(v)
+	}
+	fmt.Println(message)
+	return nil
+}
+
+// reportDryRun prints what a change would do
+func reportDryRun(opts options, action, message string, target any) error {
+	return report(opts, "dry run: would "+message, dryRun{DryRun: true, Action: action, Target: target})
+}
@@ -0,0 +1,153 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"organization_backend/internal/db"
+)
+
+// defaultMigrationsDir is where create writes new migrations, relative to
+// the backend module
+const defaultMigrationsDir = "internal/db/migrations"
+
+func runMigrate(ctx context.Context, args []string) error {
+	if len(args) == 0 {
+		return usageError{msg: "missing migrate subcommand"}
+	}
+	sub, args := args[0], args[1:]
+	if sub == "create" {
+		return migrateCreate(args)
+	}
+
+	var n int
+	switch sub {
+	case "up", "status", "verify":
+		if len(args) != 0 {
+			return usageError{msg: fmt.Sprintf("migrate %s takes no arguments", sub)}
+		}
+	case "down":
+		if len(args) != 1 {
+			return usageError{msg: "migrate down needs the number of migrations to roll back"}
+		}
+		var err error
+		if n, err = strconv.Atoi(args[0]); err != nil || n < 1 {
+			return usageError{msg: fmt.Sprintf("invalid migration count %q", args[0])}
+		}
+	default:
+		return usageError{msg: fmt.Sprintf("unknown migrate subcommand %q", sub)}
+	}
+
+	conn, err := openDB()
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	migrator, err := db.NewMigrator(conn)
+	if err != nil {
+		return err
+	}
+
+	switch sub {
+	case "up":
+		applied, err := migrator.Up(ctx)
+		for _, m := range applied {
+			fmt.Printf("applied %s\n", m.ID)
+		}
+		if err == nil && len(applied) == 0 {
+			fmt.Println("database is up to date")
+		}
+		return err
+	case "down":
+		rolledBack, err := migrator.Down(ctx, n)
+		for _, m := range rolledBack {
+			fmt.Printf("rolled back %s\n", m.ID)
+		}
+		return err
+	case "status":
+		statuses, err := migrator.Status(ctx)
+		if err != nil {
+			return err
+		}
+		w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+		fmt.Fprintln(w, "VERSION\tNAME\tSTATE\tAPPLIED AT")
+		for _, s := range statuses {
+			state, appliedAt := "pending", ""
+			if s.Applied {
+				state, appliedAt = "applied", s.AppliedAt.Local().Format(time.DateTime)
+			}
+			switch {
+			case s.Drifted:
+				state = "edited"
+			case s.Missing:
+				state = "unknown"
+			}
+			fmt.Fprintf(w, "%03d\t%s\t%s\t%s\n", s.Version, s.Name, state, appliedAt)
+		}
+		return w.Flush()
+	case "verify":
+		if err := migrator.Verify(ctx); err != nil {
+			return err
+		}
+		fmt.Println("applied migrations match their files")
+	}
+	return nil
+}
+
+var nonIdentifier = regexp.MustCompile(`[^a-z0-9]+`)
+
+// migrateCreate writes an empty pair of up and down files with the next
+// version number
+func migrateCreate(args []string) error {
+	flags := flag.NewFlagSet("migrate create", flag.ContinueOnError)
+	dir := flags.String("dir", defaultMigrationsDir, "directory of the migration files")
+	if err := flags.Parse(args); err != nil {
+		return usageError{msg: err.Error()}
+	}
+	if flags.NArg() != 1 {
+		return usageError{msg: "migrate create needs a name"}
+	}
+	name := strings.Trim(nonIdentifier.ReplaceAllString(strings.ToLower(flags.Arg(0)), "_"), "_")
+	if name == "" {
+		return usageError{msg: fmt.Sprintf("invalid migration name %q", flags.Arg(0))}
+	}
+
+	existing, err := db.LoadMigrations(os.DirFS(*dir), ".")
+	if err != nil {
+		return err
+	}
+	version := 1
+	if len(existing) > 0 {
+		version = existing[len(existing)-1].Version + 1
+	}
+
+	base := fmt.Sprintf("%03d_%s", version, name)
+	files := map[string]string{
+		base + ".up.sql":   fmt.Sprintf("-- %s\n", strings.ReplaceAll(name, "_", " ")),
+		base + ".down.sql": fmt.Sprintf("-- Reverts %s\n", base+".up.sql"),
+	}
+	for _, file := range []string{base + ".up.sql", base + ".down.sql"} {
+		path := filepath.Join(*dir, file)
+		f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0o644)
+		if err != nil {
+			return err
+		}
+		if _, err := f.WriteString(files[file]); err != nil {
+			f.Close()
+			return err
+		}
+		if err := f.Close(); err != nil {
+			return err
+		}
+		fmt.Printf("created %s\n", path)
+	}
+	return nil
+}
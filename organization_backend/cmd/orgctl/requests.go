@@ -0,0 +1,123 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/google/uuid"
+
+	"organization_backend/internal/db"
+	"organization_backend/internal/domain"
+)
+
+// requestCommands inspect requests and fix their status
+var requestCommands = map[string]subcommand{
+	"show":       {usage: "requests show [-json] ID", run: requestsShow},
+	"set-status": {usage: "requests set-status [-dry-run] [-json] ID pending|inAction|returned", run: requestsSetStatus},
+	"notify":     {usage: "requests notify [-dry-run] [-json] ID", run: requestsNotify},
+}
+
+// getRequest returns the request with the given ID
+func getRequest(ctx context.Context, store *db.Store, id string) (domain.Request, error) {
+	if _, err := uuid.Parse(id); err != nil {
+		return domain.Request{}, db.ErrRequestNotFound
+	}
+	req, err := store.GetRequestByID(ctx, id)
+	if errors.Is(err, sql.ErrNoRows) {
+		return domain.Request{}, db.ErrRequestNotFound
+	}
+	return req, err
+}
+
+func requestsShow(ctx context.Context, args []string) error {
+	opts, args, err := parseFlags("requests show", args, 1, false, nil)
+	if err != nil {
+		return err
+	}
+	return withStore(func(store *db.Store) error {
+		req, err := getRequest(ctx, store, args[0])
+		if err != nil {
+			return err
+		}
+		if opts.JSON {
+			return printJSON(req)
+		}
+		rows := [][]string{
+			{"id", req.ID},
+			{"status", req.Status},
+			{"customer", req.Customer.Email},
+			{"delivery", req.DeliveryDate.Format(time.DateOnly)},
+		}
+		if req.ReturnDate != nil {
+			rows = append(rows, []string{"return", req.ReturnDate.Format(time.DateOnly)})
+		}
+		rows = append(rows,
+			[]string{"distribution center", req.DistributionCenterID},
+			[]string{"updated", req.UpdatedAt.Local().Format(time.DateTime)},
+		)
+		materialTypes := make([]string, 0, len(req.Items))
+		for id := range req.Items {
+			materialTypes = append(materialTypes, id)
+		}
+		sort.Strings(materialTypes)
+		for _, id := range materialTypes {
+			rows = append(rows, []string{"item " + id, strconv.Itoa(req.Items[id])})
+		}
+		for _, kit := range req.Kits {
+			rows = append(rows, []string{"kit " + kit.KitID, "class of " + strconv.Itoa(kit.ClassSize)})
+		}
+		return printTable("FIELD\tVALUE", rows)
+	})
+}
+
+func requestsSetStatus(ctx context.Context, args []string) error {
+	opts, args, err := parseFlags("requests set-status", args, 2, true, nil)
+	if err != nil {
+		return err
+	}
+	status := args[1]
+	switch status {
+	case "pending", "inAction", "returned":
+	default:
+		return usageError{msg: fmt.Sprintf("invalid status %q", status)}
+	}
+	return withStore(func(store *db.Store) error {
+		req, err := getRequest(ctx, store, args[0])
+		if err != nil {
+			return err
+		}
+		if opts.DryRun {
+			return reportDryRun(opts, "set-status", fmt.Sprintf("move request %s from %s to %s", req.ID, req.Status, status), req)
+		}
+		req, err = store.SetRequestStatus(ctx, req.ID, status)
+		if err != nil {
+			return err
+		}
+		return report(opts, fmt.Sprintf("request %s is %s", req.ID, req.Status), req)
+	})
+}
+
+func requestsNotify(ctx context.Context, args []string) error {
+	opts, args, err := parseFlags("requests notify", args, 1, true, nil)
+	if err != nil {
+		return err
+	}
+	return withStore(func(store *db.Store) error {
+		req, err := getRequest(ctx, store, args[0])
+		if err != nil {
+			return err
+		}
+		if opts.DryRun {
+			return reportDryRun(opts, "notify", fmt.Sprintf("notify subscribers of request %s", req.ID), req)
+		}
+		if err := store.NotifyRequestChanged(ctx, req.ID); err != nil {
+			return err
+		}
+		return report(opts, fmt.Sprintf("notified subscribers of request %s", req.ID), req)
+	})
+}
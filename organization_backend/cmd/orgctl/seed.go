@@ -0,0 +1,167 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+
+	"organization_backend/internal/db"
+	"organization_backend/internal/domain"
+)
+
+// seedFile is the YAML document read by orgctl seed, see
+// scripts/seed.example.yaml
+type seedFile struct {
+	Categories []struct {
+		ID        string `yaml:"id"`
+		Parent    string `yaml:"parent"`
+		Name      string `yaml:"name"`
+		SortOrder int    `yaml:"sortOrder"`
+	} `yaml:"categories"`
+	MaterialTypes []struct {
+		ID          string   `yaml:"id"`
+		Name        string   `yaml:"name"`
+		Description string   `yaml:"description"`
+		Category    string   `yaml:"category"`
+		Tags        []string `yaml:"tags"`
+		Archived    bool     `yaml:"archived"`
+	} `yaml:"materialTypes"`
+	DistributionCenters []struct {
+		Name    string `yaml:"name"`
+		Address string `yaml:"address"`
+	} `yaml:"distributionCenters"`
+	Stock []struct {
+		MaterialType       string `yaml:"materialType"`
+		DistributionCenter string `yaml:"distributionCenter"`
+		Amount             int    `yaml:"amount"`
+	} `yaml:"stock"`
+}
+
+// runSeed merges a YAML catalog into the database like the catalog import of
+// the admin API. Records are matched by ID, distribution centers by name, so
+// seeding the same file again changes nothing.
+func runSeed(ctx context.Context, args []string) error {
+	opts, args, err := parseFlags("seed", args, 1, true, nil)
+	if err != nil {
+		return err
+	}
+	input, err := readSeedFile(args[0])
+	if err != nil {
+		return err
+	}
+	return withStore(func(store *db.Store) error {
+		result, err := store.ImportCatalog(ctx, input, opts.DryRun)
+		if err != nil {
+			return err
+		}
+		if opts.JSON {
+			if err := printJSON(result); err != nil {
+				return err
+			}
+		} else if err := printSeedResult(result); err != nil {
+			return err
+		}
+		if result.HasConflicts() {
+			return errors.New("seed not applied, resolve the conflicts first")
+		}
+		return nil
+	})
+}
+
+func readSeedFile(path string) (db.CatalogImport, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return db.CatalogImport{}, err
+	}
+	defer f.Close()
+
+	var seed seedFile
+	decoder := yaml.NewDecoder(f)
+	decoder.KnownFields(true)
+	if err := decoder.Decode(&seed); err != nil && !errors.Is(err, io.EOF) {
+		return db.CatalogImport{}, fmt.Errorf("parse %s: %w", path, err)
+	}
+
+	var input db.CatalogImport
+	for _, c := range seed.Categories {
+		input.Categories = append(input.Categories, db.CatalogCategoryRow{
+			ID:        seedID(c.ID, c.Name),
+			ParentID:  domain.NormalizeID(c.Parent),
+			Name:      strings.TrimSpace(c.Name),
+			SortOrder: c.SortOrder,
+		})
+	}
+	for _, mt := range seed.MaterialTypes {
+		input.MaterialTypes = append(input.MaterialTypes, db.CatalogMaterialTypeRow{
+			ID:          seedID(mt.ID, mt.Name),
+			Name:        strings.TrimSpace(mt.Name),
+			Description: strings.TrimSpace(mt.Description),
+			CategoryID:  domain.NormalizeID(mt.Category),
+			Tags:        domain.NormalizeTags(mt.Tags),
+			Archived:    mt.Archived,
+		})
+	}
+	for _, c := range seed.DistributionCenters {
+		input.DistributionCenters = append(input.DistributionCenters, db.CatalogDistributionCenterRow{
+			Name:    strings.TrimSpace(c.Name),
+			Address: strings.TrimSpace(c.Address),
+		})
+	}
+	for i, s := range seed.Stock {
+		input.Stock = append(input.Stock, db.CatalogStockRow{
+			Row:                i + 1,
+			MaterialTypeID:     domain.NormalizeID(s.MaterialType),
+			DistributionCenter: strings.TrimSpace(s.DistributionCenter),
+			Amount:             s.Amount,
+		})
+	}
+	return input, nil
+}
+
+// seedID normalizes an explicit ID, falling back to the name like new
+// records do
+func seedID(id, name string) string {
+	if strings.TrimSpace(id) != "" {
+		return domain.NormalizeID(id)
+	}
+	return domain.NormalizeID(name)
+}
+
+// printSeedResult prints the summary and every row that is not unchanged
+func printSeedResult(result db.CatalogImportResult) error {
+	switch {
+	case result.DryRun:
+		fmt.Println("dry run, nothing was changed")
+	case !result.Committed:
+		fmt.Println("nothing was changed")
+	}
+	actions := make([]string, 0, len(result.Summary))
+	for action := range result.Summary {
+		actions = append(actions, action)
+	}
+	sort.Strings(actions)
+	summary := make([]string, 0, len(actions))
+	for _, action := range actions {
+		summary = append(summary, fmt.Sprintf("%s: %d", action, result.Summary[action]))
+	}
+	fmt.Println(strings.Join(summary, ", "))
+
+	var rows [][]string
+	for _, row := range result.Rows {
+		if row.Action == db.CatalogActionUnchanged {
+			continue
+		}
+		rows = append(rows, []string{row.Entity, strconv.Itoa(row.Row), row.ID, row.Action, row.Message})
+	}
+	if len(rows) == 0 {
+		return nil
+	}
+	return printTable("ENTITY\tROW\tID\tACTION\tMESSAGE", rows)
+}
@@ -0,0 +1,174 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"strconv"
+	"time"
+
+	"organization_backend/internal/db"
+)
+
+// userCommands manage users. USER arguments are user IDs or email addresses.
+var userCommands = map[string]subcommand{
+	"list":          {usage: "users list [-json] [-admins] [-q QUERY]", run: usersList},
+	"show":          {usage: "users show [-json] USER", run: usersShow},
+	"promote":       {usage: "users promote [-dry-run] [-json] USER", run: setUserAdmin(true)},
+	"demote":        {usage: "users demote [-dry-run] [-json] USER", run: setUserAdmin(false)},
+	"disable":       {usage: "users disable [-dry-run] [-json] USER", run: setUserDisabled(true)},
+	"enable":        {usage: "users enable [-dry-run] [-json] USER", run: setUserDisabled(false)},
+	"assign-center": {usage: "users assign-center [-dry-run] [-json] USER CENTER|none", run: usersAssignCenter},
+}
+
+func usersList(ctx context.Context, args []string) error {
+	var params db.ListUsersParams
+	opts, _, err := parseFlags("users list", args, 0, false, func(flags *flag.FlagSet) {
+		flags.BoolVar(&params.AdminsOnly, "admins", false, "only list admins")
+		flags.StringVar(&params.Query, "q", "", "only list users whose email or name contains this")
+	})
+	if err != nil {
+		return err
+	}
+	return withStore(func(store *db.Store) error {
+		users, err := store.ListUsers(ctx, params)
+		if err != nil {
+			return err
+		}
+		if opts.JSON {
+			return printJSON(users)
+		}
+		rows := make([][]string, 0, len(users))
+		for _, u := range users {
+			rows = append(rows, []string{u.ID, u.Email, u.Name, strconv.FormatBool(u.IsAdmin), userState(u), u.DistributionCenterID})
+		}
+		return printTable("ID\tEMAIL\tNAME\tADMIN\tSTATE\tCENTER", rows)
+	})
+}
+
+func usersShow(ctx context.Context, args []string) error {
+	opts, args, err := parseFlags("users show", args, 1, false, nil)
+	if err != nil {
+		return err
+	}
+	return withStore(func(store *db.Store) error {
+		u, err := store.FindUser(ctx, args[0])
+		if err != nil {
+			return err
+		}
+		if opts.JSON {
+			return printJSON(u)
+		}
+		return printTable("FIELD\tVALUE", [][]string{
+			{"id", u.ID},
+			{"email", u.Email},
+			{"name", u.Name},
+			{"workos user", u.WorkOSUserID},
+			{"admin", strconv.FormatBool(u.IsAdmin)},
+			{"state", userState(u)},
+			{"distribution center", u.DistributionCenterID},
+			{"created", u.CreatedAt.Local().Format(time.DateTime)},
+		})
+	})
+}
+
+func setUserAdmin(admin bool) func(context.Context, []string) error {
+	verb := "demote"
+	if admin {
+		verb = "promote"
+	}
+	return func(ctx context.Context, args []string) error {
+		opts, args, err := parseFlags("users "+verb, args, 1, true, nil)
+		if err != nil {
+			return err
+		}
+		return withStore(func(store *db.Store) error {
+			if opts.DryRun {
+				u, err := store.FindUser(ctx, args[0])
+				if err != nil {
+					return err
+				}
+				return reportDryRun(opts, verb, fmt.Sprintf("%s %s (admin: %t -> %t)", verb, u.Email, u.IsAdmin, admin), u)
+			}
+			u, err := store.SetUserAdmin(ctx, args[0], admin)
+			if err != nil {
+				return err
+			}
+			return report(opts, fmt.Sprintf("%s is %s; sessions issued before keep their rights until they expire", u.Email, adminWord(admin)), u)
+		})
+	}
+}
+
+func setUserDisabled(disabled bool) func(context.Context, []string) error {
+	verb := "enable"
+	if disabled {
+		verb = "disable"
+	}
+	return func(ctx context.Context, args []string) error {
+		opts, args, err := parseFlags("users "+verb, args, 1, true, nil)
+		if err != nil {
+			return err
+		}
+		return withStore(func(store *db.Store) error {
+			if opts.DryRun {
+				u, err := store.FindUser(ctx, args[0])
+				if err != nil {
+					return err
+				}
+				return reportDryRun(opts, verb, fmt.Sprintf("%s %s (currently %s)", verb, u.Email, userState(u)), u)
+			}
+			u, err := store.SetUserDisabled(ctx, args[0], disabled)
+			if err != nil {
+				return err
+			}
+			message := fmt.Sprintf("%s is %s", u.Email, userState(u))
+			if disabled {
+				message += "; their calendar feed is revoked and sessions issued before stay valid until they expire"
+			}
+			return report(opts, message, u)
+		})
+	}
+}
+
+func usersAssignCenter(ctx context.Context, args []string) error {
+	opts, args, err := parseFlags("users assign-center", args, 2, true, nil)
+	if err != nil {
+		return err
+	}
+	return withStore(func(store *db.Store) error {
+		u, err := store.FindUser(ctx, args[0])
+		if err != nil {
+			return err
+		}
+		centerID, centerName := "", "no distribution center"
+		if args[1] != "none" {
+			center, err := store.FindDistributionCenter(ctx, args[1])
+			if err != nil {
+				return err
+			}
+			centerID, centerName = center.ID, center.Name
+		}
+		if opts.DryRun {
+			return reportDryRun(opts, "assign-center", fmt.Sprintf("assign %s to %s", u.Email, centerName), u)
+		}
+		u, err = store.SetUserDistributionCenter(ctx, u.ID, centerID)
+		if err != nil {
+			return err
+		}
+		return report(opts, fmt.Sprintf("%s is assigned to %s", u.Email, centerName), u)
+	})
+}
+
+func userState(u db.UserAccount) string {
+	if u.DisabledAt != nil {
+		return "disabled"
+	}
+	return "active"
+}
+
+func adminWord(admin bool) string {
+	if admin {
+		return "an admin"
+	}
+	return "no admin"
+}
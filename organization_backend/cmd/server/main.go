@@ -2,99 +2,426 @@ package main
 
 import (
 	"context"
-	"log"
+	"errors"
+	"fmt"
+	"log/slog"
 	"net/http"
 	"os"
 	"os/signal"
+	"runtime/debug"
 	"syscall"
 	"time"
+	_ "time/tzdata"
 
 	"organization_backend/internal/api"
 	"organization_backend/internal/auth"
 	"organization_backend/internal/config"
 	"organization_backend/internal/db"
+	"organization_backend/internal/logging"
+	"organization_backend/internal/metrics"
+	"organization_backend/internal/ratelimit"
 	"organization_backend/internal/service"
+	"organization_backend/internal/storage"
+	"organization_backend/internal/tracing"
 )
 
+// version is set at build time with -ldflags "-X main.version=..."
+var version string
+
 func main() {
-	cfg, err := config.Load()
+	started := time.Now()
+	args := os.Args[1:]
+	printConfig := len(args) >= 2 && args[0] == "config" && args[1] == "print"
+	if printConfig {
+		args = args[2:]
+	}
+	cfg, err := config.Load(args)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "config load failed: %v\n", err)
+		os.Exit(1)
+	}
+	if printConfig {
+		if err := config.Print(os.Stdout, cfg); err != nil {
+			fmt.Fprintf(os.Stderr, "config print failed: %v\n", err)
+			os.Exit(1)
+		}
+		return
+	}
+
+	logger, err := logging.New(os.Stderr, cfg.Log.Level, cfg.Log.Format)
 	if err != nil {
-		log.Fatalf("config load failed: %v", err)
+		fmt.Fprintf(os.Stderr, "logger init failed: %v\n", err)
+		os.Exit(1)
 	}
+	slog.SetDefault(logger)
 
 	// Initialize WorkOS
-	auth.InitWorkOS(cfg.WorkOSAPIKey, cfg.WorkOSClientID)
+	auth.InitWorkOS(cfg.Auth.WorkOSAPIKey, cfg.Auth.WorkOSClientID)
+
+	serverMetrics := metrics.New()
+
+	// Tracing is initialized even when disabled so that trace context is
+	// passed on to the services we call
+	headers, err := tracing.ParseHeaders(cfg.Tracing.Headers)
+	if err != nil {
+		fatal("tracing init failed", err)
+	}
+	shutdownTracing, err := tracing.Init(tracing.Config{
+		Exporter:    cfg.Tracing.Exporter,
+		Endpoint:    cfg.Tracing.Endpoint,
+		Headers:     headers,
+		ServiceName: cfg.Tracing.ServiceName,
+		SampleRatio: cfg.Tracing.SampleRatio,
+	})
+	if err != nil {
+		fatal("tracing init failed", err)
+	}
+	if cfg.Tracing.Exporter != "none" {
+		logger.Info("tracing enabled", "exporter", cfg.Tracing.Exporter)
+	}
 
-	log.Printf("connecting to database")
-	conn, err := db.Open(cfg.DatabaseURL)
+	logger.Info("connecting to database")
+	conn, err := db.Open(cfg.Database.URL, db.PoolConfig{
+		MaxOpenConns:    cfg.Database.MaxOpenConns,
+		MaxIdleConns:    cfg.Database.MaxIdleConns,
+		ConnMaxLifetime: cfg.Database.ConnMaxLifetime,
+	})
 	if err != nil {
-		log.Fatalf("db open failed: %v", err)
+		fatal("db open failed", err)
 	}
 	if err := conn.Ping(); err != nil {
-		log.Fatalf("db ping failed: %v", err)
+		fatal("db ping failed", err)
 	}
-	log.Printf("database connection established")
-	log.Printf("running migrations")
-	if err := db.Migrate(context.Background(), conn); err != nil {
-		log.Fatalf("db migrations failed: %v", err)
+	logger.Info("database connection established")
+	if cfg.Database.AutoMigrate {
+		logger.Info("running migrations")
+		migrator, err := db.NewMigrator(conn)
+		if err != nil {
+			fatal("db migrations failed", err)
+		}
+		applied, err := migrator.Up(context.Background())
+		for _, m := range applied {
+			logger.Info("migration applied", "migration", m.ID)
+		}
+		if err != nil {
+			fatal("db migrations failed", err)
+		}
+		logger.Info("migrations complete")
+	} else if pending, err := db.PendingMigrations(context.Background(), conn); err != nil {
+		fatal("db migration status failed", err)
+	} else if len(pending) > 0 {
+		logger.Warn("database has pending migrations, run orgctl migrate up", "pending", len(pending))
 	}
-	log.Printf("migrations complete")
 	defer conn.Close()
+	serverMetrics.RegisterDBStats(conn)
+
+	uploadStorage, err := storage.New(context.Background(), cfg.Uploads.Storage())
+	if err != nil {
+		fatal("storage init failed", err)
+	}
 
 	store := db.NewStore(conn)
 	requestService := service.NewRequestService(store)
-	notifier := db.NewNotifier(cfg.DatabaseURL)
+	notifier := db.NewNotifier(cfg.Database.URL, db.NotifierConfig{
+		MinReconnect: cfg.SSE.ListenerMinReconnect,
+		MaxReconnect: cfg.SSE.ListenerMaxReconnect,
+		BufferSize:   cfg.SSE.BufferSize,
+		Logger:       logger,
+		Metrics:      serverMetrics,
+	})
 
 	ctx, cancel := context.WithCancel(context.Background())
 	defer cancel()
 	if err := notifier.Start(ctx); err != nil {
-		log.Fatalf("notifier start failed: %v", err)
+		fatal("notifier start failed", err)
 	}
 
 	handler := &api.Handler{
-		Service:  requestService,
-		Store:    store,
-		Notifier: notifier,
+		Service:      requestService,
+		Store:        store,
+		Notifier:     notifier,
+		SSEHeartbeat: cfg.SSE.HeartbeatInterval,
+		Metrics:      serverMetrics,
+	}
+
+	rateLimits := rateLimitsFromConfig(cfg.Routing.RateLimits)
+	var rateLimiter ratelimit.Store = ratelimit.NewMemory()
+	if cfg.Routing.RateLimitStore == "postgres" {
+		rateLimiter = store
+		go every(ctx, serverMetrics, cfg.Jobs.RateLimitCleanupInterval, "rate_limit_cleanup", func(ctx context.Context) error {
+			_, err := store.DeleteIdleRateLimitBuckets(ctx, time.Hour)
+			return err
+		})
 	}
 
 	authHandler := &api.AuthHandler{
-		Store:     store,
-		JWTSecret: cfg.JWTSecret,
+		Store:         store,
+		JWTSecret:     cfg.Auth.JWTSecret,
+		TokenTTL:      cfg.Auth.TokenTTL,
+		Limiter:       rateLimiter,
+		LoginFailures: rateLimits.CallbackFailures,
 	}
 
 	materialTypeHandler := &api.MaterialTypeHandler{
-		Store:      store,
-		UploadPath: "uploads",
+		Store:   store,
+		Storage: uploadStorage,
 	}
 
 	uploadHandler := &api.UploadHandler{
-		Store:      store,
-		UploadPath: "uploads",
+		Store:         store,
+		Storage:       uploadStorage,
+		PresignExpiry: cfg.Uploads.PresignExpiry,
+		Metrics:       serverMetrics,
+	}
+
+	auditHandler := &api.AuditHandler{
+		Store: store,
+	}
+
+	categoryHandler := &api.CategoryHandler{
+		Store: store,
+	}
+
+	kitHandler := &api.KitHandler{
+		Store: store,
+	}
+
+	catalogHandler := &api.CatalogHandler{
+		Store:   store,
+		Storage: uploadStorage,
+		Metrics: serverMetrics,
+	}
+
+	packingSlipHandler := &api.PackingSlipHandler{
+		Service:  requestService,
+		Store:    store,
+		Storage:  uploadStorage,
+		AppURL:   cfg.App.URL,
+		Location: cfg.App.Location,
 	}
 
-	router := api.Routes(handler, authHandler, materialTypeHandler, uploadHandler, cfg.JWTSecret)
+	calendarHandler := &api.CalendarHandler{
+		Store:    store,
+		AppURL:   cfg.App.URL,
+		Location: cfg.App.Location,
+	}
+
+	analyticsHandler := &api.AnalyticsHandler{
+		Store:    store,
+		Location: cfg.App.Location,
+	}
+	if cfg.Jobs.AnalyticsRefreshInterval > 0 {
+		go every(ctx, serverMetrics, cfg.Jobs.AnalyticsRefreshInterval, "analytics_refresh", store.RefreshAnalytics)
+	}
+	go every(ctx, serverMetrics, cfg.Jobs.IdempotencyCleanupInterval, "idempotency_cleanup", func(ctx context.Context) error {
+		_, err := store.DeleteExpiredIdempotencyKeys(ctx)
+		return err
+	})
+
+	schoolHandler := &api.SchoolHandler{
+		Store: store,
+	}
+	addressHandler := &api.AddressHandler{
+		Store: store,
+	}
+
+	healthHandler := &api.HealthHandler{
+		Checks: []api.ReadinessCheck{
+			{Name: "database", Check: conn.PingContext},
+			{Name: "migrations", Check: func(ctx context.Context) error {
+				pending, err := db.PendingMigrations(ctx, conn)
+				if err != nil {
+					return err
+				}
+				if len(pending) > 0 {
+					return fmt.Errorf("%d pending migrations, first %s", len(pending), pending[0])
+				}
+				return nil
+			}},
+			{Name: "notifier", Check: func(context.Context) error {
+				if !notifier.Connected() {
+					return errors.New("listener not connected")
+				}
+				return nil
+			}},
+			{Name: "storage", Check: func(ctx context.Context) error {
+				return storage.Probe(ctx, uploadStorage)
+			}},
+		},
+		Notifier: notifier,
+		Version:  buildVersion(),
+		Started:  started,
+		Config:   config.Summary(cfg),
+	}
+
+	router := api.Routes(api.Handlers{
+		Request:      handler,
+		Auth:         authHandler,
+		MaterialType: materialTypeHandler,
+		Upload:       uploadHandler,
+		Audit:        auditHandler,
+		Category:     categoryHandler,
+		Kit:          kitHandler,
+		Catalog:      catalogHandler,
+		PackingSlip:  packingSlipHandler,
+		Calendar:     calendarHandler,
+		Analytics:    analyticsHandler,
+		School:       schoolHandler,
+		Address:      addressHandler,
+		Health:       healthHandler,
+	}, api.RouterConfig{
+		JWTSecret: cfg.Auth.JWTSecret,
+		Logger:    logger,
+		CORS: api.CORSConfig{
+			AllowedOrigins:   cfg.Routing.CORSAllowedOrigins,
+			AllowCredentials: cfg.Routing.CORSAllowCredentials,
+			MaxAge:           cfg.Routing.CORSMaxAge,
+		},
+		TrustedProxies:   cfg.Routing.TrustedProxyPrefixes,
+		RateLimiter:      rateLimiter,
+		RateLimits:       rateLimits,
+		IdempotencyStore: store,
+		Metrics:          serverMetrics,
+		MetricsToken:     metricsTokenOnAPI(cfg.Metrics),
+	})
 
 	server := &http.Server{
-		Addr:              ":8080",
+		Addr:              cfg.Server.Addr,
 		Handler:           router,
-		ReadHeaderTimeout: 5 * time.Second,
+		ReadHeaderTimeout: cfg.Server.ReadHeaderTimeout,
+		ReadTimeout:       cfg.Server.ReadTimeout,
+		WriteTimeout:      cfg.Server.WriteTimeout,
+		IdleTimeout:       cfg.Server.IdleTimeout,
 	}
 
 	go func() {
-		log.Printf("org backend listening on %s", server.Addr)
+		logger.Info("org backend listening", "addr", server.Addr)
 		if err := server.ListenAndServe(); err != nil && err != http.ErrServerClosed {
-			log.Fatalf("server error: %v", err)
+			fatal("server error", err)
 		}
 	}()
 
+	var metricsServer *http.Server
+	if cfg.Metrics.Addr != "" {
+		mux := http.NewServeMux()
+		mux.Handle("GET /metrics", api.MetricsHandler(serverMetrics, cfg.Metrics.Token))
+		metricsServer = &http.Server{
+			Addr:              cfg.Metrics.Addr,
+			Handler:           mux,
+			ReadHeaderTimeout: cfg.Server.ReadHeaderTimeout,
+		}
+		go func() {
+			logger.Info("metrics listening", "addr", metricsServer.Addr)
+			if err := metricsServer.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+				fatal("metrics server error", err)
+			}
+		}()
+	}
+
 	stop := make(chan os.Signal, 1)
 	signal.Notify(stop, syscall.SIGINT, syscall.SIGTERM)
 	<-stop
+
+	// Fail readiness first so load balancers stop routing to this instance
+	healthHandler.SetDraining()
+	if cfg.Server.ShutdownDelay > 0 {
+		logger.Info("draining before shutdown", "delay", cfg.Server.ShutdownDelay)
+		time.Sleep(cfg.Server.ShutdownDelay)
+	}
 	cancel()
 
-	shutdownCtx, shutdownCancel := context.WithTimeout(context.Background(), 10*time.Second)
+	shutdownCtx, shutdownCancel := context.WithTimeout(context.Background(), cfg.Server.ShutdownTimeout)
 	defer shutdownCancel()
 	if err := server.Shutdown(shutdownCtx); err != nil {
-		log.Printf("shutdown error: %v", err)
+		logger.Error("shutdown failed", "error", err)
+	}
+	if metricsServer != nil {
+		if err := metricsServer.Shutdown(shutdownCtx); err != nil {
+			logger.Error("metrics shutdown failed", "error", err)
+		}
+	}
+	if err := shutdownTracing(shutdownCtx); err != nil {
+		logger.Error("tracing shutdown failed", "error", err)
+	}
+}
+
+// buildVersion returns the version set at build time, falling back to the
+// VCS revision recorded by the Go toolchain
+func buildVersion() string {
+	if version != "" {
+		return version
+	}
+	info, ok := debug.ReadBuildInfo()
+	if !ok {
+		return "unknown"
+	}
+	revision, modified := "", false
+	for _, setting := range info.Settings {
+		switch setting.Key {
+		case "vcs.revision":
+			revision = setting.Value
+		case "vcs.modified":
+			modified = setting.Value == "true"
+		}
+	}
+	if revision == "" {
+		return "unknown"
+	}
+	if modified {
+		revision += "-dirty"
+	}
+	return revision
+}
+
+// metricsTokenOnAPI returns the token that serves /metrics on the API
+// listener, which is only done without a separate metrics listener
+func metricsTokenOnAPI(cfg config.MetricsConfig) string {
+	if cfg.Addr != "" {
+		return ""
+	}
+	return cfg.Token
+}
+
+// fatal logs err and exits
+func fatal(msg string, err error) {
+	slog.Error(msg, "error", err)
+	os.Exit(1)
+}
+
+// every runs the job fn every interval until ctx is done, logging failures
+// and recording each run in m
+func every(ctx context.Context, m *metrics.Metrics, interval time.Duration, job string, fn func(context.Context) error) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			start := time.Now()
+			err := fn(ctx)
+			if ctx.Err() != nil {
+				return
+			}
+			m.ObserveJob(job, start, err)
+			if err != nil {
+				slog.Error("background job failed", "job", job, "error", err)
+			}
+		}
+	}
+}
+
+// rateLimitsFromConfig converts the configured limits to the route limits
+func rateLimitsFromConfig(c config.RateLimitsConfig) api.RateLimits {
+	limit := func(l config.LimitConfig) ratelimit.Limit {
+		return ratelimit.Limit{Burst: l.Burst, Per: l.Per}
+	}
+	return api.RateLimits{
+		MagicLinkPerIP:    limit(c.MagicLinkPerIP),
+		MagicLinkPerEmail: limit(c.MagicLinkPerEmail),
+		CallbackPerIP:     limit(c.CallbackPerIP),
+		CallbackFailures:  limit(c.CallbackFailures),
+		Public:            limit(c.Public),
+		User:              limit(c.User),
 	}
 }
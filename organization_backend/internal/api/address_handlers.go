@@ -0,0 +1,109 @@
+package api
+
+import (
+	"context"
+	"errors"
+	"net/http"
+
+	"organization_backend/internal/db"
+	"organization_backend/internal/domain"
+)
+
+// AddressHandler serves the address book of the authenticated user. It lists
+// personal and school addresses; school addresses are edited through the
+// school endpoints.
+type AddressHandler struct {
+	Store AddressStore
+}
+
+// AddressStore defines the methods AddressHandler needs from Store
+type AddressStore interface {
+	ListAddresses(ctx context.Context, userID string) ([]domain.Address, error)
+	CreateAddress(ctx context.Context, userID string, input domain.AddressInput) (domain.Address, error)
+	UpdateAddress(ctx context.Context, userID, id string, input domain.AddressInput) (domain.Address, error)
+	DeleteAddress(ctx context.Context, userID, id string) error
+}
+
+// ListAddresses returns the personal addresses of the user and those of their schools
+func (h *AddressHandler) ListAddresses(w http.ResponseWriter, r *http.Request) {
+	claims := GetClaimsFromContext(r.Context())
+	if claims == nil {
+		writeError(w, http.StatusUnauthorized, "unauthorized", "Authentication required")
+		return
+	}
+	addresses, err := h.Store.ListAddresses(r.Context(), claims.CustomerID)
+	if err != nil {
+		serverError(w, r, err, "list_failed", "Failed to fetch addresses")
+		return
+	}
+	writeJSON(w, http.StatusOK, addresses)
+}
+
+// CreateAddress saves a personal address
+func (h *AddressHandler) CreateAddress(w http.ResponseWriter, r *http.Request) {
+	claims := GetClaimsFromContext(r.Context())
+	if claims == nil {
+		writeError(w, http.StatusUnauthorized, "unauthorized", "Authentication required")
+		return
+	}
+	input, ok := decodeAddressInput(w, r)
+	if !ok {
+		return
+	}
+	address, err := h.Store.CreateAddress(r.Context(), claims.CustomerID, input)
+	if err != nil {
+		serverError(w, r, err, "create_failed", "Failed to save address")
+		return
+	}
+	writeJSON(w, http.StatusCreated, address)
+}
+
+// UpdateAddress edits a personal address
+func (h *AddressHandler) UpdateAddress(w http.ResponseWriter, r *http.Request) {
+	claims := GetClaimsFromContext(r.Context())
+	if claims == nil {
+		writeError(w, http.StatusUnauthorized, "unauthorized", "Authentication required")
+		return
+	}
+	id, ok := urlID(w, r, "id", "Address not found")
+	if !ok {
+		return
+	}
+	input, ok := decodeAddressInput(w, r)
+	if !ok {
+		return
+	}
+	address, err := h.Store.UpdateAddress(r.Context(), claims.CustomerID, id, input)
+	if errors.Is(err, db.ErrAddressNotFound) {
+		writeError(w, http.StatusNotFound, "not_found", "Address not found")
+		return
+	}
+	if err != nil {
+		serverError(w, r, err, "update_failed", "Failed to update address")
+		return
+	}
+	writeJSON(w, http.StatusOK, address)
+}
+
+// DeleteAddress removes a personal address
+func (h *AddressHandler) DeleteAddress(w http.ResponseWriter, r *http.Request) {
+	claims := GetClaimsFromContext(r.Context())
+	if claims == nil {
+		writeError(w, http.StatusUnauthorized, "unauthorized", "Authentication required")
+		return
+	}
+	id, ok := urlID(w, r, "id", "Address not found")
+	if !ok {
+		return
+	}
+	err := h.Store.DeleteAddress(r.Context(), claims.CustomerID, id)
+	if errors.Is(err, db.ErrAddressNotFound) {
+		writeError(w, http.StatusNotFound, "not_found", "Address not found")
+		return
+	}
+	if err != nil {
+		serverError(w, r, err, "delete_failed", "Failed to delete address")
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]string{"status": "deleted"})
+}
@@ -0,0 +1,201 @@
+package api
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+	"time"
+
+	"organization_backend/internal/db"
+)
+
+// defaultAnalyticsRange is the period reported when no from parameter is given
+const defaultAnalyticsRange = 90 * 24 * time.Hour
+
+// AnalyticsHandler serves aggregates for the admin dashboard (admin only).
+// All figures are computed from materialized views, see RefreshAnalytics.
+type AnalyticsHandler struct {
+	Store *db.Store
+	// Location is the time zone buckets and dates are computed in
+	Location *time.Location
+}
+
+type analyticsResponse struct {
+	From        time.Time `json:"from"`
+	To          time.Time `json:"to"`
+	Interval    string    `json:"interval,omitempty"`
+	RefreshedAt time.Time `json:"refreshedAt"`
+	Data        any       `json:"data"`
+}
+
+// RequestsByStatus returns requests created per bucket, counted by current status
+func (h *AnalyticsHandler) RequestsByStatus(w http.ResponseWriter, r *http.Request) {
+	period, err := h.parsePeriod(r)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "invalid_params", err.Error())
+		return
+	}
+	data, err := h.Store.RequestsByStatus(r.Context(), period)
+	h.respond(w, r, period, data, err)
+}
+
+// TopMaterialTypes returns the most requested material types. limit defaults to 10.
+func (h *AnalyticsHandler) TopMaterialTypes(w http.ResponseWriter, r *http.Request) {
+	period, err := h.parsePeriod(r)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "invalid_params", err.Error())
+		return
+	}
+	limit := 10
+	if value := r.URL.Query().Get("limit"); value != "" {
+		limit, err = strconv.Atoi(value)
+		if err != nil || limit < 1 || limit > 100 {
+			writeError(w, http.StatusBadRequest, "invalid_params", "limit must be between 1 and 100")
+			return
+		}
+	}
+	period.Interval = ""
+	data, err := h.Store.TopMaterialTypes(r.Context(), period.From, period.To, limit)
+	h.respond(w, r, period, data, err)
+}
+
+// Utilization returns the average share of stock on loan per material type
+// and distribution center
+func (h *AnalyticsHandler) Utilization(w http.ResponseWriter, r *http.Request) {
+	period, err := h.parsePeriod(r)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "invalid_params", err.Error())
+		return
+	}
+	period.Interval = ""
+	data, err := h.Store.MaterialUtilization(r.Context(), period.From, period.To)
+	h.respond(w, r, period, data, err)
+}
+
+// LeadTimes returns average and median days between creating and delivering requests
+func (h *AnalyticsHandler) LeadTimes(w http.ResponseWriter, r *http.Request) {
+	period, err := h.parsePeriod(r)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "invalid_params", err.Error())
+		return
+	}
+	data, err := h.Store.LeadTimes(r.Context(), period)
+	h.respond(w, r, period, data, err)
+}
+
+// ReturnPunctuality summarizes returns that were due in the period
+func (h *AnalyticsHandler) ReturnPunctuality(w http.ResponseWriter, r *http.Request) {
+	period, err := h.parsePeriod(r)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "invalid_params", err.Error())
+		return
+	}
+	period.Interval = ""
+	data, err := h.Store.ReturnPunctualityBetween(r.Context(), period.From, period.To)
+	h.respond(w, r, period, data, err)
+}
+
+// SchoolsPerRegion counts schools served per zip code region. prefixLength
+// selects how many leading zip code digits form a region and defaults to 2.
+func (h *AnalyticsHandler) SchoolsPerRegion(w http.ResponseWriter, r *http.Request) {
+	period, err := h.parsePeriod(r)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "invalid_params", err.Error())
+		return
+	}
+	prefixLength := 2
+	if value := r.URL.Query().Get("prefixLength"); value != "" {
+		prefixLength, err = strconv.Atoi(value)
+		if err != nil || prefixLength < 1 || prefixLength > 5 {
+			writeError(w, http.StatusBadRequest, "invalid_params", "prefixLength must be between 1 and 5")
+			return
+		}
+	}
+	period.Interval = ""
+	data, err := h.Store.SchoolsPerRegion(r.Context(), period.From, period.To, prefixLength)
+	h.respond(w, r, period, data, err)
+}
+
+// RefreshAnalytics recomputes the analytics views immediately
+func (h *AnalyticsHandler) RefreshAnalytics(w http.ResponseWriter, r *http.Request) {
+	if err := h.Store.RefreshAnalytics(r.Context()); err != nil {
+		serverError(w, r, err, "refresh_failed", "Failed to refresh analytics")
+		return
+	}
+	refreshedAt, err := h.Store.AnalyticsRefreshedAt(r.Context())
+	if err != nil {
+		serverError(w, r, err, "refresh_failed", "Failed to refresh analytics")
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]time.Time{"refreshedAt": refreshedAt})
+}
+
+func (h *AnalyticsHandler) respond(w http.ResponseWriter, r *http.Request, period db.AnalyticsPeriod, data any, err error) {
+	if err != nil {
+		serverError(w, r, err, "analytics_failed", "Failed to compute analytics")
+		return
+	}
+	refreshedAt, err := h.Store.AnalyticsRefreshedAt(r.Context())
+	if err != nil {
+		serverError(w, r, err, "analytics_failed", "Failed to compute analytics")
+		return
+	}
+	writeJSON(w, http.StatusOK, analyticsResponse{
+		From:        period.From,
+		To:          period.To,
+		Interval:    period.Interval,
+		RefreshedAt: refreshedAt,
+		Data:        data,
+	})
+}
+
+// parsePeriod reads from, to (RFC 3339 or YYYY-MM-DD, to is exclusive) and
+// interval (day, week or month). The period defaults to the last 90 days in
+// weekly buckets.
+func (h *AnalyticsHandler) parsePeriod(r *http.Request) (db.AnalyticsPeriod, error) {
+	q := r.URL.Query()
+	loc := h.Location
+	if loc == nil {
+		loc = time.UTC
+	}
+	period := db.AnalyticsPeriod{Interval: db.AnalyticsIntervalWeek, TimeZone: loc.String()}
+
+	parse := func(name string) (time.Time, error) {
+		value := q.Get(name)
+		if t, err := time.Parse(time.RFC3339, value); err == nil {
+			return t, nil
+		}
+		if t, err := time.ParseInLocation("2006-01-02", value, loc); err == nil {
+			return t, nil
+		}
+		return time.Time{}, errors.New(name + " must be a date (YYYY-MM-DD) or RFC 3339 timestamp")
+	}
+	period.To = time.Now()
+	if q.Get("to") != "" {
+		to, err := parse("to")
+		if err != nil {
+			return db.AnalyticsPeriod{}, err
+		}
+		period.To = to
+	}
+	period.From = period.To.Add(-defaultAnalyticsRange)
+	if q.Get("from") != "" {
+		from, err := parse("from")
+		if err != nil {
+			return db.AnalyticsPeriod{}, err
+		}
+		period.From = from
+	}
+	if !period.From.Before(period.To) {
+		return db.AnalyticsPeriod{}, errors.New("from must be before to")
+	}
+
+	switch interval := q.Get("interval"); interval {
+	case "":
+	case db.AnalyticsIntervalDay, db.AnalyticsIntervalWeek, db.AnalyticsIntervalMonth:
+		period.Interval = interval
+	default:
+		return db.AnalyticsPeriod{}, errors.New("interval must be day, week or month")
+	}
+	return period, nil
+}
@@ -0,0 +1,77 @@
+package api
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"organization_backend/internal/db"
+	"organization_backend/pkg/pagination"
+
+	"github.com/google/uuid"
+)
+
+// AuditHandler serves the audit log (admin only)
+type AuditHandler struct {
+	Store AuditStore
+}
+
+// AuditStore defines the methods AuditHandler needs from Store
+type AuditStore interface {
+	ListAuditEntries(ctx context.Context, params db.ListAuditParams) (db.ListAuditResult, error)
+}
+
+// ListAuditEntries returns audit entries newest first, filtered by entity and actor
+func (h *AuditHandler) ListAuditEntries(w http.ResponseWriter, r *http.Request) {
+	params, err := parseAuditParams(r)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "invalid_params", err.Error())
+		return
+	}
+
+	result, err := h.Store.ListAuditEntries(r.Context(), params)
+	if err != nil {
+		serverError(w, r, err, "list_failed", "Failed to fetch audit log")
+		return
+	}
+	writeJSON(w, http.StatusOK, result)
+}
+
+func parseAuditParams(r *http.Request) (db.ListAuditParams, error) {
+	q := r.URL.Query()
+
+	limit := 20
+	if q.Get("limit") != "" {
+		parsed, err := strconv.Atoi(q.Get("limit"))
+		if err != nil {
+			return db.ListAuditParams{}, errors.New("limit must be number")
+		}
+		limit = parsed
+	}
+
+	var cursor *pagination.Cursor
+	if q.Get("cursor") != "" {
+		parsed, err := pagination.Decode(q.Get("cursor"))
+		if err != nil {
+			return db.ListAuditParams{}, errors.New("invalid cursor")
+		}
+		cursor = &parsed
+	}
+
+	actorID := strings.TrimSpace(q.Get("actorId"))
+	if actorID != "" {
+		if _, err := uuid.Parse(actorID); err != nil {
+			return db.ListAuditParams{}, errors.New("actorId must be a UUID")
+		}
+	}
+
+	return db.ListAuditParams{
+		Limit:      limit,
+		Cursor:     cursor,
+		EntityType: strings.TrimSpace(q.Get("entityType")),
+		EntityID:   strings.TrimSpace(q.Get("entityId")),
+		ActorID:    actorID,
+	}, nil
+}
@@ -0,0 +1,48 @@
+package api
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"organization_backend/internal/db"
+)
+
+type fakeAuditStore struct {
+	params *db.ListAuditParams
+}
+
+func (f *fakeAuditStore) ListAuditEntries(ctx context.Context, params db.ListAuditParams) (db.ListAuditResult, error) {
+	f.params = &params
+	return db.ListAuditResult{}, nil
+}
+
+func TestListAuditEntriesActorFilter(t *testing.T) {
+	tests := []struct {
+		query      string
+		wantStatus int
+		wantActor  string
+	}{
+		{"", http.StatusOK, ""},
+		{"?actorId=7f1c3a52-9d0e-4c55-8a7e-2b6f1e0d4c93", http.StatusOK, "7f1c3a52-9d0e-4c55-8a7e-2b6f1e0d4c93"},
+		{"?actorId=admin%40example.org", http.StatusBadRequest, ""},
+		{"?actorId=7f1c3a52", http.StatusBadRequest, ""},
+	}
+	for _, tt := range tests {
+		store := &fakeAuditStore{}
+		h := &AuditHandler{Store: store}
+		w := httptest.NewRecorder()
+		h.ListAuditEntries(w, httptest.NewRequest(http.MethodGet, "/admin/audit"+tt.query, nil))
+		if w.Code != tt.wantStatus {
+			t.Errorf("%q: status %d, want %d", tt.query, w.Code, tt.wantStatus)
+			continue
+		}
+		if tt.wantStatus == http.StatusOK && (store.params == nil || store.params.ActorID != tt.wantActor) {
+			t.Errorf("%q: store was asked for %+v, want actor %q", tt.query, store.params, tt.wantActor)
+		}
+		if tt.wantStatus != http.StatusOK && store.params != nil {
+			t.Errorf("%q: invalid actor reached the store", tt.query)
+		}
+	}
+}
@@ -2,15 +2,26 @@ package api
 
 import (
 	"encoding/json"
+	"errors"
 	"net/http"
+	"strings"
+	"time"
 
 	"organization_backend/internal/auth"
 	"organization_backend/internal/db"
+	"organization_backend/internal/logging"
+	"organization_backend/internal/ratelimit"
 )
 
 type AuthHandler struct {
-	Store     *db.Store
+	Store     db.UserRepository
 	JWTSecret string
+	// TokenTTL is how long issued session tokens are valid
+	TokenTTL time.Duration
+	// Limiter and LoginFailures lock out logins after repeated failed
+	// attempts per email and IP; a nil Limiter disables the lockout
+	Limiter       ratelimit.Store
+	LoginFailures ratelimit.Limit
 }
 
 func (h *AuthHandler) RequestMagicLink(w http.ResponseWriter, r *http.Request) {
@@ -23,7 +34,7 @@ func (h *AuthHandler) RequestMagicLink(w http.ResponseWriter, r *http.Request) {
 	}
 
 	if err := auth.CreateMagicLink(r.Context(), req.Email); err != nil {
-		writeError(w, http.StatusInternalServerError, "magic_link_failed", "Failed to create magic link")
+		serverError(w, r, err, "magic_link_failed", "Failed to create magic link")
 		return
 	}
 
@@ -40,21 +51,43 @@ func (h *AuthHandler) MagicLinkCallback(w http.ResponseWriter, r *http.Request)
 		return
 	}
 
+	failureKeys := h.loginFailureKeys(r, req.Email)
+	for _, key := range failureKeys {
+		result, err := h.Limiter.Take(r.Context(), key, h.LoginFailures, 0)
+		if err != nil {
+			logging.FromContext(r.Context()).Warn("login lockout check failed", "error", err)
+			continue
+		}
+		if !result.Allowed {
+			writeRateLimited(w, result.RetryAfter)
+			return
+		}
+	}
+
 	authResp, err := auth.AuthenticateWithCode(r.Context(), req.Code, req.Email)
 	if err != nil {
+		for _, key := range failureKeys {
+			if _, err := h.Limiter.Take(r.Context(), key, h.LoginFailures, 1); err != nil {
+				logging.FromContext(r.Context()).Warn("login failure tracking failed", "error", err)
+			}
+		}
 		writeError(w, http.StatusUnauthorized, "auth_failed", "Invalid or expired code")
 		return
 	}
 
-	customer, err := h.Store.GetOrCreateCustomerByWorkOSUser(r.Context(), &authResp.User)
+	customer, err := h.Store.GetOrCreateUserByWorkOSUser(r.Context(), &authResp.User)
+	if errors.Is(err, db.ErrUserDisabled) {
+		writeError(w, http.StatusForbidden, "account_disabled", "This account has been disabled")
+		return
+	}
 	if err != nil {
-		writeError(w, http.StatusInternalServerError, "customer_error", "Failed to process user")
+		serverError(w, r, err, "customer_error", "Failed to process user")
 		return
 	}
 
-	token, err := auth.GenerateToken(customer.ID, customer.Email, customer.WorkOSUserID, customer.IsAdmin, h.JWTSecret)
+	token, err := auth.GenerateToken(customer.ID, customer.Email, customer.WorkOSUserID, customer.IsAdmin, h.JWTSecret, h.TokenTTL)
 	if err != nil {
-		writeError(w, http.StatusInternalServerError, "token_error", "Failed to create session")
+		serverError(w, r, err, "token_error", "Failed to create session")
 		return
 	}
 
@@ -65,6 +98,18 @@ func (h *AuthHandler) MagicLinkCallback(w http.ResponseWriter, r *http.Request)
 	})
 }
 
+// loginFailureKeys returns the buckets failed logins are counted in
+func (h *AuthHandler) loginFailureKeys(r *http.Request, email string) []string {
+	if h.Limiter == nil || !h.LoginFailures.Enabled() {
+		return nil
+	}
+	keys := []string{"login-failures:ip:" + clientIP(r)}
+	if email = strings.ToLower(strings.TrimSpace(email)); email != "" {
+		keys = append(keys, "login-failures:email:"+email)
+	}
+	return keys
+}
+
 func (h *AuthHandler) GetCurrentUser(w http.ResponseWriter, r *http.Request) {
 	claims := GetClaimsFromContext(r.Context())
 	if claims == nil {
@@ -72,9 +117,9 @@ func (h *AuthHandler) GetCurrentUser(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	customer, err := h.Store.GetCustomerByID(r.Context(), claims.CustomerID)
+	customer, err := h.Store.GetUserByID(r.Context(), claims.CustomerID)
 	if err != nil {
-		writeError(w, http.StatusInternalServerError, "fetch_error", "Failed to fetch user")
+		serverError(w, r, err, "fetch_error", "Failed to fetch user")
 		return
 	}
 
@@ -5,6 +5,7 @@ import (
 	"net/http"
 	"strings"
 
+	"organization_backend/internal/audit"
 	"organization_backend/internal/auth"
 )
 
@@ -43,6 +44,8 @@ func AuthMiddleware(jwtSecret string) func(http.Handler) http.Handler {
 			}
 
 			ctx := context.WithValue(r.Context(), claimsContextKey, claims)
+			ctx = audit.WithUser(ctx, claims.CustomerID, claims.Email)
+			ctx = withLogUser(ctx, claims.CustomerID)
 			next.ServeHTTP(w, r.WithContext(ctx))
 		})
 	}
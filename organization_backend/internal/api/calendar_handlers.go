@@ -0,0 +1,205 @@
+package api
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+
+	"organization_backend/internal/db"
+	"organization_backend/internal/domain"
+	"organization_backend/internal/ical"
+)
+
+// calendarHistory is how far back past deliveries and returns stay in the feed
+const calendarHistory = 90 * 24 * time.Hour
+
+// CalendarHandler serves per-user iCalendar feeds of deliveries and returns
+type CalendarHandler struct {
+	Store CalendarStore
+	// AppURL is the user frontend base URL events link to
+	AppURL string
+	// Location is the time zone all-day events are computed in
+	Location *time.Location
+}
+
+// CalendarStore defines the methods CalendarHandler needs from Store
+type CalendarStore interface {
+	GetCalendarToken(ctx context.Context, userID string) (string, error)
+	RotateCalendarToken(ctx context.Context, userID string) (string, error)
+	GetCalendarUser(ctx context.Context, token string) (db.CalendarUser, error)
+	ListCalendarRequests(ctx context.Context, user db.CalendarUser, since time.Time) ([]domain.Request, error)
+	ListMaterialTypes(ctx context.Context) ([]domain.MaterialType, error)
+}
+
+type calendarTokenResponse struct {
+	Token string `json:"token"`
+	// Path is the feed URL relative to the API base URL
+	Path string `json:"path"`
+}
+
+// GetCalendarToken returns the secret feed URL of the authenticated user
+func (h *CalendarHandler) GetCalendarToken(w http.ResponseWriter, r *http.Request) {
+	claims := GetClaimsFromContext(r.Context())
+	if claims == nil {
+		writeError(w, http.StatusUnauthorized, "unauthorized", "Authentication required")
+		return
+	}
+	token, err := h.Store.GetCalendarToken(r.Context(), claims.CustomerID)
+	if err != nil {
+		serverError(w, r, err, "calendar_failed", "Failed to get calendar token")
+		return
+	}
+	writeJSON(w, http.StatusOK, calendarTokenResponse{Token: token, Path: "/calendar/" + token + ".ics"})
+}
+
+// RotateCalendarToken replaces the feed URL of the authenticated user, for
+// example after it was shared by accident
+func (h *CalendarHandler) RotateCalendarToken(w http.ResponseWriter, r *http.Request) {
+	claims := GetClaimsFromContext(r.Context())
+	if claims == nil {
+		writeError(w, http.StatusUnauthorized, "unauthorized", "Authentication required")
+		return
+	}
+	token, err := h.Store.RotateCalendarToken(r.Context(), claims.CustomerID)
+	if err != nil {
+		serverError(w, r, err, "calendar_failed", "Failed to rotate calendar token")
+		return
+	}
+	writeJSON(w, http.StatusOK, calendarTokenResponse{Token: token, Path: "/calendar/" + token + ".ics"})
+}
+
+// GetCalendarFeed serves the feed identified by the secret token in the URL.
+// Calendar apps cannot send credentials, so the token is the only authentication.
+func (h *CalendarHandler) GetCalendarFeed(w http.ResponseWriter, r *http.Request) {
+	user, err := h.Store.GetCalendarUser(r.Context(), chi.URLParam(r, "token"))
+	if errors.Is(err, db.ErrCalendarNotFound) {
+		writeError(w, http.StatusNotFound, "not_found", "Calendar not found")
+		return
+	}
+	if err != nil {
+		serverError(w, r, err, "calendar_failed", "Failed to load calendar")
+		return
+	}
+
+	requests, err := h.Store.ListCalendarRequests(r.Context(), user, time.Now().Add(-calendarHistory))
+	if err != nil {
+		serverError(w, r, err, "calendar_failed", "Failed to load calendar")
+		return
+	}
+	materialTypes, err := h.Store.ListMaterialTypes(r.Context())
+	if err != nil {
+		serverError(w, r, err, "calendar_failed", "Failed to load calendar")
+		return
+	}
+	names := make(map[string]string, len(materialTypes))
+	for _, mt := range materialTypes {
+		names[mt.ID] = mt.Name
+	}
+
+	cal := ical.Calendar{
+		ProdID:   "-//organization_backend//Kalender//DE",
+		Name:     "Lieferungen und Rückgaben",
+		Location: h.location(),
+	}
+	for _, req := range requests {
+		cal.Events = append(cal.Events, h.requestEvents(req, names)...)
+	}
+
+	w.Header().Set("Content-Type", ical.ContentType)
+	w.Header().Set("Content-Disposition", `inline; filename="kalender.ics"`)
+	w.Header().Set("Cache-Control", "private, no-cache")
+	w.WriteHeader(http.StatusOK)
+	_ = ical.Write(w, cal)
+}
+
+// requestEvents returns the delivery event of a request and, when a return
+// date is set, its return event. UIDs only depend on the request ID so
+// clients replace the events when the request changes.
+func (h *CalendarHandler) requestEvents(req domain.Request, names map[string]string) []ical.Event {
+	ids := make([]string, 0, len(req.Items))
+	for id := range req.Items {
+		ids = append(ids, id)
+	}
+	sort.Slice(ids, func(i, j int) bool { return names[ids[i]] < names[ids[j]] })
+	lines := make([]string, 0, len(ids)+1)
+	for _, id := range ids {
+		name := names[id]
+		if name == "" {
+			name = id
+		}
+		lines = append(lines, fmt.Sprintf("%dx %s", req.Items[id], name))
+	}
+	link := fmt.Sprintf("%s/requests/%s", h.AppURL, req.ID)
+	lines = append(lines, "", link)
+
+	address := req.ShippingAddress.Line1
+	if req.ShippingAddress.Line2 != "" {
+		address += ", " + req.ShippingAddress.Line2
+	}
+	address += ", " + strings.TrimSpace(req.ShippingAddress.ZipCode+" "+req.ShippingAddress.City)
+
+	status := "CONFIRMED"
+	if req.Status == "pending" {
+		status = "TENTATIVE"
+	}
+	base := ical.Event{
+		Description: strings.Join(lines, "\n"),
+		Location:    address,
+		URL:         link,
+		Stamp:       req.UpdatedAt,
+		Sequence:    int(req.UpdatedAt.Sub(req.CreatedAt) / time.Second),
+		Status:      status,
+	}
+
+	delivery := base
+	delivery.UID = fmt.Sprintf("request-%s-delivery@%s", req.ID, h.uidDomain())
+	delivery.Summary = "Lieferung: " + req.ShippingCustomerName
+	h.setTimes(&delivery, req.DeliveryDate)
+	events := []ical.Event{delivery}
+
+	if req.ReturnDate != nil {
+		ret := base
+		ret.UID = fmt.Sprintf("request-%s-return@%s", req.ID, h.uidDomain())
+		ret.Summary = "Rückgabe: " + req.ShippingCustomerName
+		h.setTimes(&ret, *req.ReturnDate)
+		events = append(events, ret)
+	}
+	return events
+}
+
+// setTimes turns dates without a time of day into all-day events and
+// everything else into one hour long events. Date pickers send midnight UTC,
+// so midnight in either UTC or the configured time zone counts as a date.
+func (h *CalendarHandler) setTimes(event *ical.Event, at time.Time) {
+	for _, t := range []time.Time{at.UTC(), at.In(h.location())} {
+		if t.Hour() == 0 && t.Minute() == 0 && t.Second() == 0 {
+			event.AllDay = true
+			event.Start = t
+			event.End = t.AddDate(0, 0, 1)
+			return
+		}
+	}
+	event.Start = at
+	event.End = at.Add(time.Hour)
+}
+
+func (h *CalendarHandler) uidDomain() string {
+	if u, err := url.Parse(h.AppURL); err == nil && u.Hostname() != "" {
+		return u.Hostname()
+	}
+	return "organization-backend"
+}
+
+func (h *CalendarHandler) location() *time.Location {
+	if h.Location == nil {
+		return time.UTC
+	}
+	return h.Location
+}
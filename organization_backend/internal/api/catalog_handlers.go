@@ -0,0 +1,470 @@
+package api
+
+import (
+	"archive/zip"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path"
+	"strconv"
+	"strings"
+	"time"
+
+	"organization_backend/internal/db"
+	"organization_backend/internal/domain"
+	"organization_backend/internal/metrics"
+	"organization_backend/internal/storage"
+)
+
+const (
+	// maxCatalogArchiveBytes limits the size of an uploaded catalog archive
+	maxCatalogArchiveBytes = 500 << 20
+	// maxCatalogJSONBytes limits the uncompressed size of catalog.json
+	maxCatalogJSONBytes = 20 << 20
+
+	catalogArchiveVersion = 1
+	catalogJSONFile       = "catalog.json"
+	catalogStockFile      = "stock.csv"
+)
+
+var catalogStockHeader = []string{"material_type_id", "distribution_center", "amount"}
+
+// CatalogHandler handles bulk export and import of the material catalog
+type CatalogHandler struct {
+	Store   *db.Store
+	Storage storage.Storage
+	Metrics *metrics.Metrics
+}
+
+// catalogArchive is the content of catalog.json. Stock levels live in
+// stock.csv and image originals under images/<material type id>/.
+type catalogArchive struct {
+	Version             int                                `json:"version"`
+	ExportedAt          time.Time                          `json:"exportedAt"`
+	Categories          []catalogArchiveCategory           `json:"categories"`
+	MaterialTypes       []catalogArchiveMaterialType       `json:"materialTypes"`
+	DistributionCenters []catalogArchiveDistributionCenter `json:"distributionCenters"`
+}
+
+type catalogArchiveCategory struct {
+	ID        string `json:"id,omitempty"`
+	ParentID  string `json:"parentId,omitempty"`
+	Name      string `json:"name"`
+	SortOrder int    `json:"sortOrder"`
+}
+
+type catalogArchiveMaterialType struct {
+	ID          string                `json:"id,omitempty"`
+	Name        string                `json:"name"`
+	Description string                `json:"description"`
+	CategoryID  string                `json:"categoryId,omitempty"`
+	Tags        []string              `json:"tags"`
+	Archived    bool                  `json:"archived"`
+	Images      []catalogArchiveImage `json:"images"`
+}
+
+type catalogArchiveImage struct {
+	File    string `json:"file"`
+	AltText string `json:"altText"`
+}
+
+type catalogArchiveDistributionCenter struct {
+	Name    string `json:"name"`
+	Address string `json:"address"`
+}
+
+// ExportCatalog streams the whole catalog as a ZIP archive (admin only)
+func (h *CatalogHandler) ExportCatalog(w http.ResponseWriter, r *http.Request) {
+	catalog, err := h.Store.ExportCatalog(r.Context())
+	if err != nil {
+		serverError(w, r, err, "export_failed", "Failed to export catalog")
+		return
+	}
+
+	archive := catalogArchive{
+		Version:             catalogArchiveVersion,
+		ExportedAt:          time.Now().UTC(),
+		Categories:          []catalogArchiveCategory{},
+		MaterialTypes:       []catalogArchiveMaterialType{},
+		DistributionCenters: []catalogArchiveDistributionCenter{},
+	}
+	for _, c := range catalog.Categories {
+		archive.Categories = append(archive.Categories, catalogArchiveCategory{
+			ID:        c.ID,
+			ParentID:  c.ParentID,
+			Name:      c.Name,
+			SortOrder: c.SortOrder,
+		})
+	}
+	// imageFiles maps archive paths to storage keys
+	imageFiles := map[string]string{}
+	var imageOrder []string
+	for _, mt := range catalog.MaterialTypes {
+		row := catalogArchiveMaterialType{
+			ID:          mt.ID,
+			Name:        mt.Name,
+			Description: mt.Description,
+			CategoryID:  mt.CategoryID,
+			Tags:        mt.Tags,
+			Archived:    mt.ArchivedAt != nil,
+			Images:      []catalogArchiveImage{},
+		}
+		originals := map[string]string{}
+		for _, image := range mt.Images {
+			originals[image.OriginalURL] = image.AltText
+		}
+		urls := make([]string, 0, len(mt.Images))
+		for _, image := range mt.Images {
+			urls = append(urls, image.OriginalURL)
+		}
+		// Material types from before image galleries only have a single image URL
+		if len(urls) == 0 && mt.ImageURL != "" {
+			urls = append(urls, mt.ImageURL)
+		}
+		for _, url := range urls {
+			key, ok := h.Storage.KeyFromURL(url)
+			if !ok {
+				continue
+			}
+			file := path.Join("images", mt.ID, path.Base(key))
+			if _, exists := imageFiles[file]; !exists {
+				imageFiles[file] = key
+				imageOrder = append(imageOrder, file)
+			}
+			row.Images = append(row.Images, catalogArchiveImage{File: file, AltText: originals[url]})
+		}
+		archive.MaterialTypes = append(archive.MaterialTypes, row)
+	}
+	centerNames := map[string]string{}
+	for _, c := range catalog.DistributionCenters {
+		centerNames[c.ID] = c.Name
+		archive.DistributionCenters = append(archive.DistributionCenters, catalogArchiveDistributionCenter{
+			Name:    c.Name,
+			Address: c.Address,
+		})
+	}
+
+	filename := fmt.Sprintf("catalog-%s.zip", archive.ExportedAt.Format("2006-01-02"))
+	w.Header().Set("Content-Type", "application/zip")
+	w.Header().Set("Content-Disposition", fmt.Sprintf(`attachment; filename="%s"`, filename))
+	w.WriteHeader(http.StatusOK)
+
+	// Errors after this point can only abort the stream
+	zw := zip.NewWriter(w)
+	defer zw.Close()
+
+	f, err := zw.Create(catalogJSONFile)
+	if err != nil {
+		return
+	}
+	enc := json.NewEncoder(f)
+	enc.SetIndent("", "  ")
+	if err := enc.Encode(archive); err != nil {
+		return
+	}
+
+	f, err = zw.Create(catalogStockFile)
+	if err != nil {
+		return
+	}
+	cw := csv.NewWriter(f)
+	_ = cw.Write(catalogStockHeader)
+	for _, level := range catalog.Stock {
+		_ = cw.Write([]string{level.MaterialTypeID, centerNames[level.DistributionCenterID], strconv.Itoa(level.Amount)})
+	}
+	cw.Flush()
+	if cw.Error() != nil {
+		return
+	}
+
+	for _, file := range imageOrder {
+		if err := h.copyToArchive(r, zw, file, imageFiles[file]); err != nil {
+			return
+		}
+	}
+}
+
+func (h *CatalogHandler) copyToArchive(r *http.Request, zw *zip.Writer, file, key string) error {
+	body, _, err := h.Storage.Get(r.Context(), key)
+	if errors.Is(err, storage.ErrNotFound) {
+		// A missing file leaves a dangling reference that the import reports
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	defer body.Close()
+	// Images are already compressed
+	f, err := zw.CreateHeader(&zip.FileHeader{Name: file, Method: zip.Store, Modified: time.Now()})
+	if err != nil {
+		return err
+	}
+	_, err = io.Copy(f, body)
+	return err
+}
+
+// ImportCatalog merges a catalog archive into the catalog (admin only). The
+// request body is the ZIP archive. With ?dryRun=true the per-row report is
+// returned without changing anything; otherwise the import is committed in a
+// single transaction unless a row conflicts.
+func (h *CatalogHandler) ImportCatalog(w http.ResponseWriter, r *http.Request) {
+	dryRun := r.URL.Query().Get("dryRun") == "true"
+
+	tmp, err := os.CreateTemp("", "catalog-import-*.zip")
+	if err != nil {
+		serverError(w, r, err, "import_failed", "Failed to buffer archive")
+		return
+	}
+	defer os.Remove(tmp.Name())
+	defer tmp.Close()
+
+	size, err := io.Copy(tmp, http.MaxBytesReader(w, r.Body, maxCatalogArchiveBytes))
+	if err != nil {
+		var tooLarge *http.MaxBytesError
+		if errors.As(err, &tooLarge) {
+			writeError(w, http.StatusRequestEntityTooLarge, "file_too_large", fmt.Sprintf("Archive exceeds %d MB", maxCatalogArchiveBytes>>20))
+			return
+		}
+		writeError(w, http.StatusBadRequest, "read_error", "Failed to read archive")
+		return
+	}
+	h.Metrics.ObserveUpload("catalog_archive", size)
+	zr, err := zip.NewReader(tmp, size)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "invalid_archive", "Body is not a ZIP archive")
+		return
+	}
+	files := map[string]*zip.File{}
+	for _, f := range zr.File {
+		files[f.Name] = f
+	}
+
+	archive, stock, err := readCatalogArchive(files)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "invalid_archive", err.Error())
+		return
+	}
+	input, images, rejected := buildCatalogImport(archive, stock, files)
+
+	result, err := h.Store.ImportCatalog(r.Context(), input, true)
+	if err != nil {
+		serverError(w, r, err, "import_failed", "Failed to plan catalog import")
+		return
+	}
+	for _, row := range rejected {
+		result.Add(row)
+	}
+	if dryRun {
+		writeJSON(w, http.StatusOK, result)
+		return
+	}
+	if result.HasConflicts() {
+		writeJSON(w, http.StatusConflict, result)
+		return
+	}
+
+	// Store files for the images the import is going to create
+	created := map[string]bool{}
+	for _, row := range result.Rows {
+		if row.Entity == db.AuditEntityImage && row.Action == db.CatalogActionCreate {
+			created[row.ID] = true
+		}
+	}
+	var stored []db.MaterialTypeImageInput
+	removeStored := func() {
+		for _, image := range stored {
+			removeImageFiles(r.Context(), h.Storage, image.OriginalURL, image.Variants)
+		}
+	}
+	for i := range input.MaterialTypes {
+		mt := &input.MaterialTypes[i]
+		for j := range mt.Images {
+			image := &mt.Images[j]
+			if !created[mt.ID+"/"+image.ContentHash] {
+				continue
+			}
+			storedImage, _, err := storeImage(r.Context(), h.Storage, mt.ID, images[mt.ID+"/"+image.ContentHash], image.AltText)
+			if err != nil {
+				removeStored()
+				serverError(w, r, err, "file_error", "Failed to store images")
+				return
+			}
+			*image = storedImage
+			stored = append(stored, storedImage)
+		}
+	}
+
+	result, err = h.Store.ImportCatalog(r.Context(), input, false)
+	if err != nil || !result.Committed {
+		// Duplicate images share their files with the image that won the race
+		if !errors.Is(err, db.ErrDuplicateImage) {
+			removeStored()
+		}
+		if err == nil {
+			// The catalog changed between planning and committing
+			writeJSON(w, http.StatusConflict, result)
+			return
+		}
+		serverError(w, r, err, "import_failed", "Failed to import catalog")
+		return
+	}
+	writeJSON(w, http.StatusOK, result)
+}
+
+// readCatalogArchive parses catalog.json and the optional stock.csv
+func readCatalogArchive(files map[string]*zip.File) (catalogArchive, [][]string, error) {
+	f, ok := files[catalogJSONFile]
+	if !ok {
+		return catalogArchive{}, nil, fmt.Errorf("archive does not contain %s", catalogJSONFile)
+	}
+	data, err := readZipFile(f, maxCatalogJSONBytes)
+	if err != nil {
+		return catalogArchive{}, nil, err
+	}
+	var archive catalogArchive
+	if err := json.Unmarshal(data, &archive); err != nil {
+		return catalogArchive{}, nil, fmt.Errorf("invalid %s: %v", catalogJSONFile, err)
+	}
+	if archive.Version != catalogArchiveVersion {
+		return catalogArchive{}, nil, fmt.Errorf("unsupported archive version %d", archive.Version)
+	}
+
+	f, ok = files[catalogStockFile]
+	if !ok {
+		return archive, nil, nil
+	}
+	data, err = readZipFile(f, maxCatalogJSONBytes)
+	if err != nil {
+		return catalogArchive{}, nil, err
+	}
+	records, err := csv.NewReader(strings.NewReader(string(data))).ReadAll()
+	if err != nil {
+		return catalogArchive{}, nil, fmt.Errorf("invalid %s: %v", catalogStockFile, err)
+	}
+	if len(records) == 0 || strings.Join(records[0], ",") != strings.Join(catalogStockHeader, ",") {
+		return catalogArchive{}, nil, fmt.Errorf("%s must start with the header %s", catalogStockFile, strings.Join(catalogStockHeader, ","))
+	}
+	return archive, records[1:], nil
+}
+
+// readZipFile reads an archive entry, refusing entries larger than limit
+// regardless of the size declared in the archive
+func readZipFile(f *zip.File, limit int64) ([]byte, error) {
+	if f.UncompressedSize64 > uint64(limit) {
+		return nil, fmt.Errorf("%s exceeds %d MB", f.Name, limit>>20)
+	}
+	rc, err := f.Open()
+	if err != nil {
+		return nil, fmt.Errorf("open %s: %v", f.Name, err)
+	}
+	defer rc.Close()
+	data, err := io.ReadAll(io.LimitReader(rc, limit+1))
+	if err != nil {
+		return nil, fmt.Errorf("read %s: %v", f.Name, err)
+	}
+	if int64(len(data)) > limit {
+		return nil, fmt.Errorf("%s exceeds %d MB", f.Name, limit>>20)
+	}
+	return data, nil
+}
+
+// buildCatalogImport normalizes IDs the same way domain.NormalizeID does
+// for new records, so an ID or a name from another installation matches the
+// existing record. Image files are validated and returned by
+// "<material type id>/<content hash>"; invalid rows are returned as conflicts.
+func buildCatalogImport(archive catalogArchive, stock [][]string, files map[string]*zip.File) (db.CatalogImport, map[string][]byte, []db.CatalogImportRow) {
+	var input db.CatalogImport
+	images := map[string][]byte{}
+	var rejected []db.CatalogImportRow
+
+	for _, c := range archive.Categories {
+		input.Categories = append(input.Categories, db.CatalogCategoryRow{
+			ID:        catalogID(c.ID, c.Name),
+			ParentID:  domain.NormalizeID(c.ParentID),
+			Name:      strings.TrimSpace(c.Name),
+			SortOrder: c.SortOrder,
+		})
+	}
+
+	for i, mt := range archive.MaterialTypes {
+		row := db.CatalogMaterialTypeRow{
+			ID:          catalogID(mt.ID, mt.Name),
+			Name:        strings.TrimSpace(mt.Name),
+			Description: strings.TrimSpace(mt.Description),
+			CategoryID:  domain.NormalizeID(mt.CategoryID),
+			Tags:        domain.NormalizeTags(mt.Tags),
+			Archived:    mt.Archived,
+		}
+		for _, image := range mt.Images {
+			reject := func(message string) {
+				rejected = append(rejected, db.CatalogImportRow{
+					Entity:  db.AuditEntityImage,
+					Row:     i + 1,
+					ID:      row.ID + "/" + image.File,
+					Action:  db.CatalogActionConflict,
+					Message: message,
+				})
+			}
+			f, ok := files[image.File]
+			if !ok {
+				reject("file not found in archive")
+				continue
+			}
+			data, err := readZipFile(f, maxUploadBytes)
+			if err != nil {
+				reject(err.Error())
+				continue
+			}
+			if _, err := decodeUploadedImage(data); err != nil {
+				reject("invalid image: " + err.Error())
+				continue
+			}
+			hash := imageContentHash(data)
+			images[row.ID+"/"+hash] = data
+			row.Images = append(row.Images, db.MaterialTypeImageInput{
+				AltText:     strings.TrimSpace(image.AltText),
+				ContentHash: hash,
+			})
+		}
+		input.MaterialTypes = append(input.MaterialTypes, row)
+	}
+
+	for _, c := range archive.DistributionCenters {
+		input.DistributionCenters = append(input.DistributionCenters, db.CatalogDistributionCenterRow{
+			Name:    strings.TrimSpace(c.Name),
+			Address: strings.TrimSpace(c.Address),
+		})
+	}
+
+	for i, record := range stock {
+		if len(record) != len(catalogStockHeader) {
+			rejected = append(rejected, db.CatalogImportRow{Entity: db.AuditEntityStock, Row: i + 1, Action: db.CatalogActionConflict, Message: "wrong number of columns"})
+			continue
+		}
+		amount, err := strconv.Atoi(strings.TrimSpace(record[2]))
+		if err != nil {
+			rejected = append(rejected, db.CatalogImportRow{Entity: db.AuditEntityStock, Row: i + 1, ID: record[0] + "@" + record[1], Action: db.CatalogActionConflict, Message: "amount must be a number"})
+			continue
+		}
+		input.Stock = append(input.Stock, db.CatalogStockRow{
+			Row:                i + 1,
+			MaterialTypeID:     domain.NormalizeID(record[0]),
+			DistributionCenter: strings.TrimSpace(record[1]),
+			Amount:             amount,
+		})
+	}
+
+	return input, images, rejected
+}
+
+// catalogID normalizes an explicit ID, falling back to the name like new records do
+func catalogID(id, name string) string {
+	if strings.TrimSpace(id) != "" {
+		return domain.NormalizeID(id)
+	}
+	return domain.NormalizeID(name)
+}
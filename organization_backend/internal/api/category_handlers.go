@@ -0,0 +1,148 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"organization_backend/internal/db"
+	"organization_backend/internal/domain"
+
+	"github.com/go-chi/chi/v5"
+)
+
+// CategoryHandler handles material type category requests
+type CategoryHandler struct {
+	Store CategoryStore
+}
+
+// CategoryStore defines the methods CategoryHandler needs from Store
+type CategoryStore interface {
+	ListCategories(ctx context.Context) ([]domain.Category, error)
+	GetCategoryByID(ctx context.Context, id string) (domain.Category, error)
+	CreateCategory(ctx context.Context, id string, input db.CategoryInput) (domain.Category, error)
+	UpdateCategory(ctx context.Context, id string, input db.CategoryInput) (domain.Category, error)
+	DeleteCategory(ctx context.Context, id string) error
+}
+
+// CategoryRequest represents the request body for creating or updating a category
+type CategoryRequest struct {
+	ParentID  string `json:"parentId"`
+	Name      string `json:"name"`
+	SortOrder int    `json:"sortOrder"`
+}
+
+// ListCategories returns the category tree (public)
+func (h *CategoryHandler) ListCategories(w http.ResponseWriter, r *http.Request) {
+	categories, err := h.Store.ListCategories(r.Context())
+	if err != nil {
+		serverError(w, r, err, "list_failed", "Failed to fetch categories")
+		return
+	}
+	writeJSON(w, http.StatusOK, categories)
+}
+
+// GetCategory returns a single category by ID (public)
+func (h *CategoryHandler) GetCategory(w http.ResponseWriter, r *http.Request) {
+	c, err := h.Store.GetCategoryByID(r.Context(), chi.URLParam(r, "id"))
+	if err != nil {
+		writeError(w, http.StatusNotFound, "not_found", "Category not found")
+		return
+	}
+	writeJSON(w, http.StatusOK, c)
+}
+
+// CreateCategory creates a new category (admin only)
+func (h *CategoryHandler) CreateCategory(w http.ResponseWriter, r *http.Request) {
+	var req CategoryRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, http.StatusBadRequest, "invalid_json", "Invalid JSON body")
+		return
+	}
+	if strings.TrimSpace(req.Name) == "" {
+		writeError(w, http.StatusBadRequest, "validation_error", "Name is required")
+		return
+	}
+
+	// Category IDs follow the same slug rules as material type IDs
+	id := domain.NormalizeID(req.Name)
+	if id == "" {
+		writeError(w, http.StatusBadRequest, "validation_error", "Name must contain at least one letter or number")
+		return
+	}
+
+	c, err := h.Store.CreateCategory(r.Context(), id, db.CategoryInput{
+		ParentID:  strings.TrimSpace(req.ParentID),
+		Name:      strings.TrimSpace(req.Name),
+		SortOrder: req.SortOrder,
+	})
+	if errors.Is(err, db.ErrCategoryNotFound) {
+		writeError(w, http.StatusBadRequest, "validation_error", "Parent category does not exist")
+		return
+	}
+	if errors.Is(err, db.ErrCategoryExists) {
+		writeError(w, http.StatusConflict, "conflict", "A category with this name already exists")
+		return
+	}
+	if err != nil {
+		serverError(w, r, err, "create_failed", "Failed to create category")
+		return
+	}
+	writeJSON(w, http.StatusCreated, c)
+}
+
+// UpdateCategory renames, reorders or moves a category (admin only)
+func (h *CategoryHandler) UpdateCategory(w http.ResponseWriter, r *http.Request) {
+	id := chi.URLParam(r, "id")
+
+	var req CategoryRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, http.StatusBadRequest, "invalid_json", "Invalid JSON body")
+		return
+	}
+	if strings.TrimSpace(req.Name) == "" {
+		writeError(w, http.StatusBadRequest, "validation_error", "Name is required")
+		return
+	}
+
+	c, err := h.Store.UpdateCategory(r.Context(), id, db.CategoryInput{
+		ParentID:  strings.TrimSpace(req.ParentID),
+		Name:      strings.TrimSpace(req.Name),
+		SortOrder: req.SortOrder,
+	})
+	switch {
+	case errors.Is(err, db.ErrCategoryNotFound):
+		writeError(w, http.StatusNotFound, "not_found", "Category or parent category not found")
+		return
+	case errors.Is(err, db.ErrCategoryCycle):
+		writeError(w, http.StatusBadRequest, "validation_error", "Category cannot be moved below itself")
+		return
+	case err != nil:
+		serverError(w, r, err, "update_failed", "Failed to update category")
+		return
+	}
+	writeJSON(w, http.StatusOK, c)
+}
+
+// DeleteCategory deletes a category without subcategories (admin only)
+func (h *CategoryHandler) DeleteCategory(w http.ResponseWriter, r *http.Request) {
+	err := h.Store.DeleteCategory(r.Context(), chi.URLParam(r, "id"))
+	var inUse db.CategoryInUseError
+	switch {
+	case errors.Is(err, db.ErrCategoryNotFound):
+		writeError(w, http.StatusNotFound, "not_found", "Category not found")
+		return
+	case errors.As(err, &inUse):
+		writeError(w, http.StatusConflict, "category_in_use", fmt.Sprintf(
+			"Category has %d subcategories; move or delete them first", inUse.ChildCount,
+		))
+		return
+	case err != nil:
+		serverError(w, r, err, "delete_failed", "Failed to delete category")
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]string{"status": "deleted"})
+}
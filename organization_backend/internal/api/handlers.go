@@ -1,6 +1,8 @@
 package api
 
 import (
+	"context"
+	"database/sql"
 	"encoding/json"
 	"errors"
 	"net/http"
@@ -10,17 +12,29 @@ import (
 
 	"organization_backend/internal/db"
 	"organization_backend/internal/domain"
+	"organization_backend/internal/logging"
+	"organization_backend/internal/metrics"
 	"organization_backend/internal/service"
 	"organization_backend/internal/transport"
 	"organization_backend/pkg/pagination"
 
 	"github.com/go-chi/chi/v5"
+	"github.com/google/uuid"
 )
 
 type Handler struct {
 	Service  *service.RequestService
-	Store    *db.Store
-	Notifier *db.Notifier
+	Store    RequestStore
+	Notifier db.RequestNotifier
+	// SSEHeartbeat is how often idle event streams send a keep-alive comment
+	SSEHeartbeat time.Duration
+	Metrics      *metrics.Metrics
+}
+
+// RequestStore defines the methods Handler needs from Store
+type RequestStore interface {
+	db.RequestRepository
+	ListMaterialTypes(ctx context.Context) ([]domain.MaterialType, error)
 }
 
 func (h *Handler) CreateRequest(w http.ResponseWriter, r *http.Request) {
@@ -37,7 +51,7 @@ func (h *Handler) CreateRequest(w http.ResponseWriter, r *http.Request) {
 			writeJSON(w, http.StatusBadRequest, validation)
 			return
 		}
-		writeError(w, http.StatusInternalServerError, "create_failed", err.Error())
+		serverError(w, r, err, "create_failed", "Failed to create request")
 		return
 	}
 
@@ -54,6 +68,44 @@ func (h *Handler) GetRequest(w http.ResponseWriter, r *http.Request) {
 	writeJSON(w, http.StatusOK, req)
 }
 
+type setDistributionCenterPayload struct {
+	DistributionCenterID string `json:"distributionCenterId"`
+}
+
+// SetRequestDistributionCenter routes a request to the distribution center
+// that packs and delivers it. An empty distributionCenterId removes the routing.
+func (h *Handler) SetRequestDistributionCenter(w http.ResponseWriter, r *http.Request) {
+	id := chi.URLParam(r, "id")
+	if _, err := uuid.Parse(id); err != nil {
+		writeError(w, http.StatusNotFound, "not_found", "Request not found")
+		return
+	}
+	var payload setDistributionCenterPayload
+	if err := json.NewDecoder(r.Body).Decode(&payload); err != nil {
+		writeError(w, http.StatusBadRequest, "invalid_json", "Invalid JSON body")
+		return
+	}
+	centerID := strings.TrimSpace(payload.DistributionCenterID)
+	if centerID != "" {
+		if _, err := uuid.Parse(centerID); err != nil {
+			writeError(w, http.StatusBadRequest, "invalid_params", "distributionCenterId must be a UUID")
+			return
+		}
+	}
+
+	req, err := h.Store.SetRequestDistributionCenter(r.Context(), id, centerID)
+	switch {
+	case errors.Is(err, db.ErrRequestNotFound):
+		writeError(w, http.StatusNotFound, "not_found", "Request not found")
+	case errors.Is(err, db.ErrDistributionCenterNotFound):
+		writeError(w, http.StatusBadRequest, "invalid_params", "Distribution center not found")
+	case err != nil:
+		serverError(w, r, err, "update_failed", "Failed to update request")
+	default:
+		writeJSON(w, http.StatusOK, req)
+	}
+}
+
 func (h *Handler) ListRequests(w http.ResponseWriter, r *http.Request) {
 	params, err := parseListParams(r)
 	if err != nil {
@@ -62,13 +114,14 @@ func (h *Handler) ListRequests(w http.ResponseWriter, r *http.Request) {
 	}
 	result, err := h.Service.ListRequests(r.Context(), params)
 	if err != nil {
-		writeError(w, http.StatusInternalServerError, "list_failed", err.Error())
+		serverError(w, r, err, "list_failed", "Failed to fetch requests")
 		return
 	}
 	writeJSON(w, http.StatusOK, result)
 }
 
-// GetMyRequests returns requests for the authenticated customer
+// GetMyRequests returns the requests of the authenticated user and of the
+// schools they belong to
 func (h *Handler) GetMyRequests(w http.ResponseWriter, r *http.Request) {
 	claims := GetClaimsFromContext(r.Context())
 	if claims == nil {
@@ -82,12 +135,12 @@ func (h *Handler) GetMyRequests(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	// Force customer ID filter to the authenticated customer
-	params.CustomerID = claims.CustomerID
+	// Restrict to requests the authenticated user may see
+	params.MemberID = claims.CustomerID
 
 	result, err := h.Service.ListRequests(r.Context(), params)
 	if err != nil {
-		writeError(w, http.StatusInternalServerError, "list_failed", err.Error())
+		serverError(w, r, err, "list_failed", "Failed to fetch requests")
 		return
 	}
 	writeJSON(w, http.StatusOK, result)
@@ -100,7 +153,7 @@ func (h *Handler) SubscribeRequest(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 	events := make(chan []byte, 10)
-	subID, updates := h.Notifier.Subscribe()
+	subID, updates := h.Notifier.Subscribe(r.Context())
 	defer h.Notifier.Unsubscribe(subID)
 
 	go func() {
@@ -127,6 +180,7 @@ func (h *Handler) SubscribeRequest(w http.ResponseWriter, r *http.Request) {
 				default:
 					req, err := h.Service.GetRequestByID(ctx, requestID)
 					if err != nil {
+						logStreamError(ctx, err, update.RequestID)
 						sendEvent(events, "deleted", update.Action, nil, update.RequestID, update.UpdatedAt)
 						continue
 					}
@@ -136,7 +190,9 @@ func (h *Handler) SubscribeRequest(w http.ResponseWriter, r *http.Request) {
 		}
 	}()
 
-	transport.Stream(w, r, events)
+	h.Metrics.StreamOpened("request")
+	defer h.Metrics.StreamClosed("request")
+	transport.Stream(w, r, events, h.SSEHeartbeat)
 }
 
 func (h *Handler) SubscribeRequests(w http.ResponseWriter, r *http.Request) {
@@ -147,7 +203,7 @@ func (h *Handler) SubscribeRequests(w http.ResponseWriter, r *http.Request) {
 	}
 
 	events := make(chan []byte, 10)
-	subID, updates := h.Notifier.Subscribe()
+	subID, updates := h.Notifier.Subscribe(r.Context())
 	defer h.Notifier.Unsubscribe(subID)
 
 	go func() {
@@ -167,6 +223,7 @@ func (h *Handler) SubscribeRequests(w http.ResponseWriter, r *http.Request) {
 				}
 				req, err := h.Service.GetRequestByID(ctx, update.RequestID)
 				if err != nil {
+					logStreamError(ctx, err, update.RequestID)
 					continue
 				}
 				if matchesListQuery(req, params) {
@@ -176,7 +233,18 @@ func (h *Handler) SubscribeRequests(w http.ResponseWriter, r *http.Request) {
 		}
 	}()
 
-	transport.Stream(w, r, events)
+	h.Metrics.StreamOpened("requests")
+	defer h.Metrics.StreamClosed("requests")
+	transport.Stream(w, r, events, h.SSEHeartbeat)
+}
+
+// logStreamError logs a failure to load a request for an event stream.
+// Requests deleted in the meantime are expected and not logged.
+func logStreamError(ctx context.Context, err error, requestID string) {
+	if errors.Is(err, sql.ErrNoRows) || ctx.Err() != nil {
+		return
+	}
+	logging.FromContext(ctx).Warn("load request for event stream failed", "request", requestID, "error", err)
 }
 
 func parseListParams(r *http.Request) (db.ListRequestsParams, error) {
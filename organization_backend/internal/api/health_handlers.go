@@ -0,0 +1,148 @@
+package api
+
+import (
+	"context"
+	"net/http"
+	"runtime"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"organization_backend/internal/db"
+	"organization_backend/internal/logging"
+)
+
+// defaultCheckTimeout bounds each readiness check when Timeout is unset
+const defaultCheckTimeout = 2 * time.Second
+
+// ReadinessCheck reports whether a dependency of the server is usable
+type ReadinessCheck struct {
+	Name  string
+	Check func(ctx context.Context) error
+}
+
+// HealthHandler serves the liveness and readiness probes and the admin
+// status page
+type HealthHandler struct {
+	Checks []ReadinessCheck
+	// Timeout bounds each check
+	Timeout  time.Duration
+	Notifier *db.Notifier
+	Version  string
+	Started  time.Time
+	// Config is the redacted configuration shown by Status
+	Config map[string]any
+
+	draining atomic.Bool
+}
+
+// SetDraining makes Ready fail from now on, so that load balancers stop
+// sending requests before the server shuts down
+func (h *HealthHandler) SetDraining() {
+	h.draining.Store(true)
+}
+
+type checkResult struct {
+	Status     string  `json:"status"`
+	DurationMs float64 `json:"durationMs"`
+	Error      string  `json:"error,omitempty"`
+}
+
+// Live reports that the process is up and serving requests
+func (h *HealthHandler) Live(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, map[string]string{"status": "ok"})
+}
+
+// Ready runs every readiness check concurrently and fails with 503 if any
+// of them fails or the server is shutting down
+func (h *HealthHandler) Ready(w http.ResponseWriter, r *http.Request) {
+	if h.draining.Load() {
+		writeJSON(w, http.StatusServiceUnavailable, map[string]any{
+			"status": "draining",
+			"checks": map[string]checkResult{},
+		})
+		return
+	}
+
+	results := h.runChecks(r)
+	for name, result := range results {
+		// Check errors name hosts and buckets; they are logged and shown
+		// on the admin status page only
+		if result.Error != "" {
+			result.Error = "unavailable"
+			results[name] = result
+		}
+	}
+
+	status, code := "ok", http.StatusOK
+	for _, result := range results {
+		if result.Status != "ok" {
+			status, code = "unavailable", http.StatusServiceUnavailable
+			break
+		}
+	}
+	writeJSON(w, code, map[string]any{
+		"status": status,
+		"checks": results,
+	})
+}
+
+// runChecks runs every readiness check concurrently and logs the failures
+func (h *HealthHandler) runChecks(r *http.Request) map[string]checkResult {
+	timeout := h.Timeout
+	if timeout <= 0 {
+		timeout = defaultCheckTimeout
+	}
+	results := make(map[string]checkResult, len(h.Checks))
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	for _, check := range h.Checks {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			ctx, cancel := context.WithTimeout(r.Context(), timeout)
+			defer cancel()
+			start := time.Now()
+			err := check.Check(ctx)
+			result := checkResult{
+				Status:     "ok",
+				DurationMs: float64(time.Since(start).Microseconds()) / 1000,
+			}
+			if err != nil {
+				result.Status = "failing"
+				result.Error = err.Error()
+				logging.FromContext(r.Context()).Warn("readiness check failed", "check", check.Name, "error", err)
+			}
+			mu.Lock()
+			results[check.Name] = result
+			mu.Unlock()
+		}()
+	}
+	wg.Wait()
+	return results
+}
+
+// Status shows runtime diagnostics and the readiness checks with their
+// errors (admin only)
+func (h *HealthHandler) Status(w http.ResponseWriter, r *http.Request) {
+	subscribers := 0
+	listening := false
+	if h.Notifier != nil {
+		subscribers = h.Notifier.Subscribers()
+		listening = h.Notifier.Connected()
+	}
+	writeJSON(w, http.StatusOK, map[string]any{
+		"version":       h.Version,
+		"goVersion":     runtime.Version(),
+		"startedAt":     h.Started.UTC(),
+		"uptimeSeconds": int64(time.Since(h.Started).Seconds()),
+		"draining":      h.draining.Load(),
+		"goroutines":    runtime.NumGoroutine(),
+		"notifier": map[string]any{
+			"connected":   listening,
+			"subscribers": subscribers,
+		},
+		"checks": h.runChecks(r),
+		"config": h.Config,
+	})
+}
@@ -0,0 +1,251 @@
+package api
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"time"
+
+	"organization_backend/internal/db"
+	"organization_backend/internal/logging"
+)
+
+const (
+	// idempotencyKeyHeader names the header clients send to make retries safe
+	idempotencyKeyHeader = "Idempotency-Key"
+	// idempotencyReplayedHeader marks responses that were replayed from storage
+	idempotencyReplayedHeader = "Idempotent-Replayed"
+	maxIdempotencyKeyLength   = 255
+	// idempotencyMemoryBytes is how much of a request body is kept in memory
+	// before the rest is spooled to a temporary file
+	idempotencyMemoryBytes = 1 << 20
+	// maxIdempotentBodyBytes limits the spooled request body to the largest
+	// body any route accepts, the catalog archive
+	maxIdempotentBodyBytes = maxCatalogArchiveBytes
+	// idempotencyPollInterval and idempotencyWaitTimeout control how retries
+	// wait for a concurrent request with the same key to finish
+	idempotencyPollInterval = 100 * time.Millisecond
+	idempotencyWaitTimeout  = 30 * time.Second
+)
+
+// replayedHeaders are the response headers stored with an idempotency key
+var replayedHeaders = []string{"Content-Type", "Content-Disposition", "Location"}
+
+// IdempotencyKeyStore defines the methods Idempotency needs from Store
+type IdempotencyKeyStore interface {
+	ClaimIdempotencyKey(ctx context.Context, userID, key, requestHash string) (bool, db.IdempotencyKey, error)
+	CompleteIdempotencyKey(ctx context.Context, userID, key string, response db.IdempotentResponse) error
+	ReleaseIdempotencyKey(ctx context.Context, userID, key string) error
+}
+
+// Idempotency makes POST, PUT, PATCH and DELETE requests that carry an
+// Idempotency-Key header safe to retry. The first response with a key is
+// stored for db.IdempotencyKeyTTL and replayed for retries, concurrent retries
+// wait for the first request to finish, and reusing a key for a different
+// request is rejected with 422. Keys are scoped per user, so the middleware
+// must come after AuthMiddleware. Transient failures such as server errors
+// and 429 are not stored so the request can be retried.
+func Idempotency(store IdempotencyKeyStore) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			key := r.Header.Get(idempotencyKeyHeader)
+			if key == "" || !isMutatingMethod(r.Method) {
+				next.ServeHTTP(w, r)
+				return
+			}
+			if len(key) > maxIdempotencyKeyLength {
+				writeError(w, http.StatusBadRequest, "invalid_idempotency_key", "Idempotency-Key must be at most 255 characters")
+				return
+			}
+
+			claims := GetClaimsFromContext(r.Context())
+			if claims == nil {
+				writeError(w, http.StatusUnauthorized, "unauthorized", "Authentication required")
+				return
+			}
+			userID := claims.CustomerID
+
+			hash, body, err := spoolRequestBody(r, maxIdempotentBodyBytes)
+			if errors.Is(err, errBodyTooLarge) {
+				writeError(w, http.StatusRequestEntityTooLarge, "body_too_large", fmt.Sprintf("Request body exceeds %d MB", maxIdempotentBodyBytes>>20))
+				return
+			}
+			if err != nil {
+				writeError(w, http.StatusBadRequest, "invalid_body", "Failed to read request body")
+				return
+			}
+			defer body.Close()
+			r.Body = body
+
+			waitCtx, cancel := context.WithTimeout(r.Context(), idempotencyWaitTimeout)
+			defer cancel()
+			for {
+				claimed, existing, err := store.ClaimIdempotencyKey(r.Context(), userID, key, hash)
+				if err != nil {
+					serverError(w, r, err, "idempotency_failed", "Failed to check Idempotency-Key")
+					return
+				}
+				if claimed {
+					break
+				}
+				if existing.RequestHash != "" && existing.RequestHash != hash {
+					writeError(w, http.StatusUnprocessableEntity, "idempotency_key_reused", "Idempotency-Key was already used for a different request")
+					return
+				}
+				if existing.Response != nil {
+					replayResponse(w, *existing.Response)
+					return
+				}
+				select {
+				case <-waitCtx.Done():
+					writeError(w, http.StatusConflict, "idempotency_key_in_use", "A request with this Idempotency-Key is still being processed")
+					return
+				case <-time.After(idempotencyPollInterval):
+				}
+			}
+
+			rec := &responseRecorder{ResponseWriter: w, status: http.StatusOK}
+			completed := false
+			defer func() {
+				if completed {
+					return
+				}
+				// The handler failed or panicked; let the client retry the key
+				ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+				defer cancel()
+				if err := store.ReleaseIdempotencyKey(ctx, userID, key); err != nil {
+					logging.FromContext(r.Context()).Error("release idempotency key failed", "error", err)
+				}
+			}()
+
+			next.ServeHTTP(rec, r)
+
+			if !replayable(rec.status) {
+				return
+			}
+			response := db.IdempotentResponse{StatusCode: rec.status, Header: map[string]string{}, Body: rec.body.Bytes()}
+			for _, name := range replayedHeaders {
+				if value := w.Header().Get(name); value != "" {
+					response.Header[name] = value
+				}
+			}
+			ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+			defer cancel()
+			if err := store.CompleteIdempotencyKey(ctx, userID, key, response); err != nil {
+				logging.FromContext(r.Context()).Error("store idempotent response failed", "error", err)
+				return
+			}
+			completed = true
+		})
+	}
+}
+
+// replayable reports whether a response with the status is stored for the
+// key. Server errors, failed authentication and rate limiting are transient,
+// so retries run the request again.
+func replayable(status int) bool {
+	switch status {
+	case http.StatusUnauthorized, http.StatusForbidden, http.StatusTooManyRequests:
+		return false
+	}
+	return status < http.StatusInternalServerError
+}
+
+func isMutatingMethod(method string) bool {
+	switch method {
+	case http.MethodPost, http.MethodPut, http.MethodPatch, http.MethodDelete:
+		return true
+	}
+	return false
+}
+
+// errBodyTooLarge is returned by spoolRequestBody for bodies over the limit
+var errBodyTooLarge = errors.New("request body too large")
+
+// spoolRequestBody reads a body of at most maxBytes, returning a hash of the
+// method, URL and body together with a reader that yields the body again.
+// Large bodies are spooled to a temporary file.
+func spoolRequestBody(r *http.Request, maxBytes int64) (string, io.ReadCloser, error) {
+	h := sha256.New()
+	io.WriteString(h, r.Method+" "+r.URL.RequestURI()+"\n")
+
+	var buf bytes.Buffer
+	n, err := io.Copy(&buf, io.TeeReader(io.LimitReader(r.Body, idempotencyMemoryBytes), h))
+	if err != nil {
+		return "", nil, err
+	}
+	if n < idempotencyMemoryBytes {
+		return hex.EncodeToString(h.Sum(nil)), io.NopCloser(&buf), nil
+	}
+
+	tmp, err := os.CreateTemp("", "idempotent-body-*")
+	if err != nil {
+		return "", nil, err
+	}
+	spooled, err := io.Copy(tmp, io.TeeReader(io.LimitReader(r.Body, maxBytes-n+1), h))
+	if err != nil {
+		closeTempFile(tmp)
+		return "", nil, err
+	}
+	if n+spooled > maxBytes {
+		closeTempFile(tmp)
+		return "", nil, errBodyTooLarge
+	}
+	if _, err := tmp.Seek(0, io.SeekStart); err != nil {
+		closeTempFile(tmp)
+		return "", nil, err
+	}
+	return hex.EncodeToString(h.Sum(nil)), &spooledBody{Reader: io.MultiReader(&buf, tmp), file: tmp}, nil
+}
+
+type spooledBody struct {
+	io.Reader
+	file *os.File
+}
+
+func (b *spooledBody) Close() error {
+	closeTempFile(b.file)
+	return nil
+}
+
+func closeTempFile(f *os.File) {
+	f.Close()
+	os.Remove(f.Name())
+}
+
+func replayResponse(w http.ResponseWriter, response db.IdempotentResponse) {
+	for name, value := range response.Header {
+		w.Header().Set(name, value)
+	}
+	w.Header().Set(idempotencyReplayedHeader, "true")
+	w.WriteHeader(response.StatusCode)
+	_, _ = w.Write(response.Body)
+}
+
+// responseRecorder passes a response through while keeping a copy of it
+type responseRecorder struct {
+	http.ResponseWriter
+	status      int
+	wroteHeader bool
+	body        bytes.Buffer
+}
+
+func (r *responseRecorder) WriteHeader(status int) {
+	if !r.wroteHeader {
+		r.status = status
+		r.wroteHeader = true
+	}
+	r.ResponseWriter.WriteHeader(status)
+}
+
+func (r *responseRecorder) Write(p []byte) (int, error) {
+	r.wroteHeader = true
+	r.body.Write(p)
+	return r.ResponseWriter.Write(p)
+}
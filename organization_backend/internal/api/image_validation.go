@@ -0,0 +1,291 @@
+package api
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"image"
+	"image/draw"
+	"image/gif"
+	"image/jpeg"
+	"image/png"
+
+	"github.com/chai2010/webp"
+)
+
+const (
+	// maxUploadBytes limits the whole multipart request body of an image upload
+	maxUploadBytes = 20 << 20
+	// maxImagePixels limits the decoded size of an uploaded image to guard against decompression bombs
+	maxImagePixels = 40_000_000
+)
+
+var (
+	errUnsupportedImage = errors.New("unsupported image format")
+	errImageTooLarge    = fmt.Errorf("image exceeds %d pixels", maxImagePixels)
+)
+
+// uploadedImage is a validated upload ready to be stored
+type uploadedImage struct {
+	Image  image.Image
+	Format string
+	// Data is the original file to store, with JPEG metadata removed
+	Data []byte
+}
+
+// sniffImageFormat detects the image format from magic bytes, ignoring the
+// client-supplied content type
+func sniffImageFormat(data []byte) (string, error) {
+	switch {
+	case bytes.HasPrefix(data, []byte{0xFF, 0xD8, 0xFF}):
+		return "jpeg", nil
+	case bytes.HasPrefix(data, []byte("\x89PNG\r\n\x1a\n")):
+		return "png", nil
+	case bytes.HasPrefix(data, []byte("GIF87a")), bytes.HasPrefix(data, []byte("GIF89a")):
+		return "gif", nil
+	case len(data) >= 12 && string(data[0:4]) == "RIFF" && string(data[8:12]) == "WEBP":
+		return "webp", nil
+	default:
+		return "", errUnsupportedImage
+	}
+}
+
+// decodeUploadedImage validates and decodes an uploaded image. The pixel count
+// is checked from the header before the image data is decoded. Animated GIFs
+// are reduced to their first frame and JPEGs are rotated according to their
+// EXIF orientation with all metadata stripped from the stored original.
+func decodeUploadedImage(data []byte) (uploadedImage, error) {
+	format, err := sniffImageFormat(data)
+	if err != nil {
+		return uploadedImage{}, err
+	}
+
+	var decodeConfig func([]byte) (image.Config, error)
+	var decode func([]byte) (image.Image, error)
+	switch format {
+	case "jpeg":
+		decodeConfig = func(b []byte) (image.Config, error) { return jpeg.DecodeConfig(bytes.NewReader(b)) }
+		decode = func(b []byte) (image.Image, error) { return jpeg.Decode(bytes.NewReader(b)) }
+	case "png":
+		decodeConfig = func(b []byte) (image.Config, error) { return png.DecodeConfig(bytes.NewReader(b)) }
+		decode = func(b []byte) (image.Image, error) { return png.Decode(bytes.NewReader(b)) }
+	case "gif":
+		decodeConfig = func(b []byte) (image.Config, error) { return gif.DecodeConfig(bytes.NewReader(b)) }
+		// gif.Decode stops after the first frame
+		decode = func(b []byte) (image.Image, error) { return gif.Decode(bytes.NewReader(b)) }
+	case "webp":
+		decodeConfig = func(b []byte) (image.Config, error) { return webp.DecodeConfig(bytes.NewReader(b)) }
+		decode = func(b []byte) (image.Image, error) { return webp.Decode(bytes.NewReader(b)) }
+	}
+
+	cfg, err := decodeConfig(data)
+	if err != nil {
+		return uploadedImage{}, fmt.Errorf("decode %s header: %w", format, err)
+	}
+	if cfg.Width <= 0 || cfg.Height <= 0 {
+		return uploadedImage{}, fmt.Errorf("invalid %s dimensions %dx%d", format, cfg.Width, cfg.Height)
+	}
+	if int64(cfg.Width)*int64(cfg.Height) > maxImagePixels {
+		return uploadedImage{}, errImageTooLarge
+	}
+
+	img, err := decode(data)
+	if err != nil {
+		return uploadedImage{}, fmt.Errorf("decode %s: %w", format, err)
+	}
+	if format != "jpeg" {
+		return uploadedImage{Image: img, Format: format, Data: data}, nil
+	}
+
+	orientation := jpegOrientation(data)
+	if orientation != 1 {
+		// Re-encode so the stored original is upright without relying on EXIF
+		img = applyOrientation(img, orientation)
+		var buf bytes.Buffer
+		if err := jpeg.Encode(&buf, img, &jpeg.Options{Quality: 92}); err != nil {
+			return uploadedImage{}, err
+		}
+		return uploadedImage{Image: img, Format: format, Data: buf.Bytes()}, nil
+	}
+	stripped, err := stripJPEGMetadata(data)
+	if err != nil {
+		return uploadedImage{}, fmt.Errorf("strip jpeg metadata: %w", err)
+	}
+	return uploadedImage{Image: img, Format: format, Data: stripped}, nil
+}
+
+// jpegSegment is a marker segment before the start of scan
+type jpegSegment struct {
+	Marker  byte
+	Payload []byte
+	Raw     []byte
+}
+
+// jpegSegments splits a JPEG into its header segments and the remaining scan data
+func jpegSegments(data []byte) ([]jpegSegment, []byte, error) {
+	if !bytes.HasPrefix(data, []byte{0xFF, 0xD8}) {
+		return nil, nil, errUnsupportedImage
+	}
+	var segments []jpegSegment
+	i := 2
+	for {
+		if i+1 >= len(data) || data[i] != 0xFF {
+			return nil, nil, errors.New("malformed jpeg segment")
+		}
+		// Markers may be preceded by any number of fill bytes
+		for i+1 < len(data) && data[i+1] == 0xFF {
+			i++
+		}
+		if i+1 >= len(data) {
+			return nil, nil, errors.New("malformed jpeg segment")
+		}
+		marker := data[i+1]
+		if marker == 0xDA {
+			return segments, data[i:], nil
+		}
+		if i+4 > len(data) {
+			return nil, nil, errors.New("truncated jpeg segment")
+		}
+		length := int(binary.BigEndian.Uint16(data[i+2 : i+4]))
+		if length < 2 || i+2+length > len(data) {
+			return nil, nil, errors.New("truncated jpeg segment")
+		}
+		segments = append(segments, jpegSegment{
+			Marker:  marker,
+			Payload: data[i+4 : i+2+length],
+			Raw:     data[i : i+2+length],
+		})
+		i += 2 + length
+	}
+}
+
+// stripJPEGMetadata removes EXIF, XMP, comments and other application
+// segments without re-encoding. JFIF headers and ICC color profiles are kept.
+func stripJPEGMetadata(data []byte) ([]byte, error) {
+	segments, scan, err := jpegSegments(data)
+	if err != nil {
+		return nil, err
+	}
+	out := make([]byte, 0, len(data))
+	out = append(out, 0xFF, 0xD8)
+	for _, s := range segments {
+		isApp := s.Marker >= 0xE0 && s.Marker <= 0xEF
+		keep := !isApp && s.Marker != 0xFE
+		if s.Marker == 0xE0 && bytes.HasPrefix(s.Payload, []byte("JFIF\x00")) {
+			keep = true
+		}
+		if s.Marker == 0xE2 && bytes.HasPrefix(s.Payload, []byte("ICC_PROFILE\x00")) {
+			keep = true
+		}
+		if keep {
+			out = append(out, s.Raw...)
+		}
+	}
+	return append(out, scan...), nil
+}
+
+// jpegOrientation returns the EXIF orientation (1-8) of a JPEG, or 1 when it
+// is missing or malformed
+func jpegOrientation(data []byte) int {
+	segments, _, err := jpegSegments(data)
+	if err != nil {
+		return 1
+	}
+	for _, s := range segments {
+		if s.Marker != 0xE1 || !bytes.HasPrefix(s.Payload, []byte("Exif\x00\x00")) {
+			continue
+		}
+		if o := exifOrientation(s.Payload[6:]); o != 0 {
+			return o
+		}
+	}
+	return 1
+}
+
+// exifOrientation reads the orientation tag from the first IFD of a TIFF
+// structure, returning 0 when it is absent or invalid
+func exifOrientation(tiff []byte) int {
+	if len(tiff) < 8 {
+		return 0
+	}
+	var order binary.ByteOrder
+	switch string(tiff[0:2]) {
+	case "II":
+		order = binary.LittleEndian
+	case "MM":
+		order = binary.BigEndian
+	default:
+		return 0
+	}
+	if order.Uint16(tiff[2:4]) != 42 {
+		return 0
+	}
+	offset := int64(order.Uint32(tiff[4:8]))
+	if offset+2 > int64(len(tiff)) {
+		return 0
+	}
+	count := int64(order.Uint16(tiff[offset : offset+2]))
+	for i := int64(0); i < count; i++ {
+		entry := offset + 2 + i*12
+		if entry+12 > int64(len(tiff)) {
+			return 0
+		}
+		tag := order.Uint16(tiff[entry : entry+2])
+		typ := order.Uint16(tiff[entry+2 : entry+4])
+		if tag != 0x0112 {
+			continue
+		}
+		if typ != 3 {
+			return 0
+		}
+		value := int(order.Uint16(tiff[entry+8 : entry+10]))
+		if value < 1 || value > 8 {
+			return 0
+		}
+		return value
+	}
+	return 0
+}
+
+// applyOrientation transforms an image so that an EXIF orientation of 1 applies
+func applyOrientation(img image.Image, orientation int) image.Image {
+	if orientation < 2 || orientation > 8 {
+		return img
+	}
+	b := img.Bounds()
+	src := image.NewRGBA(image.Rect(0, 0, b.Dx(), b.Dy()))
+	draw.Draw(src, src.Bounds(), img, b.Min, draw.Src)
+	w, h := b.Dx(), b.Dy()
+
+	dw, dh := w, h
+	if orientation >= 5 {
+		dw, dh = h, w
+	}
+	dst := image.NewRGBA(image.Rect(0, 0, dw, dh))
+	for y := 0; y < dh; y++ {
+		for x := 0; x < dw; x++ {
+			var sx, sy int
+			switch orientation {
+			case 2:
+				sx, sy = w-1-x, y
+			case 3:
+				sx, sy = w-1-x, h-1-y
+			case 4:
+				sx, sy = x, h-1-y
+			case 5:
+				sx, sy = y, x
+			case 6:
+				sx, sy = y, h-1-x
+			case 7:
+				sx, sy = w-1-y, h-1-x
+			case 8:
+				sx, sy = w-1-y, x
+			}
+			si := src.PixOffset(sx, sy)
+			di := dst.PixOffset(x, y)
+			copy(dst.Pix[di:di+4], src.Pix[si:si+4])
+		}
+	}
+	return dst
+}
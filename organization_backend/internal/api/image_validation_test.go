@@ -0,0 +1,378 @@
+package api
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"hash/crc32"
+	"image"
+	"image/color"
+	"image/gif"
+	"image/jpeg"
+	"image/png"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"organization_backend/internal/storage"
+
+	"github.com/chai2010/webp"
+)
+
+func testImage(w, h int) *image.RGBA {
+	img := image.NewRGBA(image.Rect(0, 0, w, h))
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			img.Set(x, y, color.RGBA{R: uint8(x * 40), G: uint8(y * 40), B: 128, A: 255})
+		}
+	}
+	return img
+}
+
+func encodeTestJPEG(t *testing.T, w, h int) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	if err := jpeg.Encode(&buf, testImage(w, h), nil); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func encodeTestPNG(t *testing.T, w, h int) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, testImage(w, h)); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func encodeTestWebP(t *testing.T, w, h int) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	if err := webp.Encode(&buf, testImage(w, h), &webp.Options{Lossless: true}); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+// encodeAnimatedGIF returns a two-frame GIF whose first frame is red
+func encodeAnimatedGIF(t *testing.T) []byte {
+	t.Helper()
+	palette := color.Palette{color.RGBA{255, 0, 0, 255}, color.RGBA{0, 0, 255, 255}}
+	red := image.NewPaletted(image.Rect(0, 0, 6, 3), palette)
+	blue := image.NewPaletted(image.Rect(0, 0, 6, 3), palette)
+	for i := range blue.Pix {
+		blue.Pix[i] = 1
+	}
+	var buf bytes.Buffer
+	if err := gif.EncodeAll(&buf, &gif.GIF{Image: []*image.Paletted{red, blue}, Delay: []int{10, 10}}); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+// withJPEGSegment inserts a marker segment directly after the SOI marker
+func withJPEGSegment(data []byte, marker byte, payload []byte) []byte {
+	segment := []byte{0xFF, marker, 0, 0}
+	binary.BigEndian.PutUint16(segment[2:], uint16(len(payload)+2))
+	segment = append(segment, payload...)
+	out := append([]byte{}, data[:2]...)
+	out = append(out, segment...)
+	return append(out, data[2:]...)
+}
+
+// exifPayload builds an APP1 Exif payload with a single IFD0 entry. ifdOffset
+// and count allow crafting malformed structures.
+func exifPayload(orientation uint16, ifdOffset uint32, count uint16) []byte {
+	tiff := []byte("MM\x00\x2a")
+	tiff = binary.BigEndian.AppendUint32(tiff, ifdOffset)
+	tiff = binary.BigEndian.AppendUint16(tiff, count)
+	tiff = binary.BigEndian.AppendUint16(tiff, 0x0112) // Orientation
+	tiff = binary.BigEndian.AppendUint16(tiff, 3)      // SHORT
+	tiff = binary.BigEndian.AppendUint32(tiff, 1)
+	tiff = binary.BigEndian.AppendUint16(tiff, orientation)
+	tiff = append(tiff, 0, 0, 0, 0, 0, 0)
+	tiff = append(tiff, []byte("GPS 52.5200N 13.4050E")...)
+	return append([]byte("Exif\x00\x00"), tiff...)
+}
+
+// pngHeader returns a PNG consisting only of a signature and an IHDR chunk
+func pngHeader(w, h uint32) []byte {
+	ihdr := []byte("IHDR")
+	ihdr = binary.BigEndian.AppendUint32(ihdr, w)
+	ihdr = binary.BigEndian.AppendUint32(ihdr, h)
+	ihdr = append(ihdr, 8, 6, 0, 0, 0)
+	out := []byte("\x89PNG\r\n\x1a\n")
+	out = binary.BigEndian.AppendUint32(out, uint32(len(ihdr)-4))
+	out = append(out, ihdr...)
+	return binary.BigEndian.AppendUint32(out, crc32.ChecksumIEEE(ihdr))
+}
+
+// gifHeader returns a GIF header announcing the given logical screen size
+func gifHeader(w, h uint16) []byte {
+	out := []byte("GIF89a")
+	out = binary.LittleEndian.AppendUint16(out, w)
+	out = binary.LittleEndian.AppendUint16(out, h)
+	return append(out, 0, 0, 0, 0x3B)
+}
+
+// withJPEGDimensions rewrites the frame header of a baseline JPEG
+func withJPEGDimensions(t *testing.T, data []byte, w, h uint16) []byte {
+	t.Helper()
+	out := append([]byte{}, data...)
+	i := bytes.Index(out, []byte{0xFF, 0xC0})
+	if i < 0 {
+		t.Fatal("no SOF0 marker")
+	}
+	binary.BigEndian.PutUint16(out[i+5:], h)
+	binary.BigEndian.PutUint16(out[i+7:], w)
+	return out
+}
+
+func TestDecodeUploadedImage(t *testing.T) {
+	validJPEG := encodeTestJPEG(t, 4, 2)
+	validPNG := encodeTestPNG(t, 5, 3)
+
+	tests := []struct {
+		name       string
+		data       []byte
+		wantErr    error
+		anyErr     bool
+		wantFormat string
+		wantWidth  int
+		wantHeight int
+	}{
+		{name: "jpeg", data: validJPEG, wantFormat: "jpeg", wantWidth: 4, wantHeight: 2},
+		{name: "png", data: validPNG, wantFormat: "png", wantWidth: 5, wantHeight: 3},
+		{name: "webp", data: encodeTestWebP(t, 7, 2), wantFormat: "webp", wantWidth: 7, wantHeight: 2},
+		{name: "animated gif", data: encodeAnimatedGIF(t), wantFormat: "gif", wantWidth: 6, wantHeight: 3},
+		{name: "jpeg rotated 90 degrees", data: withJPEGSegment(validJPEG, 0xE1, exifPayload(6, 8, 1)), wantFormat: "jpeg", wantWidth: 2, wantHeight: 4},
+		{name: "jpeg rotated 180 degrees", data: withJPEGSegment(validJPEG, 0xE1, exifPayload(3, 8, 1)), wantFormat: "jpeg", wantWidth: 4, wantHeight: 2},
+		{name: "jpeg transverse", data: withJPEGSegment(validJPEG, 0xE1, exifPayload(7, 8, 1)), wantFormat: "jpeg", wantWidth: 2, wantHeight: 4},
+		{name: "exif ifd offset out of bounds", data: withJPEGSegment(validJPEG, 0xE1, exifPayload(6, 0xFFFFFFF0, 1)), wantFormat: "jpeg", wantWidth: 4, wantHeight: 2},
+		{name: "exif entry count past end", data: withJPEGSegment(validJPEG, 0xE1, exifPayload(6, 8, 0xFFFF)), wantFormat: "jpeg", wantWidth: 2, wantHeight: 4},
+		{name: "exif invalid orientation", data: withJPEGSegment(validJPEG, 0xE1, exifPayload(42, 8, 1)), wantFormat: "jpeg", wantWidth: 4, wantHeight: 2},
+		{name: "exif truncated tiff header", data: withJPEGSegment(validJPEG, 0xE1, []byte("Exif\x00\x00MM")), wantFormat: "jpeg", wantWidth: 4, wantHeight: 2},
+		{name: "png decompression bomb", data: pngHeader(100_000, 100_000), wantErr: errImageTooLarge},
+		{name: "png just over pixel limit", data: pngHeader(maxImagePixels/1000+1, 1000), wantErr: errImageTooLarge},
+		{name: "gif oversized logical screen", data: gifHeader(65535, 65535), wantErr: errImageTooLarge},
+		{name: "jpeg oversized frame header", data: withJPEGDimensions(t, validJPEG, 65000, 65000), wantErr: errImageTooLarge},
+		{name: "png zero dimensions", data: pngHeader(0, 0), anyErr: true},
+		{name: "truncated png", data: validPNG[:len(validPNG)/2], anyErr: true},
+		{name: "truncated jpeg", data: validJPEG[:20], anyErr: true},
+		{name: "gif magic with garbage", data: append([]byte("GIF89a"), bytes.Repeat([]byte{0xFF}, 32)...), anyErr: true},
+		{name: "riff that is not webp", data: []byte("RIFF\x10\x00\x00\x00WAVEfmt "), wantErr: errUnsupportedImage},
+		{name: "html disguised as image", data: []byte("<html><script>alert(1)</script></html>"), wantErr: errUnsupportedImage},
+		{name: "svg", data: []byte(`<svg xmlns="http://www.w3.org/2000/svg" onload="alert(1)"/>`), wantErr: errUnsupportedImage},
+		{name: "empty file", data: nil, wantErr: errUnsupportedImage},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := decodeUploadedImage(tt.data)
+			switch {
+			case tt.wantErr != nil:
+				if !errors.Is(err, tt.wantErr) {
+					t.Fatalf("error = %v, want %v", err, tt.wantErr)
+				}
+				return
+			case tt.anyErr:
+				if err == nil {
+					t.Fatal("expected an error")
+				}
+				return
+			case err != nil:
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if got.Format != tt.wantFormat {
+				t.Errorf("format = %q, want %q", got.Format, tt.wantFormat)
+			}
+			if b := got.Image.Bounds(); b.Dx() != tt.wantWidth || b.Dy() != tt.wantHeight {
+				t.Errorf("size = %dx%d, want %dx%d", b.Dx(), b.Dy(), tt.wantWidth, tt.wantHeight)
+			}
+			if format, err := sniffImageFormat(got.Data); err != nil || format != tt.wantFormat {
+				t.Errorf("stored original sniffed as %q (%v), want %q", format, err, tt.wantFormat)
+			}
+		})
+	}
+}
+
+func TestDecodeUploadedImageGIFFirstFrame(t *testing.T) {
+	got, err := decodeUploadedImage(encodeAnimatedGIF(t))
+	if err != nil {
+		t.Fatal(err)
+	}
+	r, g, b, _ := got.Image.At(0, 0).RGBA()
+	if r>>8 != 255 || g != 0 || b != 0 {
+		t.Errorf("first pixel = %d,%d,%d, want red from the first frame", r>>8, g>>8, b>>8)
+	}
+}
+
+func TestDecodeUploadedImageStripsJPEGMetadata(t *testing.T) {
+	data := encodeTestJPEG(t, 4, 2)
+	data = withJPEGSegment(data, 0xFE, []byte("secret comment"))
+	data = withJPEGSegment(data, 0xE1, []byte("http://ns.adobe.com/xap/1.0/\x00<x:xmpmeta/>"))
+	data = withJPEGSegment(data, 0xE1, exifPayload(1, 8, 1))
+
+	for _, orientation := range []uint16{1, 6} {
+		input := data
+		if orientation != 1 {
+			input = withJPEGSegment(data, 0xE1, exifPayload(orientation, 8, 1))
+		}
+		got, err := decodeUploadedImage(input)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, leak := range []string{"Exif", "GPS", "secret comment", "xmpmeta"} {
+			if bytes.Contains(got.Data, []byte(leak)) {
+				t.Errorf("orientation %d: stored original still contains %q", orientation, leak)
+			}
+		}
+		if _, err := jpeg.Decode(bytes.NewReader(got.Data)); err != nil {
+			t.Errorf("orientation %d: stored original does not decode: %v", orientation, err)
+		}
+	}
+}
+
+func TestApplyOrientation(t *testing.T) {
+	// 2x1 image: left pixel red, right pixel blue
+	src := image.NewRGBA(image.Rect(0, 0, 2, 1))
+	red := color.RGBA{255, 0, 0, 255}
+	blue := color.RGBA{0, 0, 255, 255}
+	src.Set(0, 0, red)
+	src.Set(1, 0, blue)
+
+	tests := []struct {
+		orientation int
+		want        [][]color.RGBA // rows of the expected result
+	}{
+		{1, [][]color.RGBA{{red, blue}}},
+		{2, [][]color.RGBA{{blue, red}}},
+		{3, [][]color.RGBA{{blue, red}}},
+		{4, [][]color.RGBA{{red, blue}}},
+		{5, [][]color.RGBA{{red}, {blue}}},
+		{6, [][]color.RGBA{{red}, {blue}}},
+		{7, [][]color.RGBA{{blue}, {red}}},
+		{8, [][]color.RGBA{{blue}, {red}}},
+	}
+	for _, tt := range tests {
+		got := applyOrientation(src, tt.orientation)
+		if got.Bounds().Dy() != len(tt.want) || got.Bounds().Dx() != len(tt.want[0]) {
+			t.Errorf("orientation %d: size = %v", tt.orientation, got.Bounds())
+			continue
+		}
+		for y, row := range tt.want {
+			for x, want := range row {
+				if c := color.RGBAModel.Convert(got.At(x, y)).(color.RGBA); c != want {
+					t.Errorf("orientation %d: pixel (%d,%d) = %v, want %v", tt.orientation, x, y, c, want)
+				}
+			}
+		}
+	}
+}
+
+func TestResizeImage(t *testing.T) {
+	tests := []struct {
+		name                string
+		w, h                int
+		maxWidth, maxHeight int
+		wantW, wantH        int
+	}{
+		{"fits", 100, 50, 256, 256, 100, 50},
+		{"landscape", 1000, 500, 256, 256, 256, 128},
+		{"portrait", 500, 1000, 256, 256, 128, 256},
+		{"wide banner", 4000, 3, 256, 256, 256, 1},
+		{"tall strip", 3, 4000, 256, 256, 1, 256},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := resizeImage(image.NewRGBA(image.Rect(0, 0, tt.w, tt.h)), tt.maxWidth, tt.maxHeight)
+			if got.Bounds().Dx() != tt.wantW || got.Bounds().Dy() != tt.wantH {
+				t.Fatalf("resized to %v, want %dx%d", got.Bounds().Size(), tt.wantW, tt.wantH)
+			}
+			var buf bytes.Buffer
+			if err := encodeWebP(&buf, got); err != nil {
+				t.Errorf("encode resized image: %v", err)
+			}
+		})
+	}
+}
+
+func newMultipartUpload(t *testing.T, contentType string, data []byte) *http.Request {
+	t.Helper()
+	var body bytes.Buffer
+	mw := multipart.NewWriter(&body)
+	header := make(map[string][]string)
+	header["Content-Disposition"] = []string{`form-data; name="image"; filename="upload.jpg"`}
+	header["Content-Type"] = []string{contentType}
+	part, err := mw.CreatePart(header)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := part.Write(data); err != nil {
+		t.Fatal(err)
+	}
+	if err := mw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	r := httptest.NewRequest(http.MethodPost, "/material-types/mt/images", &body)
+	r.Header.Set("Content-Type", mw.FormDataContentType())
+	return r
+}
+
+func TestProcessImageUpload(t *testing.T) {
+	tests := []struct {
+		name        string
+		contentType string
+		data        []byte
+		wantStatus  int
+		wantFormat  string
+	}{
+		{name: "png sent as jpeg is sniffed", contentType: "image/jpeg", data: encodeTestPNG(t, 5, 3), wantFormat: "png"},
+		{name: "gif without registered decoder", contentType: "image/gif", data: encodeAnimatedGIF(t), wantFormat: "gif"},
+		{name: "html sent as png", contentType: "image/png", data: []byte("<html></html>"), wantStatus: http.StatusUnsupportedMediaType},
+		{name: "decompression bomb", contentType: "image/png", data: pngHeader(100_000, 100_000), wantStatus: http.StatusRequestEntityTooLarge},
+		{name: "body over limit", contentType: "image/png", data: bytes.Repeat([]byte{0}, maxUploadBytes+1), wantStatus: http.StatusRequestEntityTooLarge},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			local, err := storage.NewLocal(dir)
+			if err != nil {
+				t.Fatal(err)
+			}
+			h := &UploadHandler{Storage: local}
+			w := httptest.NewRecorder()
+
+			input, format, ok := h.processImageUpload(w, newMultipartUpload(t, tt.contentType, tt.data), "mt")
+			if tt.wantStatus != 0 {
+				if ok || w.Code != tt.wantStatus {
+					t.Fatalf("status = %d (ok=%v), want %d: %s", w.Code, ok, tt.wantStatus, w.Body.String())
+				}
+				entries, _ := os.ReadDir(filepath.Join(dir, "material-types"))
+				if len(entries) != 0 {
+					t.Errorf("rejected upload left files behind")
+				}
+				return
+			}
+			if !ok {
+				t.Fatalf("upload rejected with %d: %s", w.Code, w.Body.String())
+			}
+			if format != tt.wantFormat {
+				t.Errorf("format = %q, want %q", format, tt.wantFormat)
+			}
+			if !strings.HasSuffix(input.OriginalURL, "."+tt.wantFormat) {
+				t.Errorf("original URL %q does not use the sniffed format", input.OriginalURL)
+			}
+			if len(input.Variants) != len(imageVariantSizes) {
+				t.Errorf("got %d variants, want %d", len(input.Variants), len(imageVariantSizes))
+			}
+		})
+	}
+}
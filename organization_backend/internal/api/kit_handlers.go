@@ -0,0 +1,216 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"organization_backend/internal/db"
+	"organization_backend/internal/domain"
+
+	"github.com/go-chi/chi/v5"
+)
+
+// KitHandler handles kit related requests
+type KitHandler struct {
+	Store KitStore
+}
+
+// KitStore defines the methods KitHandler needs from Store
+type KitStore interface {
+	ListKits(ctx context.Context, params db.KitAvailabilityParams) ([]domain.Kit, error)
+	GetKitByID(ctx context.Context, id string, params db.KitAvailabilityParams) (domain.Kit, error)
+	CreateKit(ctx context.Context, id string, input db.KitInput) (domain.Kit, error)
+	UpdateKit(ctx context.Context, id string, input db.KitInput) (domain.Kit, error)
+	DeleteKit(ctx context.Context, id string) error
+}
+
+// KitRequest represents the request body for creating or updating a kit
+type KitRequest struct {
+	Name             string                `json:"name"`
+	Description      string                `json:"description"`
+	DefaultClassSize int                   `json:"defaultClassSize"`
+	Components       []domain.KitComponent `json:"components"`
+}
+
+// ListKits returns all kits with availability for the given class size and date range (public)
+func (h *KitHandler) ListKits(w http.ResponseWriter, r *http.Request) {
+	params, err := parseKitAvailabilityParams(r)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "invalid_params", err.Error())
+		return
+	}
+	kits, err := h.Store.ListKits(r.Context(), params)
+	if err != nil {
+		serverError(w, r, err, "list_failed", "Failed to fetch kits")
+		return
+	}
+	writeJSON(w, http.StatusOK, kits)
+}
+
+// GetKit returns a single kit with availability (public)
+func (h *KitHandler) GetKit(w http.ResponseWriter, r *http.Request) {
+	params, err := parseKitAvailabilityParams(r)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "invalid_params", err.Error())
+		return
+	}
+	kit, err := h.Store.GetKitByID(r.Context(), chi.URLParam(r, "id"), params)
+	if errors.Is(err, db.ErrKitNotFound) {
+		writeError(w, http.StatusNotFound, "not_found", "Kit not found")
+		return
+	}
+	if err != nil {
+		serverError(w, r, err, "fetch_failed", "Failed to fetch kit")
+		return
+	}
+	writeJSON(w, http.StatusOK, kit)
+}
+
+// CreateKit creates a new kit (admin only)
+func (h *KitHandler) CreateKit(w http.ResponseWriter, r *http.Request) {
+	input, ok := decodeKitRequest(w, r)
+	if !ok {
+		return
+	}
+
+	id := domain.NormalizeID(input.Name)
+	if id == "" {
+		writeError(w, http.StatusBadRequest, "validation_error", "Name must contain at least one letter or number")
+		return
+	}
+
+	kit, err := h.Store.CreateKit(r.Context(), id, input)
+	if writeKitStoreError(w, r, err, "create_failed", "Failed to create kit") {
+		return
+	}
+	writeJSON(w, http.StatusCreated, kit)
+}
+
+// UpdateKit replaces a kit's fields and components (admin only)
+func (h *KitHandler) UpdateKit(w http.ResponseWriter, r *http.Request) {
+	input, ok := decodeKitRequest(w, r)
+	if !ok {
+		return
+	}
+
+	kit, err := h.Store.UpdateKit(r.Context(), chi.URLParam(r, "id"), input)
+	if writeKitStoreError(w, r, err, "update_failed", "Failed to update kit") {
+		return
+	}
+	writeJSON(w, http.StatusOK, kit)
+}
+
+// DeleteKit deletes a kit that was never requested (admin only)
+func (h *KitHandler) DeleteKit(w http.ResponseWriter, r *http.Request) {
+	err := h.Store.DeleteKit(r.Context(), chi.URLParam(r, "id"))
+	var inUse db.KitInUseError
+	if errors.As(err, &inUse) {
+		writeError(w, http.StatusConflict, "kit_in_use", fmt.Sprintf(
+			"Kit is referenced by %d request(s) and cannot be deleted", inUse.RequestCount,
+		))
+		return
+	}
+	if writeKitStoreError(w, r, err, "delete_failed", "Failed to delete kit") {
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]string{"status": "deleted"})
+}
+
+func decodeKitRequest(w http.ResponseWriter, r *http.Request) (db.KitInput, bool) {
+	var req KitRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, http.StatusBadRequest, "invalid_json", "Invalid JSON body")
+		return db.KitInput{}, false
+	}
+
+	if strings.TrimSpace(req.Name) == "" {
+		writeError(w, http.StatusBadRequest, "validation_error", "Name is required")
+		return db.KitInput{}, false
+	}
+	if req.DefaultClassSize <= 0 {
+		req.DefaultClassSize = 1
+	}
+	if len(req.Components) == 0 {
+		writeError(w, http.StatusBadRequest, "validation_error", "At least one component is required")
+		return db.KitInput{}, false
+	}
+	seen := map[string]bool{}
+	for _, c := range req.Components {
+		if strings.TrimSpace(c.MaterialTypeID) == "" {
+			writeError(w, http.StatusBadRequest, "validation_error", "Component materialTypeId is required")
+			return db.KitInput{}, false
+		}
+		if seen[c.MaterialTypeID] {
+			writeError(w, http.StatusBadRequest, "validation_error", "Component material types must be unique")
+			return db.KitInput{}, false
+		}
+		seen[c.MaterialTypeID] = true
+		if c.Quantity <= 0 {
+			writeError(w, http.StatusBadRequest, "validation_error", "Component quantity must be positive")
+			return db.KitInput{}, false
+		}
+		if c.PerParticipants < 0 {
+			writeError(w, http.StatusBadRequest, "validation_error", "Component perParticipants must not be negative")
+			return db.KitInput{}, false
+		}
+	}
+
+	return db.KitInput{
+		Name:             strings.TrimSpace(req.Name),
+		Description:      req.Description,
+		DefaultClassSize: req.DefaultClassSize,
+		Components:       req.Components,
+	}, true
+}
+
+// writeKitStoreError writes the response for a kit store error and reports whether one was written
+func writeKitStoreError(w http.ResponseWriter, r *http.Request, err error, code, message string) bool {
+	var unavailable db.UnavailableMaterialTypesError
+	switch {
+	case err == nil:
+		return false
+	case errors.Is(err, db.ErrKitNotFound):
+		writeError(w, http.StatusNotFound, "not_found", "Kit not found")
+	case errors.Is(err, db.ErrKitExists):
+		writeError(w, http.StatusConflict, "conflict", "A kit with this name already exists")
+	case errors.As(err, &unavailable):
+		writeError(w, http.StatusBadRequest, "validation_error", "Unknown or archived material types: "+strings.Join(unavailable.IDs, ", "))
+	default:
+		serverError(w, r, err, code, message)
+	}
+	return true
+}
+
+func parseKitAvailabilityParams(r *http.Request) (db.KitAvailabilityParams, error) {
+	q := r.URL.Query()
+
+	var params db.KitAvailabilityParams
+	if q.Get("classSize") != "" {
+		parsed, err := strconv.Atoi(q.Get("classSize"))
+		if err != nil || parsed <= 0 {
+			return db.KitAvailabilityParams{}, errors.New("classSize must be positive number")
+		}
+		params.ClassSize = parsed
+	}
+	if q.Get("availableFrom") != "" {
+		ts, err := time.Parse(time.RFC3339, q.Get("availableFrom"))
+		if err != nil {
+			return db.KitAvailabilityParams{}, errors.New("invalid availableFrom")
+		}
+		params.From = &ts
+	}
+	if q.Get("availableTo") != "" {
+		ts, err := time.Parse(time.RFC3339, q.Get("availableTo"))
+		if err != nil {
+			return db.KitAvailabilityParams{}, errors.New("invalid availableTo")
+		}
+		params.To = &ts
+	}
+	return params, nil
+}
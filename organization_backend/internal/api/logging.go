@@ -0,0 +1,139 @@
+package api
+
+import (
+	"context"
+	"log/slog"
+	"net/http"
+	"time"
+
+	"organization_backend/internal/logging"
+	"organization_backend/internal/tracing"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/go-chi/chi/v5/middleware"
+	"github.com/google/uuid"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// requestIDHeader carries the correlation ID of a request
+const requestIDHeader = "X-Request-ID"
+
+// maxRequestIDLength bounds request IDs taken from clients and proxies
+const maxRequestIDLength = 128
+
+// RequestID takes the request ID from the X-Request-ID header or generates
+// one, stores it in the context and echoes it in the response. IDs that are
+// too long or contain characters other than letters, digits and -_.: are
+// replaced so they cannot forge log lines.
+func RequestID(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		id := r.Header.Get(requestIDHeader)
+		if !validRequestID(id) {
+			id = uuid.NewString()
+		}
+		w.Header().Set(requestIDHeader, id)
+		ctx := context.WithValue(r.Context(), middleware.RequestIDKey, id)
+		next.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
+
+func validRequestID(id string) bool {
+	if id == "" || len(id) > maxRequestIDLength {
+		return false
+	}
+	for _, c := range id {
+		switch {
+		case c >= 'a' && c <= 'z', c >= 'A' && c <= 'Z', c >= '0' && c <= '9':
+		case c == '-', c == '_', c == '.', c == ':':
+		default:
+			return false
+		}
+	}
+	return true
+}
+
+type requestLogKey struct{}
+
+// requestLog collects fields for the access log that are only known deeper
+// in the middleware chain
+type requestLog struct {
+	userID string
+}
+
+// probeRoutes are the health probes, logged at debug level unless failing
+var probeRoutes = map[string]bool{"/healthz": true, "/readyz": true}
+
+// RequestLogger attaches a logger tagged with the request and trace IDs to
+// the context and logs every request with its method, route pattern, status,
+// latency and user. It must come after RequestID and Tracing.
+func RequestLogger(logger *slog.Logger) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			start := time.Now()
+			reqLogger := logger.With("request_id", middleware.GetReqID(r.Context()))
+			if sc := trace.SpanContextFromContext(r.Context()); sc.IsValid() {
+				reqLogger = reqLogger.With("trace_id", sc.TraceID().String(), "span_id", sc.SpanID().String())
+			}
+			entry := &requestLog{}
+			ctx := logging.WithLogger(r.Context(), reqLogger)
+			ctx = context.WithValue(ctx, requestLogKey{}, entry)
+
+			ww := middleware.NewWrapResponseWriter(w, r.ProtoMajor)
+			next.ServeHTTP(ww, r.WithContext(ctx))
+
+			status := ww.Status()
+			if status == 0 {
+				status = http.StatusOK
+			}
+			route := ""
+			if rctx := chi.RouteContext(r.Context()); rctx != nil {
+				route = rctx.RoutePattern()
+			}
+			level := slog.LevelInfo
+			switch {
+			case probeRoutes[route] && status == http.StatusOK:
+				// Orchestrators poll these every few seconds
+				level = slog.LevelDebug
+			case probeRoutes[route]:
+				level = slog.LevelWarn
+			case status >= http.StatusInternalServerError:
+				level = slog.LevelError
+			}
+			reqLogger.LogAttrs(r.Context(), level, "request",
+				slog.String("method", r.Method),
+				slog.String("route", route),
+				slog.String("path", r.URL.Path),
+				slog.Int("status", status),
+				slog.Int("bytes", ww.BytesWritten()),
+				slog.Float64("duration_ms", float64(time.Since(start).Microseconds())/1000),
+				slog.String("user_id", entry.userID),
+				slog.String("ip", clientIP(r)),
+			)
+		})
+	}
+}
+
+// withLogUser adds the authenticated user to the request logger and the
+// access log entry
+func withLogUser(ctx context.Context, userID string) context.Context {
+	if entry, ok := ctx.Value(requestLogKey{}).(*requestLog); ok {
+		entry.userID = userID
+	}
+	return logging.WithLogger(ctx, logging.FromContext(ctx).With("user_id", userID))
+}
+
+// serverError logs err with the request logger and sends the client a
+// generic message without internal details. The trace ID is included so that
+// users can quote it when reporting the problem.
+func serverError(w http.ResponseWriter, r *http.Request, err error, code, message string) {
+	logging.FromContext(r.Context()).Error(message, "code", code, "error", err)
+	tracing.RecordError(trace.SpanFromContext(r.Context()), err)
+	body := map[string]string{
+		"error":   code,
+		"message": message,
+	}
+	if traceID := tracing.TraceIDFromContext(r.Context()); traceID != "" {
+		body["traceId"] = traceID
+	}
+	writeJSON(w, http.StatusInternalServerError, body)
+}
@@ -3,40 +3,121 @@ package api
 import (
 	"context"
 	"encoding/json"
+	"errors"
+	"fmt"
 	"net/http"
-	"regexp"
+	"strconv"
 	"strings"
+	"time"
 
+	"organization_backend/internal/db"
 	"organization_backend/internal/domain"
+	"organization_backend/internal/storage"
+	"organization_backend/pkg/pagination"
 
 	"github.com/go-chi/chi/v5"
 )
 
 // MaterialTypeHandler handles material type related requests
 type MaterialTypeHandler struct {
-	Store      StoreInterface
-	UploadPath string
+	Store   StoreInterface
+	Storage storage.Storage
 }
 
 // StoreInterface defines the methods needed from Store
 type StoreInterface interface {
 	ListMaterialTypes(ctx context.Context) ([]domain.MaterialType, error)
-	ListMaterialTypesWithAvailability(ctx context.Context) ([]domain.MaterialType, error)
+	ListMaterialTypesWithAvailability(ctx context.Context, params db.ListMaterialTypesParams) (db.ListMaterialTypesResult, error)
 	GetMaterialTypeByID(ctx context.Context, id string) (domain.MaterialType, error)
-	CreateMaterialType(ctx context.Context, id, name, description, imageURL string) (domain.MaterialType, error)
-	UpdateMaterialType(ctx context.Context, id, name, description string) (domain.MaterialType, error)
+	CreateMaterialType(ctx context.Context, id string, input domain.CreateMaterialTypeInput) (domain.MaterialType, error)
+	UpdateMaterialType(ctx context.Context, id string, input domain.UpdateMaterialTypeInput) (domain.MaterialType, error)
 	UpdateMaterialTypeImage(ctx context.Context, id, imageURL string) error
+	ArchiveMaterialType(ctx context.Context, id string) (domain.MaterialType, error)
+	RestoreMaterialType(ctx context.Context, id string) (domain.MaterialType, error)
 	DeleteMaterialType(ctx context.Context, id string) error
+	ListMaterialTypeImages(ctx context.Context, materialTypeID string) ([]domain.MaterialTypeImage, error)
+	AddMaterialTypeImage(ctx context.Context, materialTypeID string, input db.MaterialTypeImageInput) (domain.MaterialTypeImage, error)
+	ReplacePrimaryMaterialTypeImage(ctx context.Context, materialTypeID string, input db.MaterialTypeImageInput) (domain.MaterialTypeImage, *domain.MaterialTypeImage, error)
+	UpdateMaterialTypeImageAltText(ctx context.Context, materialTypeID, imageID, altText string) (domain.MaterialTypeImage, error)
+	ReorderMaterialTypeImages(ctx context.Context, materialTypeID string, imageIDs []string) ([]domain.MaterialTypeImage, error)
+	DeleteMaterialTypeImage(ctx context.Context, materialTypeID, imageID string) (domain.MaterialTypeImage, error)
 }
 
-// ListMaterialTypes returns all material types with availability counts (public)
+// ListMaterialTypes returns active material types with availability counts (public).
+// Supports filtering by category, tag, text search and availability in a date range.
+// When limit or cursor is given the result is paginated and the cursor for the
+// next page is returned in the X-Next-Cursor header.
 func (h *MaterialTypeHandler) ListMaterialTypes(w http.ResponseWriter, r *http.Request) {
-	materialTypes, err := h.Store.ListMaterialTypesWithAvailability(r.Context())
+	params, err := parseMaterialTypeListParams(r)
 	if err != nil {
-		writeError(w, http.StatusInternalServerError, "list_failed", "Failed to fetch material types")
+		writeError(w, http.StatusBadRequest, "invalid_params", err.Error())
 		return
 	}
-	writeJSON(w, http.StatusOK, materialTypes)
+
+	result, err := h.Store.ListMaterialTypesWithAvailability(r.Context(), params)
+	if err != nil {
+		serverError(w, r, err, "list_failed", "Failed to fetch material types")
+		return
+	}
+	if result.NextCursor != "" {
+		w.Header().Set("X-Next-Cursor", result.NextCursor)
+	}
+	writeJSON(w, http.StatusOK, result.MaterialTypes)
+}
+
+func parseMaterialTypeListParams(r *http.Request) (db.ListMaterialTypesParams, error) {
+	q := r.URL.Query()
+
+	limit := 0
+	if q.Get("limit") != "" {
+		parsed, err := strconv.Atoi(q.Get("limit"))
+		if err != nil || parsed <= 0 {
+			return db.ListMaterialTypesParams{}, errors.New("limit must be positive number")
+		}
+		limit = parsed
+	}
+
+	var cursor *pagination.KeyCursor
+	if q.Get("cursor") != "" {
+		parsed, err := pagination.DecodeKey(q.Get("cursor"))
+		if err != nil {
+			return db.ListMaterialTypesParams{}, errors.New("invalid cursor")
+		}
+		cursor = &parsed
+		if limit == 0 {
+			limit = 50
+		}
+	}
+
+	var from *time.Time
+	if q.Get("availableFrom") != "" {
+		ts, err := time.Parse(time.RFC3339, q.Get("availableFrom"))
+		if err != nil {
+			return db.ListMaterialTypesParams{}, errors.New("invalid availableFrom")
+		}
+		from = &ts
+	}
+	var to *time.Time
+	if q.Get("availableTo") != "" {
+		ts, err := time.Parse(time.RFC3339, q.Get("availableTo"))
+		if err != nil {
+			return db.ListMaterialTypesParams{}, errors.New("invalid availableTo")
+		}
+		to = &ts
+	}
+	if from != nil && to != nil && to.Before(*from) {
+		return db.ListMaterialTypesParams{}, errors.New("availableTo must not be before availableFrom")
+	}
+
+	return db.ListMaterialTypesParams{
+		Limit:         limit,
+		Cursor:        cursor,
+		CategoryID:    strings.TrimSpace(q.Get("category")),
+		Tags:          domain.NormalizeTags(q["tag"]),
+		Query:         strings.TrimSpace(q.Get("q")),
+		AvailableFrom: from,
+		AvailableTo:   to,
+	}, nil
 }
 
 // GetMaterialType returns a single material type by ID (public)
@@ -52,9 +133,11 @@ func (h *MaterialTypeHandler) GetMaterialType(w http.ResponseWriter, r *http.Req
 
 // CreateMaterialTypeRequest represents the request body for creating a material type
 type CreateMaterialTypeRequest struct {
-	Name        string `json:"name"`
-	Description string `json:"description"`
-	ImageURL    string `json:"imageUrl"`
+	Name        string   `json:"name"`
+	Description string   `json:"description"`
+	ImageURL    string   `json:"imageUrl"`
+	CategoryID  string   `json:"categoryId"`
+	Tags        []string `json:"tags"`
 }
 
 // CreateMaterialType creates a new material type (admin only)
@@ -76,7 +159,7 @@ func (h *MaterialTypeHandler) CreateMaterialType(w http.ResponseWriter, r *http.
 	}
 
 	// Generate ID from name: lowercase, replace spaces with underscores, remove special chars
-	id := generateMaterialTypeID(req.Name)
+	id := domain.NormalizeID(req.Name)
 
 	// Validate that the generated ID is not empty
 	if id == "" {
@@ -84,9 +167,19 @@ func (h *MaterialTypeHandler) CreateMaterialType(w http.ResponseWriter, r *http.
 		return
 	}
 
-	mt, err := h.Store.CreateMaterialType(r.Context(), id, req.Name, req.Description, req.ImageURL)
+	mt, err := h.Store.CreateMaterialType(r.Context(), id, domain.CreateMaterialTypeInput{
+		Name:        req.Name,
+		Description: req.Description,
+		ImageURL:    req.ImageURL,
+		CategoryID:  strings.TrimSpace(req.CategoryID),
+		Tags:        domain.NormalizeTags(req.Tags),
+	})
+	if errors.Is(err, db.ErrCategoryNotFound) {
+		writeError(w, http.StatusBadRequest, "validation_error", "Category does not exist")
+		return
+	}
 	if err != nil {
-		writeError(w, http.StatusInternalServerError, "create_failed", "Failed to create material type")
+		serverError(w, r, err, "create_failed", "Failed to create material type")
 		return
 	}
 
@@ -94,9 +187,12 @@ func (h *MaterialTypeHandler) CreateMaterialType(w http.ResponseWriter, r *http.
 }
 
 // UpdateMaterialTypeRequest represents the request body for updating a material type
+// Omitted categoryId or tags leave the current value unchanged
 type UpdateMaterialTypeRequest struct {
-	Name        string `json:"name"`
-	Description string `json:"description"`
+	Name        string   `json:"name"`
+	Description string   `json:"description"`
+	CategoryID  *string  `json:"categoryId"`
+	Tags        []string `json:"tags"`
 }
 
 // UpdateMaterialType updates an existing material type (admin only)
@@ -119,40 +215,93 @@ func (h *MaterialTypeHandler) UpdateMaterialType(w http.ResponseWriter, r *http.
 		return
 	}
 
-	mt, err := h.Store.UpdateMaterialType(r.Context(), id, req.Name, req.Description)
+	input := domain.UpdateMaterialTypeInput{
+		Name:        req.Name,
+		Description: req.Description,
+	}
+	if req.CategoryID != nil {
+		categoryID := strings.TrimSpace(*req.CategoryID)
+		input.CategoryID = &categoryID
+	}
+	if req.Tags != nil {
+		input.Tags = domain.NormalizeTags(req.Tags)
+	}
+
+	mt, err := h.Store.UpdateMaterialType(r.Context(), id, input)
+	if errors.Is(err, db.ErrMaterialTypeNotFound) {
+		writeError(w, http.StatusNotFound, "not_found", "Material type not found")
+		return
+	}
+	if errors.Is(err, db.ErrCategoryNotFound) {
+		writeError(w, http.StatusBadRequest, "validation_error", "Category does not exist")
+		return
+	}
 	if err != nil {
-		writeError(w, http.StatusInternalServerError, "update_failed", "Failed to update material type")
+		serverError(w, r, err, "update_failed", "Failed to update material type")
 		return
 	}
 
 	writeJSON(w, http.StatusOK, mt)
 }
 
-// DeleteMaterialType deletes a material type (admin only)
-func (h *MaterialTypeHandler) DeleteMaterialType(w http.ResponseWriter, r *http.Request) {
+// ArchiveMaterialType retires a material type so it can no longer be requested (admin only)
+func (h *MaterialTypeHandler) ArchiveMaterialType(w http.ResponseWriter, r *http.Request) {
 	id := chi.URLParam(r, "id")
 
-	if err := h.Store.DeleteMaterialType(r.Context(), id); err != nil {
-		writeError(w, http.StatusInternalServerError, "delete_failed", "Failed to delete material type")
+	mt, err := h.Store.ArchiveMaterialType(r.Context(), id)
+	if errors.Is(err, db.ErrMaterialTypeNotFound) {
+		writeError(w, http.StatusNotFound, "not_found", "Material type not found")
+		return
+	}
+	if err != nil {
+		serverError(w, r, err, "archive_failed", "Failed to archive material type")
 		return
 	}
 
-	writeJSON(w, http.StatusOK, map[string]string{"status": "deleted"})
+	writeJSON(w, http.StatusOK, mt)
+}
+
+// RestoreMaterialType makes an archived material type requestable again (admin only)
+func (h *MaterialTypeHandler) RestoreMaterialType(w http.ResponseWriter, r *http.Request) {
+	id := chi.URLParam(r, "id")
+
+	mt, err := h.Store.RestoreMaterialType(r.Context(), id)
+	if errors.Is(err, db.ErrMaterialTypeNotFound) {
+		writeError(w, http.StatusNotFound, "not_found", "Material type not found")
+		return
+	}
+	if err != nil {
+		serverError(w, r, err, "restore_failed", "Failed to restore material type")
+		return
+	}
+
+	writeJSON(w, http.StatusOK, mt)
 }
 
-// generateMaterialTypeID creates a URL-friendly ID from a name
-func generateMaterialTypeID(name string) string {
-	// Convert to lowercase
-	id := strings.ToLower(name)
-	// Replace spaces with underscores
-	id = strings.ReplaceAll(id, " ", "_")
-	// Remove special characters, keep only alphanumeric and underscores
-	re := regexp.MustCompile(`[^a-z0-9_]`)
-	id = re.ReplaceAllString(id, "")
-	// Remove consecutive underscores
-	re = regexp.MustCompile(`_+`)
-	id = re.ReplaceAllString(id, "_")
-	// Trim underscores from start and end
-	id = strings.Trim(id, "_")
-	return id
+// DeleteMaterialType hard-deletes a material type that was never used (admin only).
+// Material types referenced by requests or stock must be archived instead.
+func (h *MaterialTypeHandler) DeleteMaterialType(w http.ResponseWriter, r *http.Request) {
+	id := chi.URLParam(r, "id")
+
+	err := h.Store.DeleteMaterialType(r.Context(), id)
+	var inUse db.MaterialTypeInUseError
+	switch {
+	case errors.Is(err, db.ErrMaterialTypeNotFound):
+		writeError(w, http.StatusNotFound, "not_found", "Material type not found")
+		return
+	case errors.As(err, &inUse):
+		writeError(w, http.StatusConflict, "material_type_in_use", fmt.Sprintf(
+			"Material type is referenced by %d request(s), stocked at %d distribution center(s) and part of %d kit(s); archive it instead of deleting it",
+			inUse.RequestCount, inUse.StockCount, inUse.KitCount,
+		))
+		return
+	case err != nil:
+		serverError(w, r, err, "delete_failed", "Failed to delete material type")
+		return
+	}
+
+	// The images were removed by the cascading delete, so their files are orphaned
+	removeMaterialTypeFiles(r.Context(), h.Storage, id)
+
+	writeJSON(w, http.StatusOK, map[string]string{"status": "deleted"})
 }
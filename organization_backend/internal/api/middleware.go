@@ -1,18 +1,197 @@
 package api
 
-import "net/http"
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/http"
+	"net/netip"
+	"strings"
+	"time"
 
-func CORS(next http.Handler) http.Handler {
-	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		w.Header().Set("Access-Control-Allow-Origin", "*")
-		w.Header().Set("Access-Control-Allow-Methods", "GET, POST, PUT, DELETE, OPTIONS")
-		w.Header().Set("Access-Control-Allow-Headers", "Content-Type, Authorization")
+	"organization_backend/internal/audit"
+
+	"github.com/go-chi/chi/v5/middleware"
+)
+
+// CORSConfig configures which browser origins may call the API
+type CORSConfig struct {
+	// AllowedOrigins are the allowed origins such as https://app.example.org;
+	// "*" allows every origin
+	AllowedOrigins   []string
+	AllowCredentials bool
+	// MaxAge is how long browsers may cache preflight responses
+	MaxAge time.Duration
+}
+
+const (
+	corsAllowedMethods = "GET, POST, PUT, PATCH, DELETE, OPTIONS"
+	corsAllowedHeaders = "Content-Type, Authorization, Idempotency-Key, X-Request-ID"
+	corsExposedHeaders = "Content-Disposition, Retry-After, Idempotent-Replayed, X-Request-ID"
+)
 
-		if r.Method == "OPTIONS" {
-			w.WriteHeader(http.StatusOK)
-			return
+// CORS answers preflight requests and allows cross-origin requests from the
+// configured origins. Requests from other origins get no CORS headers, so
+// browsers block them.
+func CORS(cfg CORSConfig) func(http.Handler) http.Handler {
+	allowed := make(map[string]bool, len(cfg.AllowedOrigins))
+	for _, origin := range cfg.AllowedOrigins {
+		allowed[origin] = true
+	}
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			origin := r.Header.Get("Origin")
+			preflight := r.Method == http.MethodOptions && r.Header.Get("Access-Control-Request-Method") != ""
+			w.Header().Add("Vary", "Origin")
+
+			if origin == "" || !(allowed[origin] || allowed["*"]) {
+				if preflight {
+					w.WriteHeader(http.StatusNoContent)
+					return
+				}
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			if allowed["*"] && !cfg.AllowCredentials {
+				w.Header().Set("Access-Control-Allow-Origin", "*")
+			} else {
+				w.Header().Set("Access-Control-Allow-Origin", origin)
+			}
+			if cfg.AllowCredentials {
+				w.Header().Set("Access-Control-Allow-Credentials", "true")
+			}
+			if !preflight {
+				w.Header().Set("Access-Control-Expose-Headers", corsExposedHeaders)
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			w.Header().Add("Vary", "Access-Control-Request-Method")
+			w.Header().Add("Vary", "Access-Control-Request-Headers")
+			w.Header().Set("Access-Control-Allow-Methods", corsAllowedMethods)
+			w.Header().Set("Access-Control-Allow-Headers", corsAllowedHeaders)
+			if cfg.MaxAge > 0 {
+				w.Header().Set("Access-Control-Max-Age", fmt.Sprint(int(cfg.MaxAge.Seconds())))
+			}
+			w.WriteHeader(http.StatusNoContent)
+		})
+	}
+}
+
+// hstsMaxAge is how long browsers remember to only use HTTPS
+const hstsMaxAge = 365 * 24 * time.Hour
+
+// SecurityHeaders sets headers that keep browsers from sniffing content
+// types, framing responses or leaking URLs in referrers. HSTS is only sent
+// over HTTPS, so local development over plain HTTP is unaffected.
+func SecurityHeaders(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		h := w.Header()
+		h.Set("X-Content-Type-Options", "nosniff")
+		h.Set("X-Frame-Options", "DENY")
+		h.Set("Referrer-Policy", "strict-origin-when-cross-origin")
+		if isHTTPS(r) {
+			h.Set("Strict-Transport-Security", fmt.Sprintf("max-age=%d; includeSubDomains", int(hstsMaxAge.Seconds())))
 		}
+		next.ServeHTTP(w, r)
+	})
+}
 
+// UploadSecurityHeaders keeps uploaded files from running scripts when
+// opened directly, e.g. an SVG with embedded JavaScript, while still letting
+// the frontends on other origins embed them
+func UploadSecurityHeaders(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Security-Policy", "default-src 'none'; img-src 'self' data:; style-src 'unsafe-inline'; sandbox")
+		w.Header().Set("Cross-Origin-Resource-Policy", "cross-origin")
 		next.ServeHTTP(w, r)
 	})
 }
+
+type clientKey struct{}
+
+type client struct {
+	ip    string
+	https bool
+}
+
+// TrustedProxies determines the client IP and scheme of a request. The
+// X-Forwarded-For and X-Forwarded-Proto headers are only believed when the
+// connection comes from one of the trusted proxies; X-Forwarded-For is read
+// from the right, skipping further trusted proxies, so clients cannot spoof
+// their address by sending the header themselves.
+func TrustedProxies(proxies []netip.Prefix) func(http.Handler) http.Handler {
+	trusted := func(ip string) bool {
+		addr, err := netip.ParseAddr(ip)
+		if err != nil {
+			return false
+		}
+		addr = addr.Unmap()
+		for _, prefix := range proxies {
+			if prefix.Contains(addr) {
+				return true
+			}
+		}
+		return false
+	}
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			c := client{ip: remoteIP(r), https: r.TLS != nil}
+			if trusted(c.ip) {
+				forwarded := strings.Split(strings.Join(r.Header.Values("X-Forwarded-For"), ","), ",")
+				for i := len(forwarded) - 1; i >= 0; i-- {
+					ip := strings.TrimSpace(forwarded[i])
+					if ip == "" {
+						continue
+					}
+					c.ip = ip
+					if !trusted(ip) {
+						break
+					}
+				}
+				if proto := r.Header.Get("X-Forwarded-Proto"); proto != "" {
+					c.https = strings.EqualFold(strings.TrimSpace(strings.Split(proto, ",")[0]), "https")
+				}
+			}
+			next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), clientKey{}, c)))
+		})
+	}
+}
+
+// AuditContext attaches the request ID and client IP to the context so that
+// store mutations can record them in the audit log
+func AuditContext(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ctx := audit.WithActor(r.Context(), audit.Actor{
+			RequestID: middleware.GetReqID(r.Context()),
+			IP:        clientIP(r),
+		})
+		next.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
+
+// clientIP returns the IP address of the client that sent a request as
+// determined by TrustedProxies
+func clientIP(r *http.Request) string {
+	if c, ok := r.Context().Value(clientKey{}).(client); ok {
+		return c.ip
+	}
+	return remoteIP(r)
+}
+
+// isHTTPS reports whether the client connected over HTTPS
+func isHTTPS(r *http.Request) bool {
+	if c, ok := r.Context().Value(clientKey{}).(client); ok {
+		return c.https
+	}
+	return r.TLS != nil
+}
+
+func remoteIP(r *http.Request) string {
+	ip, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return ip
+}
@@ -0,0 +1,196 @@
+package api
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"image/png"
+	"io"
+	"net/http"
+	"sort"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+
+	"organization_backend/internal/db"
+	"organization_backend/internal/domain"
+	"organization_backend/internal/packingslip"
+	"organization_backend/internal/service"
+	"organization_backend/internal/storage"
+	"organization_backend/pkg/pagination"
+)
+
+// packingSlipThumbSize is the maximum edge length of thumbnails embedded in packing slips
+const packingSlipThumbSize = 160
+
+// PackingSlipHandler renders printable packing slips for requests
+type PackingSlipHandler struct {
+	Service *service.RequestService
+	Store   PackingSlipStore
+	Storage storage.Storage
+	// AppURL is the user frontend base URL the QR codes link to
+	AppURL string
+	// Location is the time zone delivery dates are printed and grouped in
+	Location *time.Location
+}
+
+// PackingSlipStore defines the methods PackingSlipHandler needs from Store
+type PackingSlipStore interface {
+	ListMaterialTypes(ctx context.Context) ([]domain.MaterialType, error)
+	SchoolRole(ctx context.Context, schoolID, userID string) (string, error)
+}
+
+// GetPackingSlip renders the packing slip of a single request. Customers can
+// only print slips for their own requests and those of their schools.
+func (h *PackingSlipHandler) GetPackingSlip(w http.ResponseWriter, r *http.Request) {
+	claims := GetClaimsFromContext(r.Context())
+	if claims == nil {
+		writeError(w, http.StatusUnauthorized, "unauthorized", "Authentication required")
+		return
+	}
+
+	req, err := h.Service.GetRequestByID(r.Context(), chi.URLParam(r, "id"))
+	if err != nil {
+		writeError(w, http.StatusNotFound, "not_found", "Request not found")
+		return
+	}
+	if !claims.IsAdmin && req.Customer.ID != claims.CustomerID {
+		role := ""
+		if req.SchoolID != "" {
+			role, err = h.Store.SchoolRole(r.Context(), req.SchoolID, claims.CustomerID)
+		}
+		if err != nil || role == "" {
+			writeError(w, http.StatusNotFound, "not_found", "Request not found")
+			return
+		}
+	}
+
+	h.render(w, r, []domain.Request{req}, fmt.Sprintf("packliste-%s.pdf", req.ID))
+}
+
+// ListPackingSlips renders one PDF with the packing slips of all requests
+// delivered on the day given by the date query parameter (YYYY-MM-DD).
+// Returned requests are skipped.
+func (h *PackingSlipHandler) ListPackingSlips(w http.ResponseWriter, r *http.Request) {
+	day, err := time.ParseInLocation("2006-01-02", r.URL.Query().Get("date"), h.location())
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "invalid_params", "date must be formatted as YYYY-MM-DD")
+		return
+	}
+	from := day
+	to := day.AddDate(0, 0, 1).Add(-time.Microsecond)
+	params := db.ListRequestsParams{Limit: exportPageSize, From: &from, To: &to}
+
+	var requests []domain.Request
+	for {
+		page, err := h.Service.ListRequests(r.Context(), params)
+		if err != nil {
+			serverError(w, r, err, "list_failed", "Failed to fetch requests")
+			return
+		}
+		for _, req := range page.Requests {
+			if req.Status != "returned" {
+				requests = append(requests, req)
+			}
+		}
+		if page.NextCursor == "" {
+			break
+		}
+		cursor, err := pagination.Decode(page.NextCursor)
+		if err != nil {
+			serverError(w, r, err, "list_failed", "Failed to fetch requests")
+			return
+		}
+		params.Cursor = &cursor
+	}
+	// Oldest requests first so the stack matches the order they came in
+	sort.SliceStable(requests, func(i, j int) bool { return requests[i].CreatedAt.Before(requests[j].CreatedAt) })
+
+	h.render(w, r, requests, fmt.Sprintf("packlisten-%s.pdf", day.Format("2006-01-02")))
+}
+
+func (h *PackingSlipHandler) render(w http.ResponseWriter, r *http.Request, requests []domain.Request, filename string) {
+	materialTypes, err := h.Store.ListMaterialTypes(r.Context())
+	if err != nil {
+		serverError(w, r, err, "render_failed", "Failed to fetch material types")
+		return
+	}
+	byID := make(map[string]domain.MaterialType, len(materialTypes))
+	for _, mt := range materialTypes {
+		byID[mt.ID] = mt
+	}
+
+	thumbnails := map[string]*packingslip.Image{}
+	slips := make([]packingslip.Slip, 0, len(requests))
+	for _, req := range requests {
+		slip := packingslip.Slip{Request: req, URL: fmt.Sprintf("%s/requests/%s", h.AppURL, req.ID)}
+		for id, quantity := range req.Items {
+			if quantity <= 0 {
+				continue
+			}
+			mt, ok := byID[id]
+			name := mt.Name
+			if !ok {
+				name = id
+			}
+			thumb, loaded := thumbnails[id]
+			if !loaded && mt.ImageURL != "" {
+				thumb = h.loadThumbnail(r.Context(), mt.ImageURL)
+				thumbnails[id] = thumb
+			}
+			slip.Items = append(slip.Items, packingslip.Item{MaterialTypeID: id, Name: name, Quantity: quantity, Image: thumb})
+		}
+		sort.Slice(slip.Items, func(i, j int) bool { return slip.Items[i].Name < slip.Items[j].Name })
+		slips = append(slips, slip)
+	}
+
+	// Render into a buffer so failures can still be reported as JSON
+	var buf bytes.Buffer
+	if err := packingslip.Render(&buf, slips, h.location()); err != nil {
+		serverError(w, r, err, "render_failed", "Failed to render packing slip")
+		return
+	}
+	w.Header().Set("Content-Type", "application/pdf")
+	w.Header().Set("Content-Disposition", fmt.Sprintf(`inline; filename="%s"`, filename))
+	w.Header().Set("Content-Length", fmt.Sprint(buf.Len()))
+	w.WriteHeader(http.StatusOK)
+	_, _ = buf.WriteTo(w)
+}
+
+// loadThumbnail fetches a material type image from storage and converts it to
+// a small PNG, since the PDF renderer cannot embed WebP. Missing or broken
+// images are left out of the slip.
+func (h *PackingSlipHandler) loadThumbnail(ctx context.Context, url string) *packingslip.Image {
+	if h.Storage == nil {
+		return nil
+	}
+	key, ok := h.Storage.KeyFromURL(url)
+	if !ok {
+		return nil
+	}
+	rc, _, err := h.Storage.Get(ctx, key)
+	if err != nil {
+		return nil
+	}
+	defer rc.Close()
+	data, err := io.ReadAll(io.LimitReader(rc, maxUploadBytes))
+	if err != nil {
+		return nil
+	}
+	img, err := decodeUploadedImage(data)
+	if err != nil {
+		return nil
+	}
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, resizeImage(img.Image, packingSlipThumbSize, packingSlipThumbSize)); err != nil {
+		return nil
+	}
+	return &packingslip.Image{Data: buf.Bytes(), Type: "PNG"}
+}
+
+func (h *PackingSlipHandler) location() *time.Location {
+	if h.Location == nil {
+		return time.UTC
+	}
+	return h.Location
+}
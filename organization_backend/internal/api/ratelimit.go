@@ -0,0 +1,128 @@
+package api
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"strings"
+	"time"
+
+	"organization_backend/internal/logging"
+	"organization_backend/internal/ratelimit"
+)
+
+// maxRateLimitBodyBytes is how much of a body is read to find a rate limit key
+const maxRateLimitBodyBytes = 64 << 10
+
+// RateLimits are the limits applied to the route groups. A zero limit
+// disables the check.
+type RateLimits struct {
+	// MagicLinkPerIP and MagicLinkPerEmail limit sending login emails
+	MagicLinkPerIP    ratelimit.Limit
+	MagicLinkPerEmail ratelimit.Limit
+	// CallbackPerIP limits login attempts with a magic link code
+	CallbackPerIP ratelimit.Limit
+	// CallbackFailures is the number of failed logins per email and IP after
+	// which further attempts are locked out until the bucket refills
+	CallbackFailures ratelimit.Limit
+	// Public limits unauthenticated reads such as the catalog, per IP
+	Public ratelimit.Limit
+	// User limits authenticated requests, per user
+	User ratelimit.Limit
+}
+
+// DefaultRateLimits returns the limits used unless configured otherwise
+func DefaultRateLimits() RateLimits {
+	return RateLimits{
+		MagicLinkPerIP:    ratelimit.PerMinute(10),
+		MagicLinkPerEmail: ratelimit.Limit{Burst: 3, Per: 15 * time.Minute},
+		CallbackPerIP:     ratelimit.PerMinute(20),
+		CallbackFailures:  ratelimit.Limit{Burst: 5, Per: 15 * time.Minute},
+		Public:            ratelimit.PerMinute(300),
+		User:              ratelimit.PerMinute(600),
+	}
+}
+
+// RateLimitKeyFunc returns the key a request is limited by, or false to skip
+// the limit for the request
+type RateLimitKeyFunc func(r *http.Request) (string, bool)
+
+// RateLimit rejects requests with 429 and a Retry-After header once the
+// bucket of their key is empty. Buckets are named name plus the key, so the
+// same key can have separate limits in different route groups. Errors of the
+// store let the request through.
+func RateLimit(store ratelimit.Store, name string, limit ratelimit.Limit, keyFn RateLimitKeyFunc) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		if store == nil || !limit.Enabled() {
+			return next
+		}
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			key, ok := keyFn(r)
+			if !ok {
+				next.ServeHTTP(w, r)
+				return
+			}
+			result, err := store.Take(r.Context(), name+":"+key, limit, 1)
+			if err != nil {
+				logging.FromContext(r.Context()).Warn("rate limit failed", "limit", name, "error", err)
+				next.ServeHTTP(w, r)
+				return
+			}
+			if !result.Allowed {
+				writeRateLimited(w, result.RetryAfter)
+				return
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+func writeRateLimited(w http.ResponseWriter, retryAfter time.Duration) {
+	seconds := int(math.Ceil(retryAfter.Seconds()))
+	if seconds < 1 {
+		seconds = 1
+	}
+	w.Header().Set("Retry-After", fmt.Sprint(seconds))
+	writeError(w, http.StatusTooManyRequests, "rate_limited", "Too many requests, please try again later")
+}
+
+// ByIP limits requests per client IP
+func ByIP(r *http.Request) (string, bool) {
+	return clientIP(r), true
+}
+
+// ByUser limits authenticated requests per user and others per client IP
+func ByUser(r *http.Request) (string, bool) {
+	if claims := GetClaimsFromContext(r.Context()); claims != nil {
+		return "user:" + claims.CustomerID, true
+	}
+	return "ip:" + clientIP(r), true
+}
+
+// ByJSONEmail limits requests per email address in the JSON body. Requests
+// without one are not limited by this key.
+func ByJSONEmail(r *http.Request) (string, bool) {
+	email := strings.ToLower(strings.TrimSpace(peekJSONEmail(r)))
+	return email, email != ""
+}
+
+// peekJSONEmail reads the email field of a JSON body and restores the body
+// for the handler
+func peekJSONEmail(r *http.Request) string {
+	if r.Body == nil {
+		return ""
+	}
+	data, err := io.ReadAll(io.LimitReader(r.Body, maxRateLimitBodyBytes))
+	r.Body = io.NopCloser(io.MultiReader(bytes.NewReader(data), r.Body))
+	if err != nil {
+		return ""
+	}
+	var body struct {
+		Email string `json:"email"`
+	}
+	_ = json.Unmarshal(data, &body)
+	return body.Email
+}
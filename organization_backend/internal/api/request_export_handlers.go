@@ -0,0 +1,231 @@
+package api
+
+import (
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+
+	"organization_backend/internal/domain"
+	"organization_backend/internal/export"
+	"organization_backend/pkg/pagination"
+)
+
+// Export layouts for request items
+const (
+	// exportLayoutColumns writes one row per request with a column per material type
+	exportLayoutColumns = "columns"
+	// exportLayoutLines writes one row per line item
+	exportLayoutLines = "lines"
+)
+
+// exportPageSize is the number of requests fetched per ListRequests page while streaming
+const exportPageSize = 100
+
+const exportTimeLayout = "2006-01-02 15:04"
+
+// ExportRequests streams requests matching the list filters as CSV or XLSX.
+// Query parameters: format=csv|xlsx, layout=columns|lines plus the filters of
+// ListRequests. Shipping addresses and status history are only included for
+// admins; other users can only export their own and their schools' requests.
+func (h *Handler) ExportRequests(w http.ResponseWriter, r *http.Request) {
+	claims := GetClaimsFromContext(r.Context())
+	if claims == nil {
+		writeError(w, http.StatusUnauthorized, "unauthorized", "Authentication required")
+		return
+	}
+
+	params, err := parseListParams(r)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "invalid_params", err.Error())
+		return
+	}
+	params.Limit = exportPageSize
+	if !claims.IsAdmin {
+		params.MemberID = claims.CustomerID
+	}
+
+	format := r.URL.Query().Get("format")
+	if format == "" {
+		format = export.FormatCSV
+	}
+	if format != export.FormatCSV && format != export.FormatXLSX {
+		writeError(w, http.StatusBadRequest, "invalid_params", "format must be csv or xlsx")
+		return
+	}
+	layout := r.URL.Query().Get("layout")
+	if layout == "" {
+		layout = exportLayoutColumns
+	}
+	if layout != exportLayoutColumns && layout != exportLayoutLines {
+		writeError(w, http.StatusBadRequest, "invalid_params", "layout must be columns or lines")
+		return
+	}
+
+	materialTypes, err := h.Store.ListMaterialTypes(r.Context())
+	if err != nil {
+		serverError(w, r, err, "export_failed", "Failed to fetch material types")
+		return
+	}
+	rows := requestExportRows{
+		layout:        layout,
+		admin:         claims.IsAdmin,
+		materialTypes: materialTypes,
+		names:         map[string]string{},
+	}
+	for _, mt := range materialTypes {
+		rows.names[mt.ID] = mt.Name
+	}
+
+	filename := fmt.Sprintf("requests-%s.%s", time.Now().UTC().Format("2006-01-02"), format)
+	w.Header().Set("Content-Type", export.ContentType(format))
+	w.Header().Set("Content-Disposition", fmt.Sprintf(`attachment; filename="%s"`, filename))
+	w.WriteHeader(http.StatusOK)
+
+	// Errors after this point can only abort the stream
+	out, err := export.New(w, format)
+	if err != nil {
+		return
+	}
+	if err := out.WriteRow(rows.header()); err != nil {
+		return
+	}
+	flusher, _ := w.(http.Flusher)
+
+	for {
+		page, err := h.Service.ListRequests(r.Context(), params)
+		if err != nil {
+			return
+		}
+		var history map[string][]domain.StatusChange
+		if rows.admin {
+			ids := make([]string, 0, len(page.Requests))
+			for _, req := range page.Requests {
+				ids = append(ids, req.ID)
+			}
+			if history, err = h.Store.GetStatusHistoryForRequests(r.Context(), ids); err != nil {
+				return
+			}
+		}
+		for _, req := range page.Requests {
+			for _, row := range rows.rows(req, history[req.ID]) {
+				if err := out.WriteRow(row); err != nil {
+					return
+				}
+			}
+		}
+		if err := out.Flush(); err != nil {
+			return
+		}
+		if flusher != nil {
+			flusher.Flush()
+		}
+
+		if page.NextCursor == "" {
+			break
+		}
+		cursor, err := pagination.Decode(page.NextCursor)
+		if err != nil {
+			return
+		}
+		params.Cursor = &cursor
+	}
+	_ = out.Close()
+}
+
+// requestExportRows turns requests into export rows
+type requestExportRows struct {
+	layout        string
+	admin         bool
+	materialTypes []domain.MaterialType
+	names         map[string]string
+}
+
+func (e requestExportRows) header() []any {
+	header := []any{"Request ID", "Created", "Updated", "Delivery date", "Return date", "Status", "Customer name", "Customer email", "Kits"}
+	if e.admin {
+		header = append(header, "Recipient", "Address line 1", "Address line 2", "Zip code", "City", "Status history")
+	}
+	if e.layout == exportLayoutLines {
+		return append(header, "Kit", "Material type ID", "Material type", "Quantity")
+	}
+	for _, mt := range e.materialTypes {
+		header = append(header, mt.Name)
+	}
+	return header
+}
+
+func (e requestExportRows) rows(req domain.Request, history []domain.StatusChange) [][]any {
+	kits := make([]string, 0, len(req.Kits))
+	for _, kit := range req.Kits {
+		kits = append(kits, fmt.Sprintf("%s x%d", kit.KitID, kit.ClassSize))
+	}
+	returnDate := ""
+	if req.ReturnDate != nil {
+		returnDate = req.ReturnDate.UTC().Format(exportTimeLayout)
+	}
+	base := []any{
+		req.ID,
+		req.CreatedAt.UTC().Format(exportTimeLayout),
+		req.UpdatedAt.UTC().Format(exportTimeLayout),
+		req.DeliveryDate.UTC().Format(exportTimeLayout),
+		returnDate,
+		req.Status,
+		req.Customer.Name,
+		req.Customer.Email,
+		strings.Join(kits, "; "),
+	}
+	if e.admin {
+		changes := make([]string, 0, len(history))
+		for _, change := range history {
+			changes = append(changes, fmt.Sprintf("%s %s", change.ChangedAt.UTC().Format(exportTimeLayout), change.Status))
+		}
+		base = append(base,
+			req.ShippingCustomerName,
+			req.ShippingAddress.Line1,
+			req.ShippingAddress.Line2,
+			req.ShippingAddress.ZipCode,
+			req.ShippingAddress.City,
+			strings.Join(changes, "; "),
+		)
+	}
+
+	if e.layout == exportLayoutColumns {
+		row := base
+		for _, mt := range e.materialTypes {
+			row = append(row, req.Items[mt.ID])
+		}
+		return [][]any{row}
+	}
+
+	// Items ordered directly come first, then the items of each kit
+	direct := map[string]int{}
+	for id, quantity := range req.Items {
+		direct[id] = quantity
+	}
+	for _, kit := range req.Kits {
+		for id, quantity := range kit.Items {
+			direct[id] -= quantity
+		}
+	}
+	var rows [][]any
+	addLines := func(kitID string, items map[string]int) {
+		ids := make([]string, 0, len(items))
+		for id, quantity := range items {
+			if quantity > 0 {
+				ids = append(ids, id)
+			}
+		}
+		sort.Slice(ids, func(i, j int) bool { return e.names[ids[i]] < e.names[ids[j]] })
+		for _, id := range ids {
+			row := append(append([]any{}, base...), kitID, id, e.names[id], items[id])
+			rows = append(rows, row)
+		}
+	}
+	addLines("", direct)
+	for _, kit := range req.Kits {
+		addLines(kit.KitID, kit.Items)
+	}
+	return rows
+}
@@ -1,63 +1,247 @@
 package api
 
 import (
-	"net/http"
-	"os"
+	"log/slog"
+	"net/netip"
 
 	"github.com/go-chi/chi/v5"
+
+	"organization_backend/internal/metrics"
+	"organization_backend/internal/ratelimit"
 )
 
-func Routes(handler *Handler, authHandler *AuthHandler, materialTypeHandler *MaterialTypeHandler, uploadHandler *UploadHandler, jwtSecret string) chi.Router {
+// Handlers are the handlers served by Routes
+type Handlers struct {
+	Request      *Handler
+	Auth         *AuthHandler
+	MaterialType *MaterialTypeHandler
+	Upload       *UploadHandler
+	Audit        *AuditHandler
+	Category     *CategoryHandler
+	Kit          *KitHandler
+	Catalog      *CatalogHandler
+	PackingSlip  *PackingSlipHandler
+	Calendar     *CalendarHandler
+	Analytics    *AnalyticsHandler
+	School       *SchoolHandler
+	Address      *AddressHandler
+	Health       *HealthHandler
+}
+
+// RouterConfig configures the middleware of Routes
+type RouterConfig struct {
+	JWTSecret string
+	// Logger writes the access log and is the base of the request loggers
+	Logger *slog.Logger
+	CORS   CORSConfig
+	// TrustedProxies are the reverse proxies whose forwarding headers are believed
+	TrustedProxies []netip.Prefix
+	// RateLimiter holds the rate limit buckets; nil disables rate limiting
+	RateLimiter ratelimit.Store
+	RateLimits  RateLimits
+	// IdempotencyStore keeps the responses replayed for repeated
+	// Idempotency-Key headers
+	IdempotencyStore IdempotencyKeyStore
+	// Metrics records request latencies; nil disables them
+	Metrics *metrics.Metrics
+	// MetricsToken, when set, serves /metrics on this router to clients
+	// sending it as a bearer token
+	MetricsToken string
+}
+
+func Routes(h Handlers, cfg RouterConfig) chi.Router {
 	r := chi.NewRouter()
+	jwtSecret := cfg.JWTSecret
+	limits := cfg.RateLimits
+	limiter := cfg.RateLimiter
+	logger := cfg.Logger
+	if logger == nil {
+		logger = slog.Default()
+	}
+	// perUser must come after AuthMiddleware to see the user
+	perUser := RateLimit(limiter, "user", limits.User, ByUser)
+	public := RateLimit(limiter, "public", limits.Public, ByIP)
+	// idempotent must come after AuthMiddleware to scope keys per user, and
+	// after perUser so rate limited requests do not claim a key
+	idempotent := Idempotency(cfg.IdempotencyStore)
 
-	r.Use(CORS)
+	r.Use(TrustedProxies(cfg.TrustedProxies))
+	r.Use(RequestID)
+	r.Use(Tracing)
+	r.Use(RequestLogger(logger))
+	r.Use(Metrics(cfg.Metrics))
+	r.Use(SecurityHeaders)
+	r.Use(CORS(cfg.CORS))
+	r.Use(AuditContext)
+
+	// Probes are not rate limited so orchestrators are never locked out
+	r.Get("/healthz", h.Health.Live)
+	r.Get("/readyz", h.Health.Ready)
+	r.With(AuthMiddleware(jwtSecret), perUser, AdminMiddleware()).Get("/debug/status", h.Health.Status)
+
+	if cfg.Metrics != nil && cfg.MetricsToken != "" {
+		r.Method("GET", "/metrics", MetricsHandler(cfg.Metrics, cfg.MetricsToken))
+	}
 
 	// Public auth routes
 	r.Route("/auth", func(r chi.Router) {
-		r.Post("/magic-link", authHandler.RequestMagicLink)
-		r.Post("/callback", authHandler.MagicLinkCallback)
-		r.With(AuthMiddleware(jwtSecret)).Get("/me", authHandler.GetCurrentUser)
+		r.With(
+			RateLimit(limiter, "magic-link-ip", limits.MagicLinkPerIP, ByIP),
+			RateLimit(limiter, "magic-link-email", limits.MagicLinkPerEmail, ByJSONEmail),
+		).Post("/magic-link", h.Auth.RequestMagicLink)
+		r.With(RateLimit(limiter, "callback-ip", limits.CallbackPerIP, ByIP)).Post("/callback", h.Auth.MagicLinkCallback)
+		r.With(AuthMiddleware(jwtSecret), perUser).Get("/me", h.Auth.GetCurrentUser)
 	})
 
 	// Protected routes
 	r.Route("/requests", func(r chi.Router) {
 		r.Use(AuthMiddleware(jwtSecret))
-		r.Post("/", handler.CreateRequest)
-		r.Get("/", handler.ListRequests)
-		r.Get("/subscribe", handler.SubscribeRequests)
-		r.Get("/{id}", handler.GetRequest)
-		r.Get("/{id}/subscribe", handler.SubscribeRequest)
+		r.Use(perUser)
+		r.Use(idempotent)
+		r.Post("/", h.Request.CreateRequest)
+		r.Get("/", h.Request.ListRequests)
+		r.Get("/export", h.Request.ExportRequests)
+		r.Get("/subscribe", h.Request.SubscribeRequests)
+		r.With(AdminMiddleware()).Get("/packing-slips.pdf", h.PackingSlip.ListPackingSlips)
+		r.Get("/{id}", h.Request.GetRequest)
+		r.Get("/{id}/packing-slip.pdf", h.PackingSlip.GetPackingSlip)
+		r.With(AdminMiddleware()).Put("/{id}/distribution-center", h.Request.SetRequestDistributionCenter)
+		r.Get("/{id}/subscribe", h.Request.SubscribeRequest)
 	})
 
 	// My Requests - protected
-	r.With(AuthMiddleware(jwtSecret)).Get("/my-requests", handler.GetMyRequests)
+	r.With(AuthMiddleware(jwtSecret), perUser).Get("/my-requests", h.Request.GetMyRequests)
+
+	// Schools - access is checked per school membership
+	r.Route("/schools", func(r chi.Router) {
+		r.Use(AuthMiddleware(jwtSecret))
+		r.Use(perUser)
+		r.Use(idempotent)
+		r.Get("/", h.School.ListSchools)
+		r.Post("/", h.School.CreateSchool)
+		r.Get("/{id}", h.School.GetSchool)
+		r.Put("/{id}", h.School.UpdateSchool)
+		r.Post("/{id}/addresses", h.School.AddAddress)
+		r.Put("/{id}/addresses/{addressId}", h.School.UpdateAddress)
+		r.Delete("/{id}/addresses/{addressId}", h.School.DeleteAddress)
+		r.With(AdminMiddleware()).Put("/{id}/addresses/{addressId}/verification", h.School.SetAddressVerification)
+		r.Post("/{id}/contacts", h.School.AddContact)
+		r.Put("/{id}/contacts/{contactId}", h.School.UpdateContact)
+		r.Delete("/{id}/contacts/{contactId}", h.School.DeleteContact)
+		r.Put("/{id}/members", h.School.SetMember)
+		r.Delete("/{id}/members/{userId}", h.School.RemoveMember)
+	})
+
+	// Address book of the authenticated user
+	r.Route("/addresses", func(r chi.Router) {
+		r.Use(AuthMiddleware(jwtSecret))
+		r.Use(perUser)
+		r.Use(idempotent)
+		r.Get("/", h.Address.ListAddresses)
+		r.Post("/", h.Address.CreateAddress)
+		r.Put("/{id}", h.Address.UpdateAddress)
+		r.Delete("/{id}", h.Address.DeleteAddress)
+	})
 
 	// Material Types routes
 	r.Route("/material-types", func(r chi.Router) {
 		// Public routes
-		r.Get("/", materialTypeHandler.ListMaterialTypes)
-		r.Get("/{id}", materialTypeHandler.GetMaterialType)
+		r.With(public).Get("/", h.MaterialType.ListMaterialTypes)
+		r.With(public).Get("/{id}", h.MaterialType.GetMaterialType)
+		r.With(public).Get("/{id}/images", h.Upload.ListMaterialTypeImages)
 
 		// Admin only routes
 		r.Group(func(r chi.Router) {
 			r.Use(AuthMiddleware(jwtSecret))
+			r.Use(perUser)
+			r.Use(idempotent)
 			r.Use(AdminMiddleware())
-			r.Post("/", materialTypeHandler.CreateMaterialType)
-			r.Put("/{id}", materialTypeHandler.UpdateMaterialType)
-			r.Delete("/{id}", materialTypeHandler.DeleteMaterialType)
-			r.Post("/{id}/image", uploadHandler.UploadMaterialTypeImage)
+			r.Post("/", h.MaterialType.CreateMaterialType)
+			r.Put("/{id}", h.MaterialType.UpdateMaterialType)
+			r.Delete("/{id}", h.MaterialType.DeleteMaterialType)
+			r.Post("/{id}/archive", h.MaterialType.ArchiveMaterialType)
+			r.Post("/{id}/restore", h.MaterialType.RestoreMaterialType)
+			r.Post("/{id}/image", h.Upload.UploadMaterialTypeImage)
+			r.Post("/{id}/images", h.Upload.AddMaterialTypeImage)
+			r.Put("/{id}/images/order", h.Upload.ReorderMaterialTypeImages)
+			r.Put("/{id}/images/{imageId}", h.Upload.UpdateMaterialTypeImageAltText)
+			r.Delete("/{id}/images/{imageId}", h.Upload.DeleteMaterialTypeImage)
 		})
 	})
 
-	// Static file serving for uploads
-	uploadsDir := uploadHandler.UploadPath
-	if uploadsDir == "" {
-		uploadsDir = "uploads"
-	}
-	// Ensure uploads directory exists
-	os.MkdirAll(uploadsDir, 0755)
-	fileServer := http.FileServer(http.Dir(uploadsDir))
-	r.Handle("/uploads/*", http.StripPrefix("/uploads/", fileServer))
+	// Categories routes
+	r.Route("/categories", func(r chi.Router) {
+		// Public routes
+		r.With(public).Get("/", h.Category.ListCategories)
+		r.With(public).Get("/{id}", h.Category.GetCategory)
+
+		// Admin only routes
+		r.Group(func(r chi.Router) {
+			r.Use(AuthMiddleware(jwtSecret))
+			r.Use(perUser)
+			r.Use(idempotent)
+			r.Use(AdminMiddleware())
+			r.Post("/", h.Category.CreateCategory)
+			r.Put("/{id}", h.Category.UpdateCategory)
+			r.Delete("/{id}", h.Category.DeleteCategory)
+		})
+	})
+
+	// Kits routes
+	r.Route("/kits", func(r chi.Router) {
+		// Public routes
+		r.With(public).Get("/", h.Kit.ListKits)
+		r.With(public).Get("/{id}", h.Kit.GetKit)
+
+		// Admin only routes
+		r.Group(func(r chi.Router) {
+			r.Use(AuthMiddleware(jwtSecret))
+			r.Use(perUser)
+			r.Use(idempotent)
+			r.Use(AdminMiddleware())
+			r.Post("/", h.Kit.CreateKit)
+			r.Put("/{id}", h.Kit.UpdateKit)
+			r.Delete("/{id}", h.Kit.DeleteKit)
+		})
+	})
+
+	// Catalog bulk export and import - admin only
+	r.Route("/catalog", func(r chi.Router) {
+		r.Use(AuthMiddleware(jwtSecret))
+		r.Use(perUser)
+		r.Use(idempotent)
+		r.Use(AdminMiddleware())
+		r.Get("/export", h.Catalog.ExportCatalog)
+		r.Post("/import", h.Catalog.ImportCatalog)
+	})
+
+	// Calendar feeds - the feed itself is authenticated by the secret token in its URL
+	r.Route("/calendar", func(r chi.Router) {
+		r.With(public).Get("/{token}.ics", h.Calendar.GetCalendarFeed)
+		r.With(AuthMiddleware(jwtSecret), perUser).Get("/token", h.Calendar.GetCalendarToken)
+		r.With(AuthMiddleware(jwtSecret), perUser, idempotent).Post("/token", h.Calendar.RotateCalendarToken)
+	})
+
+	// Dashboard analytics - admin only
+	r.Route("/analytics", func(r chi.Router) {
+		r.Use(AuthMiddleware(jwtSecret))
+		r.Use(perUser)
+		r.Use(idempotent)
+		r.Use(AdminMiddleware())
+		r.Get("/requests-by-status", h.Analytics.RequestsByStatus)
+		r.Get("/top-material-types", h.Analytics.TopMaterialTypes)
+		r.Get("/utilization", h.Analytics.Utilization)
+		r.Get("/lead-times", h.Analytics.LeadTimes)
+		r.Get("/return-punctuality", h.Analytics.ReturnPunctuality)
+		r.Get("/regions", h.Analytics.SchoolsPerRegion)
+		r.Post("/refresh", h.Analytics.RefreshAnalytics)
+	})
+
+	// Audit log - admin only
+	r.With(AuthMiddleware(jwtSecret), perUser, AdminMiddleware()).Get("/audit", h.Audit.ListAuditEntries)
+
+	// Uploaded files served from the configured storage
+	r.With(public, UploadSecurityHeaders, UploadCacheHeaders).Get("/uploads/*", h.Upload.ServeUpload)
 
 	return r
 }
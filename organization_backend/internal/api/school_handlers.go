@@ -0,0 +1,397 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"organization_backend/internal/db"
+	"organization_backend/internal/domain"
+	"organization_backend/internal/postal"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/google/uuid"
+)
+
+// SchoolHandler handles schools and their addresses, contacts and members.
+// Members can read their school and manage addresses and contacts; owners can
+// also rename it and manage members. Admins can do everything and are the
+// only ones who verify addresses.
+type SchoolHandler struct {
+	Store SchoolStore
+}
+
+// SchoolStore defines the methods SchoolHandler needs from Store
+type SchoolStore interface {
+	ListSchools(ctx context.Context, params db.ListSchoolsParams) ([]domain.School, error)
+	GetSchool(ctx context.Context, id string) (domain.School, error)
+	SchoolRole(ctx context.Context, schoolID, userID string) (string, error)
+	CreateSchool(ctx context.Context, name, ownerID string) (domain.School, error)
+	UpdateSchool(ctx context.Context, id, name string) (domain.School, error)
+	AddSchoolAddress(ctx context.Context, schoolID string, input domain.AddressInput) (domain.School, error)
+	UpdateSchoolAddress(ctx context.Context, schoolID, addressID string, input domain.AddressInput) (domain.School, error)
+	DeleteSchoolAddress(ctx context.Context, schoolID, addressID string) (domain.School, error)
+	SetSchoolAddressVerified(ctx context.Context, schoolID, addressID string, verified bool) (domain.School, error)
+	AddSchoolContact(ctx context.Context, schoolID string, input domain.SchoolContactInput) (domain.School, error)
+	UpdateSchoolContact(ctx context.Context, schoolID, contactID string, input domain.SchoolContactInput) (domain.School, error)
+	DeleteSchoolContact(ctx context.Context, schoolID, contactID string) (domain.School, error)
+	SetSchoolMember(ctx context.Context, schoolID, email, role string) (domain.School, error)
+	RemoveSchoolMember(ctx context.Context, schoolID, userID string) (domain.School, error)
+}
+
+// SchoolRequest is the request body for creating or renaming a school
+type SchoolRequest struct {
+	Name string `json:"name"`
+}
+
+// SchoolMemberRequest adds a user to a school or changes their role
+type SchoolMemberRequest struct {
+	Email string `json:"email"`
+	Role  string `json:"role"`
+}
+
+// AddressVerificationRequest sets whether an address is verified
+type AddressVerificationRequest struct {
+	Verified bool `json:"verified"`
+}
+
+// ListSchools returns all schools for admins and the own schools for everyone else
+func (h *SchoolHandler) ListSchools(w http.ResponseWriter, r *http.Request) {
+	claims := GetClaimsFromContext(r.Context())
+	if claims == nil {
+		writeError(w, http.StatusUnauthorized, "unauthorized", "Authentication required")
+		return
+	}
+	params := db.ListSchoolsParams{Query: r.URL.Query().Get("q")}
+	if !claims.IsAdmin {
+		params.UserID = claims.CustomerID
+	}
+	if value := r.URL.Query().Get("limit"); value != "" {
+		limit, err := strconv.Atoi(value)
+		if err != nil {
+			writeError(w, http.StatusBadRequest, "invalid_params", "limit must be number")
+			return
+		}
+		params.Limit = limit
+	}
+	schools, err := h.Store.ListSchools(r.Context(), params)
+	if err != nil {
+		serverError(w, r, err, "list_failed", "Failed to fetch schools")
+		return
+	}
+	writeJSON(w, http.StatusOK, schools)
+}
+
+// CreateSchool creates a school owned by the authenticated user
+func (h *SchoolHandler) CreateSchool(w http.ResponseWriter, r *http.Request) {
+	claims := GetClaimsFromContext(r.Context())
+	if claims == nil {
+		writeError(w, http.StatusUnauthorized, "unauthorized", "Authentication required")
+		return
+	}
+	var req SchoolRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, http.StatusBadRequest, "invalid_json", "Invalid JSON body")
+		return
+	}
+	if strings.TrimSpace(req.Name) == "" {
+		writeError(w, http.StatusBadRequest, "validation_error", "Name is required")
+		return
+	}
+	school, err := h.Store.CreateSchool(r.Context(), strings.TrimSpace(req.Name), claims.CustomerID)
+	if err != nil {
+		serverError(w, r, err, "create_failed", "Failed to create school")
+		return
+	}
+	writeJSON(w, http.StatusCreated, school)
+}
+
+// GetSchool returns a school with its addresses, contacts and members
+func (h *SchoolHandler) GetSchool(w http.ResponseWriter, r *http.Request) {
+	id, ok := h.authorize(w, r, false)
+	if !ok {
+		return
+	}
+	school, err := h.Store.GetSchool(r.Context(), id)
+	h.respond(w, r, school, err, http.StatusOK)
+}
+
+// UpdateSchool renames a school (owners and admins)
+func (h *SchoolHandler) UpdateSchool(w http.ResponseWriter, r *http.Request) {
+	id, ok := h.authorize(w, r, true)
+	if !ok {
+		return
+	}
+	var req SchoolRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, http.StatusBadRequest, "invalid_json", "Invalid JSON body")
+		return
+	}
+	if strings.TrimSpace(req.Name) == "" {
+		writeError(w, http.StatusBadRequest, "validation_error", "Name is required")
+		return
+	}
+	school, err := h.Store.UpdateSchool(r.Context(), id, strings.TrimSpace(req.Name))
+	h.respond(w, r, school, err, http.StatusOK)
+}
+
+// AddAddress adds an unverified address to a school
+func (h *SchoolHandler) AddAddress(w http.ResponseWriter, r *http.Request) {
+	id, ok := h.authorize(w, r, false)
+	if !ok {
+		return
+	}
+	input, ok := decodeAddressInput(w, r)
+	if !ok {
+		return
+	}
+	school, err := h.Store.AddSchoolAddress(r.Context(), id, input)
+	h.respond(w, r, school, err, http.StatusCreated)
+}
+
+// UpdateAddress edits an address of a school
+func (h *SchoolHandler) UpdateAddress(w http.ResponseWriter, r *http.Request) {
+	id, ok := h.authorize(w, r, false)
+	if !ok {
+		return
+	}
+	addressID, ok := urlID(w, r, "addressId", "Address not found")
+	if !ok {
+		return
+	}
+	input, ok := decodeAddressInput(w, r)
+	if !ok {
+		return
+	}
+	school, err := h.Store.UpdateSchoolAddress(r.Context(), id, addressID, input)
+	h.respond(w, r, school, err, http.StatusOK)
+}
+
+// DeleteAddress removes an address from a school
+func (h *SchoolHandler) DeleteAddress(w http.ResponseWriter, r *http.Request) {
+	id, ok := h.authorize(w, r, false)
+	if !ok {
+		return
+	}
+	addressID, ok := urlID(w, r, "addressId", "Address not found")
+	if !ok {
+		return
+	}
+	school, err := h.Store.DeleteSchoolAddress(r.Context(), id, addressID)
+	h.respond(w, r, school, err, http.StatusOK)
+}
+
+// SetAddressVerification marks an address as verified or unverified (admin only)
+func (h *SchoolHandler) SetAddressVerification(w http.ResponseWriter, r *http.Request) {
+	id, ok := h.authorize(w, r, true)
+	if !ok {
+		return
+	}
+	addressID, ok := urlID(w, r, "addressId", "Address not found")
+	if !ok {
+		return
+	}
+	var req AddressVerificationRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, http.StatusBadRequest, "invalid_json", "Invalid JSON body")
+		return
+	}
+	school, err := h.Store.SetSchoolAddressVerified(r.Context(), id, addressID, req.Verified)
+	h.respond(w, r, school, err, http.StatusOK)
+}
+
+// AddContact adds a contact person to a school
+func (h *SchoolHandler) AddContact(w http.ResponseWriter, r *http.Request) {
+	id, ok := h.authorize(w, r, false)
+	if !ok {
+		return
+	}
+	input, ok := decodeContactInput(w, r)
+	if !ok {
+		return
+	}
+	school, err := h.Store.AddSchoolContact(r.Context(), id, input)
+	h.respond(w, r, school, err, http.StatusCreated)
+}
+
+// UpdateContact edits a contact person of a school
+func (h *SchoolHandler) UpdateContact(w http.ResponseWriter, r *http.Request) {
+	id, ok := h.authorize(w, r, false)
+	if !ok {
+		return
+	}
+	contactID, ok := urlID(w, r, "contactId", "Contact not found")
+	if !ok {
+		return
+	}
+	input, ok := decodeContactInput(w, r)
+	if !ok {
+		return
+	}
+	school, err := h.Store.UpdateSchoolContact(r.Context(), id, contactID, input)
+	h.respond(w, r, school, err, http.StatusOK)
+}
+
+// DeleteContact removes a contact person from a school
+func (h *SchoolHandler) DeleteContact(w http.ResponseWriter, r *http.Request) {
+	id, ok := h.authorize(w, r, false)
+	if !ok {
+		return
+	}
+	contactID, ok := urlID(w, r, "contactId", "Contact not found")
+	if !ok {
+		return
+	}
+	school, err := h.Store.DeleteSchoolContact(r.Context(), id, contactID)
+	h.respond(w, r, school, err, http.StatusOK)
+}
+
+// SetMember adds an existing user to a school by email or changes their role
+// (owners and admins)
+func (h *SchoolHandler) SetMember(w http.ResponseWriter, r *http.Request) {
+	id, ok := h.authorize(w, r, true)
+	if !ok {
+		return
+	}
+	var req SchoolMemberRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, http.StatusBadRequest, "invalid_json", "Invalid JSON body")
+		return
+	}
+	if strings.TrimSpace(req.Email) == "" {
+		writeError(w, http.StatusBadRequest, "validation_error", "Email is required")
+		return
+	}
+	if req.Role == "" {
+		req.Role = domain.SchoolRoleMember
+	}
+	if req.Role != domain.SchoolRoleMember && req.Role != domain.SchoolRoleOwner {
+		writeError(w, http.StatusBadRequest, "validation_error", "Role must be owner or member")
+		return
+	}
+	school, err := h.Store.SetSchoolMember(r.Context(), id, strings.TrimSpace(req.Email), req.Role)
+	h.respond(w, r, school, err, http.StatusOK)
+}
+
+// RemoveMember removes a user from a school. Owners and admins can remove
+// anyone, members only themselves.
+func (h *SchoolHandler) RemoveMember(w http.ResponseWriter, r *http.Request) {
+	claims := GetClaimsFromContext(r.Context())
+	userID, ok := urlID(w, r, "userId", "User not found")
+	if !ok {
+		return
+	}
+	self := claims != nil && claims.CustomerID == userID
+	id, ok := h.authorize(w, r, !self)
+	if !ok {
+		return
+	}
+	school, err := h.Store.RemoveSchoolMember(r.Context(), id, userID)
+	h.respond(w, r, school, err, http.StatusOK)
+}
+
+// authorize checks that the authenticated user may access the school in the
+// URL and returns its ID. Non-members get a 404 so school IDs cannot be probed.
+func (h *SchoolHandler) authorize(w http.ResponseWriter, r *http.Request, ownerOnly bool) (string, bool) {
+	claims := GetClaimsFromContext(r.Context())
+	if claims == nil {
+		writeError(w, http.StatusUnauthorized, "unauthorized", "Authentication required")
+		return "", false
+	}
+	id, ok := urlID(w, r, "id", "School not found")
+	if !ok {
+		return "", false
+	}
+	if claims.IsAdmin {
+		return id, true
+	}
+	role, err := h.Store.SchoolRole(r.Context(), id, claims.CustomerID)
+	if err != nil {
+		serverError(w, r, err, "lookup_failed", "Failed to fetch school")
+		return "", false
+	}
+	if role == "" {
+		writeError(w, http.StatusNotFound, "not_found", "School not found")
+		return "", false
+	}
+	if ownerOnly && role != domain.SchoolRoleOwner {
+		writeError(w, http.StatusForbidden, "forbidden", "Only school owners can do this")
+		return "", false
+	}
+	return id, true
+}
+
+// urlID returns the UUID URL parameter name or writes a 404
+func urlID(w http.ResponseWriter, r *http.Request, name, notFound string) (string, bool) {
+	id := chi.URLParam(r, name)
+	if _, err := uuid.Parse(id); err != nil {
+		writeError(w, http.StatusNotFound, "not_found", notFound)
+		return "", false
+	}
+	return id, true
+}
+
+func (h *SchoolHandler) respond(w http.ResponseWriter, r *http.Request, school domain.School, err error, status int) {
+	switch {
+	case errors.Is(err, db.ErrSchoolNotFound):
+		writeError(w, http.StatusNotFound, "not_found", "School not found")
+	case errors.Is(err, db.ErrAddressNotFound):
+		writeError(w, http.StatusNotFound, "not_found", "Address not found")
+	case errors.Is(err, db.ErrContactNotFound):
+		writeError(w, http.StatusNotFound, "not_found", "Contact not found")
+	case errors.Is(err, db.ErrUserNotFound):
+		writeError(w, http.StatusNotFound, "not_found", "User not found")
+	case errors.Is(err, db.ErrLastOwner):
+		writeError(w, http.StatusConflict, "last_owner", "A school needs at least one owner")
+	case err != nil:
+		serverError(w, r, err, "update_failed", "Failed to update school")
+	default:
+		writeJSON(w, status, school)
+	}
+}
+
+func decodeAddressInput(w http.ResponseWriter, r *http.Request) (domain.AddressInput, bool) {
+	var input domain.AddressInput
+	if err := json.NewDecoder(r.Body).Decode(&input); err != nil {
+		writeError(w, http.StatusBadRequest, "invalid_json", "Invalid JSON body")
+		return input, false
+	}
+	input.Label = strings.TrimSpace(input.Label)
+	input.Line1 = strings.TrimSpace(input.Line1)
+	input.Line2 = strings.TrimSpace(input.Line2)
+	input.City = strings.TrimSpace(input.City)
+	input.ZipCode = postal.NormalizeZipCode(input.ZipCode)
+	if input.Line1 == "" || input.City == "" || input.ZipCode == "" {
+		writeError(w, http.StatusBadRequest, "validation_error", "line1, city and zipCode are required")
+		return input, false
+	}
+	switch err := postal.Validate(input.ZipCode, input.City); {
+	case errors.Is(err, postal.ErrCityMismatch):
+		writeError(w, http.StatusBadRequest, "validation_error", "City does not match zipCode")
+		return input, false
+	case err != nil:
+		writeError(w, http.StatusBadRequest, "validation_error", "zipCode is not a valid German postal code")
+		return input, false
+	}
+	return input, true
+}
+
+func decodeContactInput(w http.ResponseWriter, r *http.Request) (domain.SchoolContactInput, bool) {
+	var input domain.SchoolContactInput
+	if err := json.NewDecoder(r.Body).Decode(&input); err != nil {
+		writeError(w, http.StatusBadRequest, "invalid_json", "Invalid JSON body")
+		return input, false
+	}
+	input.Name = strings.TrimSpace(input.Name)
+	input.Email = strings.TrimSpace(input.Email)
+	input.Phone = strings.TrimSpace(input.Phone)
+	input.Role = strings.TrimSpace(input.Role)
+	if input.Name == "" {
+		writeError(w, http.StatusBadRequest, "validation_error", "Name is required")
+		return input, false
+	}
+	return input, true
+}
@@ -0,0 +1,41 @@
+package api
+
+import (
+	"net/http"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/go-chi/chi/v5/middleware"
+	"go.opentelemetry.io/contrib/instrumentation/net/http/otelhttp"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// traceIDHeader returns the trace ID of a request so that users can quote it
+const traceIDHeader = "X-Trace-ID"
+
+// Tracing continues the caller's trace from the traceparent header, or starts
+// one, and records the request as a server span named after its route
+func Tracing(next http.Handler) http.Handler {
+	named := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		span := trace.SpanFromContext(r.Context())
+		if sc := span.SpanContext(); sc.HasTraceID() {
+			w.Header().Set(traceIDHeader, sc.TraceID().String())
+		}
+		span.SetAttributes(
+			attribute.String("client.address", clientIP(r)),
+			attribute.String("http.request_id", middleware.GetReqID(r.Context())),
+		)
+
+		next.ServeHTTP(w, r)
+
+		if rctx := chi.RouteContext(r.Context()); rctx != nil && rctx.RoutePattern() != "" {
+			span.SetName(r.Method + " " + rctx.RoutePattern())
+			span.SetAttributes(attribute.String("http.route", rctx.RoutePattern()))
+		}
+	})
+	// The route is only known once chi has matched it, so spans start out
+	// named after the method
+	return otelhttp.NewHandler(named, "", otelhttp.WithSpanNameFormatter(func(_ string, r *http.Request) string {
+		return r.Method
+	}))
+}
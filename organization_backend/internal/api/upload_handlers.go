@@ -1,15 +1,26 @@
 package api
 
 import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
 	"fmt"
 	"image"
-	"image/jpeg"
-	"image/png"
 	"io"
 	"net/http"
-	"os"
-	"path/filepath"
+	"path"
+	"regexp"
+	"strconv"
 	"strings"
+	"time"
+
+	"organization_backend/internal/db"
+	"organization_backend/internal/domain"
+	"organization_backend/internal/metrics"
+	"organization_backend/internal/storage"
 
 	"github.com/chai2010/webp"
 	"github.com/go-chi/chi/v5"
@@ -18,126 +29,368 @@ import (
 
 // UploadHandler handles file uploads
 type UploadHandler struct {
-	Store      StoreInterface
-	UploadPath string
+	Store   StoreInterface
+	Storage storage.Storage
+	// PresignExpiry redirects downloads to presigned URLs when the storage supports them
+	PresignExpiry time.Duration
+	Metrics       *metrics.Metrics
+}
+
+// imageVariantSize describes a generated image variant
+type imageVariantSize struct {
+	Name      string
+	MaxWidth  int
+	MaxHeight int
+}
+
+// imageVariantSizes are generated for every uploaded image, smallest first
+var imageVariantSizes = []imageVariantSize{
+	{Name: "thumbnail", MaxWidth: 160, MaxHeight: 120},
+	{Name: "card", MaxWidth: 400, MaxHeight: 300},
+	{Name: "detail", MaxWidth: 1200, MaxHeight: 900},
 }
 
-// UploadMaterialTypeImage handles image upload for material types
+// hashedUploadPattern matches content-hashed upload filenames, which never change content
+var hashedUploadPattern = regexp.MustCompile(`/[0-9a-f]{16}(-[a-z]+)?\.[a-z]+$`)
+
+// UploadMaterialTypeImage replaces the primary image of a material type
 func (h *UploadHandler) UploadMaterialTypeImage(w http.ResponseWriter, r *http.Request) {
 	id := chi.URLParam(r, "id")
 
-	// Check material type exists
-	_, err := h.Store.GetMaterialTypeByID(r.Context(), id)
+	mt, err := h.Store.GetMaterialTypeByID(r.Context(), id)
 	if err != nil {
 		writeError(w, http.StatusNotFound, "not_found", "Material type not found")
 		return
 	}
 
-	// Parse multipart form with 10MB max memory
-	if err := r.ParseMultipartForm(10 << 20); err != nil {
-		writeError(w, http.StatusBadRequest, "invalid_form", "Failed to parse form")
+	input, format, ok := h.processImageUpload(w, r, id)
+	if !ok {
 		return
 	}
 
-	// Get the file from the form
-	file, header, err := r.FormFile("image")
+	image, replaced, err := h.Store.ReplacePrimaryMaterialTypeImage(r.Context(), id, input)
 	if err != nil {
-		writeError(w, http.StatusBadRequest, "missing_file", "No image file provided")
+		// Duplicate uploads share the files of the existing image
+		if !errors.Is(err, db.ErrDuplicateImage) {
+			h.removeImageFiles(r.Context(), input.OriginalURL, input.Variants)
+		}
+		writeImageStoreError(w, r, err)
 		return
 	}
-	defer file.Close()
+	if replaced != nil && replaced.ContentHash != image.ContentHash {
+		h.removeImageFiles(r.Context(), replaced.OriginalURL, replaced.Variants)
+	}
+	if len(mt.Images) == 0 {
+		h.removeLegacyImage(r.Context(), id)
+	}
 
-	// Validate file type
-	contentType := header.Header.Get("Content-Type")
-	if !isValidImageType(contentType) {
-		writeError(w, http.StatusBadRequest, "invalid_type", "Invalid image type. Allowed: jpeg, png, webp, gif")
-		return
+	imageURL := image.OriginalURL
+	if variant, ok := image.Variant(db.PrimaryImageVariant); ok {
+		imageURL = variant.URL
 	}
+	writeJSON(w, http.StatusOK, map[string]any{
+		"imageUrl": imageURL,
+		"format":   format,
+		"image":    image,
+	})
+}
 
-	// Decode the image
-	img, format, err := decodeImage(file, contentType)
+// ListMaterialTypeImages returns the ordered image gallery of a material type (public)
+func (h *UploadHandler) ListMaterialTypeImages(w http.ResponseWriter, r *http.Request) {
+	id := chi.URLParam(r, "id")
+	if _, err := h.Store.GetMaterialTypeByID(r.Context(), id); err != nil {
+		writeError(w, http.StatusNotFound, "not_found", "Material type not found")
+		return
+	}
+	images, err := h.Store.ListMaterialTypeImages(r.Context(), id)
 	if err != nil {
-		writeError(w, http.StatusBadRequest, "decode_error", "Failed to decode image")
+		serverError(w, r, err, "list_failed", "Failed to fetch images")
 		return
 	}
+	writeJSON(w, http.StatusOK, images)
+}
 
-	// Resize image to standard dimensions (400x300) while maintaining aspect ratio
-	img = resizeImage(img, 400, 300)
+// AddMaterialTypeImage appends an image to the gallery of a material type
+func (h *UploadHandler) AddMaterialTypeImage(w http.ResponseWriter, r *http.Request) {
+	id := chi.URLParam(r, "id")
 
-	// Create uploads directory if it doesn't exist
-	uploadDir := filepath.Join(h.UploadPath, "material-types")
-	if err := os.MkdirAll(uploadDir, 0755); err != nil {
-		writeError(w, http.StatusInternalServerError, "mkdir_error", "Failed to create upload directory")
+	if _, err := h.Store.GetMaterialTypeByID(r.Context(), id); err != nil {
+		writeError(w, http.StatusNotFound, "not_found", "Material type not found")
 		return
 	}
 
-	// Generate filename with webp extension
-	filename := fmt.Sprintf("%s.webp", id)
-	filepath := filepath.Join(uploadDir, filename)
+	input, _, ok := h.processImageUpload(w, r, id)
+	if !ok {
+		return
+	}
 
-	// Create the output file
-	outFile, err := os.Create(filepath)
+	image, err := h.Store.AddMaterialTypeImage(r.Context(), id, input)
 	if err != nil {
-		writeError(w, http.StatusInternalServerError, "file_error", "Failed to create file")
+		// Duplicate uploads share the files of the existing image
+		if !errors.Is(err, db.ErrDuplicateImage) {
+			h.removeImageFiles(r.Context(), input.OriginalURL, input.Variants)
+		}
+		writeImageStoreError(w, r, err)
 		return
 	}
-	defer outFile.Close()
+	writeJSON(w, http.StatusCreated, image)
+}
+
+// UpdateMaterialTypeImageRequest represents the request body for updating an image
+type UpdateMaterialTypeImageRequest struct {
+	AltText string `json:"altText"`
+}
 
-	// Encode as webp
-	if err := encodeWebP(outFile, img); err != nil {
-		writeError(w, http.StatusInternalServerError, "encode_error", "Failed to encode image")
+// UpdateMaterialTypeImageAltText changes the alt text of an image
+func (h *UploadHandler) UpdateMaterialTypeImageAltText(w http.ResponseWriter, r *http.Request) {
+	var req UpdateMaterialTypeImageRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, http.StatusBadRequest, "invalid_json", "Invalid JSON body")
 		return
 	}
 
-	// Generate the URL (relative path for production flexibility)
-	imageURL := fmt.Sprintf("/uploads/material-types/%s", filename)
+	image, err := h.Store.UpdateMaterialTypeImageAltText(r.Context(), chi.URLParam(r, "id"), chi.URLParam(r, "imageId"), strings.TrimSpace(req.AltText))
+	if err != nil {
+		writeImageStoreError(w, r, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, image)
+}
 
-	// Update the material type with the new image URL
-	if err := h.Store.UpdateMaterialTypeImage(r.Context(), id, imageURL); err != nil {
-		writeError(w, http.StatusInternalServerError, "update_error", "Failed to update material type")
+// ReorderMaterialTypeImagesRequest represents the request body for reordering images
+type ReorderMaterialTypeImagesRequest struct {
+	ImageIDs []string `json:"imageIds"`
+}
+
+// ReorderMaterialTypeImages sets the display order of a material type's images
+func (h *UploadHandler) ReorderMaterialTypeImages(w http.ResponseWriter, r *http.Request) {
+	var req ReorderMaterialTypeImagesRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, http.StatusBadRequest, "invalid_json", "Invalid JSON body")
 		return
 	}
 
-	writeJSON(w, http.StatusOK, map[string]string{
-		"imageUrl": imageURL,
-		"format":   format,
-	})
+	images, err := h.Store.ReorderMaterialTypeImages(r.Context(), chi.URLParam(r, "id"), req.ImageIDs)
+	if err != nil {
+		writeImageStoreError(w, r, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, images)
+}
+
+// DeleteMaterialTypeImage removes an image and its files
+func (h *UploadHandler) DeleteMaterialTypeImage(w http.ResponseWriter, r *http.Request) {
+	image, err := h.Store.DeleteMaterialTypeImage(r.Context(), chi.URLParam(r, "id"), chi.URLParam(r, "imageId"))
+	if err != nil {
+		writeImageStoreError(w, r, err)
+		return
+	}
+	h.removeImageFiles(r.Context(), image.OriginalURL, image.Variants)
+	writeJSON(w, http.StatusOK, map[string]string{"status": "deleted"})
 }
 
-// isValidImageType checks if the content type is a valid image type
-func isValidImageType(contentType string) bool {
-	validTypes := []string{
-		"image/jpeg",
-		"image/jpg",
-		"image/png",
-		"image/webp",
-		"image/gif",
+func writeImageStoreError(w http.ResponseWriter, r *http.Request, err error) {
+	switch {
+	case errors.Is(err, db.ErrMaterialTypeNotFound):
+		writeError(w, http.StatusNotFound, "not_found", "Material type not found")
+	case errors.Is(err, db.ErrImageNotFound):
+		writeError(w, http.StatusNotFound, "not_found", "Image not found")
+	case errors.Is(err, db.ErrDuplicateImage):
+		writeError(w, http.StatusConflict, "duplicate_image", "This image is already part of the material type")
+	case errors.Is(err, db.ErrImageOrderMismatch):
+		writeError(w, http.StatusBadRequest, "validation_error", "imageIds must list every image exactly once")
+	default:
+		serverError(w, r, err, "update_error", "Failed to update material type images")
 	}
-	for _, t := range validTypes {
-		if strings.EqualFold(contentType, t) {
-			return true
+}
+
+// processImageUpload reads the uploaded image, stores the original and
+// generates all size variants under content-hashed filenames
+func (h *UploadHandler) processImageUpload(w http.ResponseWriter, r *http.Request, id string) (db.MaterialTypeImageInput, string, bool) {
+	r.Body = http.MaxBytesReader(w, r.Body, maxUploadBytes)
+
+	// Parse multipart form with 10MB max memory
+	if err := r.ParseMultipartForm(10 << 20); err != nil {
+		var tooLarge *http.MaxBytesError
+		if errors.As(err, &tooLarge) {
+			writeError(w, http.StatusRequestEntityTooLarge, "file_too_large", fmt.Sprintf("Upload exceeds %d MB", maxUploadBytes>>20))
+			return db.MaterialTypeImageInput{}, "", false
 		}
+		writeError(w, http.StatusBadRequest, "invalid_form", "Failed to parse form")
+		return db.MaterialTypeImageInput{}, "", false
 	}
-	return false
-}
-
-// decodeImage decodes an image from a reader based on content type
-func decodeImage(r io.Reader, contentType string) (image.Image, string, error) {
-	switch contentType {
-	case "image/jpeg", "image/jpg":
-		img, err := jpeg.Decode(r)
-		return img, "jpeg", err
-	case "image/png":
-		img, err := png.Decode(r)
-		return img, "png", err
-	case "image/webp":
-		img, err := webp.Decode(r)
-		return img, "webp", err
-	default:
-		// Try to detect format automatically
-		img, format, err := image.Decode(r)
-		return img, format, err
+
+	// Get the file from the form
+	file, _, err := r.FormFile("image")
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "missing_file", "No image file provided")
+		return db.MaterialTypeImageInput{}, "", false
+	}
+	defer file.Close()
+
+	data, err := io.ReadAll(file)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "read_error", "Failed to read image")
+		return db.MaterialTypeImageInput{}, "", false
+	}
+	h.Metrics.ObserveUpload("image", int64(len(data)))
+
+	input, format, err := storeImage(r.Context(), h.Storage, id, data, strings.TrimSpace(r.FormValue("altText")))
+	switch {
+	case errors.Is(err, errUnsupportedImage):
+		writeError(w, http.StatusUnsupportedMediaType, "invalid_type", "Invalid image type. Allowed: jpeg, png, webp, gif")
+		return db.MaterialTypeImageInput{}, "", false
+	case errors.Is(err, errImageTooLarge):
+		writeError(w, http.StatusRequestEntityTooLarge, "image_too_large", fmt.Sprintf("Image exceeds %d megapixels", maxImagePixels/1_000_000))
+		return db.MaterialTypeImageInput{}, "", false
+	case errors.As(err, new(imageDecodeError)):
+		writeError(w, http.StatusBadRequest, "decode_error", "Failed to decode image")
+		return db.MaterialTypeImageInput{}, "", false
+	case err != nil:
+		serverError(w, r, err, "file_error", "Failed to store image")
+		return db.MaterialTypeImageInput{}, "", false
+	}
+	return input, format, true
+}
+
+// imageDecodeError wraps validation failures of uploaded image data
+type imageDecodeError struct {
+	err error
+}
+
+func (e imageDecodeError) Error() string { return e.err.Error() }
+func (e imageDecodeError) Unwrap() error { return e.err }
+
+// imageContentHash returns the short content hash used in upload filenames
+func imageContentHash(data []byte) string {
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])[:16]
+}
+
+// storeImage validates an image, stores the original and generates all size
+// variants under content-hashed keys. Invalid images are reported as
+// imageDecodeError; files written before a failure are removed again.
+func storeImage(ctx context.Context, store storage.Storage, id string, data []byte, altText string) (db.MaterialTypeImageInput, string, error) {
+	// Validate and decode the image; the client-supplied content type is ignored
+	upload, err := decodeUploadedImage(data)
+	if err != nil {
+		return db.MaterialTypeImageInput{}, "", imageDecodeError{err}
+	}
+	img, format := upload.Image, upload.Format
+
+	hash := imageContentHash(data)
+	dir := path.Join("material-types", id)
+
+	originalKey := path.Join(dir, fmt.Sprintf("%s.%s", hash, format))
+	if err := store.Put(ctx, originalKey, bytes.NewReader(upload.Data), int64(len(upload.Data)), "image/"+format); err != nil {
+		return db.MaterialTypeImageInput{}, "", err
+	}
+	input := db.MaterialTypeImageInput{
+		AltText:     altText,
+		ContentHash: hash,
+		OriginalURL: store.PublicURL(originalKey),
+	}
+
+	for _, size := range imageVariantSizes {
+		resized := resizeImage(img, size.MaxWidth, size.MaxHeight)
+		key := path.Join(dir, fmt.Sprintf("%s-%s.webp", hash, size.Name))
+		var buf bytes.Buffer
+		if err := encodeWebP(&buf, resized); err != nil {
+			removeImageFiles(ctx, store, input.OriginalURL, input.Variants)
+			return db.MaterialTypeImageInput{}, "", err
+		}
+		if err := store.Put(ctx, key, &buf, int64(buf.Len()), "image/webp"); err != nil {
+			removeImageFiles(ctx, store, input.OriginalURL, input.Variants)
+			return db.MaterialTypeImageInput{}, "", err
+		}
+		input.Variants = append(input.Variants, domain.ImageVariant{
+			Name:   size.Name,
+			URL:    store.PublicURL(key),
+			Width:  resized.Bounds().Dx(),
+			Height: resized.Bounds().Dy(),
+		})
+	}
+
+	return input, format, nil
+}
+
+// removeImageFiles deletes the original and variant files of an image
+func (h *UploadHandler) removeImageFiles(ctx context.Context, originalURL string, variants []domain.ImageVariant) {
+	removeImageFiles(ctx, h.Storage, originalURL, variants)
+}
+
+func removeImageFiles(ctx context.Context, store storage.Storage, originalURL string, variants []domain.ImageVariant) {
+	urls := []string{originalURL}
+	for _, v := range variants {
+		urls = append(urls, v.URL)
+	}
+	for _, url := range urls {
+		if key, ok := store.KeyFromURL(url); ok {
+			_ = store.Delete(ctx, key)
+		}
+	}
+}
+
+// removeLegacyImage deletes the single {id}.webp file written before image galleries existed
+func (h *UploadHandler) removeLegacyImage(ctx context.Context, id string) {
+	_ = h.Storage.Delete(ctx, path.Join("material-types", id+".webp"))
+}
+
+// removeMaterialTypeFiles deletes every uploaded file of a material type
+func removeMaterialTypeFiles(ctx context.Context, store storage.Storage, id string) {
+	_ = store.DeletePrefix(ctx, path.Join("material-types", id)+"/")
+	_ = store.Delete(ctx, path.Join("material-types", id+".webp"))
+}
+
+// ServeUpload serves a stored file, redirecting to a presigned URL when enabled
+func (h *UploadHandler) ServeUpload(w http.ResponseWriter, r *http.Request) {
+	key := chi.URLParam(r, "*")
+
+	if h.PresignExpiry > 0 {
+		url, err := h.Storage.PresignedURL(r.Context(), key, h.PresignExpiry)
+		if err != nil {
+			serverError(w, r, err, "presign_failed", "Failed to create download URL")
+			return
+		}
+		if url != "" {
+			http.Redirect(w, r, url, http.StatusFound)
+			return
+		}
+	}
+
+	body, info, err := h.Storage.Get(r.Context(), key)
+	if errors.Is(err, storage.ErrNotFound) {
+		http.NotFound(w, r)
+		return
 	}
+	if err != nil {
+		serverError(w, r, err, "read_failed", "Failed to read file")
+		return
+	}
+	defer body.Close()
+
+	if info.ContentType != "" {
+		w.Header().Set("Content-Type", info.ContentType)
+	}
+	if seeker, ok := body.(io.ReadSeeker); ok {
+		http.ServeContent(w, r, path.Base(key), info.LastModified, seeker)
+		return
+	}
+	w.Header().Set("Content-Length", strconv.FormatInt(info.Size, 10))
+	_, _ = io.Copy(w, body)
+}
+
+// UploadCacheHeaders marks content-hashed uploads as immutable so browsers and
+// proxies can cache them for a long time
+func UploadCacheHeaders(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if hashedUploadPattern.MatchString(r.URL.Path) {
+			w.Header().Set("Cache-Control", "public, max-age=31536000, immutable")
+		} else {
+			w.Header().Set("Cache-Control", "no-cache")
+		}
+		next.ServeHTTP(w, r)
+	})
 }
 
 // resizeImage resizes an image to fit within maxWidth and maxHeight while maintaining aspect ratio
@@ -160,8 +413,9 @@ func resizeImage(img image.Image, maxWidth, maxHeight int) image.Image {
 		return img
 	}
 
-	newWidth := int(float64(width) * scale)
-	newHeight := int(float64(height) * scale)
+	// Extreme aspect ratios would otherwise round one side down to zero
+	newWidth := max(1, int(float64(width)*scale))
+	newHeight := max(1, int(float64(height)*scale))
 
 	// Create new image with the calculated size
 	newImg := image.NewRGBA(image.Rect(0, 0, newWidth, newHeight))
@@ -0,0 +1,34 @@
+package audit
+
+import "context"
+
+type contextKey string
+
+const actorContextKey contextKey = "auditActor"
+
+// Actor describes who performed a mutation and where it came from
+type Actor struct {
+	UserID    string
+	Email     string
+	RequestID string
+	IP        string
+}
+
+// WithActor stores the actor in the context
+func WithActor(ctx context.Context, actor Actor) context.Context {
+	return context.WithValue(ctx, actorContextKey, actor)
+}
+
+// WithUser attaches the authenticated user to the actor already stored in the context
+func WithUser(ctx context.Context, userID, email string) context.Context {
+	actor := ActorFromContext(ctx)
+	actor.UserID = userID
+	actor.Email = email
+	return WithActor(ctx, actor)
+}
+
+// ActorFromContext returns the actor stored in the context, or an empty actor
+func ActorFromContext(ctx context.Context) Actor {
+	actor, _ := ctx.Value(actorContextKey).(Actor)
+	return actor
+}
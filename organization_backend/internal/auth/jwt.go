@@ -14,14 +14,14 @@ type Claims struct {
 	jwt.RegisteredClaims
 }
 
-func GenerateToken(customerID, email, workOSUserID string, isAdmin bool, secret string) (string, error) {
+func GenerateToken(customerID, email, workOSUserID string, isAdmin bool, secret string, ttl time.Duration) (string, error) {
 	claims := Claims{
 		CustomerID:   customerID,
 		Email:        email,
 		WorkOSUserID: workOSUserID,
 		IsAdmin:      isAdmin,
 		RegisteredClaims: jwt.RegisteredClaims{
-			ExpiresAt: jwt.NewNumericDate(time.Now().Add(24 * time.Hour)),
+			ExpiresAt: jwt.NewNumericDate(time.Now().Add(ttl)),
 			IssuedAt:  jwt.NewNumericDate(time.Now()),
 		},
 	}
@@ -2,14 +2,23 @@ package auth
 
 import (
 	"context"
+	"net/http"
+	"time"
 
 	"github.com/workos/workos-go/v4/pkg/usermanagement"
+	"go.opentelemetry.io/contrib/instrumentation/net/http/otelhttp"
 )
 
 var clientID string
 
+// InitWorkOS configures the WorkOS client. Calls are traced as client spans
+// of the request that made them.
 func InitWorkOS(apiKey, cid string) {
 	usermanagement.SetAPIKey(apiKey)
+	usermanagement.DefaultClient.HTTPClient = &http.Client{
+		Timeout:   10 * time.Second,
+		Transport: otelhttp.NewTransport(http.DefaultTransport),
+	}
 	clientID = cid
 }
 
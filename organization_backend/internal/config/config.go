@@ -1,63 +1,485 @@
+// Package config loads the server configuration. Values are layered with
+// increasing precedence: defaults, the YAML file, environment variables and
+// command line flags. Every field has a YAML key, a flag named after its YAML
+// path (e.g. -database.url) and usually an environment variable. Secrets can
+// also be read from the file named by their variable with a _FILE suffix,
+// e.g. JWT_SECRET_FILE.
 package config
 
 import (
-	"errors"
-	"os"
-	"path/filepath"
+	"fmt"
+	"net/netip"
+	"net/url"
+	"strings"
+	"time"
 
-	"github.com/joho/godotenv"
-	"gopkg.in/yaml.v3"
+	"organization_backend/internal/storage"
 )
 
+// Config is the configuration of the server
 type Config struct {
-	DatabaseURL    string `yaml:"DATABASE_URL"`
-	WorkOSAPIKey   string
-	WorkOSClientID string
-	JWTSecret      string
+	Server   ServerConfig   `yaml:"server"`
+	Log      LogConfig      `yaml:"log"`
+	Metrics  MetricsConfig  `yaml:"metrics"`
+	Tracing  TracingConfig  `yaml:"tracing"`
+	Database DatabaseConfig `yaml:"database"`
+	Auth     AuthConfig     `yaml:"auth"`
+	App      AppConfig      `yaml:"app"`
+	Uploads  UploadsConfig  `yaml:"uploads"`
+	SSE      SSEConfig      `yaml:"sse"`
+	Jobs     JobsConfig     `yaml:"jobs"`
+	Email    EmailConfig    `yaml:"email"`
+	Routing  RoutingConfig  `yaml:"routing"`
 }
 
-func Load() (Config, error) {
-	// Load .env file if it exists
-	_ = godotenv.Load(".env")
+// ServerConfig configures the HTTP server. WriteTimeout applies to the whole
+// response, so it also ends long running exports and event streams.
+type ServerConfig struct {
+	Addr              string        `yaml:"addr" env:"LISTEN_ADDR"`
+	ReadHeaderTimeout time.Duration `yaml:"readHeaderTimeout" env:"SERVER_READ_HEADER_TIMEOUT"`
+	ReadTimeout       time.Duration `yaml:"readTimeout" env:"SERVER_READ_TIMEOUT"`
+	WriteTimeout      time.Duration `yaml:"writeTimeout" env:"SERVER_WRITE_TIMEOUT"`
+	IdleTimeout       time.Duration `yaml:"idleTimeout" env:"SERVER_IDLE_TIMEOUT"`
+	// ShutdownTimeout is how long open requests may take to finish on shutdown
+	ShutdownTimeout time.Duration `yaml:"shutdownTimeout" env:"SERVER_SHUTDOWN_TIMEOUT"`
+	// ShutdownDelay is how long /readyz reports failure before the server
+	// stops accepting connections, so load balancers can take it out first
+	ShutdownDelay time.Duration `yaml:"shutdownDelay" env:"SERVER_SHUTDOWN_DELAY"`
+}
+
+// LogConfig configures the structured logs written to stderr
+type LogConfig struct {
+	// Level is debug, info, warn or error
+	Level string `yaml:"level" env:"LOG_LEVEL"`
+	// Format is json for log collectors or text for reading in a terminal
+	Format string `yaml:"format" env:"LOG_FORMAT"`
+}
+
+// MetricsConfig exposes Prometheus metrics at /metrics. With Addr they are
+// served on a separate listener, e.g. one only reachable from the cluster;
+// otherwise the API serves them when Token is set. Token is required as a
+// bearer token in both cases when set. Without either, metrics are not exposed.
+type MetricsConfig struct {
+	Addr  string `yaml:"addr" env:"METRICS_ADDR"`
+	Token string `yaml:"token" env:"METRICS_TOKEN" secret:"true"`
+}
+
+// TracingConfig selects where OpenTelemetry spans are exported
+type TracingConfig struct {
+	// Exporter is none, stdout or otlp
+	Exporter string `yaml:"exporter" env:"TRACING_EXPORTER"`
+	// Endpoint is the OTLP/HTTP traces URL of the collector
+	Endpoint string `yaml:"endpoint" env:"OTEL_EXPORTER_OTLP_TRACES_ENDPOINT"`
+	// Headers are key=value pairs sent with every export, e.g. an API key
+	Headers     []string `yaml:"headers" env:"OTEL_EXPORTER_OTLP_HEADERS" secret:"true"`
+	ServiceName string   `yaml:"serviceName" env:"OTEL_SERVICE_NAME"`
+	// SampleRatio is the share of new traces recorded, from 0 to 1
+	SampleRatio float64 `yaml:"sampleRatio" env:"TRACING_SAMPLE_RATIO"`
+}
+
+// DatabaseConfig configures the PostgreSQL connection pool
+type DatabaseConfig struct {
+	URL             string        `yaml:"url" env:"DATABASE_URL" secret:"true"`
+	MaxOpenConns    int           `yaml:"maxOpenConns" env:"DB_MAX_OPEN_CONNS"`
+	MaxIdleConns    int           `yaml:"maxIdleConns" env:"DB_MAX_IDLE_CONNS"`
+	ConnMaxLifetime time.Duration `yaml:"connMaxLifetime" env:"DB_CONN_MAX_LIFETIME"`
+	// AutoMigrate applies pending migrations on server start. Disable it to
+	// run them separately with orgctl migrate up.
+	AutoMigrate bool `yaml:"autoMigrate" env:"DB_AUTO_MIGRATE"`
+}
+
+// AuthConfig configures WorkOS and the session tokens issued after login
+type AuthConfig struct {
+	JWTSecret      string        `yaml:"jwtSecret" env:"JWT_SECRET" secret:"true"`
+	TokenTTL       time.Duration `yaml:"tokenTTL" env:"JWT_TOKEN_TTL"`
+	WorkOSAPIKey   string        `yaml:"workosApiKey" env:"WORKOS_API_KEY" secret:"true"`
+	WorkOSClientID string        `yaml:"workosClientId" env:"WORKOS_CLIENT_ID"`
+}
 
-	// Load WorkOS and JWT from environment (or .env file)
-	cfg := Config{
-		WorkOSAPIKey:   os.Getenv("WORKOS_API_KEY"),
-		WorkOSClientID: os.Getenv("WORKOS_CLIENT_ID"),
-		JWTSecret:      os.Getenv("JWT_SECRET"),
+// AppConfig describes the frontends and where the organization is located
+type AppConfig struct {
+	// URL is the base URL of the user frontend, used for links in documents
+	URL string `yaml:"url" env:"APP_URL"`
+	// AdminURL is the base URL of the orgadmin frontend
+	AdminURL string `yaml:"adminUrl" env:"ADMIN_URL"`
+	// TimeZone is the IANA time zone dates are printed and grouped in
+	TimeZone string `yaml:"timeZone" env:"APP_TIMEZONE"`
+
+	// Location is TimeZone loaded by Load
+	Location *time.Location `yaml:"-"`
+}
+
+// UploadsConfig selects where uploaded files are stored
+type UploadsConfig struct {
+	// Driver is "local" or "s3"
+	Driver    string `yaml:"driver" env:"STORAGE_DRIVER"`
+	LocalPath string `yaml:"localPath" env:"UPLOAD_PATH"`
+	// PresignExpiry enables redirects to presigned download URLs for drivers
+	// that support them; zero streams files through the API instead
+	PresignExpiry time.Duration `yaml:"presignExpiry" env:"UPLOAD_PRESIGN_EXPIRY"`
+	S3            S3Config      `yaml:"s3" env:"S3"`
+}
+
+// S3Config configures the S3 compatible storage driver. Its variables are
+// prefixed with S3_.
+type S3Config struct {
+	Endpoint        string `yaml:"endpoint" env:"ENDPOINT"`
+	Region          string `yaml:"region" env:"REGION"`
+	Bucket          string `yaml:"bucket" env:"BUCKET"`
+	AccessKeyID     string `yaml:"accessKeyId" env:"ACCESS_KEY_ID"`
+	SecretAccessKey string `yaml:"secretAccessKey" env:"SECRET_ACCESS_KEY" secret:"true"`
+	UseSSL          bool   `yaml:"useSSL" env:"USE_SSL"`
+	PublicURL       string `yaml:"publicUrl" env:"PUBLIC_URL"`
+}
+
+// Storage returns the storage driver configuration
+func (u UploadsConfig) Storage() storage.Config {
+	return storage.Config{
+		Driver:        u.Driver,
+		LocalPath:     u.LocalPath,
+		PresignExpiry: u.PresignExpiry,
+		S3: storage.S3Config{
+			Endpoint:        u.S3.Endpoint,
+			Region:          u.S3.Region,
+			Bucket:          u.S3.Bucket,
+			AccessKeyID:     u.S3.AccessKeyID,
+			SecretAccessKey: u.S3.SecretAccessKey,
+			UseSSL:          u.S3.UseSSL,
+			PublicURL:       u.S3.PublicURL,
+		},
 	}
+}
 
-	// Load DATABASE_URL from environment or config file
-	if url := os.Getenv("DATABASE_URL"); url != "" {
-		cfg.DatabaseURL = url
-	} else {
-		path := os.Getenv("CONFIG_PATH")
-		if path == "" {
-			path = "config.yaml"
+// SSEConfig configures the server-sent event streams of request updates
+type SSEConfig struct {
+	// HeartbeatInterval is how often idle streams send a comment so proxies
+	// keep them open; zero disables heartbeats
+	HeartbeatInterval time.Duration `yaml:"heartbeatInterval" env:"SSE_HEARTBEAT_INTERVAL"`
+	// BufferSize is how many updates are queued per subscriber before
+	// further updates are dropped
+	BufferSize int `yaml:"bufferSize" env:"SSE_BUFFER_SIZE"`
+	// ListenerMinReconnect and ListenerMaxReconnect bound the backoff of the
+	// PostgreSQL LISTEN connection
+	ListenerMinReconnect time.Duration `yaml:"listenerMinReconnect" env:"SSE_LISTENER_MIN_RECONNECT"`
+	ListenerMaxReconnect time.Duration `yaml:"listenerMaxReconnect" env:"SSE_LISTENER_MAX_RECONNECT"`
+}
+
+// JobsConfig configures the background jobs of the server
+type JobsConfig struct {
+	// AnalyticsRefreshInterval is how often the analytics views are
+	// recomputed; zero disables the background refresh
+	AnalyticsRefreshInterval   time.Duration `yaml:"analyticsRefreshInterval" env:"ANALYTICS_REFRESH_INTERVAL"`
+	IdempotencyCleanupInterval time.Duration `yaml:"idempotencyCleanupInterval" env:"IDEMPOTENCY_CLEANUP_INTERVAL"`
+	// RateLimitCleanupInterval only applies to the postgres rate limit store
+	RateLimitCleanupInterval time.Duration `yaml:"rateLimitCleanupInterval" env:"RATE_LIMIT_CLEANUP_INTERVAL"`
+}
+
+// EmailConfig configures emails sent by the service itself over SMTP. Login
+// emails are sent by WorkOS and do not use these settings. An empty SMTPHost
+// disables sending.
+type EmailConfig struct {
+	From         string `yaml:"from" env:"EMAIL_FROM"`
+	SMTPHost     string `yaml:"smtpHost" env:"SMTP_HOST"`
+	SMTPPort     int    `yaml:"smtpPort" env:"SMTP_PORT"`
+	SMTPUsername string `yaml:"smtpUsername" env:"SMTP_USERNAME"`
+	SMTPPassword string `yaml:"smtpPassword" env:"SMTP_PASSWORD" secret:"true"`
+}
+
+// RoutingConfig configures how requests reach the handlers: which origins
+// may call the API, which proxies are trusted and how requests are rate limited
+type RoutingConfig struct {
+	// CORSAllowedOrigins are the origins browsers may call the API from;
+	// they default to the app and admin URLs
+	CORSAllowedOrigins   []string      `yaml:"corsAllowedOrigins" env:"CORS_ALLOWED_ORIGINS"`
+	CORSAllowCredentials bool          `yaml:"corsAllowCredentials" env:"CORS_ALLOW_CREDENTIALS"`
+	CORSMaxAge           time.Duration `yaml:"corsMaxAge" env:"CORS_MAX_AGE"`
+	// TrustedProxies are IP addresses or CIDR ranges of reverse proxies whose
+	// X-Forwarded-For and X-Forwarded-Proto headers are believed
+	TrustedProxies []string `yaml:"trustedProxies" env:"TRUSTED_PROXIES"`
+	// RateLimitStore is "memory" for a single instance or "postgres" to
+	// share rate limits between replicas
+	RateLimitStore string           `yaml:"rateLimitStore" env:"RATE_LIMIT_STORE"`
+	RateLimits     RateLimitsConfig `yaml:"rateLimits" env:"RATE_LIMIT"`
+
+	// TrustedProxyPrefixes is TrustedProxies parsed by Load
+	TrustedProxyPrefixes []netip.Prefix `yaml:"-"`
+}
+
+// RateLimitsConfig holds the limits of the route groups, see api.RateLimits.
+// Their variables are prefixed with RATE_LIMIT_.
+type RateLimitsConfig struct {
+	MagicLinkPerIP    LimitConfig `yaml:"magicLinkPerIp" env:"MAGIC_LINK_IP"`
+	MagicLinkPerEmail LimitConfig `yaml:"magicLinkPerEmail" env:"MAGIC_LINK_EMAIL"`
+	CallbackPerIP     LimitConfig `yaml:"callbackPerIp" env:"CALLBACK_IP"`
+	CallbackFailures  LimitConfig `yaml:"callbackFailures" env:"CALLBACK_FAILURES"`
+	Public            LimitConfig `yaml:"public" env:"PUBLIC"`
+	User              LimitConfig `yaml:"user" env:"USER"`
+}
+
+// LimitConfig is a token bucket of Burst requests refilled every Per. A zero
+// Burst disables the limit.
+type LimitConfig struct {
+	Burst int           `yaml:"burst" env:"BURST"`
+	Per   time.Duration `yaml:"per" env:"PER"`
+}
+
+// Defaults returns the configuration used where nothing else is set
+func Defaults() Config {
+	return Config{
+		Server: ServerConfig{
+			Addr:              ":8080",
+			ReadHeaderTimeout: 5 * time.Second,
+			IdleTimeout:       2 * time.Minute,
+			ShutdownTimeout:   10 * time.Second,
+		},
+		Log: LogConfig{
+			Level:  "info",
+			Format: "json",
+		},
+		Tracing: TracingConfig{
+			Exporter:    "none",
+			Endpoint:    "http://localhost:4318/v1/traces",
+			ServiceName: "organization-backend",
+			SampleRatio: 1,
+		},
+		Database: DatabaseConfig{
+			MaxOpenConns:    20,
+			MaxIdleConns:    5,
+			ConnMaxLifetime: 5 * time.Minute,
+			AutoMigrate:     true,
+		},
+		Auth: AuthConfig{
+			TokenTTL: 24 * time.Hour,
+		},
+		App: AppConfig{
+			URL:      "http://localhost:3000",
+			AdminURL: "http://localhost:3001",
+			TimeZone: "Europe/Berlin",
+		},
+		Uploads: UploadsConfig{
+			Driver:    "local",
+			LocalPath: "uploads",
+			S3:        S3Config{UseSSL: true},
+		},
+		SSE: SSEConfig{
+			HeartbeatInterval:    30 * time.Second,
+			BufferSize:           10,
+			ListenerMinReconnect: 10 * time.Second,
+			ListenerMaxReconnect: 30 * time.Second,
+		},
+		Jobs: JobsConfig{
+			AnalyticsRefreshInterval:   15 * time.Minute,
+			IdempotencyCleanupInterval: time.Hour,
+			RateLimitCleanupInterval:   time.Hour,
+		},
+		Email: EmailConfig{
+			SMTPPort: 587,
+		},
+		Routing: RoutingConfig{
+			CORSMaxAge:     10 * time.Minute,
+			RateLimitStore: "memory",
+			RateLimits: RateLimitsConfig{
+				MagicLinkPerIP:    LimitConfig{Burst: 10, Per: time.Minute},
+				MagicLinkPerEmail: LimitConfig{Burst: 3, Per: 15 * time.Minute},
+				CallbackPerIP:     LimitConfig{Burst: 20, Per: time.Minute},
+				CallbackFailures:  LimitConfig{Burst: 5, Per: 15 * time.Minute},
+				Public:            LimitConfig{Burst: 300, Per: time.Minute},
+				User:              LimitConfig{Burst: 600, Per: time.Minute},
+			},
+		},
+	}
+}
+
+// ValidationError lists every problem found in a configuration
+type ValidationError struct {
+	Problems []string
+}
+
+func (e *ValidationError) Error() string {
+	return "invalid configuration:\n  - " + strings.Join(e.Problems, "\n  - ")
+}
+
+// validate checks cfg and fills in the derived fields
+func (cfg *Config) validate() error {
+	var problems []string
+	add := func(format string, args ...any) {
+		problems = append(problems, fmt.Sprintf(format, args...))
+	}
+	nonNegative := func(name string, d time.Duration) {
+		if d < 0 {
+			add("%s must not be negative", name)
 		}
+	}
 
-		data, err := os.ReadFile(filepath.Clean(path))
-		if err != nil {
-			return Config{}, err
+	if cfg.Server.Addr == "" {
+		add("server.addr is required")
+	}
+	nonNegative("server.readHeaderTimeout", cfg.Server.ReadHeaderTimeout)
+	nonNegative("server.readTimeout", cfg.Server.ReadTimeout)
+	nonNegative("server.writeTimeout", cfg.Server.WriteTimeout)
+	nonNegative("server.idleTimeout", cfg.Server.IdleTimeout)
+	nonNegative("server.shutdownTimeout", cfg.Server.ShutdownTimeout)
+	nonNegative("server.shutdownDelay", cfg.Server.ShutdownDelay)
+
+	switch strings.ToLower(cfg.Log.Level) {
+	case "debug", "info", "warn", "error":
+	default:
+		add("log.level must be debug, info, warn or error")
+	}
+	if cfg.Log.Format != "json" && cfg.Log.Format != "text" {
+		add("log.format must be json or text")
+	}
+
+	if cfg.Metrics.Addr != "" && cfg.Metrics.Addr == cfg.Server.Addr {
+		add("metrics.addr must differ from server.addr")
+	}
+
+	switch cfg.Tracing.Exporter {
+	case "none", "stdout":
+	case "otlp":
+		if u, err := url.Parse(cfg.Tracing.Endpoint); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			add("tracing.endpoint must be an absolute http or https URL")
+		}
+	default:
+		add("tracing.exporter must be none, stdout or otlp")
+	}
+	for _, header := range cfg.Tracing.Headers {
+		if key, _, ok := strings.Cut(header, "="); !ok || strings.TrimSpace(key) == "" {
+			add("tracing.headers must be key=value pairs")
+			break
+		}
+	}
+	if cfg.Tracing.SampleRatio < 0 || cfg.Tracing.SampleRatio > 1 {
+		add("tracing.sampleRatio must be between 0 and 1")
+	}
+
+	if cfg.Database.URL == "" {
+		add("database.url is required (DATABASE_URL)")
+	}
+	if cfg.Database.MaxOpenConns < 1 {
+		add("database.maxOpenConns must be at least 1")
+	}
+	if cfg.Database.MaxIdleConns < 0 || cfg.Database.MaxIdleConns > cfg.Database.MaxOpenConns {
+		add("database.maxIdleConns must be between 0 and database.maxOpenConns")
+	}
+	nonNegative("database.connMaxLifetime", cfg.Database.ConnMaxLifetime)
+
+	if cfg.Auth.JWTSecret == "" {
+		add("auth.jwtSecret is required (JWT_SECRET)")
+	}
+	if cfg.Auth.TokenTTL <= 0 {
+		add("auth.tokenTTL must be positive")
+	}
+	if cfg.Auth.WorkOSAPIKey == "" {
+		add("auth.workosApiKey is required (WORKOS_API_KEY)")
+	}
+	if cfg.Auth.WorkOSClientID == "" {
+		add("auth.workosClientId is required (WORKOS_CLIENT_ID)")
+	}
+
+	cfg.App.URL = strings.TrimRight(cfg.App.URL, "/")
+	cfg.App.AdminURL = strings.TrimRight(cfg.App.AdminURL, "/")
+	for _, field := range []struct{ name, value string }{{"app.url", cfg.App.URL}, {"app.adminUrl", cfg.App.AdminURL}} {
+		if u, err := url.Parse(field.value); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			add("%s must be an absolute http or https URL", field.name)
+		}
+	}
+	if location, err := time.LoadLocation(cfg.App.TimeZone); err != nil || cfg.App.TimeZone == "" {
+		add("app.timeZone must be an IANA time zone name")
+	} else {
+		cfg.App.Location = location
+	}
+
+	switch cfg.Uploads.Driver {
+	case "local":
+		if cfg.Uploads.LocalPath == "" {
+			add("uploads.localPath is required for the local driver")
+		}
+	case "s3":
+		if cfg.Uploads.S3.Endpoint == "" || cfg.Uploads.S3.Bucket == "" {
+			add("uploads.s3.endpoint and uploads.s3.bucket are required for the s3 driver")
 		}
+	default:
+		add("uploads.driver must be local or s3")
+	}
+	nonNegative("uploads.presignExpiry", cfg.Uploads.PresignExpiry)
+
+	nonNegative("sse.heartbeatInterval", cfg.SSE.HeartbeatInterval)
+	if cfg.SSE.BufferSize < 1 {
+		add("sse.bufferSize must be at least 1")
+	}
+	if cfg.SSE.ListenerMinReconnect <= 0 || cfg.SSE.ListenerMaxReconnect < cfg.SSE.ListenerMinReconnect {
+		add("sse.listenerMinReconnect must be positive and not above sse.listenerMaxReconnect")
+	}
+
+	nonNegative("jobs.analyticsRefreshInterval", cfg.Jobs.AnalyticsRefreshInterval)
+	if cfg.Jobs.IdempotencyCleanupInterval <= 0 {
+		add("jobs.idempotencyCleanupInterval must be positive")
+	}
+	if cfg.Jobs.RateLimitCleanupInterval <= 0 {
+		add("jobs.rateLimitCleanupInterval must be positive")
+	}
 
-		if err := yaml.Unmarshal(data, &cfg); err != nil {
-			return Config{}, err
+	if cfg.Email.SMTPHost != "" {
+		if cfg.Email.From == "" {
+			add("email.from is required when email.smtpHost is set")
+		}
+		if cfg.Email.SMTPPort < 1 || cfg.Email.SMTPPort > 65535 {
+			add("email.smtpPort must be a port number")
 		}
 	}
 
-	if cfg.DatabaseURL == "" {
-		return Config{}, errors.New("DATABASE_URL missing")
+	routing := &cfg.Routing
+	for i, origin := range routing.CORSAllowedOrigins {
+		routing.CORSAllowedOrigins[i] = strings.TrimRight(origin, "/")
 	}
-	if cfg.WorkOSAPIKey == "" {
-		return Config{}, errors.New("WORKOS_API_KEY missing")
+	if len(routing.CORSAllowedOrigins) == 0 {
+		routing.CORSAllowedOrigins = []string{cfg.App.URL, cfg.App.AdminURL}
 	}
-	if cfg.WorkOSClientID == "" {
-		return Config{}, errors.New("WORKOS_CLIENT_ID missing")
+	for _, origin := range routing.CORSAllowedOrigins {
+		if origin == "*" && len(routing.CORSAllowedOrigins) > 1 {
+			add("routing.corsAllowedOrigins must not mix * with other origins")
+		}
+		if origin == "*" && routing.CORSAllowCredentials {
+			add("routing.corsAllowCredentials cannot be used with routing.corsAllowedOrigins *")
+		}
 	}
-	if cfg.JWTSecret == "" {
-		return Config{}, errors.New("JWT_SECRET missing")
+	nonNegative("routing.corsMaxAge", routing.CORSMaxAge)
+	routing.TrustedProxyPrefixes = nil
+	for _, proxy := range routing.TrustedProxies {
+		prefix, err := netip.ParsePrefix(proxy)
+		if err != nil {
+			addr, addrErr := netip.ParseAddr(proxy)
+			if addrErr != nil {
+				add("routing.trustedProxies: %q is not an IP address or CIDR range", proxy)
+				continue
+			}
+			prefix = netip.PrefixFrom(addr, addr.BitLen())
+		}
+		routing.TrustedProxyPrefixes = append(routing.TrustedProxyPrefixes, prefix.Masked())
+	}
+	if routing.RateLimitStore != "memory" && routing.RateLimitStore != "postgres" {
+		add("routing.rateLimitStore must be memory or postgres")
+	}
+	limits := []struct {
+		name  string
+		limit LimitConfig
+	}{
+		{"magicLinkPerIp", routing.RateLimits.MagicLinkPerIP},
+		{"magicLinkPerEmail", routing.RateLimits.MagicLinkPerEmail},
+		{"callbackPerIp", routing.RateLimits.CallbackPerIP},
+		{"callbackFailures", routing.RateLimits.CallbackFailures},
+		{"public", routing.RateLimits.Public},
+		{"user", routing.RateLimits.User},
+	}
+	for _, l := range limits {
+		if l.limit.Burst < 0 || (l.limit.Burst > 0 && l.limit.Per <= 0) {
+			add("routing.rateLimits.%s needs a non-negative burst and a positive per", l.name)
+		}
 	}
 
-	return cfg, nil
+	if len(problems) > 0 {
+		return &ValidationError{Problems: problems}
+	}
+	return nil
 }
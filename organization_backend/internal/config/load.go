@@ -0,0 +1,215 @@
+package config
+
+import (
+	"bytes"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/joho/godotenv"
+	"gopkg.in/yaml.v3"
+)
+
+// defaultConfigPath is read when it exists and no other file is named
+const defaultConfigPath = "config.yaml"
+
+var durationType = reflect.TypeOf(time.Duration(0))
+
+// field is a configurable leaf of Config
+type field struct {
+	// Path is the dotted YAML path, which is also the flag name
+	Path string
+	// Env is the environment variable, empty when there is none
+	Env    string
+	Secret bool
+	Value  reflect.Value
+}
+
+// walk calls fn for every configurable field of v in declaration order
+func walk(v reflect.Value, path, env string, fn func(field)) {
+	t := v.Type()
+	for i := 0; i < t.NumField(); i++ {
+		sf := t.Field(i)
+		key := strings.Split(sf.Tag.Get("yaml"), ",")[0]
+		if key == "-" || !sf.IsExported() {
+			continue
+		}
+		if key == "" {
+			key = strings.ToLower(sf.Name)
+		}
+		if path != "" {
+			key = path + "." + key
+		}
+		fv := v.Field(i)
+		envTag := sf.Tag.Get("env")
+		if sf.Type.Kind() == reflect.Struct {
+			prefix := env
+			if envTag != "" {
+				prefix += envTag + "_"
+			}
+			walk(fv, key, prefix, fn)
+			continue
+		}
+		f := field{Path: key, Secret: sf.Tag.Get("secret") == "true", Value: fv}
+		if envTag != "" {
+			f.Env = env + envTag
+		}
+		fn(f)
+	}
+}
+
+// set parses s into the field
+func (f field) set(s string) error {
+	v := f.Value
+	switch {
+	case v.Type() == durationType:
+		d, err := time.ParseDuration(strings.TrimSpace(s))
+		if err != nil {
+			return fmt.Errorf("%q is not a duration like 30s or 15m", s)
+		}
+		v.SetInt(int64(d))
+	case v.Kind() == reflect.String:
+		v.SetString(s)
+	case v.Kind() == reflect.Bool:
+		b, err := strconv.ParseBool(strings.TrimSpace(s))
+		if err != nil {
+			return fmt.Errorf("%q is not true or false", s)
+		}
+		v.SetBool(b)
+	case v.Kind() == reflect.Float64:
+		f, err := strconv.ParseFloat(strings.TrimSpace(s), 64)
+		if err != nil {
+			return fmt.Errorf("%q is not a number", s)
+		}
+		v.SetFloat(f)
+	case v.Kind() == reflect.Int:
+		n, err := strconv.Atoi(strings.TrimSpace(s))
+		if err != nil {
+			return fmt.Errorf("%q is not a number", s)
+		}
+		v.SetInt(int64(n))
+	case v.Kind() == reflect.Slice && v.Type().Elem().Kind() == reflect.String:
+		items := []string{}
+		for _, item := range strings.Split(s, ",") {
+			if item = strings.TrimSpace(item); item != "" {
+				items = append(items, item)
+			}
+		}
+		v.Set(reflect.ValueOf(items))
+	default:
+		return fmt.Errorf("unsupported type %s", v.Type())
+	}
+	return nil
+}
+
+// Load builds the configuration from defaults, the YAML file, environment
+// variables and the flags in args, in that order of precedence. The YAML file
+// is named by the -config flag or CONFIG_PATH and defaults to config.yaml if
+// it exists. A .env file in the working directory is loaded into the
+// environment first. All problems are reported together in a *ValidationError.
+func Load(args []string) (Config, error) {
+	_ = godotenv.Load(".env")
+
+	cfg := Defaults()
+	fs := flag.NewFlagSet("config", flag.ContinueOnError)
+	configPath := fs.String("config", "", "YAML configuration file (env CONFIG_PATH)")
+	flagFields := map[string]field{}
+	walk(reflect.ValueOf(&cfg).Elem(), "", "", func(f field) {
+		usage := f.Path
+		if f.Env != "" {
+			usage += " (env " + f.Env + ")"
+		}
+		fs.String(f.Path, "", usage)
+		flagFields[f.Path] = f
+	})
+	if err := fs.Parse(args); err != nil {
+		return Config{}, err
+	}
+
+	var problems []string
+	if err := readYAML(&cfg, *configPath); err != nil {
+		return Config{}, err
+	}
+
+	walk(reflect.ValueOf(&cfg).Elem(), "", "", func(f field) {
+		if f.Env == "" {
+			return
+		}
+		value, ok := os.LookupEnv(f.Env)
+		if f.Secret {
+			if file := os.Getenv(f.Env + "_FILE"); file != "" {
+				if ok {
+					problems = append(problems, fmt.Sprintf("%s and %s_FILE are both set", f.Env, f.Env))
+					return
+				}
+				data, err := os.ReadFile(filepath.Clean(file))
+				if err != nil {
+					problems = append(problems, fmt.Sprintf("%s_FILE: %v", f.Env, err))
+					return
+				}
+				value, ok = strings.TrimRight(string(data), "\r\n"), true
+			}
+		}
+		if !ok || value == "" {
+			return
+		}
+		if err := f.set(value); err != nil {
+			problems = append(problems, fmt.Sprintf("%s: %v", f.Env, err))
+		}
+	})
+
+	fs.Visit(func(fl *flag.Flag) {
+		f, ok := flagFields[fl.Name]
+		if !ok {
+			return
+		}
+		if err := f.set(fl.Value.String()); err != nil {
+			problems = append(problems, fmt.Sprintf("-%s: %v", fl.Name, err))
+		}
+	})
+
+	if err := cfg.validate(); err != nil {
+		var invalid *ValidationError
+		if !errors.As(err, &invalid) {
+			return Config{}, err
+		}
+		problems = append(problems, invalid.Problems...)
+	}
+	if len(problems) > 0 {
+		return Config{}, &ValidationError{Problems: problems}
+	}
+	return cfg, nil
+}
+
+// readYAML decodes the configuration file over cfg. Unknown keys are errors
+// so that typos do not go unnoticed.
+func readYAML(cfg *Config, path string) error {
+	explicit := path != ""
+	if !explicit {
+		path = os.Getenv("CONFIG_PATH")
+		explicit = path != ""
+	}
+	if !explicit {
+		path = defaultConfigPath
+	}
+	data, err := os.ReadFile(filepath.Clean(path))
+	if errors.Is(err, os.ErrNotExist) && !explicit {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("read config file: %w", err)
+	}
+	decoder := yaml.NewDecoder(bytes.NewReader(data))
+	decoder.KnownFields(true)
+	if err := decoder.Decode(cfg); err != nil && !errors.Is(err, io.EOF) {
+		return fmt.Errorf("parse %s: %w", path, err)
+	}
+	return nil
+}
@@ -0,0 +1,108 @@
+package config
+
+import (
+	"fmt"
+	"io"
+	"reflect"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+// redacted replaces the value of secrets that are set
+const redacted = "REDACTED"
+
+// Print writes cfg as YAML with secrets redacted. Each value is annotated
+// with its environment variable.
+func Print(w io.Writer, cfg Config) error {
+	root := &yaml.Node{Kind: yaml.MappingNode}
+	sections := map[string]*yaml.Node{"": root}
+	var err error
+	walk(reflect.ValueOf(&cfg).Elem(), "", "", func(f field) {
+		if err != nil {
+			return
+		}
+		parent := mappingFor(sections, f.Path)
+		value := &yaml.Node{}
+		switch {
+		case f.Secret && !isEmpty(f.Value):
+			value.SetString(redacted)
+		case f.Value.Type() == durationType:
+			value.SetString(time.Duration(f.Value.Int()).String())
+		default:
+			err = value.Encode(f.Value.Interface())
+		}
+		if f.Env != "" {
+			value.LineComment = f.Env
+		}
+		key := &yaml.Node{Kind: yaml.ScalarNode, Value: f.Path[strings.LastIndex(f.Path, ".")+1:]}
+		parent.Content = append(parent.Content, key, value)
+	})
+	if err != nil {
+		return err
+	}
+
+	encoder := yaml.NewEncoder(w)
+	encoder.SetIndent(2)
+	if err := encoder.Encode(root); err != nil {
+		return fmt.Errorf("print config: %w", err)
+	}
+	return encoder.Close()
+}
+
+// Summary returns cfg as nested maps keyed like the YAML file, with secrets
+// redacted, for diagnostics endpoints
+func Summary(cfg Config) map[string]any {
+	root := map[string]any{}
+	walk(reflect.ValueOf(&cfg).Elem(), "", "", func(f field) {
+		section := root
+		path := strings.Split(f.Path, ".")
+		for _, name := range path[:len(path)-1] {
+			next, ok := section[name].(map[string]any)
+			if !ok {
+				next = map[string]any{}
+				section[name] = next
+			}
+			section = next
+		}
+		var value any
+		switch {
+		case f.Secret && !isEmpty(f.Value):
+			value = redacted
+		case f.Value.Type() == durationType:
+			value = time.Duration(f.Value.Int()).String()
+		default:
+			value = f.Value.Interface()
+		}
+		section[path[len(path)-1]] = value
+	})
+	return root
+}
+
+// isEmpty reports whether a secret is unset
+func isEmpty(v reflect.Value) bool {
+	if v.Kind() == reflect.Slice {
+		return v.Len() == 0
+	}
+	return v.IsZero()
+}
+
+// mappingFor returns the mapping node holding the field at path, creating
+// the mappings of its sections on first use
+func mappingFor(sections map[string]*yaml.Node, path string) *yaml.Node {
+	i := strings.LastIndex(path, ".")
+	if i < 0 {
+		return sections[""]
+	}
+	section := path[:i]
+	if node, ok := sections[section]; ok {
+		return node
+	}
+	parent := mappingFor(sections, section)
+	node := &yaml.Node{Kind: yaml.MappingNode}
+	key := &yaml.Node{Kind: yaml.ScalarNode, Value: section[strings.LastIndex(section, ".")+1:]}
+	parent.Content = append(parent.Content, key, node)
+	sections[section] = node
+	return node
+}
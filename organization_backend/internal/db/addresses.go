@@ -0,0 +1,167 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+
+	"organization_backend/internal/domain"
+)
+
+// ErrAddressSchoolMismatch is returned when a request names a school and a
+// saved address of another school
+var ErrAddressSchoolMismatch = errors.New("address belongs to another school")
+
+const addressColumns = `id, COALESCE(school_id::text, ''), label, line1, line2, city, zip_code, verified_at`
+
+func scanAddress(scanner interface {
+	Scan(dest ...any) error
+}) (domain.Address, error) {
+	var a domain.Address
+	err := scanner.Scan(&a.ID, &a.SchoolID, &a.Label, &a.Line1, &a.Line2, &a.City, &a.ZipCode, &a.VerifiedAt)
+	return a, err
+}
+
+// ListAddresses returns the address book of a user: their personal addresses
+// followed by the addresses of their schools
+func (s *Store) ListAddresses(ctx context.Context, userID string) ([]domain.Address, error) {
+	rows, err := s.db.QueryContext(ctx, `
+		SELECT `+addressColumns+`
+		FROM addresses
+		WHERE user_id = $1
+		   OR school_id IN (SELECT school_id FROM school_members WHERE user_id = $1)
+		ORDER BY school_id NULLS FIRST, created_at, id
+	`, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	addresses := []domain.Address{}
+	for rows.Next() {
+		a, err := scanAddress(rows)
+		if err != nil {
+			return nil, err
+		}
+		addresses = append(addresses, a)
+	}
+	return addresses, rows.Err()
+}
+
+// CreateAddress saves a personal address of a user
+func (s *Store) CreateAddress(ctx context.Context, userID string, input domain.AddressInput) (domain.Address, error) {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return domain.Address{}, err
+	}
+	defer tx.Rollback()
+
+	address, err := scanAddress(tx.QueryRowContext(ctx, `
+		INSERT INTO addresses (user_id, label, line1, line2, city, zip_code)
+		VALUES ($1, $2, $3, $4, $5, $6)
+		RETURNING `+addressColumns,
+		userID, input.Label, input.Line1, input.Line2, input.City, input.ZipCode))
+	if err != nil {
+		return domain.Address{}, err
+	}
+	if err := recordAudit(ctx, tx, AuditActionCreate, AuditEntityAddress, address.ID, nil, address); err != nil {
+		return domain.Address{}, err
+	}
+	if err := tx.Commit(); err != nil {
+		return domain.Address{}, err
+	}
+	return address, nil
+}
+
+// UpdateAddress edits a personal address. Requests made with it keep their
+// copy of the old address.
+func (s *Store) UpdateAddress(ctx context.Context, userID, id string, input domain.AddressInput) (domain.Address, error) {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return domain.Address{}, err
+	}
+	defer tx.Rollback()
+
+	before, err := getPersonalAddress(ctx, tx, userID, id)
+	if err != nil {
+		return domain.Address{}, err
+	}
+	after, err := scanAddress(tx.QueryRowContext(ctx, `
+		UPDATE addresses
+		SET label = $2, line1 = $3, line2 = $4, city = $5, zip_code = $6,
+		    verified_at = CASE WHEN (line1, line2, city, zip_code) = ($3, $4, $5, $6) THEN verified_at END
+		WHERE id = $1
+		RETURNING `+addressColumns,
+		id, input.Label, input.Line1, input.Line2, input.City, input.ZipCode))
+	if err != nil {
+		return domain.Address{}, err
+	}
+	if err := recordAudit(ctx, tx, AuditActionUpdate, AuditEntityAddress, id, before, after); err != nil {
+		return domain.Address{}, err
+	}
+	if err := tx.Commit(); err != nil {
+		return domain.Address{}, err
+	}
+	return after, nil
+}
+
+// DeleteAddress removes a personal address. Requests keep their copy of it.
+func (s *Store) DeleteAddress(ctx context.Context, userID, id string) error {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	before, err := getPersonalAddress(ctx, tx, userID, id)
+	if err != nil {
+		return err
+	}
+	if _, err := tx.ExecContext(ctx, `DELETE FROM addresses WHERE id = $1`, id); err != nil {
+		return err
+	}
+	if err := recordAudit(ctx, tx, AuditActionDelete, AuditEntityAddress, id, before, nil); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+func getPersonalAddress(ctx context.Context, tx *sql.Tx, userID, id string) (domain.Address, error) {
+	address, err := scanAddress(tx.QueryRowContext(ctx, `
+		SELECT `+addressColumns+` FROM addresses WHERE id = $1 AND user_id = $2 FOR UPDATE
+	`, id, userID))
+	if errors.Is(err, sql.ErrNoRows) {
+		return domain.Address{}, ErrAddressNotFound
+	}
+	return address, err
+}
+
+// applySavedAddress copies a saved address the user has access to into the
+// shipping fields of a new request. A school address also selects its school
+// when the request does not name one.
+func applySavedAddress(ctx context.Context, tx *sql.Tx, user userRow, input CreateRequestInput) (CreateRequestInput, error) {
+	address, err := scanAddress(tx.QueryRowContext(ctx, `
+		SELECT `+addressColumns+`
+		FROM addresses
+		WHERE id = $1
+		  AND (user_id = $2 OR school_id IN (SELECT school_id FROM school_members WHERE user_id = $2))
+	`, input.ShippingAddressID, user.ID))
+	if errors.Is(err, sql.ErrNoRows) {
+		return input, ErrAddressNotFound
+	}
+	if err != nil {
+		return input, err
+	}
+	if address.SchoolID != "" {
+		if input.SchoolID == "" {
+			input.SchoolID = address.SchoolID
+		} else if input.SchoolID != address.SchoolID {
+			return input, ErrAddressSchoolMismatch
+		}
+	}
+	input.ShippingAddressLine1 = address.Line1
+	input.ShippingAddressLine2 = address.Line2
+	input.ShippingCity = address.City
+	input.ShippingZipCode = address.ZipCode
+	return input, nil
+}
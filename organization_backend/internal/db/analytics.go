@@ -0,0 +1,319 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"time"
+)
+
+// Bucket sizes accepted by the time-bucketed analytics queries
+const (
+	AnalyticsIntervalDay   = "day"
+	AnalyticsIntervalWeek  = "week"
+	AnalyticsIntervalMonth = "month"
+)
+
+// analyticsRefreshLock is the advisory lock key that keeps several server
+// instances from refreshing the analytics views at the same time
+const analyticsRefreshLock = 727274
+
+// AnalyticsPeriod is the time range and bucketing of an analytics query.
+// Buckets start at midnight in TimeZone.
+type AnalyticsPeriod struct {
+	From     time.Time
+	To       time.Time
+	Interval string
+	TimeZone string
+}
+
+// StatusBucket counts requests created in a bucket by their current status
+type StatusBucket struct {
+	Start  time.Time      `json:"start"`
+	Counts map[string]int `json:"counts"`
+	Total  int            `json:"total"`
+}
+
+// MaterialTypeDemand is how often a material type was requested
+type MaterialTypeDemand struct {
+	MaterialTypeID string `json:"materialTypeId"`
+	Name           string `json:"name"`
+	Quantity       int    `json:"quantity"`
+	Requests       int    `json:"requests"`
+}
+
+// Utilization is the share of stock that was on loan on average during a
+// period. DistributionCenterID is empty for the total over all centers.
+type Utilization struct {
+	MaterialTypeID       string  `json:"materialTypeId"`
+	Name                 string  `json:"name"`
+	DistributionCenterID string  `json:"distributionCenterId,omitempty"`
+	Stock                int     `json:"stock"`
+	AverageOnLoan        float64 `json:"averageOnLoan"`
+	Percent              float64 `json:"percent"`
+}
+
+// LeadTimeBucket is the time between creating a request and its delivery
+type LeadTimeBucket struct {
+	Start       time.Time `json:"start"`
+	Requests    int       `json:"requests"`
+	AverageDays float64   `json:"averageDays"`
+	MedianDays  float64   `json:"medianDays"`
+}
+
+// ReturnPunctuality summarizes returns that were due in a period. Returns on
+// the due day count as on time.
+type ReturnPunctuality struct {
+	Due              int     `json:"due"`
+	OnTime           int     `json:"onTime"`
+	Late             int     `json:"late"`
+	Overdue          int     `json:"overdue"`
+	Open             int     `json:"open"`
+	OnTimePercent    float64 `json:"onTimePercent"`
+	AverageDelayDays float64 `json:"averageDelayDays"`
+}
+
+// RegionReach counts the schools with deliveries in a region, identified by
+// the leading digits of the zip code
+type RegionReach struct {
+	Region   string `json:"region"`
+	Schools  int    `json:"schools"`
+	Requests int    `json:"requests"`
+}
+
+// RefreshAnalytics recomputes the analytics views. It returns without doing
+// anything when another instance is already refreshing.
+func (s *Store) RefreshAnalytics(ctx context.Context) error {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	var locked bool
+	if err := tx.QueryRowContext(ctx, `SELECT pg_try_advisory_xact_lock($1)`, analyticsRefreshLock).Scan(&locked); err != nil {
+		return err
+	}
+	if !locked {
+		return nil
+	}
+	// The loans view reads the request facts, so it has to be refreshed second
+	for _, stmt := range []string{
+		`REFRESH MATERIALIZED VIEW CONCURRENTLY analytics_request_facts`,
+		`REFRESH MATERIALIZED VIEW CONCURRENTLY analytics_item_loans`,
+		`UPDATE analytics_refreshes SET refreshed_at = now()`,
+	} {
+		if _, err := tx.ExecContext(ctx, stmt); err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+// AnalyticsRefreshedAt returns when the analytics views were last refreshed
+func (s *Store) AnalyticsRefreshedAt(ctx context.Context) (time.Time, error) {
+	var refreshedAt time.Time
+	err := s.db.QueryRowContext(ctx, `SELECT refreshed_at FROM analytics_refreshes`).Scan(&refreshedAt)
+	return refreshedAt, err
+}
+
+// RequestsByStatus counts requests created in the period per bucket and current status
+func (s *Store) RequestsByStatus(ctx context.Context, period AnalyticsPeriod) ([]StatusBucket, error) {
+	rows, err := s.db.QueryContext(ctx, `
+		SELECT date_trunc($3, created_at AT TIME ZONE $4) AT TIME ZONE $4 AS bucket, status, count(*)
+		FROM analytics_request_facts
+		WHERE created_at >= $1 AND created_at < $2
+		GROUP BY bucket, status
+		ORDER BY bucket, status
+	`, period.From, period.To, period.Interval, period.TimeZone)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	result := []StatusBucket{}
+	for rows.Next() {
+		var start time.Time
+		var status string
+		var count int
+		if err := rows.Scan(&start, &status, &count); err != nil {
+			return nil, err
+		}
+		if len(result) == 0 || !result[len(result)-1].Start.Equal(start) {
+			result = append(result, StatusBucket{Start: start, Counts: map[string]int{}})
+		}
+		bucket := &result[len(result)-1]
+		bucket.Counts[status] = count
+		bucket.Total += count
+	}
+	return result, rows.Err()
+}
+
+// TopMaterialTypes returns the material types requested most often in
+// requests created during the period, by quantity
+func (s *Store) TopMaterialTypes(ctx context.Context, from, to time.Time, limit int) ([]MaterialTypeDemand, error) {
+	rows, err := s.db.QueryContext(ctx, `
+		SELECT l.material_type_id, COALESCE(mt.name, l.material_type_id), sum(l.quantity), count(*)
+		FROM analytics_item_loans l
+		LEFT JOIN material_types mt ON mt.id = l.material_type_id
+		WHERE l.created_at >= $1 AND l.created_at < $2
+		GROUP BY l.material_type_id, mt.name
+		ORDER BY sum(l.quantity) DESC, l.material_type_id
+		LIMIT $3
+	`, from, to, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	result := []MaterialTypeDemand{}
+	for rows.Next() {
+		var d MaterialTypeDemand
+		if err := rows.Scan(&d.MaterialTypeID, &d.Name, &d.Quantity, &d.Requests); err != nil {
+			return nil, err
+		}
+		result = append(result, d)
+	}
+	return result, rows.Err()
+}
+
+// MaterialUtilization returns how much of the stock of each material type
+// was on loan on average during the period, per distribution center and in
+// total. Loans of requests that are not routed to a center only count
+// towards the total.
+func (s *Store) MaterialUtilization(ctx context.Context, from, to time.Time) ([]Utilization, error) {
+	rows, err := s.db.QueryContext(ctx, `
+		WITH loans AS (
+			SELECT material_type_id, distribution_center_id,
+			       GROUPING(distribution_center_id) = 1 AS all_centers,
+			       sum(quantity * EXTRACT(EPOCH FROM LEAST(loan_end, $2) - GREATEST(loan_start, $1))) AS unit_seconds
+			FROM analytics_item_loans
+			WHERE loan_start < $2 AND loan_end > $1
+			GROUP BY GROUPING SETS ((material_type_id, distribution_center_id), (material_type_id))
+		), stock AS (
+			SELECT material_type_id, distribution_center_id,
+			       GROUPING(distribution_center_id) = 1 AS all_centers,
+			       sum(amount) AS amount
+			FROM material_available
+			GROUP BY GROUPING SETS ((material_type_id, distribution_center_id), (material_type_id))
+		)
+		SELECT s.material_type_id, mt.name, s.distribution_center_id, s.all_centers, s.amount,
+		       COALESCE(l.unit_seconds, 0)
+		FROM stock s
+		JOIN material_types mt ON mt.id = s.material_type_id
+		LEFT JOIN loans l ON l.material_type_id = s.material_type_id
+		                 AND l.all_centers = s.all_centers
+		                 AND l.distribution_center_id IS NOT DISTINCT FROM s.distribution_center_id
+		WHERE mt.archived_at IS NULL
+		ORDER BY mt.name, s.all_centers DESC, s.distribution_center_id
+	`, from, to)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	seconds := to.Sub(from).Seconds()
+	result := []Utilization{}
+	for rows.Next() {
+		var u Utilization
+		var centerID sql.NullString
+		var allCenters bool
+		var unitSeconds float64
+		if err := rows.Scan(&u.MaterialTypeID, &u.Name, &centerID, &allCenters, &u.Stock, &unitSeconds); err != nil {
+			return nil, err
+		}
+		if !allCenters {
+			u.DistributionCenterID = centerID.String
+		}
+		if seconds > 0 {
+			u.AverageOnLoan = unitSeconds / seconds
+		}
+		if u.Stock > 0 {
+			u.Percent = u.AverageOnLoan / float64(u.Stock) * 100
+		}
+		result = append(result, u)
+	}
+	return result, rows.Err()
+}
+
+// LeadTimes returns the time between creation and delivery of requests
+// created in the period, per bucket
+func (s *Store) LeadTimes(ctx context.Context, period AnalyticsPeriod) ([]LeadTimeBucket, error) {
+	rows, err := s.db.QueryContext(ctx, `
+		SELECT date_trunc($3, created_at AT TIME ZONE $4) AT TIME ZONE $4 AS bucket,
+		       count(*),
+		       avg(EXTRACT(EPOCH FROM delivery_date - created_at)) / 86400,
+		       percentile_cont(0.5) WITHIN GROUP (ORDER BY EXTRACT(EPOCH FROM delivery_date - created_at)) / 86400
+		FROM analytics_request_facts
+		WHERE created_at >= $1 AND created_at < $2
+		GROUP BY bucket
+		ORDER BY bucket
+	`, period.From, period.To, period.Interval, period.TimeZone)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	result := []LeadTimeBucket{}
+	for rows.Next() {
+		var b LeadTimeBucket
+		if err := rows.Scan(&b.Start, &b.Requests, &b.AverageDays, &b.MedianDays); err != nil {
+			return nil, err
+		}
+		result = append(result, b)
+	}
+	return result, rows.Err()
+}
+
+// ReturnPunctualityBetween summarizes returns due in the period
+func (s *Store) ReturnPunctualityBetween(ctx context.Context, from, to time.Time) (ReturnPunctuality, error) {
+	var p ReturnPunctuality
+	var delay sql.NullFloat64
+	err := s.db.QueryRowContext(ctx, `
+		WITH due AS (
+			SELECT returned_at, return_date + interval '1 day' AS deadline
+			FROM analytics_request_facts
+			WHERE return_date >= $1 AND return_date < $2
+		)
+		SELECT count(*),
+		       count(*) FILTER (WHERE returned_at < deadline),
+		       count(*) FILTER (WHERE returned_at >= deadline),
+		       count(*) FILTER (WHERE returned_at IS NULL AND deadline <= now()),
+		       count(*) FILTER (WHERE returned_at IS NULL AND deadline > now()),
+		       avg(EXTRACT(EPOCH FROM returned_at - deadline)) FILTER (WHERE returned_at >= deadline) / 86400
+		FROM due
+	`, from, to).Scan(&p.Due, &p.OnTime, &p.Late, &p.Overdue, &p.Open, &delay)
+	if err != nil {
+		return ReturnPunctuality{}, err
+	}
+	if settled := p.OnTime + p.Late + p.Overdue; settled > 0 {
+		p.OnTimePercent = float64(p.OnTime) / float64(settled) * 100
+	}
+	p.AverageDelayDays = delay.Float64
+	return p, nil
+}
+
+// SchoolsPerRegion counts schools with deliveries in the period by the first
+// prefixLength digits of the shipping zip code
+func (s *Store) SchoolsPerRegion(ctx context.Context, from, to time.Time, prefixLength int) ([]RegionReach, error) {
+	rows, err := s.db.QueryContext(ctx, `
+		SELECT left(zip_code, $3) AS region, count(DISTINCT customer_id), count(*)
+		FROM analytics_request_facts
+		WHERE delivery_date >= $1 AND delivery_date < $2
+		GROUP BY region
+		ORDER BY region
+	`, from, to, prefixLength)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	result := []RegionReach{}
+	for rows.Next() {
+		var r RegionReach
+		if err := rows.Scan(&r.Region, &r.Schools, &r.Requests); err != nil {
+			return nil, err
+		}
+		result = append(result, r)
+	}
+	return result, rows.Err()
+}
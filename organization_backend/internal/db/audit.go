@@ -0,0 +1,169 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"organization_backend/internal/audit"
+	"organization_backend/internal/domain"
+	"organization_backend/pkg/pagination"
+)
+
+// Audit actions
+const (
+	AuditActionCreate  = "create"
+	AuditActionUpdate  = "update"
+	AuditActionDelete  = "delete"
+	AuditActionArchive = "archive"
+	AuditActionRestore = "restore"
+)
+
+// Audited entity types
+const (
+	AuditEntityMaterialType = "material_type"
+	AuditEntityRequest      = "request"
+	AuditEntityUser         = "user"
+	AuditEntityCategory     = "category"
+	AuditEntityKit          = "kit"
+	AuditEntityImage        = "material_type_image"
+	AuditEntityCenter       = "distribution_center"
+	AuditEntityStock        = "stock"
+	// AuditEntitySchool covers schools with their addresses, contacts and members
+	AuditEntitySchool = "school"
+	// AuditEntityAddress covers personal addresses; school addresses are audited with their school
+	AuditEntityAddress = "address"
+)
+
+type execer interface {
+	ExecContext(ctx context.Context, query string, args ...any) (sql.Result, error)
+}
+
+type ListAuditParams struct {
+	Limit      int
+	Cursor     *pagination.Cursor
+	EntityType string
+	EntityID   string
+	ActorID    string
+}
+
+type ListAuditResult struct {
+	Entries    []domain.AuditEntry `json:"entries"`
+	NextCursor string              `json:"nextCursor,omitempty"`
+}
+
+// recordAudit writes an audit entry for the actor stored in ctx. It should be
+// called with the same transaction as the mutation so both commit together.
+func recordAudit(ctx context.Context, q execer, action, entityType, entityID string, before, after any) error {
+	beforeBytes, err := marshalAuditState(before)
+	if err != nil {
+		return fmt.Errorf("marshal audit before: %w", err)
+	}
+	afterBytes, err := marshalAuditState(after)
+	if err != nil {
+		return fmt.Errorf("marshal audit after: %w", err)
+	}
+
+	actor := audit.ActorFromContext(ctx)
+	_, err = q.ExecContext(ctx, `
+		INSERT INTO audit_log (actor_id, actor_email, action, entity_type, entity_id, before, after, request_id, ip)
+		VALUES ($1,$2,$3,$4,$5,$6,$7,$8,$9)
+	`, nullString(actor.UserID), nullString(actor.Email), action, entityType, entityID,
+		beforeBytes, afterBytes, nullString(actor.RequestID), nullString(actor.IP))
+	if err != nil {
+		return fmt.Errorf("record audit: %w", err)
+	}
+	return nil
+}
+
+func marshalAuditState(state any) ([]byte, error) {
+	if state == nil {
+		return nil, nil
+	}
+	return json.Marshal(state)
+}
+
+func nullString(value string) sql.NullString {
+	return sql.NullString{String: value, Valid: value != ""}
+}
+
+// ListAuditEntries returns audit entries newest first with cursor pagination
+func (s *Store) ListAuditEntries(ctx context.Context, params ListAuditParams) (ListAuditResult, error) {
+	limit := params.Limit
+	if limit <= 0 || limit > 100 {
+		limit = 20
+	}
+
+	args := []any{}
+	where := []string{"1=1"}
+
+	if params.EntityType != "" {
+		args = append(args, params.EntityType)
+		where = append(where, fmt.Sprintf("entity_type = $%d", len(args)))
+	}
+	if params.EntityID != "" {
+		args = append(args, params.EntityID)
+		where = append(where, fmt.Sprintf("entity_id = $%d", len(args)))
+	}
+	if params.ActorID != "" {
+		args = append(args, params.ActorID)
+		where = append(where, fmt.Sprintf("actor_id = $%d::uuid", len(args)))
+	}
+	if params.Cursor != nil {
+		args = append(args, params.Cursor.Time, params.Cursor.ID)
+		where = append(where, fmt.Sprintf("(created_at, id) < ($%d, $%d::uuid)", len(args)-1, len(args)))
+	}
+
+	args = append(args, limit+1)
+	query := fmt.Sprintf(`
+		SELECT id, actor_id, actor_email, action, entity_type, entity_id, before, after, request_id, ip, created_at
+		FROM audit_log
+		WHERE %s
+		ORDER BY created_at DESC, id DESC
+		LIMIT $%d
+	`, strings.Join(where, " AND "), len(args))
+
+	rows, err := s.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return ListAuditResult{}, err
+	}
+	defer rows.Close()
+
+	entries := []domain.AuditEntry{}
+	for rows.Next() {
+		var entry domain.AuditEntry
+		var actorID, actorEmail, requestID, ip sql.NullString
+		var before, after []byte
+		if err := rows.Scan(
+			&entry.ID, &actorID, &actorEmail, &entry.Action, &entry.EntityType, &entry.EntityID,
+			&before, &after, &requestID, &ip, &entry.CreatedAt,
+		); err != nil {
+			return ListAuditResult{}, err
+		}
+		entry.ActorID = actorID.String
+		entry.ActorEmail = actorEmail.String
+		entry.RequestID = requestID.String
+		entry.IP = ip.String
+		if len(before) > 0 {
+			entry.Before = before
+		}
+		if len(after) > 0 {
+			entry.After = after
+		}
+		entries = append(entries, entry)
+	}
+	if err := rows.Err(); err != nil {
+		return ListAuditResult{}, err
+	}
+
+	nextCursor := ""
+	if len(entries) > limit {
+		entries = entries[:limit]
+		last := entries[limit-1]
+		nextCursor = pagination.Encode(pagination.Cursor{Time: last.CreatedAt, ID: last.ID})
+	}
+
+	return ListAuditResult{Entries: entries, NextCursor: nextCursor}, nil
+}
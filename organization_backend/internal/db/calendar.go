@@ -0,0 +1,199 @@
+package db
+
+import (
+	"context"
+	"crypto/rand"
+	"database/sql"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"organization_backend/internal/domain"
+)
+
+// ErrRequestNotFound is returned when a request does not exist
+var ErrRequestNotFound = errors.New("request not found")
+
+// ErrDistributionCenterNotFound is returned when a distribution center does not exist
+var ErrDistributionCenterNotFound = errors.New("distribution center not found")
+
+// ErrCalendarNotFound is returned for unknown calendar feed tokens
+var ErrCalendarNotFound = errors.New("calendar not found")
+
+// CalendarUser is the owner of a calendar feed and decides which requests it contains
+type CalendarUser struct {
+	ID      string
+	IsAdmin bool
+	// DistributionCenterID is set for distribution center staff
+	DistributionCenterID string
+}
+
+// newCalendarToken returns a random URL-safe token
+func newCalendarToken() (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+// GetCalendarToken returns the calendar feed token of a user, creating one on first use
+func (s *Store) GetCalendarToken(ctx context.Context, userID string) (string, error) {
+	token, err := newCalendarToken()
+	if err != nil {
+		return "", err
+	}
+	err = s.db.QueryRowContext(ctx, `
+		UPDATE users SET calendar_token = COALESCE(calendar_token, $2)
+		WHERE id = $1
+		RETURNING calendar_token
+	`, userID, token).Scan(&token)
+	if errors.Is(err, sql.ErrNoRows) {
+		return "", ErrCalendarNotFound
+	}
+	return token, err
+}
+
+// RotateCalendarToken replaces the calendar feed token of a user so the old
+// feed URL stops working
+func (s *Store) RotateCalendarToken(ctx context.Context, userID string) (string, error) {
+	token, err := newCalendarToken()
+	if err != nil {
+		return "", err
+	}
+	res, err := s.db.ExecContext(ctx, `UPDATE users SET calendar_token = $2 WHERE id = $1`, userID, token)
+	if err != nil {
+		return "", err
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return "", ErrCalendarNotFound
+	}
+	return token, nil
+}
+
+// GetCalendarUser looks up the owner of a calendar feed token. Feeds of
+// disabled users are not found.
+func (s *Store) GetCalendarUser(ctx context.Context, token string) (CalendarUser, error) {
+	var user CalendarUser
+	var centerID sql.NullString
+	err := s.db.QueryRowContext(ctx, `
+		SELECT id, is_admin, distribution_center_id
+		FROM users WHERE calendar_token = $1 AND disabled_at IS NULL
+	`, token).Scan(&user.ID, &user.IsAdmin, &centerID)
+	if errors.Is(err, sql.ErrNoRows) {
+		return CalendarUser{}, ErrCalendarNotFound
+	}
+	user.DistributionCenterID = centerID.String
+	return user, err
+}
+
+// ListCalendarRequests returns the requests shown in a user's calendar feed
+// with a delivery or return date at or after since. Admins see all requests,
+// distribution center staff the requests routed to their center and everyone
+// else the requests of their schools.
+func (s *Store) ListCalendarRequests(ctx context.Context, user CalendarUser, since time.Time) ([]domain.Request, error) {
+	args := []any{since}
+	where := []string{"(r.delivery_date >= $1 OR r.return_date >= $1)"}
+	switch {
+	case user.IsAdmin:
+	case user.DistributionCenterID != "":
+		args = append(args, user.DistributionCenterID)
+		where = append(where, fmt.Sprintf("r.distribution_center_id = $%d", len(args)))
+	default:
+		args = append(args, user.ID)
+		where = append(where, fmt.Sprintf(
+			"(r.customer_id = $%[1]d OR r.school_id IN (SELECT school_id FROM school_members WHERE user_id = $%[1]d))", len(args)))
+	}
+
+	rows, err := s.db.QueryContext(ctx, fmt.Sprintf(`
+		SELECT r.id, r.customer_id, r.delivery_date, r.return_date, r.distribution_center_id, r.school_id, r.status, r.shipping_customer_name,
+		       r.shipping_address_line1, r.shipping_address_line2, r.shipping_city, r.shipping_zip_code, r.shipping_address_id,
+		       r.metadata, r.created_at, r.updated_at,
+		       u.email, u.name, u.token, u.workos_user_id, u.email_verified, u.created_at
+		FROM requests r
+		JOIN users u ON r.customer_id = u.id
+		WHERE %s
+		ORDER BY r.delivery_date ASC, r.id ASC
+	`, strings.Join(where, " AND ")), args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var requestRows []requestRow
+	var ids []string
+	for rows.Next() {
+		row, err := scanRequestRow(rows)
+		if err != nil {
+			return nil, err
+		}
+		requestRows = append(requestRows, row)
+		ids = append(ids, row.ID)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	items, err := s.getItemsForRequests(ctx, ids)
+	if err != nil {
+		return nil, err
+	}
+	result := make([]domain.Request, 0, len(requestRows))
+	for _, row := range requestRows {
+		result = append(result, mapRequest(row, items[row.ID]))
+	}
+	return result, nil
+}
+
+// SetRequestDistributionCenter routes a request to a distribution center. An
+// empty centerID removes the routing.
+func (s *Store) SetRequestDistributionCenter(ctx context.Context, requestID, centerID string) (domain.Request, error) {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return domain.Request{}, err
+	}
+	defer tx.Rollback()
+
+	var before sql.NullString
+	err = tx.QueryRowContext(ctx, `
+		SELECT distribution_center_id FROM requests WHERE id = $1 FOR UPDATE
+	`, requestID).Scan(&before)
+	if errors.Is(err, sql.ErrNoRows) {
+		return domain.Request{}, ErrRequestNotFound
+	}
+	if err != nil {
+		return domain.Request{}, err
+	}
+
+	after := sql.NullString{String: centerID, Valid: centerID != ""}
+	if after.Valid {
+		var exists bool
+		if err := tx.QueryRowContext(ctx, `
+			SELECT EXISTS (SELECT 1 FROM distribution_centers WHERE id = $1)
+		`, centerID).Scan(&exists); err != nil {
+			return domain.Request{}, err
+		}
+		if !exists {
+			return domain.Request{}, ErrDistributionCenterNotFound
+		}
+	}
+
+	if _, err := tx.ExecContext(ctx, `
+		UPDATE requests SET distribution_center_id = $2 WHERE id = $1
+	`, requestID, after); err != nil {
+		return domain.Request{}, err
+	}
+	type routing struct {
+		DistributionCenterID string `json:"distributionCenterId"`
+	}
+	if err := recordAudit(ctx, tx, AuditActionUpdate, AuditEntityRequest, requestID,
+		routing{before.String}, routing{after.String}); err != nil {
+		return domain.Request{}, err
+	}
+	if err := tx.Commit(); err != nil {
+		return domain.Request{}, err
+	}
+	return s.GetRequestByID(ctx, requestID)
+}
@@ -0,0 +1,698 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"slices"
+	"sort"
+	"strings"
+
+	"organization_backend/internal/domain"
+
+	"github.com/lib/pq"
+)
+
+// ErrImageNotStored is returned when a catalog import would create an image whose files were not stored yet
+var ErrImageNotStored = errors.New("image files must be stored before the import is committed")
+
+// Catalog import row actions
+const (
+	CatalogActionCreate    = "create"
+	CatalogActionUpdate    = "update"
+	CatalogActionUnchanged = "unchanged"
+	CatalogActionConflict  = "conflict"
+)
+
+// Catalog is a complete snapshot of the material catalog
+type Catalog struct {
+	Categories          []domain.Category
+	MaterialTypes       []domain.MaterialType
+	DistributionCenters []domain.DistributionCenter
+	Stock               []domain.StockLevel
+}
+
+// CatalogImport is merged into the existing catalog. IDs must already be
+// normalized; rows missing from the import are left untouched.
+type CatalogImport struct {
+	Categories          []CatalogCategoryRow
+	MaterialTypes       []CatalogMaterialTypeRow
+	DistributionCenters []CatalogDistributionCenterRow
+	Stock               []CatalogStockRow
+}
+
+type CatalogCategoryRow struct {
+	ID        string
+	ParentID  string
+	Name      string
+	SortOrder int
+}
+
+type CatalogMaterialTypeRow struct {
+	ID          string
+	Name        string
+	Description string
+	CategoryID  string
+	Tags        []string
+	Archived    bool
+	// Images are appended to the gallery unless an image with the same content hash exists
+	Images []MaterialTypeImageInput
+}
+
+// CatalogDistributionCenterRow is matched to existing distribution centers by name
+type CatalogDistributionCenterRow struct {
+	Name    string
+	Address string
+}
+
+// CatalogStockRow sets the stock of a material type at the distribution center
+// with the given name. Row is the data row number reported back.
+type CatalogStockRow struct {
+	Row                int
+	MaterialTypeID     string
+	DistributionCenter string
+	Amount             int
+}
+
+// CatalogImportResult reports what an import did or would do per row
+type CatalogImportResult struct {
+	DryRun    bool               `json:"dryRun"`
+	Committed bool               `json:"committed"`
+	Summary   map[string]int     `json:"summary"`
+	Rows      []CatalogImportRow `json:"rows"`
+}
+
+// CatalogImportRow is the outcome for one row of the archive. Row is the
+// 1-based position within its entity list.
+type CatalogImportRow struct {
+	Entity  string `json:"entity"`
+	Row     int    `json:"row"`
+	ID      string `json:"id"`
+	Action  string `json:"action"`
+	Message string `json:"message,omitempty"`
+}
+
+// Add appends a row and updates the summary counts
+func (r *CatalogImportResult) Add(row CatalogImportRow) {
+	if r.Summary == nil {
+		r.Summary = map[string]int{}
+	}
+	r.Summary[row.Action]++
+	r.Rows = append(r.Rows, row)
+}
+
+// HasConflicts reports whether any row prevents the import from being committed
+func (r CatalogImportResult) HasConflicts() bool {
+	return r.Summary[CatalogActionConflict] > 0
+}
+
+// ExportCatalog returns every category, material type (including archived
+// ones and their images), distribution center and stock level from a single
+// consistent snapshot
+func (s *Store) ExportCatalog(ctx context.Context) (Catalog, error) {
+	tx, err := s.db.BeginTx(ctx, &sql.TxOptions{Isolation: sql.LevelRepeatableRead, ReadOnly: true})
+	if err != nil {
+		return Catalog{}, err
+	}
+	defer tx.Rollback()
+
+	var catalog Catalog
+	if catalog.Categories, err = listCategoriesFlat(ctx, tx, false); err != nil {
+		return Catalog{}, err
+	}
+	if catalog.MaterialTypes, err = listAllMaterialTypes(ctx, tx, false); err != nil {
+		return Catalog{}, err
+	}
+	images, err := listAllMaterialTypeImages(ctx, tx)
+	if err != nil {
+		return Catalog{}, err
+	}
+	for i := range catalog.MaterialTypes {
+		catalog.MaterialTypes[i].Images = images[catalog.MaterialTypes[i].ID]
+	}
+	if catalog.DistributionCenters, err = listDistributionCenters(ctx, tx, false); err != nil {
+		return Catalog{}, err
+	}
+	if catalog.Stock, err = listStockLevels(ctx, tx); err != nil {
+		return Catalog{}, err
+	}
+	return catalog, nil
+}
+
+// ImportCatalog plans an import against the current catalog and, unless
+// dryRun is set or a row conflicts, applies it in a single transaction
+func (s *Store) ImportCatalog(ctx context.Context, input CatalogImport, dryRun bool) (CatalogImportResult, error) {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return CatalogImportResult{}, err
+	}
+	defer tx.Rollback()
+
+	// Serialize imports so two archives cannot interleave
+	if _, err := tx.ExecContext(ctx, `SELECT pg_advisory_xact_lock(hashtext('catalog_import'))`); err != nil {
+		return CatalogImportResult{}, err
+	}
+
+	plan, result, err := planCatalogImport(ctx, tx, input)
+	if err != nil {
+		return CatalogImportResult{}, err
+	}
+	result.DryRun = dryRun
+	if dryRun || result.HasConflicts() {
+		return result, nil
+	}
+
+	if err := plan.apply(ctx, tx); err != nil {
+		return result, err
+	}
+	if err := tx.Commit(); err != nil {
+		return result, err
+	}
+	result.Committed = true
+	return result, nil
+}
+
+type catalogPlan struct {
+	categories    []plannedCategory
+	materialTypes []plannedMaterialType
+	centers       []plannedCenter
+	stock         []plannedStock
+	centerIDs     map[string]string
+}
+
+type plannedCategory struct {
+	row    CatalogCategoryRow
+	action string
+	depth  int
+	before *domain.Category
+}
+
+type plannedMaterialType struct {
+	row       CatalogMaterialTypeRow
+	action    string
+	before    *domain.MaterialType
+	newImages []MaterialTypeImageInput
+}
+
+type plannedCenter struct {
+	row    CatalogDistributionCenterRow
+	action string
+	before *domain.DistributionCenter
+}
+
+type plannedStock struct {
+	row    CatalogStockRow
+	action string
+	before int
+}
+
+// planCatalogImport compares the import with the locked current catalog
+func planCatalogImport(ctx context.Context, tx *sql.Tx, input CatalogImport) (catalogPlan, CatalogImportResult, error) {
+	var result CatalogImportResult
+	plan := catalogPlan{centerIDs: map[string]string{}}
+
+	// Categories
+	existingCategories, err := listCategoriesFlat(ctx, tx, true)
+	if err != nil {
+		return catalogPlan{}, result, err
+	}
+	categoryByID := map[string]domain.Category{}
+	parents := map[string]string{}
+	for _, c := range existingCategories {
+		categoryByID[c.ID] = c
+		parents[c.ID] = c.ParentID
+	}
+	categoryRows := map[string]bool{}
+	conflict := func(entity string, row int, id, message string) {
+		result.Add(CatalogImportRow{Entity: entity, Row: row, ID: id, Action: CatalogActionConflict, Message: message})
+	}
+	var candidates []int
+	for i, row := range input.Categories {
+		switch {
+		case row.ID == "":
+			conflict(AuditEntityCategory, i+1, row.Name, "name must contain at least one letter or number")
+		case categoryRows[row.ID]:
+			conflict(AuditEntityCategory, i+1, row.ID, "duplicate category in archive")
+		case strings.TrimSpace(row.Name) == "":
+			conflict(AuditEntityCategory, i+1, row.ID, "name is required")
+		default:
+			categoryRows[row.ID] = true
+			parents[row.ID] = row.ParentID
+			candidates = append(candidates, i)
+		}
+	}
+	for _, i := range candidates {
+		row := input.Categories[i]
+		if row.ParentID != "" && !categoryRows[row.ParentID] {
+			if _, ok := categoryByID[row.ParentID]; !ok {
+				conflict(AuditEntityCategory, i+1, row.ID, fmt.Sprintf("unknown parent category %q", row.ParentID))
+				continue
+			}
+		}
+		depth, ok := categoryDepth(parents, row.ID)
+		if !ok {
+			conflict(AuditEntityCategory, i+1, row.ID, "category cannot be moved below itself")
+			continue
+		}
+		p := plannedCategory{row: row, action: CatalogActionCreate, depth: depth}
+		if before, ok := categoryByID[row.ID]; ok {
+			p.before = &before
+			p.action = CatalogActionUpdate
+			if before.ParentID == row.ParentID && before.Name == row.Name && before.SortOrder == row.SortOrder {
+				p.action = CatalogActionUnchanged
+			}
+		}
+		result.Add(CatalogImportRow{Entity: AuditEntityCategory, Row: i + 1, ID: row.ID, Action: p.action})
+		plan.categories = append(plan.categories, p)
+	}
+	// Parents are written before their children
+	sort.SliceStable(plan.categories, func(a, b int) bool {
+		return plan.categories[a].depth < plan.categories[b].depth
+	})
+
+	// Material types and their images
+	existingTypes, err := listAllMaterialTypes(ctx, tx, true)
+	if err != nil {
+		return catalogPlan{}, result, err
+	}
+	typeByID := map[string]domain.MaterialType{}
+	for _, mt := range existingTypes {
+		typeByID[mt.ID] = mt
+	}
+	existingImages, err := listAllMaterialTypeImages(ctx, tx)
+	if err != nil {
+		return catalogPlan{}, result, err
+	}
+	typeRows := map[string]bool{}
+	for i, row := range input.MaterialTypes {
+		switch {
+		case row.ID == "":
+			conflict(AuditEntityMaterialType, i+1, row.Name, "name must contain at least one letter or number")
+			continue
+		case typeRows[row.ID]:
+			conflict(AuditEntityMaterialType, i+1, row.ID, "duplicate material type in archive")
+			continue
+		case strings.TrimSpace(row.Name) == "" || strings.TrimSpace(row.Description) == "":
+			conflict(AuditEntityMaterialType, i+1, row.ID, "name and description are required")
+			continue
+		}
+		typeRows[row.ID] = true
+		if row.CategoryID != "" && !categoryRows[row.CategoryID] {
+			if _, ok := categoryByID[row.CategoryID]; !ok {
+				conflict(AuditEntityMaterialType, i+1, row.ID, fmt.Sprintf("unknown category %q", row.CategoryID))
+				continue
+			}
+		}
+
+		p := plannedMaterialType{row: row, action: CatalogActionCreate}
+		if before, ok := typeByID[row.ID]; ok {
+			p.before = &before
+			p.action = CatalogActionUpdate
+			if before.Name == row.Name && before.Description == row.Description && before.CategoryID == row.CategoryID &&
+				slices.Equal(before.Tags, nonNilTags(row.Tags)) && (before.ArchivedAt != nil) == row.Archived {
+				p.action = CatalogActionUnchanged
+			}
+		}
+		result.Add(CatalogImportRow{Entity: AuditEntityMaterialType, Row: i + 1, ID: row.ID, Action: p.action})
+
+		hashes := map[string]bool{}
+		for _, image := range existingImages[row.ID] {
+			hashes[image.ContentHash] = true
+		}
+		for _, image := range row.Images {
+			id := row.ID + "/" + image.ContentHash
+			if hashes[image.ContentHash] {
+				result.Add(CatalogImportRow{Entity: AuditEntityImage, Row: i + 1, ID: id, Action: CatalogActionUnchanged})
+				continue
+			}
+			hashes[image.ContentHash] = true
+			p.newImages = append(p.newImages, image)
+			result.Add(CatalogImportRow{Entity: AuditEntityImage, Row: i + 1, ID: id, Action: CatalogActionCreate})
+		}
+		plan.materialTypes = append(plan.materialTypes, p)
+	}
+
+	// Distribution centers, matched by name
+	existingCenters, err := listDistributionCenters(ctx, tx, true)
+	if err != nil {
+		return catalogPlan{}, result, err
+	}
+	centerByName := map[string]domain.DistributionCenter{}
+	for _, c := range existingCenters {
+		centerByName[centerKey(c.Name)] = c
+		plan.centerIDs[centerKey(c.Name)] = c.ID
+	}
+	centerRows := map[string]bool{}
+	for i, row := range input.DistributionCenters {
+		key := centerKey(row.Name)
+		switch {
+		case key == "":
+			conflict(AuditEntityCenter, i+1, row.Name, "name is required")
+			continue
+		case centerRows[key]:
+			conflict(AuditEntityCenter, i+1, row.Name, "duplicate distribution center in archive")
+			continue
+		}
+		centerRows[key] = true
+		p := plannedCenter{row: row, action: CatalogActionCreate}
+		if before, ok := centerByName[key]; ok {
+			p.before = &before
+			p.action = CatalogActionUpdate
+			if before.Address == row.Address {
+				p.action = CatalogActionUnchanged
+			}
+		}
+		result.Add(CatalogImportRow{Entity: AuditEntityCenter, Row: i + 1, ID: row.Name, Action: p.action})
+		plan.centers = append(plan.centers, p)
+	}
+
+	// Stock levels
+	existingStock, err := listStockLevels(ctx, tx)
+	if err != nil {
+		return catalogPlan{}, result, err
+	}
+	stockByKey := map[string]int{}
+	for _, level := range existingStock {
+		stockByKey[level.MaterialTypeID+"@"+level.DistributionCenterID] = level.Amount
+	}
+	stockRows := map[string]bool{}
+	for _, row := range input.Stock {
+		key := centerKey(row.DistributionCenter)
+		id := row.MaterialTypeID + "@" + row.DistributionCenter
+		_, typeExists := typeByID[row.MaterialTypeID]
+		_, centerExists := centerByName[key]
+		switch {
+		case !typeRows[row.MaterialTypeID] && !typeExists:
+			conflict(AuditEntityStock, row.Row, id, fmt.Sprintf("unknown material type %q", row.MaterialTypeID))
+			continue
+		case !centerRows[key] && !centerExists:
+			conflict(AuditEntityStock, row.Row, id, fmt.Sprintf("unknown distribution center %q", row.DistributionCenter))
+			continue
+		case row.Amount < 0:
+			conflict(AuditEntityStock, row.Row, id, "amount must not be negative")
+			continue
+		case stockRows[row.MaterialTypeID+"@"+key]:
+			conflict(AuditEntityStock, row.Row, id, "duplicate stock row in archive")
+			continue
+		}
+		stockRows[row.MaterialTypeID+"@"+key] = true
+
+		p := plannedStock{row: row, action: CatalogActionCreate}
+		if centerExists {
+			if before, ok := stockByKey[row.MaterialTypeID+"@"+centerByName[key].ID]; ok {
+				p.before = before
+				p.action = CatalogActionUpdate
+				if before == row.Amount {
+					p.action = CatalogActionUnchanged
+				}
+			}
+		}
+		result.Add(CatalogImportRow{Entity: AuditEntityStock, Row: row.Row, ID: id, Action: p.action})
+		plan.stock = append(plan.stock, p)
+	}
+
+	return plan, result, nil
+}
+
+// categoryDepth returns how many ancestors a category has, or false when its
+// parent chain loops back on itself
+func categoryDepth(parents map[string]string, id string) (int, bool) {
+	seen := map[string]bool{id: true}
+	depth := 0
+	for parent := parents[id]; parent != ""; parent = parents[parent] {
+		if seen[parent] {
+			return 0, false
+		}
+		seen[parent] = true
+		depth++
+	}
+	return depth, true
+}
+
+func centerKey(name string) string {
+	return strings.ToLower(strings.TrimSpace(name))
+}
+
+func (p catalogPlan) apply(ctx context.Context, tx *sql.Tx) error {
+	for _, c := range p.categories {
+		if err := applyCatalogCategory(ctx, tx, c); err != nil {
+			return fmt.Errorf("category %s: %w", c.row.ID, err)
+		}
+	}
+	for _, mt := range p.materialTypes {
+		if err := applyCatalogMaterialType(ctx, tx, mt); err != nil {
+			return fmt.Errorf("material type %s: %w", mt.row.ID, err)
+		}
+	}
+	for _, c := range p.centers {
+		id, err := applyCatalogCenter(ctx, tx, c)
+		if err != nil {
+			return fmt.Errorf("distribution center %s: %w", c.row.Name, err)
+		}
+		p.centerIDs[centerKey(c.row.Name)] = id
+	}
+	for _, level := range p.stock {
+		if level.action == CatalogActionUnchanged {
+			continue
+		}
+		centerID := p.centerIDs[centerKey(level.row.DistributionCenter)]
+		if _, err := tx.ExecContext(ctx, `
+			INSERT INTO material_available (material_type_id, distribution_center_id, amount)
+			VALUES ($1, $2, $3)
+			ON CONFLICT (material_type_id, distribution_center_id) DO UPDATE SET amount = EXCLUDED.amount
+		`, level.row.MaterialTypeID, centerID, level.row.Amount); err != nil {
+			return fmt.Errorf("stock %s@%s: %w", level.row.MaterialTypeID, level.row.DistributionCenter, err)
+		}
+		after := domain.StockLevel{MaterialTypeID: level.row.MaterialTypeID, DistributionCenterID: centerID, Amount: level.row.Amount}
+		var before any
+		action := AuditActionCreate
+		if level.action == CatalogActionUpdate {
+			action = AuditActionUpdate
+			before = domain.StockLevel{MaterialTypeID: after.MaterialTypeID, DistributionCenterID: centerID, Amount: level.before}
+		}
+		if err := recordAudit(ctx, tx, action, AuditEntityStock, after.MaterialTypeID+"@"+centerID, before, after); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func applyCatalogCategory(ctx context.Context, tx *sql.Tx, p plannedCategory) error {
+	switch p.action {
+	case CatalogActionCreate:
+		c, err := scanCategory(tx.QueryRowContext(ctx, `
+			INSERT INTO categories (id, parent_id, name, sort_order)
+			VALUES ($1, $2, $3, $4)
+			RETURNING id, parent_id, name, sort_order
+		`, p.row.ID, nullString(p.row.ParentID), p.row.Name, p.row.SortOrder))
+		if err != nil {
+			return err
+		}
+		return recordAudit(ctx, tx, AuditActionCreate, AuditEntityCategory, c.ID, nil, c)
+	case CatalogActionUpdate:
+		c, err := scanCategory(tx.QueryRowContext(ctx, `
+			UPDATE categories
+			SET parent_id = $2, name = $3, sort_order = $4
+			WHERE id = $1
+			RETURNING id, parent_id, name, sort_order
+		`, p.row.ID, nullString(p.row.ParentID), p.row.Name, p.row.SortOrder))
+		if err != nil {
+			return err
+		}
+		return recordAudit(ctx, tx, AuditActionUpdate, AuditEntityCategory, c.ID, p.before, c)
+	}
+	return nil
+}
+
+func applyCatalogMaterialType(ctx context.Context, tx *sql.Tx, p plannedMaterialType) error {
+	var mt domain.MaterialType
+	var err error
+	switch p.action {
+	case CatalogActionCreate:
+		mt, err = scanMaterialType(tx.QueryRowContext(ctx, `
+			INSERT INTO material_types (id, name, description, image_url, category_id, tags, archived_at)
+			VALUES ($1, $2, $3, '', $4, $5, CASE WHEN $6 THEN now() END)
+			RETURNING id, name, description, image_url, archived_at, category_id, tags
+		`, p.row.ID, p.row.Name, p.row.Description, nullString(p.row.CategoryID), pq.Array(nonNilTags(p.row.Tags)), p.row.Archived))
+		if err != nil {
+			return err
+		}
+		if err := recordAudit(ctx, tx, AuditActionCreate, AuditEntityMaterialType, mt.ID, nil, mt); err != nil {
+			return err
+		}
+	case CatalogActionUpdate:
+		mt, err = scanMaterialType(tx.QueryRowContext(ctx, `
+			UPDATE material_types
+			SET name = $2, description = $3, category_id = $4, tags = $5,
+			    archived_at = CASE WHEN $6 THEN COALESCE(archived_at, now()) END
+			WHERE id = $1
+			RETURNING id, name, description, image_url, archived_at, category_id, tags
+		`, p.row.ID, p.row.Name, p.row.Description, nullString(p.row.CategoryID), pq.Array(nonNilTags(p.row.Tags)), p.row.Archived))
+		if err != nil {
+			return err
+		}
+		if err := recordAudit(ctx, tx, AuditActionUpdate, AuditEntityMaterialType, mt.ID, p.before, mt); err != nil {
+			return err
+		}
+	default:
+		mt = *p.before
+	}
+
+	if len(p.newImages) == 0 {
+		return nil
+	}
+	var position int
+	if err := tx.QueryRowContext(ctx, `
+		SELECT COALESCE(MAX(position) + 1, 0) FROM material_type_images WHERE material_type_id = $1
+	`, mt.ID).Scan(&position); err != nil {
+		return err
+	}
+	for _, input := range p.newImages {
+		if input.OriginalURL == "" {
+			return ErrImageNotStored
+		}
+		image, err := insertMaterialTypeImage(ctx, tx, mt.ID, position, input)
+		if err != nil {
+			return err
+		}
+		if err := recordAudit(ctx, tx, AuditActionCreate, AuditEntityImage, image.ID, nil, image); err != nil {
+			return err
+		}
+		position++
+	}
+	return syncPrimaryImage(ctx, tx, mt)
+}
+
+func applyCatalogCenter(ctx context.Context, tx *sql.Tx, p plannedCenter) (string, error) {
+	switch p.action {
+	case CatalogActionCreate:
+		var c domain.DistributionCenter
+		if err := tx.QueryRowContext(ctx, `
+			INSERT INTO distribution_centers (name, address)
+			VALUES ($1, $2)
+			RETURNING id::text, name, address
+		`, strings.TrimSpace(p.row.Name), p.row.Address).Scan(&c.ID, &c.Name, &c.Address); err != nil {
+			return "", err
+		}
+		return c.ID, recordAudit(ctx, tx, AuditActionCreate, AuditEntityCenter, c.ID, nil, c)
+	case CatalogActionUpdate:
+		after := *p.before
+		after.Address = p.row.Address
+		if _, err := tx.ExecContext(ctx, `
+			UPDATE distribution_centers SET address = $2 WHERE id = $1
+		`, after.ID, after.Address); err != nil {
+			return "", err
+		}
+		return after.ID, recordAudit(ctx, tx, AuditActionUpdate, AuditEntityCenter, after.ID, p.before, after)
+	}
+	return p.before.ID, nil
+}
+
+func listCategoriesFlat(ctx context.Context, tx *sql.Tx, forUpdate bool) ([]domain.Category, error) {
+	query := `SELECT id, parent_id, name, sort_order FROM categories ORDER BY sort_order ASC, name ASC`
+	if forUpdate {
+		query += ` FOR UPDATE`
+	}
+	rows, err := tx.QueryContext(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	categories := []domain.Category{}
+	for rows.Next() {
+		c, err := scanCategory(rows)
+		if err != nil {
+			return nil, err
+		}
+		categories = append(categories, c)
+	}
+	return categories, rows.Err()
+}
+
+func listAllMaterialTypes(ctx context.Context, tx *sql.Tx, forUpdate bool) ([]domain.MaterialType, error) {
+	query := `
+		SELECT id, name, description, image_url, archived_at, category_id, tags
+		FROM material_types
+		ORDER BY name ASC, id ASC`
+	if forUpdate {
+		query += ` FOR UPDATE`
+	}
+	rows, err := tx.QueryContext(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	materialTypes := []domain.MaterialType{}
+	for rows.Next() {
+		mt, err := scanMaterialType(rows)
+		if err != nil {
+			return nil, err
+		}
+		materialTypes = append(materialTypes, mt)
+	}
+	return materialTypes, rows.Err()
+}
+
+func listAllMaterialTypeImages(ctx context.Context, tx *sql.Tx) (map[string][]domain.MaterialTypeImage, error) {
+	rows, err := tx.QueryContext(ctx, `
+		SELECT id, material_type_id, position, alt_text, content_hash, original_url, variants, created_at
+		FROM material_type_images
+		ORDER BY material_type_id, position ASC, created_at ASC
+	`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	images := map[string][]domain.MaterialTypeImage{}
+	for rows.Next() {
+		image, err := scanMaterialTypeImage(rows)
+		if err != nil {
+			return nil, err
+		}
+		images[image.MaterialTypeID] = append(images[image.MaterialTypeID], image)
+	}
+	return images, rows.Err()
+}
+
+func listDistributionCenters(ctx context.Context, q queryer, forUpdate bool) ([]domain.DistributionCenter, error) {
+	query := `SELECT id::text, name, address FROM distribution_centers ORDER BY name ASC`
+	if forUpdate {
+		query += ` FOR UPDATE`
+	}
+	rows, err := q.QueryContext(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	centers := []domain.DistributionCenter{}
+	for rows.Next() {
+		var c domain.DistributionCenter
+		if err := rows.Scan(&c.ID, &c.Name, &c.Address); err != nil {
+			return nil, err
+		}
+		centers = append(centers, c)
+	}
+	return centers, rows.Err()
+}
+
+func listStockLevels(ctx context.Context, q queryer) ([]domain.StockLevel, error) {
+	rows, err := q.QueryContext(ctx, `
+		SELECT material_type_id, distribution_center_id::text, amount
+		FROM material_available
+		ORDER BY material_type_id, distribution_center_id
+	`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	levels := []domain.StockLevel{}
+	for rows.Next() {
+		var level domain.StockLevel
+		if err := rows.Scan(&level.MaterialTypeID, &level.DistributionCenterID, &level.Amount); err != nil {
+			return nil, err
+		}
+		levels = append(levels, level)
+	}
+	return levels, rows.Err()
+}
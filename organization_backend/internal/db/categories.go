@@ -0,0 +1,246 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+
+	"organization_backend/internal/domain"
+)
+
+var (
+	// ErrCategoryNotFound is returned when a category does not exist
+	ErrCategoryNotFound = errors.New("category not found")
+	// ErrCategoryCycle is returned when a parent change would make a category its own ancestor
+	ErrCategoryCycle = errors.New("category cannot be moved below itself")
+	// ErrCategoryExists is returned when a category with the same ID exists
+	ErrCategoryExists = errors.New("category already exists")
+)
+
+// CategoryInUseError is returned when a category still has subcategories
+type CategoryInUseError struct {
+	ChildCount int
+}
+
+func (e CategoryInUseError) Error() string {
+	return fmt.Sprintf("category has %d subcategories", e.ChildCount)
+}
+
+type CategoryInput struct {
+	ParentID  string
+	Name      string
+	SortOrder int
+}
+
+func scanCategory(scanner interface {
+	Scan(dest ...any) error
+}) (domain.Category, error) {
+	var c domain.Category
+	var parentID sql.NullString
+	if err := scanner.Scan(&c.ID, &parentID, &c.Name, &c.SortOrder); err != nil {
+		return domain.Category{}, err
+	}
+	c.ParentID = parentID.String
+	return c, nil
+}
+
+// ListCategories returns all categories as a tree ordered by sort order and name
+func (s *Store) ListCategories(ctx context.Context) ([]domain.Category, error) {
+	rows, err := s.db.QueryContext(ctx, `
+		SELECT id, parent_id, name, sort_order
+		FROM categories
+		ORDER BY sort_order ASC, name ASC
+	`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var flat []domain.Category
+	for rows.Next() {
+		c, err := scanCategory(rows)
+		if err != nil {
+			return nil, err
+		}
+		flat = append(flat, c)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return buildCategoryTree(flat, ""), nil
+}
+
+func buildCategoryTree(flat []domain.Category, parentID string) []domain.Category {
+	tree := []domain.Category{}
+	for _, c := range flat {
+		if c.ParentID != parentID {
+			continue
+		}
+		c.Children = buildCategoryTree(flat, c.ID)
+		tree = append(tree, c)
+	}
+	return tree
+}
+
+// GetCategoryByID returns a single category without children
+func (s *Store) GetCategoryByID(ctx context.Context, id string) (domain.Category, error) {
+	c, err := scanCategory(s.db.QueryRowContext(ctx, `
+		SELECT id, parent_id, name, sort_order
+		FROM categories
+		WHERE id = $1
+	`, id))
+	if errors.Is(err, sql.ErrNoRows) {
+		return domain.Category{}, ErrCategoryNotFound
+	}
+	return c, err
+}
+
+// CreateCategory creates a new category
+func (s *Store) CreateCategory(ctx context.Context, id string, input CategoryInput) (domain.Category, error) {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return domain.Category{}, err
+	}
+	defer tx.Rollback()
+
+	if err := checkCategoryExists(ctx, tx, input.ParentID); err != nil {
+		return domain.Category{}, err
+	}
+
+	c, err := scanCategory(tx.QueryRowContext(ctx, `
+		INSERT INTO categories (id, parent_id, name, sort_order)
+		VALUES ($1, $2, $3, $4)
+		RETURNING id, parent_id, name, sort_order
+	`, id, nullString(input.ParentID), input.Name, input.SortOrder))
+	if isUniqueViolation(err) {
+		return domain.Category{}, ErrCategoryExists
+	}
+	if err != nil {
+		return domain.Category{}, err
+	}
+	if err := recordAudit(ctx, tx, AuditActionCreate, AuditEntityCategory, c.ID, nil, c); err != nil {
+		return domain.Category{}, err
+	}
+	if err := tx.Commit(); err != nil {
+		return domain.Category{}, err
+	}
+	return c, nil
+}
+
+// UpdateCategory renames, reorders or moves a category
+func (s *Store) UpdateCategory(ctx context.Context, id string, input CategoryInput) (domain.Category, error) {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return domain.Category{}, err
+	}
+	defer tx.Rollback()
+
+	before, err := scanCategory(tx.QueryRowContext(ctx, `
+		SELECT id, parent_id, name, sort_order
+		FROM categories
+		WHERE id = $1
+		FOR UPDATE
+	`, id))
+	if errors.Is(err, sql.ErrNoRows) {
+		return domain.Category{}, ErrCategoryNotFound
+	}
+	if err != nil {
+		return domain.Category{}, err
+	}
+
+	if input.ParentID != "" {
+		if err := checkCategoryExists(ctx, tx, input.ParentID); err != nil {
+			return domain.Category{}, err
+		}
+		var cycle bool
+		if err := tx.QueryRowContext(ctx, `
+			WITH RECURSIVE descendants AS (
+				SELECT id FROM categories WHERE id = $1
+				UNION ALL
+				SELECT c.id FROM categories c JOIN descendants d ON c.parent_id = d.id
+			)
+			SELECT EXISTS (SELECT 1 FROM descendants WHERE id = $2)
+		`, id, input.ParentID).Scan(&cycle); err != nil {
+			return domain.Category{}, err
+		}
+		if cycle {
+			return domain.Category{}, ErrCategoryCycle
+		}
+	}
+
+	c, err := scanCategory(tx.QueryRowContext(ctx, `
+		UPDATE categories
+		SET parent_id = $2, name = $3, sort_order = $4
+		WHERE id = $1
+		RETURNING id, parent_id, name, sort_order
+	`, id, nullString(input.ParentID), input.Name, input.SortOrder))
+	if err != nil {
+		return domain.Category{}, err
+	}
+	if err := recordAudit(ctx, tx, AuditActionUpdate, AuditEntityCategory, c.ID, before, c); err != nil {
+		return domain.Category{}, err
+	}
+	if err := tx.Commit(); err != nil {
+		return domain.Category{}, err
+	}
+	return c, nil
+}
+
+// DeleteCategory deletes a category without subcategories. Material types in
+// the category become uncategorized.
+func (s *Store) DeleteCategory(ctx context.Context, id string) error {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	before, err := scanCategory(tx.QueryRowContext(ctx, `
+		SELECT id, parent_id, name, sort_order
+		FROM categories
+		WHERE id = $1
+		FOR UPDATE
+	`, id))
+	if errors.Is(err, sql.ErrNoRows) {
+		return ErrCategoryNotFound
+	}
+	if err != nil {
+		return err
+	}
+
+	var inUse CategoryInUseError
+	if err := tx.QueryRowContext(ctx, `
+		SELECT COUNT(*) FROM categories WHERE parent_id = $1
+	`, id).Scan(&inUse.ChildCount); err != nil {
+		return err
+	}
+	if inUse.ChildCount > 0 {
+		return inUse
+	}
+
+	if _, err := tx.ExecContext(ctx, `DELETE FROM categories WHERE id = $1`, id); err != nil {
+		return err
+	}
+	if err := recordAudit(ctx, tx, AuditActionDelete, AuditEntityCategory, id, before, nil); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// checkCategoryExists returns ErrCategoryNotFound unless id is empty or refers to an existing category
+func checkCategoryExists(ctx context.Context, tx *sql.Tx, id string) error {
+	if id == "" {
+		return nil
+	}
+	var exists bool
+	if err := tx.QueryRowContext(ctx, `
+		SELECT EXISTS (SELECT 1 FROM categories WHERE id = $1)
+	`, id).Scan(&exists); err != nil {
+		return err
+	}
+	if !exists {
+		return ErrCategoryNotFound
+	}
+	return nil
+}
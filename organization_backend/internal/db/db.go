@@ -2,18 +2,43 @@ package db
 
 import (
 	"database/sql"
+	"errors"
+	"strings"
 	"time"
 
-	_ "github.com/lib/pq"
+	"github.com/lib/pq"
 )
 
-func Open(databaseURL string) (*sql.DB, error) {
-	db, err := sql.Open("postgres", databaseURL)
+// PoolConfig sizes the connection pool
+type PoolConfig struct {
+	MaxOpenConns    int
+	MaxIdleConns    int
+	ConnMaxLifetime time.Duration
+}
+
+// Open returns a connection pool whose statements are traced
+func Open(databaseURL string, pool PoolConfig) (*sql.DB, error) {
+	connector, err := pq.NewConnector(databaseURL)
 	if err != nil {
 		return nil, err
 	}
-	db.SetMaxOpenConns(20)
-	db.SetMaxIdleConns(5)
-	db.SetConnMaxLifetime(5 * time.Minute)
+	db := sql.OpenDB(tracedConnector{base: connector})
+	db.SetMaxOpenConns(pool.MaxOpenConns)
+	db.SetMaxIdleConns(pool.MaxIdleConns)
+	db.SetConnMaxLifetime(pool.ConnMaxLifetime)
 	return db, nil
 }
+
+// isUniqueViolation reports whether err is a PostgreSQL unique_violation
+func isUniqueViolation(err error) bool {
+	var pqErr *pq.Error
+	return errors.As(err, &pqErr) && pqErr.Code == "23505"
+}
+
+// likeEscaper escapes the LIKE wildcards and the escape character itself
+var likeEscaper = strings.NewReplacer(`\`, `\\`, "%", `\%`, "_", `\_`)
+
+// containsPattern returns an ILIKE pattern matching values that contain s
+func containsPattern(s string) string {
+	return "%" + likeEscaper.Replace(s) + "%"
+}
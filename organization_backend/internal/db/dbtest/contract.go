@@ -0,0 +1,733 @@
+// Package dbtest holds the contract tests every implementation of the
+// repositories in package db has to pass.
+package dbtest
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"sort"
+	"testing"
+	"time"
+
+	"organization_backend/internal/db"
+	"organization_backend/internal/domain"
+	"organization_backend/pkg/pagination"
+
+	"github.com/google/uuid"
+	"github.com/workos/workos-go/v4/pkg/usermanagement"
+)
+
+// Backend is an implementation under test. The records created by the
+// tests have unique IDs and emails, so a backend may hold other data.
+type Backend struct {
+	Requests db.RequestRepository
+	Users    db.UserRepository
+	Notifier db.RequestNotifier
+	Fixtures Fixtures
+}
+
+// Fixtures creates the records the repositories refer to
+type Fixtures interface {
+	CreateMaterialType(ctx context.Context, id string, input domain.CreateMaterialTypeInput) (domain.MaterialType, error)
+	ArchiveMaterialType(ctx context.Context, id string) (domain.MaterialType, error)
+	CreateDistributionCenter(ctx context.Context, name, address string) (domain.DistributionCenter, error)
+	SetUserDisabled(ctx context.Context, idOrEmail string, disabled bool) (db.UserAccount, error)
+	CreateSchool(ctx context.Context, name, ownerID string) (domain.School, error)
+	GetSchool(ctx context.Context, id string) (domain.School, error)
+	AddSchoolAddress(ctx context.Context, schoolID string, input domain.AddressInput) (domain.School, error)
+	SetSchoolMember(ctx context.Context, schoolID, email, role string) (domain.School, error)
+	CreateAddress(ctx context.Context, userID string, input domain.AddressInput) (domain.Address, error)
+	CreateKit(ctx context.Context, id string, input db.KitInput) (domain.Kit, error)
+}
+
+// notificationTimeout bounds how long a test waits for a request update
+const notificationTimeout = 5 * time.Second
+
+// Run runs the contract tests against the backends returned by newBackend,
+// which is called once per test
+func Run(t *testing.T, newBackend func(t *testing.T) Backend) {
+	tests := []struct {
+		name string
+		run  func(t *testing.T, b Backend)
+	}{
+		{"users", testUsers},
+		{"disabled user", testDisabledUser},
+		{"create and get request", testCreateAndGetRequest},
+		{"create request errors", testCreateRequestErrors},
+		{"request school", testRequestSchool},
+		{"saved address", testSavedAddress},
+		{"kits", testKits},
+		{"missing request", testMissingRequest},
+		{"set status", testSetStatus},
+		{"set distribution center", testSetDistributionCenter},
+		{"list requests", testListRequests},
+		{"notifications", testNotifications},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.run(t, newBackend(t))
+		})
+	}
+}
+
+func uniqueID(prefix string) string {
+	return prefix + "-" + uuid.NewString()[:8]
+}
+
+func newUser(t *testing.T, b Backend) domain.Customer {
+	t.Helper()
+	id := uniqueID("user")
+	user, err := b.Users.GetOrCreateUserByWorkOSUser(context.Background(), &usermanagement.User{
+		ID:        id,
+		Email:     id + "@example.org",
+		FirstName: "Erika",
+		LastName:  "Mustermann",
+	})
+	if err != nil {
+		t.Fatalf("create user: %v", err)
+	}
+	return user
+}
+
+func newMaterialType(t *testing.T, b Backend) string {
+	t.Helper()
+	id := uniqueID("mt")
+	if _, err := b.Fixtures.CreateMaterialType(context.Background(), id, domain.CreateMaterialTypeInput{Name: id}); err != nil {
+		t.Fatalf("create material type: %v", err)
+	}
+	return id
+}
+
+var deliveryDate = time.Date(2031, time.May, 4, 8, 0, 0, 0, time.UTC)
+
+func requestInput(customerID string, items map[string]int) db.CreateRequestInput {
+	return db.CreateRequestInput{
+		CustomerID:           customerID,
+		DeliveryDate:         deliveryDate,
+		Status:               "pending",
+		ShippingCustomerName: "Grundschule am Park",
+		ShippingAddressLine1: "Parkweg 3",
+		ShippingCity:         "Hamburg",
+		ShippingZipCode:      "20095",
+		Items:                items,
+	}
+}
+
+func newRequest(t *testing.T, b Backend, customerID string) domain.Request {
+	t.Helper()
+	req, err := b.Requests.CreateRequest(context.Background(), requestInput(customerID, map[string]int{newMaterialType(t, b): 2}))
+	if err != nil {
+		t.Fatalf("create request: %v", err)
+	}
+	return req
+}
+
+func testUsers(t *testing.T, b Backend) {
+	ctx := context.Background()
+	id := uniqueID("user")
+	workosUser := &usermanagement.User{ID: id, Email: id + "@example.org"}
+
+	created, err := b.Users.GetOrCreateUserByWorkOSUser(ctx, workosUser)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if created.ID == "" || created.Token == "" {
+		t.Fatalf("created user lacks ID or token: %+v", created)
+	}
+	if created.Email != workosUser.Email || created.Name != workosUser.Email || created.WorkOSUserID != id {
+		t.Errorf("created user = %+v, want email %s as name and WorkOS ID %s", created, workosUser.Email, id)
+	}
+	if !created.EmailVerified || created.IsAdmin {
+		t.Errorf("created user is verified %t and admin %t, want verified non-admin", created.EmailVerified, created.IsAdmin)
+	}
+
+	again, err := b.Users.GetOrCreateUserByWorkOSUser(ctx, workosUser)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if again.ID != created.ID {
+		t.Errorf("second login created user %s, want %s", again.ID, created.ID)
+	}
+
+	got, err := b.Users.GetUserByID(ctx, created.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.ID != created.ID || got.Email != created.Email || got.Token != created.Token {
+		t.Errorf("GetUserByID = %+v, want %+v", got, created)
+	}
+
+	if _, err := b.Users.GetUserByID(ctx, uuid.NewString()); !errors.Is(err, sql.ErrNoRows) {
+		t.Errorf("GetUserByID of a missing user returned %v, want sql.ErrNoRows", err)
+	}
+}
+
+func testDisabledUser(t *testing.T, b Backend) {
+	ctx := context.Background()
+	user := newUser(t, b)
+	workosUser := &usermanagement.User{ID: user.WorkOSUserID, Email: user.Email}
+
+	account, err := b.Fixtures.SetUserDisabled(ctx, user.Email, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if account.ID != user.ID || account.DisabledAt == nil {
+		t.Fatalf("SetUserDisabled = %+v, want user %s disabled", account, user.ID)
+	}
+	if _, err := b.Users.GetOrCreateUserByWorkOSUser(ctx, workosUser); !errors.Is(err, db.ErrUserDisabled) {
+		t.Errorf("login of a disabled user returned %v, want ErrUserDisabled", err)
+	}
+
+	if _, err := b.Fixtures.SetUserDisabled(ctx, user.ID, false); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := b.Users.GetOrCreateUserByWorkOSUser(ctx, workosUser); err != nil {
+		t.Errorf("login of a re-enabled user returned %v", err)
+	}
+}
+
+func testCreateAndGetRequest(t *testing.T, b Backend) {
+	ctx := context.Background()
+	user := newUser(t, b)
+	materialType := newMaterialType(t, b)
+	returnDate := deliveryDate.AddDate(0, 0, 14)
+	input := requestInput(user.ID, map[string]int{materialType: 3})
+	input.ReturnDate = &returnDate
+	input.ShippingAddressLine2 = "Hintereingang"
+	input.Metadata = map[string]any{"note": "vormittags", "classes": 2}
+
+	created, err := b.Requests.CreateRequest(ctx, input)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := uuid.Parse(created.ID); err != nil {
+		t.Errorf("request ID %q is not a UUID", created.ID)
+	}
+	if created.CreatedAt.IsZero() || !created.UpdatedAt.Equal(created.CreatedAt) {
+		t.Errorf("created at %v, updated at %v, want both set and equal", created.CreatedAt, created.UpdatedAt)
+	}
+
+	got, err := b.Requests.GetRequestByID(ctx, created.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, req := range []domain.Request{created, got} {
+		if req.ID != created.ID || req.Customer.ID != user.ID || req.Customer.Email != user.Email {
+			t.Errorf("request %s of customer %s (%s), want %s of %s", req.ID, req.Customer.ID, req.Customer.Email, created.ID, user.ID)
+		}
+		if req.Status != "pending" || req.Items[materialType] != 3 || len(req.Items) != 1 {
+			t.Errorf("request has status %q and items %v, want pending with 3 %s", req.Status, req.Items, materialType)
+		}
+		if !req.DeliveryDate.Equal(deliveryDate) || req.ReturnDate == nil || !req.ReturnDate.Equal(returnDate) {
+			t.Errorf("request is delivered %v and returned %v, want %v and %v", req.DeliveryDate, req.ReturnDate, deliveryDate, returnDate)
+		}
+		want := domain.ShippingAddress{Line1: "Parkweg 3", Line2: "Hintereingang", City: "Hamburg", ZipCode: "20095"}
+		if req.ShippingAddress != want || req.ShippingCustomerName != input.ShippingCustomerName {
+			t.Errorf("request ships to %s at %+v, want %s at %+v", req.ShippingCustomerName, req.ShippingAddress, input.ShippingCustomerName, want)
+		}
+		if req.DistributionCenterID != "" {
+			t.Errorf("request is routed to %q, want no distribution center", req.DistributionCenterID)
+		}
+		if req.SchoolID == "" || req.SchoolID != created.SchoolID {
+			t.Errorf("request is for school %q, want the school %q created for the user", req.SchoolID, created.SchoolID)
+		}
+		if len(req.Kits) != 0 {
+			t.Errorf("request has kits %v, want none", req.Kits)
+		}
+	}
+	// Metadata is stored as JSON, so numbers come back as float64
+	if got.Metadata["note"] != "vormittags" || got.Metadata["classes"] != float64(2) {
+		t.Errorf("metadata = %v, want note and classes", got.Metadata)
+	}
+	if !got.UpdatedAt.Equal(created.UpdatedAt) {
+		t.Errorf("stored updated at %v, want %v", got.UpdatedAt, created.UpdatedAt)
+	}
+}
+
+func testCreateRequestErrors(t *testing.T, b Backend) {
+	ctx := context.Background()
+	user := newUser(t, b)
+	materialType := newMaterialType(t, b)
+	archived := newMaterialType(t, b)
+	if _, err := b.Fixtures.ArchiveMaterialType(ctx, archived); err != nil {
+		t.Fatal(err)
+	}
+	unknown := uniqueID("unknown")
+
+	var unavailable db.UnavailableMaterialTypesError
+	_, err := b.Requests.CreateRequest(ctx, requestInput(user.ID, map[string]int{materialType: 1, archived: 1, unknown: 1}))
+	if !errors.As(err, &unavailable) {
+		t.Fatalf("request for archived and unknown material types returned %v, want UnavailableMaterialTypesError", err)
+	}
+	want := []string{archived, unknown}
+	sort.Strings(want)
+	if len(unavailable.IDs) != 2 || unavailable.IDs[0] != want[0] || unavailable.IDs[1] != want[1] {
+		t.Errorf("unavailable material types = %v, want %v", unavailable.IDs, want)
+	}
+
+	tests := []struct {
+		name   string
+		modify func(input *db.CreateRequestInput)
+		want   error
+	}{
+		{"no items", func(input *db.CreateRequestInput) { input.Items = nil }, nil},
+		{"zero quantity", func(input *db.CreateRequestInput) { input.Items = map[string]int{materialType: 0} }, nil},
+		{"invalid status", func(input *db.CreateRequestInput) { input.Status = "lost" }, nil},
+		{"return before delivery", func(input *db.CreateRequestInput) {
+			returnDate := deliveryDate.AddDate(0, 0, -1)
+			input.ReturnDate = &returnDate
+		}, nil},
+		{"unknown customer", func(input *db.CreateRequestInput) { input.CustomerID = uuid.NewString() }, nil},
+		{"unknown kit", func(input *db.CreateRequestInput) {
+			input.Kits = []domain.RequestKit{{KitID: uniqueID("kit")}}
+		}, db.ErrKitNotFound},
+		{"unknown saved address", func(input *db.CreateRequestInput) { input.ShippingAddressID = uuid.NewString() }, db.ErrAddressNotFound},
+		{"foreign school", func(input *db.CreateRequestInput) { input.SchoolID = uuid.NewString() }, db.ErrNotSchoolMember},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			input := requestInput(user.ID, map[string]int{materialType: 1})
+			tt.modify(&input)
+			_, err := b.Requests.CreateRequest(ctx, input)
+			switch {
+			case err == nil:
+				t.Fatal("request was created")
+			case tt.want != nil && !errors.Is(err, tt.want):
+				t.Fatalf("got %v, want %v", err, tt.want)
+			}
+		})
+	}
+
+	result, err := b.Requests.ListRequests(ctx, db.ListRequestsParams{CustomerID: user.ID})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(result.Requests) != 0 {
+		t.Errorf("failed creations left %d requests", len(result.Requests))
+	}
+}
+
+func testRequestSchool(t *testing.T, b Backend) {
+	ctx := context.Background()
+	user := newUser(t, b)
+
+	// The first request of a user without a school creates one named after
+	// the shipping recipient
+	first := newRequest(t, b, user.ID)
+	school, err := b.Fixtures.GetSchool(ctx, first.SchoolID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if school.Name != first.ShippingCustomerName {
+		t.Errorf("created school is named %q, want %q", school.Name, first.ShippingCustomerName)
+	}
+	if len(school.Members) != 1 || school.Members[0].UserID != user.ID || school.Members[0].Role != domain.SchoolRoleOwner {
+		t.Errorf("created school has members %+v, want the user as owner", school.Members)
+	}
+	if len(school.Addresses) != 1 || school.Addresses[0].Line1 != first.ShippingAddress.Line1 || school.Addresses[0].ZipCode != first.ShippingAddress.ZipCode {
+		t.Errorf("created school has addresses %+v, want the shipping address", school.Addresses)
+	}
+
+	// Later requests of a user with one school go to that school
+	second := newRequest(t, b, user.ID)
+	if second.SchoolID != first.SchoolID {
+		t.Errorf("second request is for school %s, want %s", second.SchoolID, first.SchoolID)
+	}
+
+	// Users with several schools have to name one
+	other, err := b.Fixtures.CreateSchool(ctx, uniqueID("Gymnasium"), user.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	input := requestInput(user.ID, map[string]int{newMaterialType(t, b): 1})
+	if _, err := b.Requests.CreateRequest(ctx, input); !errors.Is(err, db.ErrSchoolRequired) {
+		t.Errorf("request without a school returned %v, want ErrSchoolRequired", err)
+	}
+	input.SchoolID = other.ID
+	third, err := b.Requests.CreateRequest(ctx, input)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if third.SchoolID != other.ID {
+		t.Errorf("request is for school %s, want %s", third.SchoolID, other.ID)
+	}
+
+	// Members see the requests of their schools
+	member := newUser(t, b)
+	if _, err := b.Fixtures.SetSchoolMember(ctx, other.ID, member.Email, domain.SchoolRoleMember); err != nil {
+		t.Fatal(err)
+	}
+	listed, err := b.Requests.ListRequests(ctx, db.ListRequestsParams{MemberID: member.ID})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(listed.Requests) != 1 || listed.Requests[0].ID != third.ID {
+		t.Errorf("member of school %s listed %d requests, want %s", other.ID, len(listed.Requests), third.ID)
+	}
+}
+
+func testSavedAddress(t *testing.T, b Backend) {
+	ctx := context.Background()
+	user := newUser(t, b)
+	materialType := newMaterialType(t, b)
+
+	personal, err := b.Fixtures.CreateAddress(ctx, user.ID, domain.AddressInput{
+		Label: "Zuhause", Line1: "Lindenallee 7", Line2: "3. OG", City: "Bremen", ZipCode: "28195",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	input := requestInput(user.ID, map[string]int{materialType: 1})
+	input.ShippingAddressID = personal.ID
+	req, err := b.Requests.CreateRequest(ctx, input)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err := b.Requests.GetRequestByID(ctx, req.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := domain.ShippingAddress{AddressID: personal.ID, Line1: "Lindenallee 7", Line2: "3. OG", City: "Bremen", ZipCode: "28195"}
+	for _, r := range []domain.Request{req, got} {
+		if r.ShippingAddress != want {
+			t.Errorf("request ships to %+v, want the saved address %+v", r.ShippingAddress, want)
+		}
+	}
+
+	// A school address selects its school
+	owner := newUser(t, b)
+	school, err := b.Fixtures.CreateSchool(ctx, uniqueID("Grundschule"), owner.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	school, err = b.Fixtures.AddSchoolAddress(ctx, school.ID, domain.AddressInput{Label: "Pforte", Line1: "Schulweg 1", City: "Kiel", ZipCode: "24103"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(school.Addresses) != 1 {
+		t.Fatalf("school has addresses %+v, want one", school.Addresses)
+	}
+	schoolAddress := school.Addresses[0]
+	input = requestInput(owner.ID, map[string]int{materialType: 1})
+	input.ShippingAddressID = schoolAddress.ID
+	req, err = b.Requests.CreateRequest(ctx, input)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if req.SchoolID != school.ID || req.ShippingAddress.Line1 != schoolAddress.Line1 {
+		t.Errorf("request is for school %q shipping to %+v, want %s at %+v", req.SchoolID, req.ShippingAddress, school.ID, schoolAddress)
+	}
+
+	// Addresses of other users and foreign schools are hidden, and a school
+	// address cannot be used for a request of another school
+	stranger := newUser(t, b)
+	if _, err := b.Fixtures.SetSchoolMember(ctx, school.ID, user.Email, domain.SchoolRoleMember); err != nil {
+		t.Fatal(err)
+	}
+	mine, err := b.Fixtures.CreateSchool(ctx, uniqueID("Realschule"), user.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		name      string
+		userID    string
+		addressID string
+		schoolID  string
+		want      error
+	}{
+		{"address of another user", owner.ID, personal.ID, "", db.ErrAddressNotFound},
+		{"address of a foreign school", stranger.ID, schoolAddress.ID, "", db.ErrAddressNotFound},
+		{"address of another school", user.ID, schoolAddress.ID, mine.ID, db.ErrAddressSchoolMismatch},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			input := requestInput(tt.userID, map[string]int{materialType: 1})
+			input.ShippingAddressID = tt.addressID
+			input.SchoolID = tt.schoolID
+			if _, err := b.Requests.CreateRequest(ctx, input); !errors.Is(err, tt.want) {
+				t.Errorf("got %v, want %v", err, tt.want)
+			}
+		})
+	}
+}
+
+func testKits(t *testing.T, b Backend) {
+	ctx := context.Background()
+	user := newUser(t, b)
+	lupe := newMaterialType(t, b)
+	becher := newMaterialType(t, b)
+	kitID := uniqueID("kit")
+	kit, err := b.Fixtures.CreateKit(ctx, kitID, db.KitInput{
+		Name:             "Wasserlabor",
+		DefaultClassSize: 20,
+		Components: []domain.KitComponent{
+			{MaterialTypeID: lupe, Quantity: 1},
+			{MaterialTypeID: becher, Quantity: 2, PerParticipants: 5},
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if kit.ID != kitID || len(kit.Components) != 2 {
+		t.Fatalf("created kit %s has components %+v, want %s with two", kit.ID, kit.Components, kitID)
+	}
+	if _, err := b.Fixtures.CreateKit(ctx, kitID, db.KitInput{Name: "Wasserlabor", DefaultClassSize: 20}); !errors.Is(err, db.ErrKitExists) {
+		t.Errorf("creating kit %s twice returned %v, want ErrKitExists", kitID, err)
+	}
+
+	// Kit quantities scale with the class size and add to the direct items
+	input := requestInput(user.ID, map[string]int{lupe: 2})
+	input.Kits = []domain.RequestKit{{KitID: kitID, ClassSize: 12}}
+	created, err := b.Requests.CreateRequest(ctx, input)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err := b.Requests.GetRequestByID(ctx, created.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, req := range []domain.Request{created, got} {
+		if len(req.Items) != 2 || req.Items[lupe] != 3 || req.Items[becher] != 6 {
+			t.Errorf("request has items %v, want 3 %s and 6 %s", req.Items, lupe, becher)
+		}
+		if len(req.Kits) != 1 || req.Kits[0].KitID != kitID || req.Kits[0].ClassSize != 12 ||
+			req.Kits[0].Items[lupe] != 1 || req.Kits[0].Items[becher] != 6 {
+			t.Errorf("request has kits %+v, want %s for 12 with 1 %s and 6 %s", req.Kits, kitID, lupe, becher)
+		}
+	}
+
+	// Kits alone are enough and default to their class size
+	input = requestInput(user.ID, nil)
+	input.Kits = []domain.RequestKit{{KitID: kitID}}
+	byDefault, err := b.Requests.CreateRequest(ctx, input)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(byDefault.Kits) != 1 || byDefault.Kits[0].ClassSize != 20 || byDefault.Items[becher] != 8 {
+		t.Errorf("request has kits %+v and items %v, want class size 20 with 8 %s", byDefault.Kits, byDefault.Items, becher)
+	}
+
+	// Kits with an archived component cannot be requested
+	if _, err := b.Fixtures.ArchiveMaterialType(ctx, becher); err != nil {
+		t.Fatal(err)
+	}
+	var unavailable db.UnavailableMaterialTypesError
+	if _, err := b.Requests.CreateRequest(ctx, input); !errors.As(err, &unavailable) || len(unavailable.IDs) != 1 || unavailable.IDs[0] != becher {
+		t.Errorf("request for a kit with archived %s returned %v, want UnavailableMaterialTypesError", becher, err)
+	}
+}
+
+func testMissingRequest(t *testing.T, b Backend) {
+	ctx := context.Background()
+	id := uuid.NewString()
+	if _, err := b.Requests.GetRequestByID(ctx, id); !errors.Is(err, sql.ErrNoRows) {
+		t.Errorf("GetRequestByID returned %v, want sql.ErrNoRows", err)
+	}
+	if _, err := b.Requests.SetRequestStatus(ctx, id, "inAction"); !errors.Is(err, db.ErrRequestNotFound) {
+		t.Errorf("SetRequestStatus returned %v, want ErrRequestNotFound", err)
+	}
+	if _, err := b.Requests.SetRequestDistributionCenter(ctx, id, ""); !errors.Is(err, db.ErrRequestNotFound) {
+		t.Errorf("SetRequestDistributionCenter returned %v, want ErrRequestNotFound", err)
+	}
+}
+
+func testSetStatus(t *testing.T, b Backend) {
+	ctx := context.Background()
+	req := newRequest(t, b, newUser(t, b).ID)
+
+	updated, err := b.Requests.SetRequestStatus(ctx, req.ID, "inAction")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if updated.Status != "inAction" || updated.UpdatedAt.Before(req.UpdatedAt) {
+		t.Errorf("updated request has status %q updated at %v, want inAction after %v", updated.Status, updated.UpdatedAt, req.UpdatedAt)
+	}
+	got, err := b.Requests.GetRequestByID(ctx, req.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.Status != "inAction" {
+		t.Errorf("stored status = %q, want inAction", got.Status)
+	}
+
+	if _, err := b.Requests.SetRequestStatus(ctx, req.ID, "lost"); err == nil {
+		t.Error("invalid status was accepted")
+	}
+
+	// Setting the same status again is not a change of status
+	if _, err := b.Requests.SetRequestStatus(ctx, req.ID, "inAction"); err != nil {
+		t.Fatal(err)
+	}
+	history, err := b.Requests.GetStatusHistoryForRequests(ctx, []string{req.ID, uuid.NewString()})
+	if err != nil {
+		t.Fatal(err)
+	}
+	changes := history[req.ID]
+	if len(history) != 1 || len(changes) != 2 || changes[0].Status != "pending" || changes[1].Status != "inAction" {
+		t.Fatalf("status history = %v, want pending then inAction", history)
+	}
+	if !changes[1].ChangedAt.Equal(updated.UpdatedAt) {
+		t.Errorf("status changed at %v, want %v", changes[1].ChangedAt, updated.UpdatedAt)
+	}
+}
+
+func testSetDistributionCenter(t *testing.T, b Backend) {
+	ctx := context.Background()
+	req := newRequest(t, b, newUser(t, b).ID)
+	center, err := b.Fixtures.CreateDistributionCenter(ctx, uniqueID("Lager"), "Hafenstraße 1, 20457 Hamburg")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	routed, err := b.Requests.SetRequestDistributionCenter(ctx, req.ID, center.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if routed.DistributionCenterID != center.ID {
+		t.Errorf("request is routed to %q, want %s", routed.DistributionCenterID, center.ID)
+	}
+	if _, err := b.Requests.SetRequestDistributionCenter(ctx, req.ID, uuid.NewString()); !errors.Is(err, db.ErrDistributionCenterNotFound) {
+		t.Errorf("routing to an unknown center returned %v, want ErrDistributionCenterNotFound", err)
+	}
+
+	cleared, err := b.Requests.SetRequestDistributionCenter(ctx, req.ID, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cleared.DistributionCenterID != "" {
+		t.Errorf("request is still routed to %q", cleared.DistributionCenterID)
+	}
+}
+
+func testListRequests(t *testing.T, b Backend) {
+	ctx := context.Background()
+	user := newUser(t, b)
+	other := newUser(t, b)
+	first := newRequest(t, b, user.ID)
+	second := newRequest(t, b, user.ID)
+	third := newRequest(t, b, user.ID)
+	newRequest(t, b, other.ID)
+	// Updating a request moves it to the top of the list
+	if _, err := b.Requests.SetRequestStatus(ctx, first.ID, "inAction"); err != nil {
+		t.Fatal(err)
+	}
+
+	page, err := b.Requests.ListRequests(ctx, db.ListRequestsParams{CustomerID: user.ID, Limit: 2})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(page.Requests) != 2 || page.NextCursor == "" {
+		t.Fatalf("first page has %d requests and cursor %q, want 2 and a cursor", len(page.Requests), page.NextCursor)
+	}
+	if page.Requests[0].ID != first.ID {
+		t.Errorf("first listed request is %s, want the updated %s", page.Requests[0].ID, first.ID)
+	}
+	cursor, err := pagination.Decode(page.NextCursor)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rest, err := b.Requests.ListRequests(ctx, db.ListRequestsParams{CustomerID: user.ID, Limit: 2, Cursor: &cursor})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(rest.Requests) != 1 || rest.NextCursor != "" {
+		t.Fatalf("second page has %d requests and cursor %q, want 1 and no cursor", len(rest.Requests), rest.NextCursor)
+	}
+	listed := map[string]bool{}
+	for _, req := range append(page.Requests, rest.Requests...) {
+		listed[req.ID] = true
+		if req.Customer.ID != user.ID {
+			t.Errorf("request %s of customer %s was listed", req.ID, req.Customer.ID)
+		}
+		if len(req.Items) != 1 {
+			t.Errorf("listed request %s has items %v, want one material type", req.ID, req.Items)
+		}
+	}
+	for _, req := range []domain.Request{first, second, third} {
+		if !listed[req.ID] {
+			t.Errorf("request %s was not listed", req.ID)
+		}
+	}
+
+	byStatus, err := b.Requests.ListRequests(ctx, db.ListRequestsParams{CustomerID: user.ID, Status: "pending"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(byStatus.Requests) != 2 {
+		t.Errorf("listed %d pending requests, want 2", len(byStatus.Requests))
+	}
+
+	byMember, err := b.Requests.ListRequests(ctx, db.ListRequestsParams{MemberID: other.ID})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(byMember.Requests) != 1 || byMember.Requests[0].Customer.ID != other.ID {
+		t.Errorf("listed %d requests for member %s, want their one request", len(byMember.Requests), other.ID)
+	}
+
+	byQuery, err := b.Requests.ListRequests(ctx, db.ListRequestsParams{Query: other.Email})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(byQuery.Requests) != 1 {
+		t.Errorf("query for %s listed %d requests, want 1", other.Email, len(byQuery.Requests))
+	}
+
+	later := deliveryDate.Add(time.Hour)
+	byDate, err := b.Requests.ListRequests(ctx, db.ListRequestsParams{CustomerID: user.ID, From: &later})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(byDate.Requests) != 0 {
+		t.Errorf("listed %d requests delivered after %v, want none", len(byDate.Requests), later)
+	}
+}
+
+func testNotifications(t *testing.T, b Backend) {
+	ctx := context.Background()
+	user := newUser(t, b)
+	id, updates := b.Notifier.Subscribe(ctx)
+
+	req := newRequest(t, b, user.ID)
+	created := waitForUpdate(t, updates, req.ID)
+	if created.Action != "INSERT" {
+		t.Errorf("creation was announced as %s, want INSERT", created.Action)
+	}
+
+	updated, err := b.Requests.SetRequestStatus(ctx, req.ID, "returned")
+	if err != nil {
+		t.Fatal(err)
+	}
+	update := waitForUpdate(t, updates, req.ID)
+	if update.Action != "UPDATE" || !update.UpdatedAt.Equal(updated.UpdatedAt) {
+		t.Errorf("update was announced as %s at %v, want UPDATE at %v", update.Action, update.UpdatedAt, updated.UpdatedAt)
+	}
+
+	// Unsubscribing closes the queue once the updates of other requests are
+	// drained, and unsubscribing again does nothing
+	b.Notifier.Unsubscribe(id)
+	for range updates {
+	}
+	b.Notifier.Unsubscribe(id)
+}
+
+// waitForUpdate returns the next update of the request, skipping updates of
+// other requests
+func waitForUpdate(t *testing.T, updates <-chan db.RequestUpdate, requestID string) db.RequestUpdate {
+	t.Helper()
+	timeout := time.After(notificationTimeout)
+	for {
+		select {
+		case update, ok := <-updates:
+			if !ok {
+				t.Fatal("update queue was closed")
+			}
+			if update.RequestID == requestID {
+				return update
+			}
+		case <-timeout:
+			t.Fatalf("no update of request %s within %v", requestID, notificationTimeout)
+		}
+	}
+}
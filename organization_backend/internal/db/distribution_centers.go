@@ -0,0 +1,201 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"strings"
+
+	"organization_backend/internal/domain"
+)
+
+// ErrAmbiguousDistributionCenter is returned when several distribution
+// centers have the name looked up
+var ErrAmbiguousDistributionCenter = errors.New("several distribution centers have this name, use the ID")
+
+// ListDistributionCenters returns all distribution centers ordered by name
+func (s *Store) ListDistributionCenters(ctx context.Context) ([]domain.DistributionCenter, error) {
+	return listDistributionCenters(ctx, s.db, false)
+}
+
+// FindDistributionCenter returns the distribution center with the given ID
+// or name
+func (s *Store) FindDistributionCenter(ctx context.Context, idOrName string) (domain.DistributionCenter, error) {
+	rows, err := s.db.QueryContext(ctx, `
+		SELECT id::text, name, address
+		FROM distribution_centers
+		WHERE id::text = $1 OR lower(name) = lower(trim($1))
+		ORDER BY id::text = $1 DESC
+	`, idOrName)
+	if err != nil {
+		return domain.DistributionCenter{}, err
+	}
+	defer rows.Close()
+	var matches []domain.DistributionCenter
+	for rows.Next() {
+		var c domain.DistributionCenter
+		if err := rows.Scan(&c.ID, &c.Name, &c.Address); err != nil {
+			return domain.DistributionCenter{}, err
+		}
+		matches = append(matches, c)
+	}
+	if err := rows.Err(); err != nil {
+		return domain.DistributionCenter{}, err
+	}
+	switch {
+	case len(matches) == 0:
+		return domain.DistributionCenter{}, ErrDistributionCenterNotFound
+	case matches[0].ID == idOrName, len(matches) == 1:
+		return matches[0], nil
+	}
+	return domain.DistributionCenter{}, ErrAmbiguousDistributionCenter
+}
+
+// CreateDistributionCenter adds a distribution center
+func (s *Store) CreateDistributionCenter(ctx context.Context, name, address string) (domain.DistributionCenter, error) {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return domain.DistributionCenter{}, err
+	}
+	defer tx.Rollback()
+
+	var c domain.DistributionCenter
+	if err := tx.QueryRowContext(ctx, `
+		INSERT INTO distribution_centers (name, address)
+		VALUES ($1, $2)
+		RETURNING id::text, name, address
+	`, strings.TrimSpace(name), strings.TrimSpace(address)).Scan(&c.ID, &c.Name, &c.Address); err != nil {
+		return domain.DistributionCenter{}, err
+	}
+	if err := recordAudit(ctx, tx, AuditActionCreate, AuditEntityCenter, c.ID, nil, c); err != nil {
+		return domain.DistributionCenter{}, err
+	}
+	if err := tx.Commit(); err != nil {
+		return domain.DistributionCenter{}, err
+	}
+	return c, nil
+}
+
+// ListStock returns the stock levels of a distribution center, or of all
+// distribution centers when centerID is empty
+func (s *Store) ListStock(ctx context.Context, centerID string) ([]domain.StockLevel, error) {
+	levels, err := listStockLevels(ctx, s.db)
+	if err != nil || centerID == "" {
+		return levels, err
+	}
+	filtered := []domain.StockLevel{}
+	for _, level := range levels {
+		if level.DistributionCenterID == centerID {
+			filtered = append(filtered, level)
+		}
+	}
+	return filtered, nil
+}
+
+// SetStock sets the amount of a material type held at a distribution center
+func (s *Store) SetStock(ctx context.Context, materialTypeID, centerID string, amount int) (domain.StockLevel, error) {
+	if amount < 0 {
+		return domain.StockLevel{}, errors.New("amount must not be negative")
+	}
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return domain.StockLevel{}, err
+	}
+	defer tx.Rollback()
+
+	var typeExists, centerExists bool
+	if err := tx.QueryRowContext(ctx, `
+		SELECT EXISTS (SELECT 1 FROM material_types WHERE id = $1),
+		       EXISTS (SELECT 1 FROM distribution_centers WHERE id::text = $2)
+	`, materialTypeID, centerID).Scan(&typeExists, &centerExists); err != nil {
+		return domain.StockLevel{}, err
+	}
+	switch {
+	case !typeExists:
+		return domain.StockLevel{}, ErrMaterialTypeNotFound
+	case !centerExists:
+		return domain.StockLevel{}, ErrDistributionCenterNotFound
+	}
+
+	var before sql.NullInt64
+	err = tx.QueryRowContext(ctx, `
+		SELECT amount FROM material_available
+		WHERE material_type_id = $1 AND distribution_center_id = $2
+		FOR UPDATE
+	`, materialTypeID, centerID).Scan(&before)
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		return domain.StockLevel{}, err
+	}
+	if _, err := tx.ExecContext(ctx, `
+		INSERT INTO material_available (material_type_id, distribution_center_id, amount)
+		VALUES ($1, $2, $3)
+		ON CONFLICT (material_type_id, distribution_center_id) DO UPDATE SET amount = EXCLUDED.amount
+	`, materialTypeID, centerID, amount); err != nil {
+		return domain.StockLevel{}, err
+	}
+
+	after := domain.StockLevel{MaterialTypeID: materialTypeID, DistributionCenterID: centerID, Amount: amount}
+	action, beforeState := AuditActionCreate, any(nil)
+	if before.Valid {
+		action = AuditActionUpdate
+		beforeState = domain.StockLevel{MaterialTypeID: materialTypeID, DistributionCenterID: centerID, Amount: int(before.Int64)}
+	}
+	if err := recordAudit(ctx, tx, action, AuditEntityStock, materialTypeID+"@"+centerID, beforeState, after); err != nil {
+		return domain.StockLevel{}, err
+	}
+	if err := tx.Commit(); err != nil {
+		return domain.StockLevel{}, err
+	}
+	return after, nil
+}
+
+// ResetStock sets every stock level of a distribution center to zero and
+// returns the levels that changed, with their previous amounts
+func (s *Store) ResetStock(ctx context.Context, centerID string) ([]domain.StockLevel, error) {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	rows, err := tx.QueryContext(ctx, `
+		SELECT material_type_id, amount FROM material_available
+		WHERE distribution_center_id::text = $1 AND amount <> 0
+		ORDER BY material_type_id
+		FOR UPDATE
+	`, centerID)
+	if err != nil {
+		return nil, err
+	}
+	reset := []domain.StockLevel{}
+	for rows.Next() {
+		level := domain.StockLevel{DistributionCenterID: centerID}
+		if err := rows.Scan(&level.MaterialTypeID, &level.Amount); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		reset = append(reset, level)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	if _, err := tx.ExecContext(ctx, `
+		UPDATE material_available SET amount = 0 WHERE distribution_center_id::text = $1
+	`, centerID); err != nil {
+		return nil, err
+	}
+	for _, level := range reset {
+		after := level
+		after.Amount = 0
+		if err := recordAudit(ctx, tx, AuditActionUpdate, AuditEntityStock, level.MaterialTypeID+"@"+centerID, level, after); err != nil {
+			return nil, fmt.Errorf("stock %s: %w", level.MaterialTypeID, err)
+		}
+	}
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+	return reset, nil
+}
@@ -0,0 +1,122 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"time"
+)
+
+const (
+	// IdempotencyKeyTTL is how long stored responses are replayed
+	IdempotencyKeyTTL = 24 * time.Hour
+	// idempotencyKeyStaleAfter is when an unfinished key is considered
+	// abandoned, e.g. because the server crashed while handling it
+	idempotencyKeyStaleAfter = 5 * time.Minute
+)
+
+// IdempotentResponse is a stored response that is replayed for retries
+type IdempotentResponse struct {
+	StatusCode int
+	Header     map[string]string
+	Body       []byte
+}
+
+// IdempotencyKey is the stored state of an idempotency key. Response is nil
+// while the first request with the key is still being processed.
+type IdempotencyKey struct {
+	RequestHash string
+	Response    *IdempotentResponse
+}
+
+// ClaimIdempotencyKey reserves a key for a request. It returns true when the
+// caller should process the request; otherwise it returns the stored state of
+// the key. Expired and abandoned keys are claimed again.
+func (s *Store) ClaimIdempotencyKey(ctx context.Context, userID, key, requestHash string) (bool, IdempotencyKey, error) {
+	now := time.Now()
+	var claimed bool
+	err := s.db.QueryRowContext(ctx, `
+		INSERT INTO idempotency_keys (user_id, key, request_hash, created_at)
+		VALUES ($1, $2, $3, $4)
+		ON CONFLICT (user_id, key) DO UPDATE
+		SET request_hash = EXCLUDED.request_hash, status_code = NULL, response_headers = NULL,
+		    response_body = NULL, created_at = EXCLUDED.created_at, completed_at = NULL
+		WHERE idempotency_keys.created_at < $5
+		   OR (idempotency_keys.completed_at IS NULL AND idempotency_keys.created_at < $6)
+		RETURNING true
+	`, userID, key, requestHash, now, now.Add(-IdempotencyKeyTTL), now.Add(-idempotencyKeyStaleAfter)).Scan(&claimed)
+	if err == nil {
+		return true, IdempotencyKey{}, nil
+	}
+	if !errors.Is(err, sql.ErrNoRows) {
+		return false, IdempotencyKey{}, err
+	}
+
+	existing, err := s.GetIdempotencyKey(ctx, userID, key)
+	if errors.Is(err, sql.ErrNoRows) {
+		// Released between the insert and the lookup; the caller retries
+		return false, IdempotencyKey{}, nil
+	}
+	return false, existing, err
+}
+
+// GetIdempotencyKey returns the stored state of a key or sql.ErrNoRows
+func (s *Store) GetIdempotencyKey(ctx context.Context, userID, key string) (IdempotencyKey, error) {
+	var result IdempotencyKey
+	var status sql.NullInt64
+	var header []byte
+	var body []byte
+	err := s.db.QueryRowContext(ctx, `
+		SELECT request_hash, status_code, response_headers, response_body
+		FROM idempotency_keys
+		WHERE user_id = $1 AND key = $2
+	`, userID, key).Scan(&result.RequestHash, &status, &header, &body)
+	if err != nil {
+		return IdempotencyKey{}, err
+	}
+	if status.Valid {
+		result.Response = &IdempotentResponse{StatusCode: int(status.Int64), Body: body}
+		if len(header) > 0 {
+			if err := json.Unmarshal(header, &result.Response.Header); err != nil {
+				return IdempotencyKey{}, err
+			}
+		}
+	}
+	return result, nil
+}
+
+// CompleteIdempotencyKey stores the response of a claimed key
+func (s *Store) CompleteIdempotencyKey(ctx context.Context, userID, key string, response IdempotentResponse) error {
+	header, err := json.Marshal(response.Header)
+	if err != nil {
+		return err
+	}
+	_, err = s.db.ExecContext(ctx, `
+		UPDATE idempotency_keys
+		SET status_code = $3, response_headers = $4, response_body = $5, completed_at = now()
+		WHERE user_id = $1 AND key = $2
+	`, userID, key, response.StatusCode, header, response.Body)
+	return err
+}
+
+// ReleaseIdempotencyKey forgets a claimed key whose request failed so that it
+// can be retried
+func (s *Store) ReleaseIdempotencyKey(ctx context.Context, userID, key string) error {
+	_, err := s.db.ExecContext(ctx, `
+		DELETE FROM idempotency_keys WHERE user_id = $1 AND key = $2 AND completed_at IS NULL
+	`, userID, key)
+	return err
+}
+
+// DeleteExpiredIdempotencyKeys removes keys older than IdempotencyKeyTTL and
+// returns how many were removed
+func (s *Store) DeleteExpiredIdempotencyKeys(ctx context.Context) (int64, error) {
+	res, err := s.db.ExecContext(ctx, `
+		DELETE FROM idempotency_keys WHERE created_at < $1
+	`, time.Now().Add(-IdempotencyKeyTTL))
+	if err != nil {
+		return 0, err
+	}
+	return res.RowsAffected()
+}
@@ -0,0 +1,449 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+
+	"organization_backend/internal/domain"
+
+	"github.com/lib/pq"
+)
+
+var (
+	// ErrImageNotFound is returned when a material type image does not exist
+	ErrImageNotFound = errors.New("image not found")
+	// ErrDuplicateImage is returned when the same content is uploaded twice for a material type
+	ErrDuplicateImage = errors.New("image already exists for material type")
+	// ErrImageOrderMismatch is returned when a reorder does not list exactly the existing images
+	ErrImageOrderMismatch = errors.New("image order must list every image exactly once")
+)
+
+// PrimaryImageVariant is the variant whose URL is mirrored into material_types.image_url
+const PrimaryImageVariant = "card"
+
+type MaterialTypeImageInput struct {
+	AltText     string
+	ContentHash string
+	OriginalURL string
+	Variants    []domain.ImageVariant
+}
+
+// ListMaterialTypeImages returns a material type's images in display order
+func (s *Store) ListMaterialTypeImages(ctx context.Context, materialTypeID string) ([]domain.MaterialTypeImage, error) {
+	return listMaterialTypeImages(ctx, s.db, materialTypeID)
+}
+
+// AddMaterialTypeImage appends an image to the end of a material type's gallery
+func (s *Store) AddMaterialTypeImage(ctx context.Context, materialTypeID string, input MaterialTypeImageInput) (domain.MaterialTypeImage, error) {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return domain.MaterialTypeImage{}, err
+	}
+	defer tx.Rollback()
+
+	before, err := getMaterialTypeForUpdate(ctx, tx, materialTypeID)
+	if err != nil {
+		return domain.MaterialTypeImage{}, err
+	}
+
+	var position int
+	if err := tx.QueryRowContext(ctx, `
+		SELECT COALESCE(MAX(position) + 1, 0) FROM material_type_images WHERE material_type_id = $1
+	`, materialTypeID).Scan(&position); err != nil {
+		return domain.MaterialTypeImage{}, err
+	}
+
+	image, err := insertMaterialTypeImage(ctx, tx, materialTypeID, position, input)
+	if err != nil {
+		return domain.MaterialTypeImage{}, err
+	}
+	if err := syncPrimaryImage(ctx, tx, before); err != nil {
+		return domain.MaterialTypeImage{}, err
+	}
+	if err := recordAudit(ctx, tx, AuditActionCreate, AuditEntityImage, image.ID, nil, image); err != nil {
+		return domain.MaterialTypeImage{}, err
+	}
+	if err := tx.Commit(); err != nil {
+		return domain.MaterialTypeImage{}, err
+	}
+	return image, nil
+}
+
+// ReplacePrimaryMaterialTypeImage replaces the first image of a material type,
+// or adds it when the gallery is empty. The replaced image is returned so its
+// files can be removed.
+func (s *Store) ReplacePrimaryMaterialTypeImage(ctx context.Context, materialTypeID string, input MaterialTypeImageInput) (domain.MaterialTypeImage, *domain.MaterialTypeImage, error) {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return domain.MaterialTypeImage{}, nil, err
+	}
+	defer tx.Rollback()
+
+	before, err := getMaterialTypeForUpdate(ctx, tx, materialTypeID)
+	if err != nil {
+		return domain.MaterialTypeImage{}, nil, err
+	}
+	images, err := listMaterialTypeImages(ctx, tx, materialTypeID)
+	if err != nil {
+		return domain.MaterialTypeImage{}, nil, err
+	}
+
+	var replaced *domain.MaterialTypeImage
+	position := 0
+	if len(images) > 0 {
+		replaced = &images[0]
+		position = replaced.Position
+		if _, err := tx.ExecContext(ctx, `DELETE FROM material_type_images WHERE id = $1`, replaced.ID); err != nil {
+			return domain.MaterialTypeImage{}, nil, err
+		}
+	}
+
+	image, err := insertMaterialTypeImage(ctx, tx, materialTypeID, position, input)
+	if err != nil {
+		return domain.MaterialTypeImage{}, nil, err
+	}
+	if err := syncPrimaryImage(ctx, tx, before); err != nil {
+		return domain.MaterialTypeImage{}, nil, err
+	}
+	action := AuditActionCreate
+	if replaced != nil {
+		action = AuditActionUpdate
+	}
+	if err := recordAudit(ctx, tx, action, AuditEntityImage, image.ID, replaced, image); err != nil {
+		return domain.MaterialTypeImage{}, nil, err
+	}
+	if err := tx.Commit(); err != nil {
+		return domain.MaterialTypeImage{}, nil, err
+	}
+	return image, replaced, nil
+}
+
+// UpdateMaterialTypeImageAltText changes the alt text of an image
+func (s *Store) UpdateMaterialTypeImageAltText(ctx context.Context, materialTypeID, imageID, altText string) (domain.MaterialTypeImage, error) {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return domain.MaterialTypeImage{}, err
+	}
+	defer tx.Rollback()
+
+	before, err := getMaterialTypeImage(ctx, tx, materialTypeID, imageID)
+	if err != nil {
+		return domain.MaterialTypeImage{}, err
+	}
+	if _, err := tx.ExecContext(ctx, `
+		UPDATE material_type_images SET alt_text = $2 WHERE id = $1
+	`, imageID, altText); err != nil {
+		return domain.MaterialTypeImage{}, err
+	}
+	after := before
+	after.AltText = altText
+	if err := recordAudit(ctx, tx, AuditActionUpdate, AuditEntityImage, imageID, before, after); err != nil {
+		return domain.MaterialTypeImage{}, err
+	}
+	if err := tx.Commit(); err != nil {
+		return domain.MaterialTypeImage{}, err
+	}
+	return after, nil
+}
+
+// ReorderMaterialTypeImages sets the display order; imageIDs must list every image once
+func (s *Store) ReorderMaterialTypeImages(ctx context.Context, materialTypeID string, imageIDs []string) ([]domain.MaterialTypeImage, error) {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	mt, err := getMaterialTypeForUpdate(ctx, tx, materialTypeID)
+	if err != nil {
+		return nil, err
+	}
+	before, err := listMaterialTypeImages(ctx, tx, materialTypeID)
+	if err != nil {
+		return nil, err
+	}
+	if len(before) != len(imageIDs) {
+		return nil, ErrImageOrderMismatch
+	}
+	existing := map[string]bool{}
+	for _, image := range before {
+		existing[image.ID] = true
+	}
+	for position, id := range imageIDs {
+		if !existing[id] {
+			return nil, ErrImageOrderMismatch
+		}
+		delete(existing, id)
+		if _, err := tx.ExecContext(ctx, `
+			UPDATE material_type_images SET position = $2 WHERE id = $1
+		`, id, position); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := syncPrimaryImage(ctx, tx, mt); err != nil {
+		return nil, err
+	}
+	after, err := listMaterialTypeImages(ctx, tx, materialTypeID)
+	if err != nil {
+		return nil, err
+	}
+	if err := recordAudit(ctx, tx, AuditActionUpdate, AuditEntityMaterialType, materialTypeID,
+		map[string]any{"imageOrder": imageIDsOf(before)}, map[string]any{"imageOrder": imageIDsOf(after)}); err != nil {
+		return nil, err
+	}
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+	return after, nil
+}
+
+// DeleteMaterialTypeImage removes an image and returns it so its files can be removed
+func (s *Store) DeleteMaterialTypeImage(ctx context.Context, materialTypeID, imageID string) (domain.MaterialTypeImage, error) {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return domain.MaterialTypeImage{}, err
+	}
+	defer tx.Rollback()
+
+	mt, err := getMaterialTypeForUpdate(ctx, tx, materialTypeID)
+	if err != nil {
+		return domain.MaterialTypeImage{}, err
+	}
+	image, err := getMaterialTypeImage(ctx, tx, materialTypeID, imageID)
+	if err != nil {
+		return domain.MaterialTypeImage{}, err
+	}
+	if _, err := tx.ExecContext(ctx, `DELETE FROM material_type_images WHERE id = $1`, imageID); err != nil {
+		return domain.MaterialTypeImage{}, err
+	}
+	if err := syncPrimaryImage(ctx, tx, mt); err != nil {
+		return domain.MaterialTypeImage{}, err
+	}
+	if err := recordAudit(ctx, tx, AuditActionDelete, AuditEntityImage, imageID, image, nil); err != nil {
+		return domain.MaterialTypeImage{}, err
+	}
+	if err := tx.Commit(); err != nil {
+		return domain.MaterialTypeImage{}, err
+	}
+	return image, nil
+}
+
+func insertMaterialTypeImage(ctx context.Context, tx *sql.Tx, materialTypeID string, position int, input MaterialTypeImageInput) (domain.MaterialTypeImage, error) {
+	variants, err := json.Marshal(input.Variants)
+	if err != nil {
+		return domain.MaterialTypeImage{}, err
+	}
+	image, err := scanMaterialTypeImage(tx.QueryRowContext(ctx, `
+		INSERT INTO material_type_images (material_type_id, position, alt_text, content_hash, original_url, variants)
+		VALUES ($1, $2, $3, $4, $5, $6)
+		RETURNING id, material_type_id, position, alt_text, content_hash, original_url, variants, created_at
+	`, materialTypeID, position, input.AltText, input.ContentHash, input.OriginalURL, variants))
+	var pqErr *pq.Error
+	if errors.As(err, &pqErr) && pqErr.Code == "23505" {
+		return domain.MaterialTypeImage{}, ErrDuplicateImage
+	}
+	return image, err
+}
+
+// syncPrimaryImage mirrors the first image's card variant into material_types.image_url
+func syncPrimaryImage(ctx context.Context, tx *sql.Tx, before domain.MaterialType) error {
+	images, err := listMaterialTypeImages(ctx, tx, before.ID)
+	if err != nil {
+		return err
+	}
+	imageURL := ""
+	if len(images) > 0 {
+		imageURL = images[0].OriginalURL
+		if variant, ok := images[0].Variant(PrimaryImageVariant); ok {
+			imageURL = variant.URL
+		}
+	}
+	if imageURL == before.ImageURL {
+		return nil
+	}
+	if _, err := tx.ExecContext(ctx, `
+		UPDATE material_types SET image_url = $2 WHERE id = $1
+	`, before.ID, imageURL); err != nil {
+		return err
+	}
+	after := before
+	after.ImageURL = imageURL
+	return recordAudit(ctx, tx, AuditActionUpdate, AuditEntityMaterialType, before.ID, before, after)
+}
+
+func listMaterialTypeImages(ctx context.Context, q queryer, materialTypeID string) ([]domain.MaterialTypeImage, error) {
+	rows, err := q.QueryContext(ctx, `
+		SELECT id, material_type_id, position, alt_text, content_hash, original_url, variants, created_at
+		FROM material_type_images
+		WHERE material_type_id = $1
+		ORDER BY position ASC, created_at ASC
+	`, materialTypeID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	images := []domain.MaterialTypeImage{}
+	for rows.Next() {
+		image, err := scanMaterialTypeImage(rows)
+		if err != nil {
+			return nil, err
+		}
+		images = append(images, image)
+	}
+	return images, rows.Err()
+}
+
+func getMaterialTypeImage(ctx context.Context, q queryer, materialTypeID, imageID string) (domain.MaterialTypeImage, error) {
+	image, err := scanMaterialTypeImage(q.QueryRowContext(ctx, `
+		SELECT id, material_type_id, position, alt_text, content_hash, original_url, variants, created_at
+		FROM material_type_images
+		WHERE material_type_id = $1 AND id::text = $2
+	`, materialTypeID, imageID))
+	if errors.Is(err, sql.ErrNoRows) {
+		return domain.MaterialTypeImage{}, ErrImageNotFound
+	}
+	return image, err
+}
+
+func scanMaterialTypeImage(scanner interface {
+	Scan(dest ...any) error
+}) (domain.MaterialTypeImage, error) {
+	var image domain.MaterialTypeImage
+	var variants []byte
+	if err := scanner.Scan(
+		&image.ID, &image.MaterialTypeID, &image.Position, &image.AltText,
+		&image.ContentHash, &image.OriginalURL, &variants, &image.CreatedAt,
+	); err != nil {
+		return domain.MaterialTypeImage{}, err
+	}
+	if err := json.Unmarshal(variants, &image.Variants); err != nil {
+		return domain.MaterialTypeImage{}, err
+	}
+	image.SrcSet = srcSet(image.Variants)
+	return image, nil
+}
+
+// srcSet builds an HTML srcset attribute value from the variants
+func srcSet(variants []domain.ImageVariant) string {
+	parts := make([]string, 0, len(variants))
+	for _, v := range variants {
+		parts = append(parts, fmt.Sprintf("%s %dw", v.URL, v.Width))
+	}
+	return strings.Join(parts, ", ")
+}
+
+func imageIDsOf(images []domain.MaterialTypeImage) []string {
+	ids := make([]string, 0, len(images))
+	for _, image := range images {
+		ids = append(ids, image.ID)
+	}
+	return ids
+}
+
+// RewriteUploadURLs maps every stored upload URL through rewrite in a single
+// transaction and returns the number of changed rows. Used when moving
+// uploads to a different storage backend.
+func (s *Store) RewriteUploadURLs(ctx context.Context, rewrite func(string) string) (int, error) {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	changed := 0
+
+	rows, err := tx.QueryContext(ctx, `
+		SELECT id, name, description, image_url, archived_at, category_id, tags
+		FROM material_types
+		WHERE image_url <> ''
+		FOR UPDATE
+	`)
+	if err != nil {
+		return 0, err
+	}
+	var materialTypes []domain.MaterialType
+	for rows.Next() {
+		mt, err := scanMaterialType(rows)
+		if err != nil {
+			rows.Close()
+			return 0, err
+		}
+		materialTypes = append(materialTypes, mt)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return 0, err
+	}
+	for _, before := range materialTypes {
+		after := before
+		after.ImageURL = rewrite(before.ImageURL)
+		if after.ImageURL == before.ImageURL {
+			continue
+		}
+		if _, err := tx.ExecContext(ctx, `
+			UPDATE material_types SET image_url = $2 WHERE id = $1
+		`, before.ID, after.ImageURL); err != nil {
+			return 0, err
+		}
+		if err := recordAudit(ctx, tx, AuditActionUpdate, AuditEntityMaterialType, before.ID, before, after); err != nil {
+			return 0, err
+		}
+		changed++
+	}
+
+	rows, err = tx.QueryContext(ctx, `
+		SELECT id, material_type_id, position, alt_text, content_hash, original_url, variants, created_at
+		FROM material_type_images
+		FOR UPDATE
+	`)
+	if err != nil {
+		return 0, err
+	}
+	var images []domain.MaterialTypeImage
+	for rows.Next() {
+		image, err := scanMaterialTypeImage(rows)
+		if err != nil {
+			rows.Close()
+			return 0, err
+		}
+		images = append(images, image)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return 0, err
+	}
+	for _, image := range images {
+		originalURL := rewrite(image.OriginalURL)
+		variants := make([]domain.ImageVariant, len(image.Variants))
+		dirty := originalURL != image.OriginalURL
+		for i, v := range image.Variants {
+			variants[i] = v
+			variants[i].URL = rewrite(v.URL)
+			dirty = dirty || variants[i].URL != v.URL
+		}
+		if !dirty {
+			continue
+		}
+		variantsJSON, err := json.Marshal(variants)
+		if err != nil {
+			return 0, err
+		}
+		if _, err := tx.ExecContext(ctx, `
+			UPDATE material_type_images SET original_url = $2, variants = $3 WHERE id = $1
+		`, image.ID, originalURL, variantsJSON); err != nil {
+			return 0, err
+		}
+		changed++
+	}
+
+	if err := tx.Commit(); err != nil {
+		return 0, err
+	}
+	return changed, nil
+}
@@ -0,0 +1,347 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	"organization_backend/internal/domain"
+
+	"github.com/lib/pq"
+)
+
+var (
+	// ErrKitNotFound is returned when a kit does not exist
+	ErrKitNotFound = errors.New("kit not found")
+	// ErrKitExists is returned when a kit with the same ID exists
+	ErrKitExists = errors.New("kit already exists")
+)
+
+// KitInUseError is returned when a kit cannot be deleted because requests reference it
+type KitInUseError struct {
+	RequestCount int
+}
+
+func (e KitInUseError) Error() string {
+	return fmt.Sprintf("kit referenced by %d requests", e.RequestCount)
+}
+
+type KitInput struct {
+	Name             string
+	Description      string
+	DefaultClassSize int
+	Components       []domain.KitComponent
+}
+
+// KitAvailabilityParams selects the class size and delivery range used to
+// decide whether a kit is available
+type KitAvailabilityParams struct {
+	ClassSize int
+	From      *time.Time
+	To        *time.Time
+}
+
+// ListKits returns all kits with their components and availability
+func (s *Store) ListKits(ctx context.Context, params KitAvailabilityParams) ([]domain.Kit, error) {
+	rows, err := s.db.QueryContext(ctx, `
+		SELECT id, name, description, default_class_size
+		FROM kits
+		ORDER BY name ASC
+	`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	kits := []domain.Kit{}
+	var ids []string
+	for rows.Next() {
+		var k domain.Kit
+		if err := rows.Scan(&k.ID, &k.Name, &k.Description, &k.DefaultClassSize); err != nil {
+			return nil, err
+		}
+		kits = append(kits, k)
+		ids = append(ids, k.ID)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	components, err := getKitComponents(ctx, s.db, ids)
+	if err != nil {
+		return nil, err
+	}
+	for i := range kits {
+		kits[i].Components = components[kits[i].ID]
+	}
+	if err := s.applyKitAvailability(ctx, kits, params); err != nil {
+		return nil, err
+	}
+	return kits, nil
+}
+
+// GetKitByID returns a single kit with its components and availability
+func (s *Store) GetKitByID(ctx context.Context, id string, params KitAvailabilityParams) (domain.Kit, error) {
+	k, err := getKit(ctx, s.db, id)
+	if err != nil {
+		return domain.Kit{}, err
+	}
+	kits := []domain.Kit{k}
+	if err := s.applyKitAvailability(ctx, kits, params); err != nil {
+		return domain.Kit{}, err
+	}
+	return kits[0], nil
+}
+
+// CreateKit creates a kit with its components
+func (s *Store) CreateKit(ctx context.Context, id string, input KitInput) (domain.Kit, error) {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return domain.Kit{}, err
+	}
+	defer tx.Rollback()
+
+	if err := checkMaterialTypesRequestable(ctx, tx, kitComponentIDs(input.Components)); err != nil {
+		return domain.Kit{}, err
+	}
+	_, err = tx.ExecContext(ctx, `
+		INSERT INTO kits (id, name, description, default_class_size)
+		VALUES ($1, $2, $3, $4)
+	`, id, input.Name, input.Description, input.DefaultClassSize)
+	if isUniqueViolation(err) {
+		return domain.Kit{}, ErrKitExists
+	}
+	if err != nil {
+		return domain.Kit{}, err
+	}
+	if err := insertKitComponents(ctx, tx, id, input.Components); err != nil {
+		return domain.Kit{}, err
+	}
+
+	k, err := getKit(ctx, tx, id)
+	if err != nil {
+		return domain.Kit{}, err
+	}
+	if err := recordAudit(ctx, tx, AuditActionCreate, AuditEntityKit, id, nil, k); err != nil {
+		return domain.Kit{}, err
+	}
+	if err := tx.Commit(); err != nil {
+		return domain.Kit{}, err
+	}
+	return k, nil
+}
+
+// UpdateKit replaces a kit's fields and components
+func (s *Store) UpdateKit(ctx context.Context, id string, input KitInput) (domain.Kit, error) {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return domain.Kit{}, err
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.ExecContext(ctx, `SELECT 1 FROM kits WHERE id = $1 FOR UPDATE`, id); err != nil {
+		return domain.Kit{}, err
+	}
+	before, err := getKit(ctx, tx, id)
+	if err != nil {
+		return domain.Kit{}, err
+	}
+	if err := checkMaterialTypesRequestable(ctx, tx, kitComponentIDs(input.Components)); err != nil {
+		return domain.Kit{}, err
+	}
+
+	if _, err := tx.ExecContext(ctx, `
+		UPDATE kits
+		SET name = $2, description = $3, default_class_size = $4
+		WHERE id = $1
+	`, id, input.Name, input.Description, input.DefaultClassSize); err != nil {
+		return domain.Kit{}, err
+	}
+	if _, err := tx.ExecContext(ctx, `DELETE FROM kit_items WHERE kit_id = $1`, id); err != nil {
+		return domain.Kit{}, err
+	}
+	if err := insertKitComponents(ctx, tx, id, input.Components); err != nil {
+		return domain.Kit{}, err
+	}
+
+	k, err := getKit(ctx, tx, id)
+	if err != nil {
+		return domain.Kit{}, err
+	}
+	if err := recordAudit(ctx, tx, AuditActionUpdate, AuditEntityKit, id, before, k); err != nil {
+		return domain.Kit{}, err
+	}
+	if err := tx.Commit(); err != nil {
+		return domain.Kit{}, err
+	}
+	return k, nil
+}
+
+// DeleteKit deletes a kit that was never requested
+func (s *Store) DeleteKit(ctx context.Context, id string) error {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.ExecContext(ctx, `SELECT 1 FROM kits WHERE id = $1 FOR UPDATE`, id); err != nil {
+		return err
+	}
+	before, err := getKit(ctx, tx, id)
+	if err != nil {
+		return err
+	}
+
+	var inUse KitInUseError
+	if err := tx.QueryRowContext(ctx, `
+		SELECT COUNT(*) FROM request_kits WHERE kit_id = $1
+	`, id).Scan(&inUse.RequestCount); err != nil {
+		return err
+	}
+	if inUse.RequestCount > 0 {
+		return inUse
+	}
+
+	if _, err := tx.ExecContext(ctx, `DELETE FROM kits WHERE id = $1`, id); err != nil {
+		return err
+	}
+	if err := recordAudit(ctx, tx, AuditActionDelete, AuditEntityKit, id, before, nil); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+type queryer interface {
+	QueryContext(ctx context.Context, query string, args ...any) (*sql.Rows, error)
+	QueryRowContext(ctx context.Context, query string, args ...any) *sql.Row
+}
+
+func getKit(ctx context.Context, q queryer, id string) (domain.Kit, error) {
+	var k domain.Kit
+	err := q.QueryRowContext(ctx, `
+		SELECT id, name, description, default_class_size
+		FROM kits
+		WHERE id = $1
+	`, id).Scan(&k.ID, &k.Name, &k.Description, &k.DefaultClassSize)
+	if errors.Is(err, sql.ErrNoRows) {
+		return domain.Kit{}, ErrKitNotFound
+	}
+	if err != nil {
+		return domain.Kit{}, err
+	}
+	components, err := getKitComponents(ctx, q, []string{id})
+	if err != nil {
+		return domain.Kit{}, err
+	}
+	k.Components = components[id]
+	return k, nil
+}
+
+func getKitComponents(ctx context.Context, q queryer, kitIDs []string) (map[string][]domain.KitComponent, error) {
+	result := map[string][]domain.KitComponent{}
+	if len(kitIDs) == 0 {
+		return result, nil
+	}
+	rows, err := q.QueryContext(ctx, `
+		SELECT kit_id, material_type_id, quantity, per_participants
+		FROM kit_items
+		WHERE kit_id = ANY($1)
+		ORDER BY kit_id, material_type_id
+	`, pq.Array(kitIDs))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var kitID string
+		var c domain.KitComponent
+		if err := rows.Scan(&kitID, &c.MaterialTypeID, &c.Quantity, &c.PerParticipants); err != nil {
+			return nil, err
+		}
+		result[kitID] = append(result[kitID], c)
+	}
+	return result, rows.Err()
+}
+
+func insertKitComponents(ctx context.Context, tx *sql.Tx, kitID string, components []domain.KitComponent) error {
+	for _, c := range components {
+		if _, err := tx.ExecContext(ctx, `
+			INSERT INTO kit_items (kit_id, material_type_id, quantity, per_participants)
+			VALUES ($1, $2, $3, $4)
+		`, kitID, c.MaterialTypeID, c.Quantity, c.PerParticipants); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func kitComponentIDs(components []domain.KitComponent) []string {
+	ids := make([]string, 0, len(components))
+	for _, c := range components {
+		ids = append(ids, c.MaterialTypeID)
+	}
+	return ids
+}
+
+// applyKitAvailability marks each kit available only if every component has
+// enough stock for the requested class size
+func (s *Store) applyKitAvailability(ctx context.Context, kits []domain.Kit, params KitAvailabilityParams) error {
+	var ids []string
+	for _, k := range kits {
+		ids = append(ids, kitComponentIDs(k.Components)...)
+	}
+	available, err := materialAvailability(ctx, s.db, ids, params.From, params.To)
+	if err != nil {
+		return err
+	}
+	for i := range kits {
+		needed := kits[i].Expand(params.ClassSize)
+		kits[i].Available = len(needed) > 0
+		for materialTypeID, quantity := range needed {
+			if available[materialTypeID] < quantity {
+				kits[i].Available = false
+				break
+			}
+		}
+	}
+	return nil
+}
+
+// materialAvailability returns stock minus quantities reserved by open requests
+// on loan during the range for each active material type. Archived material
+// types are omitted and therefore count as unavailable.
+func materialAvailability(ctx context.Context, q queryer, ids []string, from, to *time.Time) (map[string]int, error) {
+	result := map[string]int{}
+	if len(ids) == 0 {
+		return result, nil
+	}
+
+	args := []any{pq.Array(ids)}
+	reserved := "0"
+	if from != nil || to != nil {
+		reserved, args = reservedQuantity(args, from, to)
+	}
+
+	rows, err := q.QueryContext(ctx, fmt.Sprintf(`
+		SELECT mt.id,
+		       COALESCE((SELECT SUM(amount) FROM material_available ma WHERE ma.material_type_id = mt.id), 0) - %s
+		FROM material_types mt
+		WHERE mt.id = ANY($1) AND mt.archived_at IS NULL
+	`, reserved), args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var id string
+		var count int
+		if err := rows.Scan(&id, &count); err != nil {
+			return nil, err
+		}
+		result[id] = count
+	}
+	return result, rows.Err()
+}
@@ -0,0 +1,830 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"organization_backend/internal/domain"
+	"organization_backend/pkg/pagination"
+
+	"github.com/google/uuid"
+	"github.com/workos/workos-go/v4/pkg/usermanagement"
+)
+
+// MemoryStore keeps requests, users and the records requests refer to in
+// memory, for tests and local development without PostgreSQL. Schools are
+// kept with their members and addresses only, without contacts. Changes are
+// published to the notifier like the table triggers do, and nothing is
+// audited.
+type MemoryStore struct {
+	mu            sync.RWMutex
+	notifier      *MemoryNotifier
+	now           func() time.Time
+	last          time.Time
+	users         map[string]*memoryUser
+	requests      map[string]*domain.Request
+	history       map[string][]domain.StatusChange
+	materialTypes map[string]domain.MaterialType
+	centers       map[string]domain.DistributionCenter
+	schools       map[string]*memorySchool
+	addresses     map[string]*memoryAddress
+	kits          map[string]domain.Kit
+}
+
+type memoryUser struct {
+	domain.Customer
+	DisabledAt *time.Time
+}
+
+type memorySchool struct {
+	ID        string
+	Name      string
+	CreatedAt time.Time
+	UpdatedAt time.Time
+	// members maps user IDs to their role
+	members map[string]string
+}
+
+// memoryAddress is a saved address of a school or, when UserID is set, of a
+// single user
+type memoryAddress struct {
+	domain.Address
+	UserID    string
+	CreatedAt time.Time
+}
+
+// NewMemoryStore returns an empty store publishing changes to notifier,
+// which may be nil
+func NewMemoryStore(notifier *MemoryNotifier) *MemoryStore {
+	return &MemoryStore{
+		notifier:      notifier,
+		now:           time.Now,
+		users:         map[string]*memoryUser{},
+		requests:      map[string]*domain.Request{},
+		history:       map[string][]domain.StatusChange{},
+		materialTypes: map[string]domain.MaterialType{},
+		centers:       map[string]domain.DistributionCenter{},
+		schools:       map[string]*memorySchool{},
+		addresses:     map[string]*memoryAddress{},
+		kits:          map[string]domain.Kit{},
+	}
+}
+
+// timestamp returns the current time at the precision PostgreSQL keeps.
+// Timestamps are strictly increasing, so changes made within the same
+// microsecond are still listed in order. m.mu must be held.
+func (m *MemoryStore) timestamp() time.Time {
+	now := m.now().UTC().Truncate(time.Microsecond)
+	if !now.After(m.last) {
+		now = m.last.Add(time.Microsecond)
+	}
+	m.last = now
+	return now
+}
+
+func (m *MemoryStore) publish(action string, req *domain.Request) {
+	if m.notifier != nil {
+		m.notifier.Publish(RequestUpdate{RequestID: req.ID, Action: action, UpdatedAt: req.UpdatedAt})
+	}
+}
+
+// CreateRequest implements RequestRepository
+func (m *MemoryStore) CreateRequest(ctx context.Context, input CreateRequestInput) (domain.Request, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	user, err := m.ensureUser(input)
+	if err != nil {
+		return domain.Request{}, err
+	}
+	if input.ShippingAddressID != "" {
+		if input, err = m.applySavedAddress(user.ID, input); err != nil {
+			return domain.Request{}, err
+		}
+	}
+	schoolID, err := m.requestSchool(user.ID, input)
+	if err != nil {
+		return domain.Request{}, err
+	}
+	switch input.Status {
+	case "pending", "inAction", "returned":
+	default:
+		return domain.Request{}, errors.New("invalid status")
+	}
+	if input.ReturnDate != nil && input.ReturnDate.Before(input.DeliveryDate) {
+		return domain.Request{}, errors.New("return date before delivery date")
+	}
+	metadata, err := cloneMetadata(input.Metadata)
+	if err != nil {
+		return domain.Request{}, err
+	}
+	if len(input.Items) == 0 && len(input.Kits) == 0 {
+		return domain.Request{}, errors.New("items required")
+	}
+
+	kits := make([]domain.RequestKit, 0, len(input.Kits))
+	selected := map[string]bool{}
+	for _, selection := range input.Kits {
+		kit, ok := m.kits[selection.KitID]
+		if !ok {
+			return domain.Request{}, ErrKitNotFound
+		}
+		if selected[kit.ID] {
+			return domain.Request{}, errors.New("kit selected twice")
+		}
+		selected[kit.ID] = true
+		classSize := selection.ClassSize
+		if classSize <= 0 {
+			classSize = kit.DefaultClassSize
+		}
+		kits = append(kits, domain.RequestKit{KitID: kit.ID, ClassSize: classSize, Items: kit.Expand(classSize)})
+	}
+
+	materialTypeIDs := make([]string, 0, len(input.Items))
+	for materialTypeID := range input.Items {
+		materialTypeIDs = append(materialTypeIDs, materialTypeID)
+	}
+	for _, rk := range kits {
+		for materialTypeID := range rk.Items {
+			materialTypeIDs = append(materialTypeIDs, materialTypeID)
+		}
+	}
+	if err := m.checkRequestable(materialTypeIDs); err != nil {
+		return domain.Request{}, err
+	}
+	items := map[string]int{}
+	for materialTypeID, quantity := range input.Items {
+		if quantity <= 0 {
+			return domain.Request{}, errors.New("quantity must be positive")
+		}
+		items[materialTypeID] += quantity
+	}
+	for _, rk := range kits {
+		for materialTypeID, quantity := range rk.Items {
+			items[materialTypeID] += quantity
+		}
+	}
+
+	// Users without a school get one named after the shipping recipient,
+	// created only once nothing can fail any more
+	if schoolID == "" {
+		name := input.ShippingCustomerName
+		if name == "" {
+			name = user.Name
+		}
+		schoolID = m.createSchool(name, user.ID)
+		m.addAddress("", schoolID, domain.AddressInput{
+			Line1:   input.ShippingAddressLine1,
+			Line2:   input.ShippingAddressLine2,
+			City:    input.ShippingCity,
+			ZipCode: input.ShippingZipCode,
+		})
+	}
+
+	customer := user.Customer
+	customer.IsAdmin = false
+	now := m.timestamp()
+	req := &domain.Request{
+		ID:                   uuid.NewString(),
+		Customer:             customer,
+		SchoolID:             schoolID,
+		Items:                items,
+		DeliveryDate:         input.DeliveryDate.Truncate(time.Microsecond),
+		ReturnDate:           truncateTime(input.ReturnDate),
+		Status:               input.Status,
+		ShippingCustomerName: input.ShippingCustomerName,
+		ShippingAddress: domain.ShippingAddress{
+			AddressID: input.ShippingAddressID,
+			Line1:     input.ShippingAddressLine1,
+			Line2:     input.ShippingAddressLine2,
+			City:      input.ShippingCity,
+			ZipCode:   input.ShippingZipCode,
+		},
+		CreatedAt: now,
+		UpdatedAt: now,
+		Metadata:  metadata,
+	}
+	// Stored kits are listed by ID like the Store reads them back
+	if len(kits) > 0 {
+		req.Kits = copyKits(kits)
+		sort.Slice(req.Kits, func(i, j int) bool { return req.Kits[i].KitID < req.Kits[j].KitID })
+	}
+	m.requests[req.ID] = req
+	m.history[req.ID] = []domain.StatusChange{{Status: req.Status, ChangedAt: now}}
+	m.publish("INSERT", req)
+
+	created := copyRequest(req)
+	created.Kits = kits
+	return created, nil
+}
+
+// applySavedAddress copies a saved address the user has access to into the
+// shipping fields of a new request. A school address also selects its school
+// when the request does not name one. m.mu must be held.
+func (m *MemoryStore) applySavedAddress(userID string, input CreateRequestInput) (CreateRequestInput, error) {
+	address, ok := m.addresses[input.ShippingAddressID]
+	if !ok || (address.UserID != userID && m.schoolRole(address.SchoolID, userID) == "") {
+		return input, ErrAddressNotFound
+	}
+	if address.SchoolID != "" {
+		if input.SchoolID == "" {
+			input.SchoolID = address.SchoolID
+		} else if input.SchoolID != address.SchoolID {
+			return input, ErrAddressSchoolMismatch
+		}
+	}
+	input.ShippingAddressLine1 = address.Line1
+	input.ShippingAddressLine2 = address.Line2
+	input.ShippingCity = address.City
+	input.ShippingZipCode = address.ZipCode
+	return input, nil
+}
+
+// requestSchool picks the school a new request belongs to like the Store
+// does, but returns an empty ID for users without a school instead of
+// creating one. m.mu must be held.
+func (m *MemoryStore) requestSchool(userID string, input CreateRequestInput) (string, error) {
+	if input.SchoolID != "" {
+		if m.schoolRole(input.SchoolID, userID) == "" {
+			return "", ErrNotSchoolMember
+		}
+		return input.SchoolID, nil
+	}
+	var schoolIDs []string
+	for id, school := range m.schools {
+		if _, ok := school.members[userID]; ok {
+			schoolIDs = append(schoolIDs, id)
+		}
+	}
+	switch len(schoolIDs) {
+	case 0:
+		return "", nil
+	case 1:
+		return schoolIDs[0], nil
+	default:
+		return "", ErrSchoolRequired
+	}
+}
+
+// checkRequestable fails with UnavailableMaterialTypesError unless every ID
+// is a known, non-archived material type. m.mu must be held.
+func (m *MemoryStore) checkRequestable(ids []string) error {
+	var missing []string
+	for _, id := range ids {
+		if mt, ok := m.materialTypes[id]; !ok || mt.ArchivedAt != nil {
+			missing = append(missing, id)
+		}
+	}
+	if len(missing) > 0 {
+		sort.Strings(missing)
+		return UnavailableMaterialTypesError{IDs: missing}
+	}
+	return nil
+}
+
+// ensureUser returns the customer of a new request, creating it by email
+// when no ID is given
+func (m *MemoryStore) ensureUser(input CreateRequestInput) (*memoryUser, error) {
+	if input.CustomerID != "" {
+		user, ok := m.users[input.CustomerID]
+		if !ok {
+			return nil, sql.ErrNoRows
+		}
+		return user, nil
+	}
+	if input.CustomerEmail == "" {
+		return nil, errors.New("customer email required")
+	}
+	if user := m.userByEmail(input.CustomerEmail); user != nil {
+		return user, nil
+	}
+	token := input.CustomerToken
+	if token == "" {
+		token = uuid.NewString()
+	}
+	user := &memoryUser{Customer: domain.Customer{
+		ID:        uuid.NewString(),
+		Email:     input.CustomerEmail,
+		Name:      input.CustomerName,
+		Token:     token,
+		CreatedAt: m.timestamp(),
+	}}
+	m.users[user.ID] = user
+	return user, nil
+}
+
+func (m *MemoryStore) userByEmail(email string) *memoryUser {
+	for _, user := range m.users {
+		if user.Email == email {
+			return user
+		}
+	}
+	return nil
+}
+
+// GetRequestByID implements RequestRepository
+func (m *MemoryStore) GetRequestByID(ctx context.Context, id string) (domain.Request, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	req, ok := m.requests[id]
+	if !ok {
+		return domain.Request{}, sql.ErrNoRows
+	}
+	return copyRequest(req), nil
+}
+
+// ListRequests implements RequestRepository
+func (m *MemoryStore) ListRequests(ctx context.Context, params ListRequestsParams) (ListRequestsResult, error) {
+	limit := params.Limit
+	if limit <= 0 || limit > 100 {
+		limit = 20
+	}
+	query := strings.ToLower(params.Query)
+
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	var matches []*domain.Request
+	for _, req := range m.requests {
+		switch {
+		case query != "" &&
+			!strings.Contains(strings.ToLower(req.Customer.Name), query) &&
+			!strings.Contains(strings.ToLower(req.Customer.Email), query) &&
+			!strings.Contains(req.ID, query):
+		case params.Status != "" && req.Status != params.Status:
+		case params.CustomerID != "" && req.Customer.ID != params.CustomerID:
+		case params.MemberID != "" && req.Customer.ID != params.MemberID && m.schoolRole(req.SchoolID, params.MemberID) == "":
+		case params.From != nil && req.DeliveryDate.Before(*params.From):
+		case params.To != nil && req.DeliveryDate.After(*params.To):
+		case params.Cursor != nil && !beforeCursor(req, *params.Cursor):
+		default:
+			matches = append(matches, req)
+		}
+	}
+	sort.Slice(matches, func(i, j int) bool {
+		return beforeCursor(matches[j], pagination.Cursor{Time: matches[i].UpdatedAt, ID: matches[i].ID})
+	})
+
+	result := ListRequestsResult{}
+	if len(matches) > limit {
+		matches = matches[:limit]
+		last := matches[limit-1]
+		result.NextCursor = pagination.Encode(pagination.Cursor{Time: last.UpdatedAt, ID: last.ID})
+	}
+	for _, req := range matches {
+		result.Requests = append(result.Requests, copyRequest(req))
+	}
+	return result, nil
+}
+
+// beforeCursor reports whether req is listed after the cursor position, i.e.
+// (updated_at, id) < (cursor.Time, cursor.ID)
+func beforeCursor(req *domain.Request, cursor pagination.Cursor) bool {
+	if !req.UpdatedAt.Equal(cursor.Time) {
+		return req.UpdatedAt.Before(cursor.Time)
+	}
+	return req.ID < cursor.ID
+}
+
+// SetRequestStatus implements RequestRepository
+func (m *MemoryStore) SetRequestStatus(ctx context.Context, requestID, status string) (domain.Request, error) {
+	switch status {
+	case "pending", "inAction", "returned":
+	default:
+		return domain.Request{}, errors.New("invalid status")
+	}
+	return m.updateRequest(requestID, func(req *domain.Request) error {
+		req.Status = status
+		return nil
+	})
+}
+
+// SetRequestDistributionCenter implements RequestRepository
+func (m *MemoryStore) SetRequestDistributionCenter(ctx context.Context, requestID, centerID string) (domain.Request, error) {
+	return m.updateRequest(requestID, func(req *domain.Request) error {
+		if _, ok := m.centers[centerID]; centerID != "" && !ok {
+			return ErrDistributionCenterNotFound
+		}
+		req.DistributionCenterID = centerID
+		return nil
+	})
+}
+
+// updateRequest applies fn to a request and publishes the change
+func (m *MemoryStore) updateRequest(requestID string, fn func(req *domain.Request) error) (domain.Request, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	req, ok := m.requests[requestID]
+	if !ok {
+		return domain.Request{}, ErrRequestNotFound
+	}
+	updated := copyRequest(req)
+	if err := fn(&updated); err != nil {
+		return domain.Request{}, err
+	}
+	updated.UpdatedAt = m.timestamp()
+	if updated.Status != req.Status {
+		m.history[requestID] = append(m.history[requestID], domain.StatusChange{Status: updated.Status, ChangedAt: updated.UpdatedAt})
+	}
+	m.requests[requestID] = &updated
+	m.publish("UPDATE", &updated)
+	return copyRequest(&updated), nil
+}
+
+// GetStatusHistoryForRequests implements RequestRepository
+func (m *MemoryStore) GetStatusHistoryForRequests(ctx context.Context, requestIDs []string) (map[string][]domain.StatusChange, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	result := make(map[string][]domain.StatusChange)
+	for _, id := range requestIDs {
+		if history, ok := m.history[id]; ok {
+			result[id] = append([]domain.StatusChange(nil), history...)
+		}
+	}
+	return result, nil
+}
+
+// GetOrCreateUserByWorkOSUser implements UserRepository
+func (m *MemoryStore) GetOrCreateUserByWorkOSUser(ctx context.Context, workosUser *usermanagement.User) (domain.Customer, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for _, user := range m.users {
+		if user.WorkOSUserID == workosUser.ID {
+			if user.DisabledAt != nil {
+				return domain.Customer{}, ErrUserDisabled
+			}
+			return user.Customer, nil
+		}
+	}
+	if m.userByEmail(workosUser.Email) != nil {
+		return domain.Customer{}, errors.New("email already in use")
+	}
+
+	name := strings.TrimSpace(workosUser.FirstName + " " + workosUser.LastName)
+	if name == "" {
+		name = workosUser.Email
+	}
+	user := &memoryUser{Customer: domain.Customer{
+		ID:            uuid.NewString(),
+		Email:         workosUser.Email,
+		Name:          name,
+		Token:         uuid.NewString(),
+		WorkOSUserID:  workosUser.ID,
+		EmailVerified: true,
+		CreatedAt:     m.timestamp(),
+	}}
+	m.users[user.ID] = user
+	return user.Customer, nil
+}
+
+// GetUserByID implements UserRepository
+func (m *MemoryStore) GetUserByID(ctx context.Context, id string) (domain.Customer, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	user, ok := m.users[id]
+	if !ok {
+		return domain.Customer{}, sql.ErrNoRows
+	}
+	return user.Customer, nil
+}
+
+// SetUserDisabled disables or re-enables a user. Disabled users cannot log
+// in.
+func (m *MemoryStore) SetUserDisabled(ctx context.Context, idOrEmail string, disabled bool) (UserAccount, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	user, ok := m.users[idOrEmail]
+	if !ok {
+		for _, u := range m.users {
+			if strings.EqualFold(u.Email, idOrEmail) {
+				user, ok = u, true
+			}
+		}
+	}
+	if !ok {
+		return UserAccount{}, ErrUserNotFound
+	}
+	switch {
+	case !disabled:
+		user.DisabledAt = nil
+	case user.DisabledAt == nil:
+		now := m.timestamp()
+		user.DisabledAt = &now
+	}
+	return UserAccount{Customer: user.Customer, DisabledAt: user.DisabledAt}, nil
+}
+
+// CreateMaterialType adds a material type requests can refer to. Categories
+// are not kept, so input.CategoryID must be empty.
+func (m *MemoryStore) CreateMaterialType(ctx context.Context, id string, input domain.CreateMaterialTypeInput) (domain.MaterialType, error) {
+	if input.CategoryID != "" {
+		return domain.MaterialType{}, ErrCategoryNotFound
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if _, ok := m.materialTypes[id]; ok {
+		return domain.MaterialType{}, errors.New("material type already exists")
+	}
+	mt := domain.MaterialType{
+		ID:          id,
+		Name:        input.Name,
+		Description: input.Description,
+		ImageURL:    input.ImageURL,
+		Tags:        nonNilTags(input.Tags),
+	}
+	m.materialTypes[id] = mt
+	return mt, nil
+}
+
+// ListMaterialTypes returns all material types ordered by name
+func (m *MemoryStore) ListMaterialTypes(ctx context.Context) ([]domain.MaterialType, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	var result []domain.MaterialType
+	for _, mt := range m.materialTypes {
+		result = append(result, mt)
+	}
+	sort.Slice(result, func(i, j int) bool { return result[i].Name < result[j].Name })
+	return result, nil
+}
+
+// ArchiveMaterialType retires a material type so it can no longer be requested
+func (m *MemoryStore) ArchiveMaterialType(ctx context.Context, id string) (domain.MaterialType, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	mt, ok := m.materialTypes[id]
+	if !ok {
+		return domain.MaterialType{}, ErrMaterialTypeNotFound
+	}
+	if mt.ArchivedAt == nil {
+		now := m.timestamp()
+		mt.ArchivedAt = &now
+		m.materialTypes[id] = mt
+	}
+	return mt, nil
+}
+
+// CreateDistributionCenter adds a distribution center
+func (m *MemoryStore) CreateDistributionCenter(ctx context.Context, name, address string) (domain.DistributionCenter, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	c := domain.DistributionCenter{
+		ID:      uuid.NewString(),
+		Name:    strings.TrimSpace(name),
+		Address: strings.TrimSpace(address),
+	}
+	m.centers[c.ID] = c
+	return c, nil
+}
+
+// CreateSchool creates a school with the given user as its owner
+func (m *MemoryStore) CreateSchool(ctx context.Context, name, ownerID string) (domain.School, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if _, ok := m.users[ownerID]; !ok {
+		return domain.School{}, ErrUserNotFound
+	}
+	return m.school(m.createSchool(name, ownerID)), nil
+}
+
+// createSchool adds a school owned by ownerID and returns its ID. m.mu must
+// be held.
+func (m *MemoryStore) createSchool(name, ownerID string) string {
+	now := m.timestamp()
+	school := &memorySchool{
+		ID:        uuid.NewString(),
+		Name:      name,
+		CreatedAt: now,
+		UpdatedAt: now,
+		members:   map[string]string{ownerID: domain.SchoolRoleOwner},
+	}
+	m.schools[school.ID] = school
+	return school.ID
+}
+
+// GetSchool returns a school with its addresses and members
+func (m *MemoryStore) GetSchool(ctx context.Context, id string) (domain.School, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	if _, ok := m.schools[id]; !ok {
+		return domain.School{}, ErrSchoolNotFound
+	}
+	return m.school(id), nil
+}
+
+// AddSchoolAddress adds an unverified address to a school
+func (m *MemoryStore) AddSchoolAddress(ctx context.Context, schoolID string, input domain.AddressInput) (domain.School, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if _, ok := m.schools[schoolID]; !ok {
+		return domain.School{}, ErrSchoolNotFound
+	}
+	m.addAddress("", schoolID, input)
+	return m.school(schoolID), nil
+}
+
+// SetSchoolMember adds the user with the given email to a school or changes
+// their role
+func (m *MemoryStore) SetSchoolMember(ctx context.Context, schoolID, email, role string) (domain.School, error) {
+	if role != domain.SchoolRoleOwner && role != domain.SchoolRoleMember {
+		return domain.School{}, errors.New("invalid role")
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	school, ok := m.schools[schoolID]
+	if !ok {
+		return domain.School{}, ErrSchoolNotFound
+	}
+	var user *memoryUser
+	for _, u := range m.users {
+		if strings.EqualFold(u.Email, email) {
+			user = u
+		}
+	}
+	if user == nil {
+		return domain.School{}, ErrUserNotFound
+	}
+	if role != domain.SchoolRoleOwner && school.members[user.ID] == domain.SchoolRoleOwner {
+		owners := 0
+		for _, r := range school.members {
+			if r == domain.SchoolRoleOwner {
+				owners++
+			}
+		}
+		if owners == 1 {
+			return domain.School{}, ErrLastOwner
+		}
+	}
+	school.members[user.ID] = role
+	return m.school(schoolID), nil
+}
+
+// schoolRole returns the role of a user in a school, or an empty string when
+// the user is not a member. m.mu must be held.
+func (m *MemoryStore) schoolRole(schoolID, userID string) string {
+	if school, ok := m.schools[schoolID]; ok {
+		return school.members[userID]
+	}
+	return ""
+}
+
+// school returns a school with its addresses in the order they were added
+// and its members ordered by name. m.mu must be held.
+func (m *MemoryStore) school(id string) domain.School {
+	s := m.schools[id]
+	school := domain.School{
+		ID:        s.ID,
+		Name:      s.Name,
+		Addresses: []domain.Address{},
+		Contacts:  []domain.SchoolContact{},
+		Members:   []domain.SchoolMember{},
+		CreatedAt: s.CreatedAt,
+		UpdatedAt: s.UpdatedAt,
+	}
+	var addresses []*memoryAddress
+	for _, a := range m.addresses {
+		if a.SchoolID == id {
+			addresses = append(addresses, a)
+		}
+	}
+	sort.Slice(addresses, func(i, j int) bool { return addresses[i].CreatedAt.Before(addresses[j].CreatedAt) })
+	for _, a := range addresses {
+		school.Addresses = append(school.Addresses, a.Address)
+	}
+	for userID, role := range s.members {
+		user := m.users[userID]
+		school.Members = append(school.Members, domain.SchoolMember{UserID: userID, Name: user.Name, Email: user.Email, Role: role})
+	}
+	sort.Slice(school.Members, func(i, j int) bool {
+		a, b := school.Members[i], school.Members[j]
+		if a.Name != b.Name {
+			return a.Name < b.Name
+		}
+		return a.UserID < b.UserID
+	})
+	return school
+}
+
+// CreateAddress saves a personal address of a user
+func (m *MemoryStore) CreateAddress(ctx context.Context, userID string, input domain.AddressInput) (domain.Address, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if _, ok := m.users[userID]; !ok {
+		return domain.Address{}, ErrUserNotFound
+	}
+	return m.addAddress(userID, "", input), nil
+}
+
+// addAddress saves an address of a user or a school. m.mu must be held.
+func (m *MemoryStore) addAddress(userID, schoolID string, input domain.AddressInput) domain.Address {
+	a := &memoryAddress{
+		Address: domain.Address{
+			ID:       uuid.NewString(),
+			SchoolID: schoolID,
+			Label:    input.Label,
+			Line1:    input.Line1,
+			Line2:    input.Line2,
+			City:     input.City,
+			ZipCode:  input.ZipCode,
+		},
+		UserID:    userID,
+		CreatedAt: m.timestamp(),
+	}
+	m.addresses[a.ID] = a
+	return a.Address
+}
+
+// CreateKit creates a kit with its components
+func (m *MemoryStore) CreateKit(ctx context.Context, id string, input KitInput) (domain.Kit, error) {
+	if input.DefaultClassSize <= 0 {
+		return domain.Kit{}, errors.New("default class size must be positive")
+	}
+	var components []domain.KitComponent
+	seen := map[string]bool{}
+	for _, c := range input.Components {
+		if c.Quantity <= 0 || c.PerParticipants < 0 || seen[c.MaterialTypeID] {
+			return domain.Kit{}, errors.New("invalid kit component")
+		}
+		seen[c.MaterialTypeID] = true
+		components = append(components, c)
+	}
+	sort.Slice(components, func(i, j int) bool { return components[i].MaterialTypeID < components[j].MaterialTypeID })
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if err := m.checkRequestable(kitComponentIDs(components)); err != nil {
+		return domain.Kit{}, err
+	}
+	if _, ok := m.kits[id]; ok {
+		return domain.Kit{}, ErrKitExists
+	}
+	kit := domain.Kit{
+		ID:               id,
+		Name:             input.Name,
+		Description:      input.Description,
+		DefaultClassSize: input.DefaultClassSize,
+		Components:       components,
+	}
+	m.kits[id] = kit
+	kit.Components = append([]domain.KitComponent(nil), components...)
+	return kit, nil
+}
+
+// copyRequest returns a request sharing no maps or pointers with req
+func copyRequest(req *domain.Request) domain.Request {
+	c := *req
+	c.Items = copyItems(req.Items)
+	c.Kits = copyKits(req.Kits)
+	c.ReturnDate = truncateTime(req.ReturnDate)
+	c.Metadata, _ = cloneMetadata(req.Metadata)
+	return c
+}
+
+func copyItems(items map[string]int) map[string]int {
+	c := make(map[string]int, len(items))
+	for id, quantity := range items {
+		c[id] = quantity
+	}
+	return c
+}
+
+func copyKits(kits []domain.RequestKit) []domain.RequestKit {
+	if kits == nil {
+		return nil
+	}
+	c := make([]domain.RequestKit, len(kits))
+	for i, rk := range kits {
+		rk.Items = copyItems(rk.Items)
+		c[i] = rk
+	}
+	return c
+}
+
+func truncateTime(t *time.Time) *time.Time {
+	if t == nil {
+		return nil
+	}
+	truncated := t.Truncate(time.Microsecond)
+	return &truncated
+}
+
+// cloneMetadata copies metadata through JSON like the jsonb column does
+func cloneMetadata(metadata map[string]any) (map[string]any, error) {
+	clone := map[string]any{}
+	if metadata == nil {
+		return clone, nil
+	}
+	data, err := json.Marshal(metadata)
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(data, &clone); err != nil {
+		return nil, err
+	}
+	return clone, nil
+}
@@ -0,0 +1,16 @@
+package db_test
+
+import (
+	"testing"
+
+	"organization_backend/internal/db"
+	"organization_backend/internal/db/dbtest"
+)
+
+func TestMemoryStoreContract(t *testing.T) {
+	dbtest.Run(t, func(t *testing.T) dbtest.Backend {
+		notifier := db.NewMemoryNotifier(16)
+		store := db.NewMemoryStore(notifier)
+		return dbtest.Backend{Requests: store, Users: store, Notifier: notifier, Fixtures: store}
+	})
+}
@@ -2,79 +2,404 @@ package db
 
 import (
 	"context"
+	"crypto/sha256"
 	"database/sql"
 	"embed"
+	"encoding/hex"
+	"errors"
 	"fmt"
 	"io/fs"
+	"path"
+	"regexp"
 	"sort"
+	"strconv"
+	"strings"
 	"time"
 )
 
 //go:embed migrations/*.sql
 var migrationsFS embed.FS
 
+// migrationLockKey is the advisory lock held while migrations run, so that
+// replicas starting at the same time do not migrate concurrently
+const migrationLockKey int64 = 0x6f72675f6d696772 // "org_migr"
+
+// migrationFile matches NNN_name.up.sql and NNN_name.down.sql
+var migrationFile = regexp.MustCompile(`^(\d+)_([a-z0-9_]+)\.(up|down)\.sql$`)
+
+// Migration is a numbered schema change and its rollback
+type Migration struct {
+	Version int
+	Name    string
+	// ID is recorded in schema_migrations.filename. It keeps the
+	// migrations/NNN_name.sql form of the files before they were split into
+	// up and down, so databases migrated by older builds stay recognized.
+	ID   string
+	Up   string
+	Down string
+	// Checksum is the SHA-256 of Up, recorded to detect edited migrations
+	Checksum string
+}
+
+// MigrationStatus is a migration together with its state in the database
+type MigrationStatus struct {
+	Migration
+	Applied   bool
+	AppliedAt time.Time
+	// Drifted is set when the applied migration was edited since
+	Drifted bool
+	// Missing is set for applied migrations that have no file, e.g. when a
+	// newer build migrated the database
+	Missing bool
+}
+
+// LoadMigrations reads the migrations in dir of fsys, ordered by version
+func LoadMigrations(fsys fs.FS, dir string) ([]Migration, error) {
+	entries, err := fs.ReadDir(fsys, dir)
+	if err != nil {
+		return nil, fmt.Errorf("list migrations: %w", err)
+	}
+	byVersion := map[int]*Migration{}
+	for _, entry := range entries {
+		if entry.IsDir() || !strings.HasSuffix(entry.Name(), ".sql") {
+			continue
+		}
+		match := migrationFile.FindStringSubmatch(entry.Name())
+		if match == nil {
+			return nil, fmt.Errorf("migration %s is not named NNN_name.up.sql or NNN_name.down.sql", entry.Name())
+		}
+		version, err := strconv.Atoi(match[1])
+		if err != nil {
+			return nil, fmt.Errorf("migration %s: %w", entry.Name(), err)
+		}
+		m := byVersion[version]
+		if m == nil {
+			m = &Migration{
+				Version: version,
+				Name:    match[2],
+				ID:      "migrations/" + match[1] + "_" + match[2] + ".sql",
+			}
+			byVersion[version] = m
+		} else if m.Name != match[2] {
+			return nil, fmt.Errorf("migrations %s and %s share version %d", m.Name, match[2], version)
+		}
+		body, err := fs.ReadFile(fsys, path.Join(dir, entry.Name()))
+		if err != nil {
+			return nil, fmt.Errorf("read migration %s: %w", entry.Name(), err)
+		}
+		if match[3] == "up" {
+			m.Up = string(body)
+			sum := sha256.Sum256(body)
+			m.Checksum = hex.EncodeToString(sum[:])
+		} else {
+			m.Down = string(body)
+		}
+	}
+
+	migrations := make([]Migration, 0, len(byVersion))
+	for _, m := range byVersion {
+		if m.Checksum == "" {
+			return nil, fmt.Errorf("migration %03d_%s has no up file", m.Version, m.Name)
+		}
+		migrations = append(migrations, *m)
+	}
+	sort.Slice(migrations, func(i, j int) bool { return migrations[i].Version < migrations[j].Version })
+	return migrations, nil
+}
+
+// Migrator applies and rolls back migrations
+type Migrator struct {
+	db         *sql.DB
+	migrations []Migration
+}
+
+// NewMigrator returns a migrator for the migrations embedded in the binary
+func NewMigrator(db *sql.DB) (*Migrator, error) {
+	migrations, err := LoadMigrations(migrationsFS, "migrations")
+	if err != nil {
+		return nil, err
+	}
+	return &Migrator{db: db, migrations: migrations}, nil
+}
+
+// Migrate applies all pending migrations
 func Migrate(ctx context.Context, db *sql.DB) error {
-	if _, err := db.ExecContext(ctx, `
-		CREATE TABLE IF NOT EXISTS schema_migrations (
-			filename text PRIMARY KEY,
-			applied_at timestamptz NOT NULL
-		)
-	`); err != nil {
-		return fmt.Errorf("create schema_migrations: %w", err)
+	m, err := NewMigrator(db)
+	if err != nil {
+		return err
 	}
+	_, err = m.Up(ctx)
+	return err
+}
 
-	entries, err := fs.Glob(migrationsFS, "migrations/*.sql")
+// PendingMigrations returns the IDs of the embedded migrations not yet
+// applied to db
+func PendingMigrations(ctx context.Context, db *sql.DB) ([]string, error) {
+	m, err := NewMigrator(db)
 	if err != nil {
-		return fmt.Errorf("list migrations: %w", err)
+		return nil, err
+	}
+	statuses, err := m.Status(ctx)
+	if err != nil {
+		return nil, err
+	}
+	var pending []string
+	for _, s := range statuses {
+		if !s.Applied {
+			pending = append(pending, s.ID)
+		}
 	}
-	sort.Strings(entries)
+	return pending, nil
+}
 
-	for _, path := range entries {
-		applied, err := isMigrationApplied(ctx, db, path)
+// Up applies the pending migrations in order, each in its own transaction,
+// and returns them. It refuses to run when an applied migration was edited.
+func (m *Migrator) Up(ctx context.Context) ([]Migration, error) {
+	var applied []Migration
+	err := m.locked(ctx, func(conn *sql.Conn) error {
+		statuses, err := m.status(ctx, conn)
 		if err != nil {
 			return err
 		}
-		if applied {
-			continue
+		if err := checkDrift(statuses); err != nil {
+			return err
 		}
+		for _, s := range statuses {
+			if s.Applied && !s.Missing {
+				// Rows of older builds get the checksum of the current file
+				if _, err := conn.ExecContext(ctx, `
+					UPDATE schema_migrations SET checksum = $2
+					WHERE filename = $1 AND checksum IS NULL
+				`, s.ID, s.Checksum); err != nil {
+					return fmt.Errorf("record checksum of %s: %w", s.ID, err)
+				}
+			}
+			if s.Applied || s.Missing {
+				continue
+			}
+			if err := m.apply(ctx, conn, s.Migration); err != nil {
+				return err
+			}
+			applied = append(applied, s.Migration)
+		}
+		return nil
+	})
+	return applied, err
+}
 
-		body, err := migrationsFS.ReadFile(path)
+// Down rolls back the n most recently applied migrations and returns them
+func (m *Migrator) Down(ctx context.Context, n int) ([]Migration, error) {
+	if n < 1 {
+		return nil, errors.New("roll back at least one migration")
+	}
+	var rolledBack []Migration
+	err := m.locked(ctx, func(conn *sql.Conn) error {
+		statuses, err := m.status(ctx, conn)
 		if err != nil {
-			return fmt.Errorf("read migration %s: %w", path, err)
+			return err
+		}
+		var targets []Migration
+		for i := len(statuses) - 1; i >= 0 && len(targets) < n; i-- {
+			s := statuses[i]
+			if !s.Applied {
+				continue
+			}
+			if s.Missing {
+				return fmt.Errorf("migration %s was applied by another build and cannot be rolled back by this one", s.ID)
+			}
+			if strings.TrimSpace(s.Down) == "" {
+				return fmt.Errorf("migration %03d_%s has no down file", s.Version, s.Name)
+			}
+			targets = append(targets, s.Migration)
+		}
+		for _, migration := range targets {
+			if err := m.revert(ctx, conn, migration); err != nil {
+				return err
+			}
+			rolledBack = append(rolledBack, migration)
 		}
+		return nil
+	})
+	return rolledBack, err
+}
 
-		tx, err := db.BeginTx(ctx, nil)
-		if err != nil {
-			return fmt.Errorf("begin migration %s: %w", path, err)
+// Status returns every known migration and every applied one, ordered by
+// version. It only reads, so it is cheap enough for readiness checks.
+func (m *Migrator) Status(ctx context.Context) ([]MigrationStatus, error) {
+	return m.status(ctx, m.db)
+}
+
+// Verify reports applied migrations that were edited or have no file
+func (m *Migrator) Verify(ctx context.Context) error {
+	statuses, err := m.Status(ctx)
+	if err != nil {
+		return err
+	}
+	var problems []string
+	for _, s := range statuses {
+		switch {
+		case s.Drifted:
+			problems = append(problems, fmt.Sprintf("%s was edited after it was applied", s.ID))
+		case s.Missing:
+			problems = append(problems, fmt.Sprintf("%s is applied but has no file", s.ID))
 		}
+	}
+	if len(problems) > 0 {
+		return fmt.Errorf("migrations do not match the database:\n  - %s", strings.Join(problems, "\n  - "))
+	}
+	return nil
+}
+
+// locked runs fn on a single connection holding the migration lock
+func (m *Migrator) locked(ctx context.Context, fn func(*sql.Conn) error) error {
+	conn, err := m.db.Conn(ctx)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	if _, err := conn.ExecContext(ctx, `SELECT pg_advisory_lock($1)`, migrationLockKey); err != nil {
+		return fmt.Errorf("acquire migration lock: %w", err)
+	}
+	defer func() {
+		// Unlock even when ctx was canceled
+		_, _ = conn.ExecContext(context.Background(), `SELECT pg_advisory_unlock($1)`, migrationLockKey)
+	}()
+	if err := ensureMigrationsTable(ctx, conn); err != nil {
+		return err
+	}
+	return fn(conn)
+}
 
-		if _, err := tx.ExecContext(ctx, string(body)); err != nil {
-			_ = tx.Rollback()
-			return fmt.Errorf("execute migration %s: %w", path, err)
+// ensureMigrationsTable creates schema_migrations, or adds the checksum
+// column to the table of older builds
+func ensureMigrationsTable(ctx context.Context, conn *sql.Conn) error {
+	if _, err := conn.ExecContext(ctx, `
+		CREATE TABLE IF NOT EXISTS schema_migrations (
+			filename text PRIMARY KEY,
+			applied_at timestamptz NOT NULL
+		)
+	`); err != nil {
+		return fmt.Errorf("create schema_migrations: %w", err)
+	}
+	if _, err := conn.ExecContext(ctx, `
+		ALTER TABLE schema_migrations ADD COLUMN IF NOT EXISTS checksum text
+	`); err != nil {
+		return fmt.Errorf("upgrade schema_migrations: %w", err)
+	}
+	return nil
+}
+
+func (m *Migrator) status(ctx context.Context, q queryer) ([]MigrationStatus, error) {
+	type appliedRow struct {
+		appliedAt time.Time
+		checksum  sql.NullString
+	}
+	// The table may not exist yet, or lack the checksum of older builds
+	var hasTable, hasChecksum bool
+	if err := q.QueryRowContext(ctx, `
+		SELECT to_regclass('schema_migrations') IS NOT NULL,
+		       EXISTS (
+		         SELECT 1 FROM information_schema.columns
+		         WHERE table_schema = current_schema()
+		           AND table_name = 'schema_migrations' AND column_name = 'checksum'
+		       )
+	`).Scan(&hasTable, &hasChecksum); err != nil {
+		return nil, fmt.Errorf("inspect schema_migrations: %w", err)
+	}
+	applied := map[string]appliedRow{}
+	if hasTable {
+		query := `SELECT filename, applied_at, NULL::text FROM schema_migrations`
+		if hasChecksum {
+			query = `SELECT filename, applied_at, checksum FROM schema_migrations`
+		}
+		rows, err := q.QueryContext(ctx, query)
+		if err != nil {
+			return nil, fmt.Errorf("list applied migrations: %w", err)
 		}
-		if _, err := tx.ExecContext(ctx, `
-			INSERT INTO schema_migrations (filename, applied_at)
-			VALUES ($1, $2)
-		`, path, time.Now().UTC()); err != nil {
-			_ = tx.Rollback()
-			return fmt.Errorf("record migration %s: %w", path, err)
+		defer rows.Close()
+		for rows.Next() {
+			var filename string
+			var row appliedRow
+			if err := rows.Scan(&filename, &row.appliedAt, &row.checksum); err != nil {
+				return nil, err
+			}
+			applied[filename] = row
 		}
-		if err := tx.Commit(); err != nil {
-			return fmt.Errorf("commit migration %s: %w", path, err)
+		if err := rows.Err(); err != nil {
+			return nil, err
 		}
 	}
 
+	statuses := make([]MigrationStatus, 0, len(m.migrations))
+	for _, migration := range m.migrations {
+		s := MigrationStatus{Migration: migration}
+		if row, ok := applied[migration.ID]; ok {
+			s.Applied = true
+			s.AppliedAt = row.appliedAt
+			// Rows of older builds have no checksum until the next Up
+			s.Drifted = row.checksum.Valid && row.checksum.String != migration.Checksum
+			delete(applied, migration.ID)
+		}
+		statuses = append(statuses, s)
+	}
+	for filename, row := range applied {
+		s := MigrationStatus{Applied: true, AppliedAt: row.appliedAt, Missing: true}
+		s.ID = filename
+		version, name, _ := strings.Cut(strings.TrimSuffix(path.Base(filename), ".sql"), "_")
+		s.Version, _ = strconv.Atoi(version)
+		s.Name = name
+		statuses = append(statuses, s)
+	}
+	sort.SliceStable(statuses, func(i, j int) bool { return statuses[i].Version < statuses[j].Version })
+	return statuses, nil
+}
+
+func checkDrift(statuses []MigrationStatus) error {
+	for _, s := range statuses {
+		if s.Drifted {
+			return fmt.Errorf("migration %s was edited after it was applied; run migrate verify", s.ID)
+		}
+	}
 	return nil
 }
 
-func isMigrationApplied(ctx context.Context, db *sql.DB, filename string) (bool, error) {
-	var exists bool
-	if err := db.QueryRowContext(ctx, `
-		SELECT EXISTS (
-			SELECT 1 FROM schema_migrations WHERE filename = $1
-		)
-	`, filename).Scan(&exists); err != nil {
-		return false, fmt.Errorf("check migration %s: %w", filename, err)
+func (m *Migrator) apply(ctx context.Context, conn *sql.Conn, migration Migration) error {
+	tx, err := conn.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("begin migration %s: %w", migration.ID, err)
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.ExecContext(ctx, migration.Up); err != nil {
+		return fmt.Errorf("execute migration %s: %w", migration.ID, err)
+	}
+	if _, err := tx.ExecContext(ctx, `
+		INSERT INTO schema_migrations (filename, applied_at, checksum)
+		VALUES ($1, $2, $3)
+	`, migration.ID, time.Now().UTC(), migration.Checksum); err != nil {
+		return fmt.Errorf("record migration %s: %w", migration.ID, err)
 	}
-	return exists, nil
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("commit migration %s: %w", migration.ID, err)
+	}
+	return nil
+}
+
+func (m *Migrator) revert(ctx context.Context, conn *sql.Conn, migration Migration) error {
+	tx, err := conn.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("begin rollback of %s: %w", migration.ID, err)
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.ExecContext(ctx, migration.Down); err != nil {
+		return fmt.Errorf("roll back migration %s: %w", migration.ID, err)
+	}
+	if _, err := tx.ExecContext(ctx, `DELETE FROM schema_migrations WHERE filename = $1`, migration.ID); err != nil {
+		return fmt.Errorf("unrecord migration %s: %w", migration.ID, err)
+	}
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("commit rollback of %s: %w", migration.ID, err)
+	}
+	return nil
 }
@@ -0,0 +1,10 @@
+DROP TRIGGER IF EXISTS requests_notify_change ON requests;
+DROP FUNCTION IF EXISTS notify_request_change();
+DROP TRIGGER IF EXISTS requests_set_updated_at ON requests;
+DROP FUNCTION IF EXISTS set_requests_updated_at();
+
+DROP TABLE IF EXISTS material_available;
+DROP TABLE IF EXISTS distribution_centers;
+DROP TABLE IF EXISTS request_items;
+DROP TABLE IF EXISTS requests;
+DROP TABLE IF EXISTS customers;
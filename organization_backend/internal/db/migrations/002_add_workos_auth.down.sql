@@ -0,0 +1,3 @@
+DROP INDEX IF EXISTS customers_workos_user_id_idx;
+ALTER TABLE customers DROP COLUMN IF EXISTS email_verified;
+ALTER TABLE customers DROP COLUMN IF EXISTS workos_user_id;
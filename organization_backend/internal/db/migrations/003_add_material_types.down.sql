@@ -0,0 +1,3 @@
+ALTER TABLE material_available DROP CONSTRAINT IF EXISTS material_available_material_type_id_fkey;
+ALTER TABLE request_items DROP CONSTRAINT IF EXISTS request_items_material_type_id_fkey;
+DROP TABLE IF EXISTS material_types;
@@ -0,0 +1,13 @@
+DROP INDEX IF EXISTS users_is_admin_idx;
+
+ALTER TABLE requests
+  DROP CONSTRAINT IF EXISTS requests_user_id_fkey,
+  ADD CONSTRAINT requests_customer_id_fkey
+    FOREIGN KEY (customer_id) REFERENCES users(id) ON DELETE RESTRICT;
+
+ALTER TABLE users DROP COLUMN IF EXISTS is_admin;
+
+ALTER INDEX IF EXISTS users_workos_user_id_idx RENAME TO customers_workos_user_id_idx;
+ALTER INDEX IF EXISTS users_email_idx RENAME TO customers_email_idx;
+ALTER TABLE users RENAME CONSTRAINT users_pkey TO customers_pkey;
+ALTER TABLE users RENAME TO customers;
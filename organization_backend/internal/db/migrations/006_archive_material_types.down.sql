@@ -0,0 +1,2 @@
+DROP INDEX IF EXISTS material_types_active_name_idx;
+ALTER TABLE material_types DROP COLUMN IF EXISTS archived_at;
@@ -0,0 +1,5 @@
+-- Material types are archived instead of deleted once they are in use
+ALTER TABLE material_types ADD COLUMN IF NOT EXISTS archived_at timestamptz;
+
+-- Index for listing active material types
+CREATE INDEX IF NOT EXISTS material_types_active_name_idx ON material_types(name) WHERE archived_at IS NULL;
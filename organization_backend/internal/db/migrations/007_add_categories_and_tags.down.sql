@@ -0,0 +1,6 @@
+DROP INDEX IF EXISTS material_types_tags_idx;
+DROP INDEX IF EXISTS material_types_category_idx;
+ALTER TABLE material_types DROP COLUMN IF EXISTS tags;
+ALTER TABLE material_types DROP COLUMN IF EXISTS category_id;
+
+DROP TABLE IF EXISTS categories;
@@ -0,0 +1,24 @@
+-- Hierarchical, orderable categories for material types
+CREATE TABLE IF NOT EXISTS categories (
+  id text PRIMARY KEY,
+  parent_id text REFERENCES categories(id) ON DELETE RESTRICT,
+  name text NOT NULL,
+  sort_order int NOT NULL DEFAULT 0,
+  CONSTRAINT categories_parent_check CHECK (parent_id IS NULL OR parent_id <> id)
+);
+
+CREATE INDEX IF NOT EXISTS categories_parent_idx ON categories(parent_id, sort_order, name);
+
+-- Seed the categories used by the demo catalog
+INSERT INTO categories (id, name, sort_order) VALUES
+  ('reanimation', 'Reanimation', 10),
+  ('wundversorgung_trauma', 'Wundversorgung & Trauma', 20),
+  ('zubehoer', 'Zubehör', 30)
+ON CONFLICT (id) DO NOTHING;
+
+-- Category and free-form tags on material types
+ALTER TABLE material_types ADD COLUMN IF NOT EXISTS category_id text REFERENCES categories(id) ON DELETE SET NULL;
+ALTER TABLE material_types ADD COLUMN IF NOT EXISTS tags text[] NOT NULL DEFAULT '{}';
+
+CREATE INDEX IF NOT EXISTS material_types_category_idx ON material_types(category_id);
+CREATE INDEX IF NOT EXISTS material_types_tags_idx ON material_types USING gin (tags);
@@ -0,0 +1,20 @@
+-- Items expanded from kits may repeat a material type; they are merged back
+-- into one row per material type before the old primary key is restored
+DROP INDEX IF EXISTS request_items_material_type_idx;
+DROP INDEX IF EXISTS request_items_origin_idx;
+
+CREATE TEMP TABLE merged_request_items ON COMMIT DROP AS
+SELECT request_id, material_type_id, sum(quantity)::int AS quantity
+FROM request_items
+GROUP BY request_id, material_type_id;
+
+DELETE FROM request_items;
+ALTER TABLE request_items DROP COLUMN IF EXISTS id;
+ALTER TABLE request_items DROP COLUMN IF EXISTS kit_id;
+INSERT INTO request_items (request_id, material_type_id, quantity)
+SELECT request_id, material_type_id, quantity FROM merged_request_items;
+ALTER TABLE request_items ADD PRIMARY KEY (request_id, material_type_id);
+
+DROP TABLE IF EXISTS request_kits;
+DROP TABLE IF EXISTS kit_items;
+DROP TABLE IF EXISTS kits;
@@ -0,0 +1,34 @@
+-- Kits bundle several material types, scaled by class size
+CREATE TABLE IF NOT EXISTS kits (
+  id text PRIMARY KEY,
+  name text NOT NULL,
+  description text NOT NULL,
+  default_class_size int NOT NULL DEFAULT 1 CHECK (default_class_size > 0),
+  created_at timestamptz NOT NULL DEFAULT now()
+);
+
+-- per_participants = 0 means a fixed quantity regardless of class size,
+-- otherwise quantity is needed for every started group of per_participants
+CREATE TABLE IF NOT EXISTS kit_items (
+  kit_id text NOT NULL REFERENCES kits(id) ON DELETE CASCADE,
+  material_type_id text NOT NULL REFERENCES material_types(id) ON DELETE RESTRICT,
+  quantity int NOT NULL CHECK (quantity > 0),
+  per_participants int NOT NULL DEFAULT 0 CHECK (per_participants >= 0),
+  PRIMARY KEY (kit_id, material_type_id)
+);
+
+-- Kits chosen for a request
+CREATE TABLE IF NOT EXISTS request_kits (
+  request_id uuid NOT NULL REFERENCES requests(id) ON DELETE CASCADE,
+  kit_id text NOT NULL REFERENCES kits(id) ON DELETE RESTRICT,
+  class_size int NOT NULL CHECK (class_size > 0),
+  PRIMARY KEY (request_id, kit_id)
+);
+
+-- Request items remember which kit they were expanded from, so the same
+-- material type may appear once per origin
+ALTER TABLE request_items ADD COLUMN IF NOT EXISTS kit_id text REFERENCES kits(id) ON DELETE RESTRICT;
+ALTER TABLE request_items DROP CONSTRAINT IF EXISTS request_items_pkey;
+ALTER TABLE request_items ADD COLUMN IF NOT EXISTS id bigserial PRIMARY KEY;
+CREATE UNIQUE INDEX IF NOT EXISTS request_items_origin_idx ON request_items (request_id, material_type_id, COALESCE(kit_id, ''));
+CREATE INDEX IF NOT EXISTS request_items_material_type_idx ON request_items (material_type_id);
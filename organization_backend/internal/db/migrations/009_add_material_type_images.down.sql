@@ -0,0 +1 @@
+DROP TABLE IF EXISTS material_type_images;
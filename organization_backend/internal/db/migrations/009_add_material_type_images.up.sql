@@ -0,0 +1,15 @@
+-- Ordered image gallery per material type with generated size variants.
+-- Files are named by content hash, so a hash is unique per material type.
+CREATE TABLE IF NOT EXISTS material_type_images (
+  id uuid PRIMARY KEY DEFAULT gen_random_uuid(),
+  material_type_id text NOT NULL REFERENCES material_types(id) ON DELETE CASCADE,
+  position int NOT NULL,
+  alt_text text NOT NULL DEFAULT '',
+  content_hash text NOT NULL,
+  original_url text NOT NULL,
+  variants jsonb NOT NULL DEFAULT '[]'::jsonb,
+  created_at timestamptz NOT NULL DEFAULT now(),
+  UNIQUE (material_type_id, content_hash)
+);
+
+CREATE INDEX IF NOT EXISTS material_type_images_position_idx ON material_type_images (material_type_id, position);
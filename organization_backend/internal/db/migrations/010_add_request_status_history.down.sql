@@ -0,0 +1,3 @@
+DROP TRIGGER IF EXISTS requests_record_status ON requests;
+DROP FUNCTION IF EXISTS record_request_status();
+DROP TABLE IF EXISTS request_status_history;
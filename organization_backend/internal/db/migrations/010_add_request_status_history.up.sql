@@ -0,0 +1,33 @@
+-- Every status a request has been in, recorded by trigger so status changes
+-- made by the distribution backend are captured as well
+CREATE TABLE IF NOT EXISTS request_status_history (
+  id bigserial PRIMARY KEY,
+  request_id uuid NOT NULL REFERENCES requests(id) ON DELETE CASCADE,
+  status text NOT NULL,
+  changed_at timestamptz NOT NULL DEFAULT now()
+);
+
+CREATE INDEX IF NOT EXISTS request_status_history_request_idx ON request_status_history (request_id, changed_at);
+
+CREATE OR REPLACE FUNCTION record_request_status()
+RETURNS trigger AS $$
+BEGIN
+  IF TG_OP = 'INSERT' OR NEW.status IS DISTINCT FROM OLD.status THEN
+    INSERT INTO request_status_history (request_id, status, changed_at)
+    VALUES (NEW.id, NEW.status, now());
+  END IF;
+  RETURN NEW;
+END;
+$$ LANGUAGE plpgsql;
+
+DROP TRIGGER IF EXISTS requests_record_status ON requests;
+CREATE TRIGGER requests_record_status
+AFTER INSERT OR UPDATE OF status ON requests
+FOR EACH ROW
+EXECUTE FUNCTION record_request_status();
+
+-- Existing requests start their history with the current status
+INSERT INTO request_status_history (request_id, status, changed_at)
+SELECT r.id, r.status, r.updated_at
+FROM requests r
+WHERE NOT EXISTS (SELECT 1 FROM request_status_history h WHERE h.request_id = r.id);
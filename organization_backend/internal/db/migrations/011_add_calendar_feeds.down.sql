@@ -0,0 +1,9 @@
+ALTER TABLE users DROP COLUMN IF EXISTS calendar_token;
+ALTER TABLE users DROP COLUMN IF EXISTS distribution_center_id;
+
+DROP INDEX IF EXISTS requests_return_date_idx;
+DROP INDEX IF EXISTS requests_delivery_date_idx;
+DROP INDEX IF EXISTS requests_distribution_center_idx;
+ALTER TABLE requests DROP COLUMN IF EXISTS distribution_center_id;
+ALTER TABLE requests DROP CONSTRAINT IF EXISTS requests_return_date_check;
+ALTER TABLE requests DROP COLUMN IF EXISTS return_date;
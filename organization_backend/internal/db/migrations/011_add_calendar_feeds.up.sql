@@ -0,0 +1,17 @@
+-- Date the material is due back, shown in calendar feeds
+ALTER TABLE requests ADD COLUMN IF NOT EXISTS return_date timestamptz;
+ALTER TABLE requests DROP CONSTRAINT IF EXISTS requests_return_date_check;
+ALTER TABLE requests ADD CONSTRAINT requests_return_date_check CHECK (return_date IS NULL OR return_date >= delivery_date);
+
+-- Distribution center a request is routed to for packing and delivery
+ALTER TABLE requests ADD COLUMN IF NOT EXISTS distribution_center_id uuid REFERENCES distribution_centers(id) ON DELETE SET NULL;
+CREATE INDEX IF NOT EXISTS requests_distribution_center_idx ON requests (distribution_center_id) WHERE distribution_center_id IS NOT NULL;
+
+CREATE INDEX IF NOT EXISTS requests_delivery_date_idx ON requests (delivery_date);
+CREATE INDEX IF NOT EXISTS requests_return_date_idx ON requests (return_date) WHERE return_date IS NOT NULL;
+
+-- Users assigned to a distribution center are its staff
+ALTER TABLE users ADD COLUMN IF NOT EXISTS distribution_center_id uuid REFERENCES distribution_centers(id) ON DELETE SET NULL;
+
+-- Secret token of the user's calendar feed URL
+ALTER TABLE users ADD COLUMN IF NOT EXISTS calendar_token text UNIQUE;
@@ -0,0 +1,3 @@
+DROP TABLE IF EXISTS analytics_refreshes;
+DROP MATERIALIZED VIEW IF EXISTS analytics_item_loans;
+DROP MATERIALIZED VIEW IF EXISTS analytics_request_facts;
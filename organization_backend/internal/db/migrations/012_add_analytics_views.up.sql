@@ -0,0 +1,56 @@
+-- Denormalized facts for the admin dashboard. The views are refreshed
+-- periodically by the server so dashboard queries never scan the live tables.
+
+-- One row per request. returned_at is the time a returned request last
+-- entered the returned status.
+CREATE MATERIALIZED VIEW IF NOT EXISTS analytics_request_facts AS
+SELECT r.id AS request_id,
+       r.customer_id,
+       r.status,
+       r.created_at,
+       r.delivery_date,
+       r.return_date,
+       CASE WHEN r.status = 'returned' THEN (
+         SELECT max(h.changed_at) FROM request_status_history h
+         WHERE h.request_id = r.id AND h.status = 'returned'
+       ) END AS returned_at,
+       r.distribution_center_id,
+       r.shipping_zip_code AS zip_code
+FROM requests r
+WITH DATA;
+
+CREATE UNIQUE INDEX IF NOT EXISTS analytics_request_facts_pkey ON analytics_request_facts (request_id);
+CREATE INDEX IF NOT EXISTS analytics_request_facts_created_idx ON analytics_request_facts (created_at);
+CREATE INDEX IF NOT EXISTS analytics_request_facts_delivery_idx ON analytics_request_facts (delivery_date);
+CREATE INDEX IF NOT EXISTS analytics_request_facts_return_idx ON analytics_request_facts (return_date) WHERE return_date IS NOT NULL;
+
+-- One row per request and material type with the period the material is
+-- away from the distribution center. Items of kits and items requested
+-- directly are summed. Loans of requests that are not returned yet are open
+-- ended.
+CREATE MATERIALIZED VIEW IF NOT EXISTS analytics_item_loans AS
+SELECT f.request_id,
+       i.material_type_id,
+       f.distribution_center_id,
+       SUM(i.quantity) AS quantity,
+       f.created_at,
+       f.delivery_date AS loan_start,
+       GREATEST(f.delivery_date, COALESCE(f.returned_at, 'infinity'::timestamptz)) AS loan_end
+FROM analytics_request_facts f
+JOIN request_items i ON i.request_id = f.request_id
+GROUP BY f.request_id, i.material_type_id, f.distribution_center_id, f.created_at,
+         f.delivery_date, f.returned_at
+WITH DATA;
+
+CREATE UNIQUE INDEX IF NOT EXISTS analytics_item_loans_pkey ON analytics_item_loans (request_id, material_type_id);
+CREATE INDEX IF NOT EXISTS analytics_item_loans_created_idx ON analytics_item_loans (created_at);
+CREATE INDEX IF NOT EXISTS analytics_item_loans_period_idx ON analytics_item_loans (loan_start, loan_end);
+
+-- Time of the last refresh, shown next to the charts
+CREATE TABLE IF NOT EXISTS analytics_refreshes (
+  id boolean PRIMARY KEY DEFAULT true CHECK (id),
+  refreshed_at timestamptz NOT NULL
+);
+
+INSERT INTO analytics_refreshes (id, refreshed_at) VALUES (true, now())
+ON CONFLICT (id) DO NOTHING;
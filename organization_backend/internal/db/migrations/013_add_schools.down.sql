@@ -0,0 +1,8 @@
+-- Requests keep their customer_id, so only the school assignment is lost
+DROP INDEX IF EXISTS requests_school_idx;
+ALTER TABLE requests DROP COLUMN IF EXISTS school_id;
+
+DROP TABLE IF EXISTS school_contacts;
+DROP TABLE IF EXISTS addresses;
+DROP TABLE IF EXISTS school_members;
+DROP TABLE IF EXISTS schools;
@@ -0,0 +1,81 @@
+-- Schools (organizations) that request material. Users are login identities
+-- and can be members of several schools.
+CREATE TABLE IF NOT EXISTS schools (
+  id uuid PRIMARY KEY DEFAULT gen_random_uuid(),
+  name text NOT NULL,
+  created_at timestamptz NOT NULL DEFAULT now(),
+  updated_at timestamptz NOT NULL DEFAULT now()
+);
+
+CREATE TABLE IF NOT EXISTS school_members (
+  school_id uuid NOT NULL REFERENCES schools(id) ON DELETE CASCADE,
+  user_id uuid NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+  role text NOT NULL DEFAULT 'member',
+  created_at timestamptz NOT NULL DEFAULT now(),
+  PRIMARY KEY (school_id, user_id),
+  CONSTRAINT school_members_role_check CHECK (role IN ('owner', 'member'))
+);
+
+CREATE INDEX IF NOT EXISTS school_members_user_idx ON school_members (user_id);
+
+-- Addresses of a school. verified_at is set by an admin once the address
+-- has been confirmed and cleared again when it is edited.
+CREATE TABLE IF NOT EXISTS addresses (
+  id uuid PRIMARY KEY DEFAULT gen_random_uuid(),
+  school_id uuid NOT NULL REFERENCES schools(id) ON DELETE CASCADE,
+  label text NOT NULL DEFAULT '',
+  line1 text NOT NULL,
+  line2 text NOT NULL DEFAULT '',
+  city text NOT NULL,
+  zip_code text NOT NULL,
+  verified_at timestamptz,
+  created_at timestamptz NOT NULL DEFAULT now()
+);
+
+CREATE INDEX IF NOT EXISTS addresses_school_idx ON addresses (school_id);
+
+-- Contact people of a school; they do not need a login
+CREATE TABLE IF NOT EXISTS school_contacts (
+  id uuid PRIMARY KEY DEFAULT gen_random_uuid(),
+  school_id uuid NOT NULL REFERENCES schools(id) ON DELETE CASCADE,
+  name text NOT NULL,
+  email text NOT NULL DEFAULT '',
+  phone text NOT NULL DEFAULT '',
+  role text NOT NULL DEFAULT '',
+  created_at timestamptz NOT NULL DEFAULT now()
+);
+
+CREATE INDEX IF NOT EXISTS school_contacts_school_idx ON school_contacts (school_id);
+
+ALTER TABLE requests ADD COLUMN IF NOT EXISTS school_id uuid REFERENCES schools(id) ON DELETE RESTRICT;
+CREATE INDEX IF NOT EXISTS requests_school_idx ON requests (school_id);
+
+DROP TRIGGER IF EXISTS schools_set_updated_at ON schools;
+CREATE TRIGGER schools_set_updated_at
+BEFORE UPDATE ON schools
+FOR EACH ROW
+EXECUTE FUNCTION set_requests_updated_at();
+
+-- Every existing user becomes the owner of a school of their own that keeps
+-- their request history and the addresses they shipped to
+CREATE TEMP TABLE user_schools ON COMMIT DROP AS
+SELECT u.id AS user_id, gen_random_uuid() AS school_id, u.name, u.created_at
+FROM users u
+WHERE NOT EXISTS (SELECT 1 FROM school_members m WHERE m.user_id = u.id);
+
+INSERT INTO schools (id, name, created_at, updated_at)
+SELECT school_id, name, created_at, created_at FROM user_schools;
+
+INSERT INTO school_members (school_id, user_id, role, created_at)
+SELECT school_id, user_id, 'owner', created_at FROM user_schools;
+
+UPDATE requests r SET school_id = us.school_id
+FROM user_schools us
+WHERE r.customer_id = us.user_id AND r.school_id IS NULL;
+
+INSERT INTO addresses (school_id, line1, line2, city, zip_code, created_at)
+SELECT DISTINCT ON (us.school_id, r.shipping_address_line1, COALESCE(r.shipping_address_line2, ''), r.shipping_zip_code, r.shipping_city)
+       us.school_id, r.shipping_address_line1, COALESCE(r.shipping_address_line2, ''), r.shipping_city, r.shipping_zip_code, r.created_at
+FROM user_schools us
+JOIN requests r ON r.customer_id = us.user_id
+ORDER BY us.school_id, r.shipping_address_line1, COALESCE(r.shipping_address_line2, ''), r.shipping_zip_code, r.shipping_city, r.created_at DESC;
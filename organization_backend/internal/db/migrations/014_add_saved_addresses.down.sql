@@ -0,0 +1,8 @@
+-- Addresses saved by single users have no school and are removed
+ALTER TABLE requests DROP COLUMN IF EXISTS shipping_address_id;
+
+DELETE FROM addresses WHERE school_id IS NULL;
+DROP INDEX IF EXISTS addresses_user_idx;
+ALTER TABLE addresses DROP CONSTRAINT IF EXISTS addresses_owner_check;
+ALTER TABLE addresses ALTER COLUMN school_id SET NOT NULL;
+ALTER TABLE addresses DROP COLUMN IF EXISTS user_id;
@@ -0,0 +1,11 @@
+-- Saved addresses belong either to a school or to a single user
+ALTER TABLE addresses ADD COLUMN IF NOT EXISTS user_id uuid REFERENCES users(id) ON DELETE CASCADE;
+ALTER TABLE addresses ALTER COLUMN school_id DROP NOT NULL;
+ALTER TABLE addresses DROP CONSTRAINT IF EXISTS addresses_owner_check;
+ALTER TABLE addresses ADD CONSTRAINT addresses_owner_check CHECK ((school_id IS NULL) <> (user_id IS NULL));
+
+CREATE INDEX IF NOT EXISTS addresses_user_idx ON addresses (user_id);
+
+-- The shipping_* columns keep a snapshot of the address a request was made
+-- with; shipping_address_id only records which saved address it came from
+ALTER TABLE requests ADD COLUMN IF NOT EXISTS shipping_address_id uuid REFERENCES addresses(id) ON DELETE SET NULL;
@@ -0,0 +1,17 @@
+-- Responses of mutating requests sent with an Idempotency-Key header, so that
+-- retries replay the original response instead of repeating the mutation.
+-- user_id is empty for unauthenticated requests. status_code stays NULL while
+-- the first request is still being processed.
+CREATE TABLE IF NOT EXISTS idempotency_keys (
+  user_id text NOT NULL,
+  key text NOT NULL,
+  request_hash text NOT NULL,
+  status_code integer,
+  response_headers jsonb,
+  response_body bytea,
+  created_at timestamptz NOT NULL DEFAULT now(),
+  completed_at timestamptz,
+  PRIMARY KEY (user_id, key)
+);
+
+CREATE INDEX IF NOT EXISTS idempotency_keys_created_at_idx ON idempotency_keys (created_at);
@@ -0,0 +1,2 @@
+-- Disabled users cannot log in; they keep their requests and history
+ALTER TABLE users ADD COLUMN IF NOT EXISTS disabled_at timestamptz;
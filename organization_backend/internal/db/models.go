@@ -20,12 +20,16 @@ type requestRow struct {
 	ID                     string
 	CustomerID             string
 	DeliveryDate           time.Time
+	ReturnDate             *time.Time
+	DistributionCenterID   *string
+	SchoolID               *string
 	Status                 string
 	ShippingCustomerName   string
 	ShippingAddressLine1   string
 	ShippingAddressLine2   *string
 	ShippingCity           string
 	ShippingZipCode        string
+	ShippingAddressID      *string
 	Metadata               json.RawMessage
 	CreatedAt              time.Time
 	UpdatedAt              time.Time
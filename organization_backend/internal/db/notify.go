@@ -3,10 +3,18 @@ package db
 import (
 	"context"
 	"encoding/json"
+	"log/slog"
 	"sync"
+	"sync/atomic"
 	"time"
 
+	"organization_backend/internal/logging"
+	"organization_backend/internal/metrics"
+	"organization_backend/internal/tracing"
+
 	"github.com/lib/pq"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
 )
 
 type RequestUpdate struct {
@@ -15,28 +23,80 @@ type RequestUpdate struct {
 	UpdatedAt time.Time `json:"updated_at"`
 }
 
+// NotifierConfig tunes the LISTEN connection and the subscriber queues
+type NotifierConfig struct {
+	// MinReconnect and MaxReconnect bound the backoff after the listener
+	// loses its connection
+	MinReconnect time.Duration
+	MaxReconnect time.Duration
+	// BufferSize is how many updates are queued per subscriber before
+	// further updates are dropped
+	BufferSize int
+	// Logger receives listener errors; nil uses the default logger
+	Logger  *slog.Logger
+	Metrics *metrics.Metrics
+}
+
+// Notifier passes the notifications of the requests table triggers to its
+// subscribers
 type Notifier struct {
+	hub
 	connStr string
-	mu      sync.RWMutex
-	subs    map[int]chan RequestUpdate
-	nextID  int
+	cfg     NotifierConfig
+	// connected is whether the LISTEN connection is up
+	connected atomic.Bool
+}
+
+// hub queues request updates for its subscribers
+type hub struct {
+	bufferSize int
+	metrics    *metrics.Metrics
+	mu         sync.RWMutex
+	subs       map[int]subscriber
+	nextID     int
+}
+
+// subscriber is a queue of updates and the logger of the request that opened it
+type subscriber struct {
+	ch     chan RequestUpdate
+	logger *slog.Logger
 }
 
-func NewNotifier(connStr string) *Notifier {
+func NewNotifier(connStr string, cfg NotifierConfig) *Notifier {
 	return &Notifier{
+		hub:     newHub(cfg.BufferSize, cfg.Metrics),
 		connStr: connStr,
-		subs:    map[int]chan RequestUpdate{},
+		cfg:     cfg,
+	}
+}
+
+func (n *Notifier) logger() *slog.Logger {
+	if n.cfg.Logger != nil {
+		return n.cfg.Logger
 	}
+	return slog.Default()
 }
 
 func (n *Notifier) Start(ctx context.Context) error {
-	listener := pq.NewListener(n.connStr, 10*time.Second, 30*time.Second, nil)
+	listener := pq.NewListener(n.connStr, n.cfg.MinReconnect, n.cfg.MaxReconnect, func(event pq.ListenerEventType, err error) {
+		n.connected.Store(event == pq.ListenerEventConnected || event == pq.ListenerEventReconnected)
+		switch event {
+		case pq.ListenerEventDisconnected:
+			n.logger().Warn("notification listener disconnected", "error", err)
+		case pq.ListenerEventConnectionAttemptFailed:
+			n.logger().Error("notification listener reconnect failed", "error", err)
+		case pq.ListenerEventReconnected:
+			n.logger().Info("notification listener reconnected")
+		}
+	})
 	if err := listener.Listen("requests_channel"); err != nil {
 		return err
 	}
+	n.connected.Store(true)
 
 	go func() {
 		defer listener.Close()
+		defer n.connected.Store(false)
 		for {
 			select {
 			case <-ctx.Done():
@@ -45,11 +105,8 @@ func (n *Notifier) Start(ctx context.Context) error {
 				if notif == nil {
 					continue
 				}
-				var update RequestUpdate
-				if err := json.Unmarshal([]byte(notif.Extra), &update); err != nil {
-					continue
-				}
-				n.broadcast(update)
+				n.cfg.Metrics.NotificationReceived()
+				n.dispatch(ctx, notif)
 			}
 		}
 	}()
@@ -57,34 +114,98 @@ func (n *Notifier) Start(ctx context.Context) error {
 	return nil
 }
 
-func (n *Notifier) Subscribe() (int, <-chan RequestUpdate) {
+// Connected reports whether the notifier is listening for notifications
+func (n *Notifier) Connected() bool {
+	return n.connected.Load()
+}
+
+// dispatch decodes a notification and passes it to the subscribers
+func (n *Notifier) dispatch(ctx context.Context, notif *pq.Notification) {
+	_, span := tracing.Tracer().Start(ctx, "notifier dispatch", trace.WithSpanKind(trace.SpanKindConsumer), trace.WithAttributes(
+		attribute.String("messaging.system", "postgresql"),
+		attribute.String("messaging.destination.name", notif.Channel),
+	))
+	defer span.End()
+	var update RequestUpdate
+	if err := json.Unmarshal([]byte(notif.Extra), &update); err != nil {
+		tracing.RecordError(span, err)
+		n.logger().Error("malformed request notification", "payload", notif.Extra, "error", err)
+		return
+	}
+	delivered := n.broadcast(update)
+	span.SetAttributes(
+		attribute.String("request.id", update.RequestID),
+		attribute.String("request.action", update.Action),
+		attribute.Int("notifier.delivered", delivered),
+	)
+}
+
+func newHub(bufferSize int, m *metrics.Metrics) hub {
+	return hub{bufferSize: bufferSize, metrics: m, subs: map[int]subscriber{}}
+}
+
+// Subscribers returns the number of open subscriptions
+func (n *hub) Subscribers() int {
+	n.mu.RLock()
+	defer n.mu.RUnlock()
+	return len(n.subs)
+}
+
+// Subscribe returns a queue of request updates. Updates dropped because the
+// queue is full are logged with the logger of ctx.
+func (n *hub) Subscribe(ctx context.Context) (int, <-chan RequestUpdate) {
 	n.mu.Lock()
 	defer n.mu.Unlock()
 	id := n.nextID
 	n.nextID++
-	ch := make(chan RequestUpdate, 10)
-	n.subs[id] = ch
+	ch := make(chan RequestUpdate, n.bufferSize)
+	n.subs[id] = subscriber{ch: ch, logger: logging.FromContext(ctx)}
+	n.metrics.SubscribersChanged(1)
 	return id, ch
 }
 
-func (n *Notifier) Unsubscribe(id int) {
+func (n *hub) Unsubscribe(id int) {
 	n.mu.Lock()
 	defer n.mu.Unlock()
-	ch, ok := n.subs[id]
+	sub, ok := n.subs[id]
 	if !ok {
 		return
 	}
 	delete(n.subs, id)
-	close(ch)
+	close(sub.ch)
+	n.metrics.SubscribersChanged(-1)
 }
 
-func (n *Notifier) broadcast(update RequestUpdate) {
+// broadcast queues update for every subscriber and returns to how many
+func (n *hub) broadcast(update RequestUpdate) int {
 	n.mu.RLock()
 	defer n.mu.RUnlock()
-	for _, ch := range n.subs {
+	delivered := 0
+	for _, sub := range n.subs {
 		select {
-		case ch <- update:
+		case sub.ch <- update:
+			delivered++
 		default:
+			n.metrics.NotificationDropped()
+			sub.logger.Warn("dropped request update for slow subscriber", "request", update.RequestID)
 		}
 	}
+	return delivered
+}
+
+// MemoryNotifier is a RequestNotifier for the memory store. Updates are
+// published by the store instead of table triggers.
+type MemoryNotifier struct {
+	hub
+}
+
+// NewMemoryNotifier returns a notifier queueing up to bufferSize updates
+// per subscriber
+func NewMemoryNotifier(bufferSize int) *MemoryNotifier {
+	return &MemoryNotifier{hub: newHub(bufferSize, nil)}
+}
+
+// Publish queues update for every subscriber and returns to how many
+func (n *MemoryNotifier) Publish(update RequestUpdate) int {
+	return n.broadcast(update)
 }
@@ -6,10 +6,12 @@ import (
 	"encoding/json"
 	"errors"
 	"fmt"
+	"sort"
 	"strings"
 	"time"
 
 	"organization_backend/internal/domain"
+	"organization_backend/internal/tracing"
 	"organization_backend/pkg/pagination"
 
 	"github.com/google/uuid"
@@ -30,14 +32,18 @@ type CreateRequestInput struct {
 	CustomerEmail        string
 	CustomerName         string
 	CustomerToken        string
+	SchoolID             string
 	DeliveryDate         time.Time
+	ReturnDate           *time.Time
 	Status               string
 	ShippingCustomerName string
 	ShippingAddressLine1 string
 	ShippingAddressLine2 string
 	ShippingCity         string
 	ShippingZipCode      string
+	ShippingAddressID    string
 	Items                map[string]int
+	Kits                 []domain.RequestKit
 	Metadata             map[string]any
 }
 
@@ -49,6 +55,9 @@ type ListRequestsParams struct {
 	CustomerID string
 	From       *time.Time
 	To         *time.Time
+	// MemberID restricts results to requests created by the user or
+	// belonging to one of the user's schools
+	MemberID string
 }
 
 type ListRequestsResult struct {
@@ -57,6 +66,8 @@ type ListRequestsResult struct {
 }
 
 func (s *Store) CreateRequest(ctx context.Context, input CreateRequestInput) (domain.Request, error) {
+	ctx, span := tracing.Tracer().Start(ctx, "Store.CreateRequest")
+	defer span.End()
 	tx, err := s.db.BeginTx(ctx, nil)
 	if err != nil {
 		return domain.Request{}, err
@@ -67,6 +78,15 @@ func (s *Store) CreateRequest(ctx context.Context, input CreateRequestInput) (do
 	if err != nil {
 		return domain.Request{}, err
 	}
+	if input.ShippingAddressID != "" {
+		if input, err = applySavedAddress(ctx, tx, user, input); err != nil {
+			return domain.Request{}, err
+		}
+	}
+	schoolID, err := resolveRequestSchool(ctx, tx, user, input)
+	if err != nil {
+		return domain.Request{}, err
+	}
 
 	metadata := input.Metadata
 	if metadata == nil {
@@ -81,39 +101,83 @@ func (s *Store) CreateRequest(ctx context.Context, input CreateRequestInput) (do
 	var createdAt time.Time
 	var updatedAt time.Time
 	line2 := sql.NullString{String: input.ShippingAddressLine2, Valid: input.ShippingAddressLine2 != ""}
+	addressID := sql.NullString{String: input.ShippingAddressID, Valid: input.ShippingAddressID != ""}
 	err = tx.QueryRowContext(ctx, `
 		INSERT INTO requests (
-			customer_id, delivery_date, status, shipping_customer_name, shipping_address_line1,
-			shipping_address_line2, shipping_city, shipping_zip_code, metadata
-		) VALUES ($1,$2,$3,$4,$5,$6,$7,$8,$9)
+			customer_id, school_id, delivery_date, return_date, status, shipping_customer_name, shipping_address_line1,
+			shipping_address_line2, shipping_city, shipping_zip_code, shipping_address_id, metadata
+		) VALUES ($1,$2,$3,$4,$5,$6,$7,$8,$9,$10,$11,$12)
 		RETURNING id, created_at, updated_at
-	`, user.ID, input.DeliveryDate, input.Status, input.ShippingCustomerName, input.ShippingAddressLine1,
-		line2, input.ShippingCity, input.ShippingZipCode, metadataBytes).Scan(&reqID, &createdAt, &updatedAt)
+	`, user.ID, schoolID, input.DeliveryDate, input.ReturnDate, input.Status, input.ShippingCustomerName, input.ShippingAddressLine1,
+		line2, input.ShippingCity, input.ShippingZipCode, addressID, metadataBytes).Scan(&reqID, &createdAt, &updatedAt)
 	if err != nil {
 		return domain.Request{}, err
 	}
 
-	if len(input.Items) == 0 {
+	if len(input.Items) == 0 && len(input.Kits) == 0 {
 		return domain.Request{}, errors.New("items required")
 	}
+
+	requestKits := make([]domain.RequestKit, 0, len(input.Kits))
+	for _, selection := range input.Kits {
+		kit, err := getKit(ctx, tx, selection.KitID)
+		if err != nil {
+			return domain.Request{}, err
+		}
+		classSize := selection.ClassSize
+		if classSize <= 0 {
+			classSize = kit.DefaultClassSize
+		}
+		requestKits = append(requestKits, domain.RequestKit{
+			KitID:     kit.ID,
+			ClassSize: classSize,
+			Items:     kit.Expand(classSize),
+		})
+	}
+
+	materialTypeIDs := make([]string, 0, len(input.Items))
+	for materialTypeID := range input.Items {
+		materialTypeIDs = append(materialTypeIDs, materialTypeID)
+	}
+	for _, rk := range requestKits {
+		for materialTypeID := range rk.Items {
+			materialTypeIDs = append(materialTypeIDs, materialTypeID)
+		}
+	}
+	if err := checkMaterialTypesRequestable(ctx, tx, materialTypeIDs); err != nil {
+		return domain.Request{}, err
+	}
+
+	itemsCtx, itemsSpan := tracing.Tracer().Start(ctx, "Store.insertRequestItems")
+	defer itemsSpan.End()
+	totalItems := map[string]int{}
 	for materialTypeID, quantity := range input.Items {
 		if quantity <= 0 {
 			return domain.Request{}, errors.New("quantity must be positive")
 		}
-		_, err = tx.ExecContext(ctx, `
-			INSERT INTO request_items (request_id, material_type_id, quantity)
+		if err := insertRequestItem(itemsCtx, tx, reqID, materialTypeID, quantity, ""); err != nil {
+			return domain.Request{}, err
+		}
+		totalItems[materialTypeID] += quantity
+	}
+	for _, rk := range requestKits {
+		if _, err := tx.ExecContext(itemsCtx, `
+			INSERT INTO request_kits (request_id, kit_id, class_size)
 			VALUES ($1,$2,$3)
-		`, reqID, materialTypeID, quantity)
-		if err != nil {
+		`, reqID, rk.KitID, rk.ClassSize); err != nil {
 			return domain.Request{}, err
 		}
+		for materialTypeID, quantity := range rk.Items {
+			if err := insertRequestItem(itemsCtx, tx, reqID, materialTypeID, quantity, rk.KitID); err != nil {
+				return domain.Request{}, err
+			}
+			totalItems[materialTypeID] += quantity
+		}
 	}
 
-	if err := tx.Commit(); err != nil {
-		return domain.Request{}, err
-	}
+	itemsSpan.End()
 
-	return domain.Request{
+	created := domain.Request{
 		ID: reqID,
 		Customer: domain.Customer{
 			ID:        user.ID,
@@ -122,20 +186,44 @@ func (s *Store) CreateRequest(ctx context.Context, input CreateRequestInput) (do
 			Token:     user.Token,
 			CreatedAt: user.CreatedAt,
 		},
-		Items:                input.Items,
+		SchoolID:             schoolID,
+		Items:                totalItems,
+		Kits:                 requestKits,
 		DeliveryDate:         input.DeliveryDate,
+		ReturnDate:           input.ReturnDate,
 		Status:               input.Status,
 		ShippingCustomerName: input.ShippingCustomerName,
 		ShippingAddress: domain.ShippingAddress{
-			Line1:   input.ShippingAddressLine1,
-			Line2:   input.ShippingAddressLine2,
-			City:    input.ShippingCity,
-			ZipCode: input.ShippingZipCode,
+			AddressID: input.ShippingAddressID,
+			Line1:     input.ShippingAddressLine1,
+			Line2:     input.ShippingAddressLine2,
+			City:      input.ShippingCity,
+			ZipCode:   input.ShippingZipCode,
 		},
 		CreatedAt: createdAt,
 		UpdatedAt: updatedAt,
 		Metadata:  metadata,
-	}, nil
+	}
+
+	auditState := created
+	auditState.Customer.Token = ""
+	if err := recordAudit(ctx, tx, AuditActionCreate, AuditEntityRequest, reqID, nil, auditState); err != nil {
+		return domain.Request{}, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return domain.Request{}, err
+	}
+
+	return created, nil
+}
+
+func insertRequestItem(ctx context.Context, tx *sql.Tx, requestID, materialTypeID string, quantity int, kitID string) error {
+	_, err := tx.ExecContext(ctx, `
+		INSERT INTO request_items (request_id, material_type_id, quantity, kit_id)
+		VALUES ($1,$2,$3,$4)
+	`, requestID, materialTypeID, quantity, nullString(kitID))
+	return err
 }
 
 func (s *Store) GetRequestByID(ctx context.Context, id string) (domain.Request, error) {
@@ -147,7 +235,13 @@ func (s *Store) GetRequestByID(ctx context.Context, id string) (domain.Request,
 	if err != nil {
 		return domain.Request{}, err
 	}
-	return mapRequest(row, items), nil
+	kits, err := s.getKitsForRequests(ctx, []string{id})
+	if err != nil {
+		return domain.Request{}, err
+	}
+	req := mapRequest(row, items)
+	req.Kits = kits[id]
+	return req, nil
 }
 
 func (s *Store) ListRequests(ctx context.Context, params ListRequestsParams) (ListRequestsResult, error) {
@@ -162,7 +256,7 @@ func (s *Store) ListRequests(ctx context.Context, params ListRequestsParams) (Li
 	if params.Query != "" {
 		args = append(args, "%"+params.Query+"%")
 		n := len(args)
-		where = append(where, fmt.Sprintf("(c.name ILIKE $%d OR c.email ILIKE $%d OR r.id::text ILIKE $%d)", n, n, n))
+		where = append(where, fmt.Sprintf("(u.name ILIKE $%d OR u.email ILIKE $%d OR r.id::text ILIKE $%d)", n, n, n))
 	}
 	if params.Status != "" {
 		args = append(args, params.Status)
@@ -172,6 +266,11 @@ func (s *Store) ListRequests(ctx context.Context, params ListRequestsParams) (Li
 		args = append(args, params.CustomerID)
 		where = append(where, fmt.Sprintf("r.customer_id = $%d", len(args)))
 	}
+	if params.MemberID != "" {
+		args = append(args, params.MemberID)
+		where = append(where, fmt.Sprintf(
+			"(r.customer_id = $%[1]d OR r.school_id IN (SELECT school_id FROM school_members WHERE user_id = $%[1]d))", len(args)))
+	}
 	if params.From != nil {
 		args = append(args, *params.From)
 		where = append(where, fmt.Sprintf("r.delivery_date >= $%d", len(args)))
@@ -187,8 +286,8 @@ func (s *Store) ListRequests(ctx context.Context, params ListRequestsParams) (Li
 
 	args = append(args, limit+1)
 	query := fmt.Sprintf(`
-		SELECT r.id, r.customer_id, r.delivery_date, r.status, r.shipping_customer_name,
-		       r.shipping_address_line1, r.shipping_address_line2, r.shipping_city, r.shipping_zip_code,
+		SELECT r.id, r.customer_id, r.delivery_date, r.return_date, r.distribution_center_id, r.school_id, r.status, r.shipping_customer_name,
+		       r.shipping_address_line1, r.shipping_address_line2, r.shipping_city, r.shipping_zip_code, r.shipping_address_id,
 		       r.metadata, r.created_at, r.updated_at,
 		       u.email, u.name, u.token, u.workos_user_id, u.email_verified, u.created_at
 		FROM requests r
@@ -233,14 +332,21 @@ func (s *Store) ListRequests(ctx context.Context, params ListRequestsParams) (Li
 	if err != nil {
 		return ListRequestsResult{}, err
 	}
+	kitsByRequest, err := s.getKitsForRequests(ctx, ids)
+	if err != nil {
+		return ListRequestsResult{}, err
+	}
 	for i := range result {
 		result[i].Items = itemsByRequest[result[i].ID]
+		result[i].Kits = kitsByRequest[result[i].ID]
 	}
 
 	return ListRequestsResult{Requests: result, NextCursor: nextCursor}, nil
 }
 
 func (s *Store) ensureUser(ctx context.Context, tx *sql.Tx, input CreateRequestInput) (userRow, error) {
+	ctx, span := tracing.Tracer().Start(ctx, "Store.ensureUser")
+	defer span.End()
 	if input.CustomerID != "" {
 		return s.getUserByID(ctx, tx, input.CustomerID)
 	}
@@ -271,6 +377,15 @@ func (s *Store) ensureUser(ctx context.Context, tx *sql.Tx, input CreateRequestI
 	if err != nil {
 		return userRow{}, err
 	}
+	if err := recordAudit(ctx, tx, AuditActionCreate, AuditEntityUser, created.ID, nil, domain.Customer{
+		ID:        created.ID,
+		Email:     created.Email,
+		Name:      created.Name,
+		IsAdmin:   created.IsAdmin,
+		CreatedAt: created.CreatedAt,
+	}); err != nil {
+		return userRow{}, err
+	}
 	return created, nil
 }
 
@@ -294,8 +409,8 @@ func (s *Store) getUserByEmail(ctx context.Context, tx *sql.Tx, email string) (u
 
 func (s *Store) getRequestRow(ctx context.Context, id string) (requestRow, error) {
 	row := s.db.QueryRowContext(ctx, `
-		SELECT r.id, r.customer_id, r.delivery_date, r.status, r.shipping_customer_name,
-		       r.shipping_address_line1, r.shipping_address_line2, r.shipping_city, r.shipping_zip_code,
+		SELECT r.id, r.customer_id, r.delivery_date, r.return_date, r.distribution_center_id, r.school_id, r.status, r.shipping_customer_name,
+		       r.shipping_address_line1, r.shipping_address_line2, r.shipping_city, r.shipping_zip_code, r.shipping_address_id,
 		       r.metadata, r.created_at, r.updated_at,
 		       u.email, u.name, u.token, u.workos_user_id, u.email_verified, u.created_at
 		FROM requests r
@@ -311,8 +426,8 @@ func scanRequestRow(scanner interface {
 	var row requestRow
 	var line2 sql.NullString
 	if err := scanner.Scan(
-		&row.ID, &row.CustomerID, &row.DeliveryDate, &row.Status, &row.ShippingCustomerName,
-		&row.ShippingAddressLine1, &line2, &row.ShippingCity, &row.ShippingZipCode,
+		&row.ID, &row.CustomerID, &row.DeliveryDate, &row.ReturnDate, &row.DistributionCenterID, &row.SchoolID, &row.Status, &row.ShippingCustomerName,
+		&row.ShippingAddressLine1, &line2, &row.ShippingCity, &row.ShippingZipCode, &row.ShippingAddressID,
 		&row.Metadata, &row.CreatedAt, &row.UpdatedAt,
 		&row.CustomerEmail, &row.CustomerName, &row.CustomerToken, &row.CustomerWorkOSUserID, &row.CustomerEmailVerified, &row.CustomerCreatedAt,
 	); err != nil {
@@ -341,7 +456,7 @@ func (s *Store) getItemsForRequest(ctx context.Context, requestID string) (map[s
 		if err := rows.Scan(&materialID, &qty); err != nil {
 			return nil, err
 		}
-		items[materialID] = qty
+		items[materialID] += qty
 	}
 	return items, rows.Err()
 }
@@ -370,7 +485,67 @@ func (s *Store) getItemsForRequests(ctx context.Context, requestIDs []string) (m
 		if _, ok := result[requestID]; !ok {
 			result[requestID] = map[string]int{}
 		}
-		result[requestID][materialID] = qty
+		result[requestID][materialID] += qty
+	}
+	return result, rows.Err()
+}
+
+// getKitsForRequests returns the kits of each request with the items they expanded into
+func (s *Store) getKitsForRequests(ctx context.Context, requestIDs []string) (map[string][]domain.RequestKit, error) {
+	result := make(map[string][]domain.RequestKit)
+	if len(requestIDs) == 0 {
+		return result, nil
+	}
+	rows, err := s.db.QueryContext(ctx, `
+		SELECT rk.request_id, rk.kit_id, rk.class_size, ri.material_type_id, ri.quantity
+		FROM request_kits rk
+		JOIN request_items ri ON ri.request_id = rk.request_id AND ri.kit_id = rk.kit_id
+		WHERE rk.request_id = ANY($1::uuid[])
+		ORDER BY rk.request_id, rk.kit_id
+	`, pq.Array(requestIDs))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var requestID, kitID, materialID string
+		var classSize, qty int
+		if err := rows.Scan(&requestID, &kitID, &classSize, &materialID, &qty); err != nil {
+			return nil, err
+		}
+		kits := result[requestID]
+		if len(kits) == 0 || kits[len(kits)-1].KitID != kitID {
+			kits = append(kits, domain.RequestKit{KitID: kitID, ClassSize: classSize, Items: map[string]int{}})
+		}
+		kits[len(kits)-1].Items[materialID] = qty
+		result[requestID] = kits
+	}
+	return result, rows.Err()
+}
+
+// GetStatusHistoryForRequests returns the status changes of each request, oldest first
+func (s *Store) GetStatusHistoryForRequests(ctx context.Context, requestIDs []string) (map[string][]domain.StatusChange, error) {
+	result := make(map[string][]domain.StatusChange)
+	if len(requestIDs) == 0 {
+		return result, nil
+	}
+	rows, err := s.db.QueryContext(ctx, `
+		SELECT request_id, status, changed_at
+		FROM request_status_history
+		WHERE request_id = ANY($1::uuid[])
+		ORDER BY request_id, changed_at ASC, id ASC
+	`, pq.Array(requestIDs))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var requestID string
+		var change domain.StatusChange
+		if err := rows.Scan(&requestID, &change.Status, &change.ChangedAt); err != nil {
+			return nil, err
+		}
+		result[requestID] = append(result[requestID], change)
 	}
 	return result, rows.Err()
 }
@@ -391,6 +566,16 @@ func mapRequest(row requestRow, items map[string]int) domain.Request {
 	if row.ShippingAddressLine2 != nil {
 		address.Line2 = *row.ShippingAddressLine2
 	}
+	if row.ShippingAddressID != nil {
+		address.AddressID = *row.ShippingAddressID
+	}
+	var distributionCenterID, schoolID string
+	if row.DistributionCenterID != nil {
+		distributionCenterID = *row.DistributionCenterID
+	}
+	if row.SchoolID != nil {
+		schoolID = *row.SchoolID
+	}
 	return domain.Request{
 		ID: row.ID,
 		Customer: domain.Customer{
@@ -404,6 +589,9 @@ func mapRequest(row requestRow, items map[string]int) domain.Request {
 		},
 		Items:                items,
 		DeliveryDate:         row.DeliveryDate,
+		ReturnDate:           row.ReturnDate,
+		SchoolID:             schoolID,
+		DistributionCenterID: distributionCenterID,
 		Status:               row.Status,
 		ShippingCustomerName: row.ShippingCustomerName,
 		ShippingAddress:      address,
@@ -415,15 +603,19 @@ func mapRequest(row requestRow, items map[string]int) domain.Request {
 
 func (s *Store) GetOrCreateUserByWorkOSUser(ctx context.Context, workosUser *usermanagement.User) (domain.Customer, error) {
 	var user domain.Customer
+	var disabled bool
 	err := s.db.QueryRowContext(ctx, `
-		SELECT id, email, name, token, workos_user_id, email_verified, is_admin, created_at
+		SELECT id, email, name, token, workos_user_id, email_verified, is_admin, created_at, disabled_at IS NOT NULL
 		FROM users WHERE workos_user_id = $1
 	`, workosUser.ID).Scan(
 		&user.ID, &user.Email, &user.Name, &user.Token,
-		&user.WorkOSUserID, &user.EmailVerified, &user.IsAdmin, &user.CreatedAt,
+		&user.WorkOSUserID, &user.EmailVerified, &user.IsAdmin, &user.CreatedAt, &disabled,
 	)
 
 	if err == nil {
+		if disabled {
+			return domain.Customer{}, ErrUserDisabled
+		}
 		return user, nil
 	}
 
@@ -436,7 +628,13 @@ func (s *Store) GetOrCreateUserByWorkOSUser(ctx context.Context, workosUser *use
 		name = workosUser.Email
 	}
 
-	err = s.db.QueryRowContext(ctx, `
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return domain.Customer{}, err
+	}
+	defer tx.Rollback()
+
+	err = tx.QueryRowContext(ctx, `
 		INSERT INTO users (email, name, token, workos_user_id, email_verified)
 		VALUES ($1, $2, $3, $4, $5)
 		RETURNING id, email, name, token, workos_user_id, email_verified, is_admin, created_at
@@ -450,8 +648,19 @@ func (s *Store) GetOrCreateUserByWorkOSUser(ctx context.Context, workosUser *use
 		&user.ID, &user.Email, &user.Name, &user.Token,
 		&user.WorkOSUserID, &user.EmailVerified, &user.IsAdmin, &user.CreatedAt,
 	)
+	if err != nil {
+		return domain.Customer{}, err
+	}
 
-	return user, err
+	auditState := user
+	auditState.Token = ""
+	if err := recordAudit(ctx, tx, AuditActionCreate, AuditEntityUser, user.ID, nil, auditState); err != nil {
+		return domain.Customer{}, err
+	}
+	if err := tx.Commit(); err != nil {
+		return domain.Customer{}, err
+	}
+	return user, nil
 }
 
 func (s *Store) GetUserByID(ctx context.Context, id string) (domain.Customer, error) {
@@ -478,10 +687,57 @@ func (s *Store) GetOrCreateCustomerByWorkOSUser(ctx context.Context, workosUser
 
 // Material Type CRUD operations
 
-// ListMaterialTypes returns all material types ordered by name
+// ErrMaterialTypeNotFound is returned when a material type does not exist
+var ErrMaterialTypeNotFound = errors.New("material type not found")
+
+// MaterialTypeInUseError is returned when a material type cannot be hard-deleted
+// because requests, stock rows or kits still reference it
+type MaterialTypeInUseError struct {
+	RequestCount int
+	StockCount   int
+	KitCount     int
+}
+
+func (e MaterialTypeInUseError) Error() string {
+	return fmt.Sprintf("material type referenced by %d requests, %d stock entries and %d kits", e.RequestCount, e.StockCount, e.KitCount)
+}
+
+// UnavailableMaterialTypesError is returned when a request references material
+// types that do not exist or are archived
+type UnavailableMaterialTypesError struct {
+	IDs []string
+}
+
+func (e UnavailableMaterialTypesError) Error() string {
+	return fmt.Sprintf("material types not available: %s", strings.Join(e.IDs, ", "))
+}
+
+func scanMaterialType(scanner interface {
+	Scan(dest ...any) error
+}, extra ...any) (domain.MaterialType, error) {
+	var mt domain.MaterialType
+	var archivedAt sql.NullTime
+	var categoryID sql.NullString
+	var tags pq.StringArray
+	dest := append([]any{&mt.ID, &mt.Name, &mt.Description, &mt.ImageURL, &archivedAt, &categoryID, &tags}, extra...)
+	if err := scanner.Scan(dest...); err != nil {
+		return domain.MaterialType{}, err
+	}
+	if archivedAt.Valid {
+		mt.ArchivedAt = &archivedAt.Time
+	}
+	mt.CategoryID = categoryID.String
+	mt.Tags = []string(tags)
+	if mt.Tags == nil {
+		mt.Tags = []string{}
+	}
+	return mt, nil
+}
+
+// ListMaterialTypes returns all material types ordered by name, including archived ones
 func (s *Store) ListMaterialTypes(ctx context.Context) ([]domain.MaterialType, error) {
 	rows, err := s.db.QueryContext(ctx, `
-		SELECT id, name, description, image_url
+		SELECT id, name, description, image_url, archived_at, category_id, tags
 		FROM material_types
 		ORDER BY name ASC
 	`)
@@ -492,8 +748,8 @@ func (s *Store) ListMaterialTypes(ctx context.Context) ([]domain.MaterialType, e
 
 	var result []domain.MaterialType
 	for rows.Next() {
-		var mt domain.MaterialType
-		if err := rows.Scan(&mt.ID, &mt.Name, &mt.Description, &mt.ImageURL); err != nil {
+		mt, err := scanMaterialType(rows)
+		if err != nil {
 			return nil, err
 		}
 		result = append(result, mt)
@@ -501,44 +757,163 @@ func (s *Store) ListMaterialTypes(ctx context.Context) ([]domain.MaterialType, e
 	return result, rows.Err()
 }
 
-// ListMaterialTypesWithAvailability returns all material types with available counts summed from material_available table
-func (s *Store) ListMaterialTypesWithAvailability(ctx context.Context) ([]domain.MaterialType, error) {
-	rows, err := s.db.QueryContext(ctx, `
+// ListMaterialTypesParams filters the public material type catalog
+type ListMaterialTypesParams struct {
+	// Limit of zero returns the whole catalog without pagination
+	Limit      int
+	Cursor     *pagination.KeyCursor
+	CategoryID string
+	Tags       []string
+	Query      string
+	// AvailableFrom and AvailableTo restrict the result to material types with
+	// stock left after subtracting open requests on loan during the range
+	AvailableFrom *time.Time
+	AvailableTo   *time.Time
+}
+
+type ListMaterialTypesResult struct {
+	MaterialTypes []domain.MaterialType `json:"materialTypes"`
+	NextCursor    string                `json:"nextCursor,omitempty"`
+}
+
+// reservedQuantity returns a subquery summing the quantities of material type
+// mt.id that open requests have on loan at some point between from and to,
+// either of which may be nil, and args with its parameters appended. A loan
+// starts at the delivery date and lasts until the return date, or until the
+// request is returned when it has none.
+func reservedQuantity(args []any, from, to *time.Time) (string, []any) {
+	conditions := []string{"r.status <> 'returned'"}
+	if to != nil {
+		args = append(args, *to)
+		conditions = append(conditions, fmt.Sprintf("r.delivery_date <= $%d", len(args)))
+	}
+	if from != nil {
+		args = append(args, *from)
+		conditions = append(conditions, fmt.Sprintf("(r.return_date IS NULL OR r.return_date >= $%d)", len(args)))
+	}
+	return fmt.Sprintf(`(
+			SELECT COALESCE(SUM(ri.quantity), 0)
+			FROM request_items ri
+			JOIN requests r ON r.id = ri.request_id
+			WHERE ri.material_type_id = mt.id AND %s
+		)`, strings.Join(conditions, " AND ")), args
+}
+
+// ListMaterialTypesWithAvailability returns active material types with available counts summed
+// from the material_available table, filtered by category (including subcategories), tags,
+// text search and availability within a date range
+func (s *Store) ListMaterialTypesWithAvailability(ctx context.Context, params ListMaterialTypesParams) (ListMaterialTypesResult, error) {
+	limit := params.Limit
+	if limit < 0 || limit > 200 {
+		limit = 200
+	}
+
+	args := []any{}
+	with := ""
+	where := []string{"mt.archived_at IS NULL"}
+	reserved := "0"
+
+	if params.CategoryID != "" {
+		args = append(args, params.CategoryID)
+		with = fmt.Sprintf(`
+		WITH RECURSIVE category_tree AS (
+			SELECT id FROM categories WHERE id = $%d
+			UNION ALL
+			SELECT c.id FROM categories c JOIN category_tree t ON c.parent_id = t.id
+		)`, len(args))
+		where = append(where, "mt.category_id IN (SELECT id FROM category_tree)")
+	}
+	if len(params.Tags) > 0 {
+		args = append(args, pq.Array(params.Tags))
+		where = append(where, fmt.Sprintf("mt.tags @> $%d", len(args)))
+	}
+	if params.Query != "" {
+		args = append(args, containsPattern(params.Query))
+		n := len(args)
+		where = append(where, fmt.Sprintf("(mt.name ILIKE $%d OR mt.description ILIKE $%d OR array_to_string(mt.tags, ' ') ILIKE $%d)", n, n, n))
+	}
+	if params.AvailableFrom != nil || params.AvailableTo != nil {
+		reserved, args = reservedQuantity(args, params.AvailableFrom, params.AvailableTo)
+		where = append(where, fmt.Sprintf("COALESCE(stock.total, 0) - %s > 0", reserved))
+	}
+	if params.Cursor != nil {
+		args = append(args, params.Cursor.Key, params.Cursor.ID)
+		where = append(where, fmt.Sprintf("(mt.name, mt.id) > ($%d, $%d)", len(args)-1, len(args)))
+	}
+
+	limitClause := ""
+	if limit > 0 {
+		args = append(args, limit+1)
+		limitClause = fmt.Sprintf("LIMIT $%d", len(args))
+	}
+
+	query := fmt.Sprintf(`%s
 		SELECT 
 			mt.id, 
 			mt.name, 
 			mt.description, 
 			mt.image_url,
-			COALESCE(SUM(ma.amount), 0) as available_count
+			mt.archived_at,
+			mt.category_id,
+			mt.tags,
+			COALESCE(stock.total, 0) - %s as available_count
 		FROM material_types mt
-		LEFT JOIN material_available ma ON mt.id = ma.material_type_id
-		GROUP BY mt.id, mt.name, mt.description, mt.image_url
-		ORDER BY mt.name ASC
-	`)
+		LEFT JOIN (
+			SELECT material_type_id, SUM(amount) AS total
+			FROM material_available
+			GROUP BY material_type_id
+		) stock ON stock.material_type_id = mt.id
+		WHERE %s
+		ORDER BY mt.name ASC, mt.id ASC
+		%s
+	`, with, reserved, strings.Join(where, " AND "), limitClause)
+
+	rows, err := s.db.QueryContext(ctx, query, args...)
 	if err != nil {
-		return nil, err
+		return ListMaterialTypesResult{}, err
 	}
 	defer rows.Close()
 
-	var result []domain.MaterialType
+	result := []domain.MaterialType{}
 	for rows.Next() {
-		var mt domain.MaterialType
-		if err := rows.Scan(&mt.ID, &mt.Name, &mt.Description, &mt.ImageURL, &mt.AvailableCount); err != nil {
-			return nil, err
+		var availableCount int
+		mt, err := scanMaterialType(rows, &availableCount)
+		if err != nil {
+			return ListMaterialTypesResult{}, err
 		}
+		mt.AvailableCount = availableCount
 		result = append(result, mt)
 	}
-	return result, rows.Err()
+	if err := rows.Err(); err != nil {
+		return ListMaterialTypesResult{}, err
+	}
+
+	nextCursor := ""
+	if limit > 0 && len(result) > limit {
+		result = result[:limit]
+		last := result[limit-1]
+		nextCursor = pagination.EncodeKey(pagination.KeyCursor{Key: last.Name, ID: last.ID})
+	}
+
+	return ListMaterialTypesResult{MaterialTypes: result, NextCursor: nextCursor}, nil
 }
 
-// GetMaterialTypeByID returns a single material type by ID
+// GetMaterialTypeByID returns a single material type by ID. Archived material
+// types are still returned so historical requests can resolve them.
 func (s *Store) GetMaterialTypeByID(ctx context.Context, id string) (domain.MaterialType, error) {
-	var mt domain.MaterialType
-	err := s.db.QueryRowContext(ctx, `
-		SELECT id, name, description, image_url
+	row := s.db.QueryRowContext(ctx, `
+		SELECT id, name, description, image_url, archived_at, category_id, tags
 		FROM material_types
 		WHERE id = $1
-	`, id).Scan(&mt.ID, &mt.Name, &mt.Description, &mt.ImageURL)
+	`, id)
+	mt, err := scanMaterialType(row)
+	if errors.Is(err, sql.ErrNoRows) {
+		return domain.MaterialType{}, ErrMaterialTypeNotFound
+	}
+	if err != nil {
+		return domain.MaterialType{}, err
+	}
+	mt.Images, err = listMaterialTypeImages(ctx, s.db, id)
 	if err != nil {
 		return domain.MaterialType{}, err
 	}
@@ -546,49 +921,253 @@ func (s *Store) GetMaterialTypeByID(ctx context.Context, id string) (domain.Mate
 }
 
 // CreateMaterialType creates a new material type
-func (s *Store) CreateMaterialType(ctx context.Context, id, name, description, imageURL string) (domain.MaterialType, error) {
-	var mt domain.MaterialType
-	err := s.db.QueryRowContext(ctx, `
-		INSERT INTO material_types (id, name, description, image_url)
-		VALUES ($1, $2, $3, $4)
-		RETURNING id, name, description, image_url
-	`, id, name, description, imageURL).Scan(&mt.ID, &mt.Name, &mt.Description, &mt.ImageURL)
+func (s *Store) CreateMaterialType(ctx context.Context, id string, input domain.CreateMaterialTypeInput) (domain.MaterialType, error) {
+	tx, err := s.db.BeginTx(ctx, nil)
 	if err != nil {
 		return domain.MaterialType{}, err
 	}
+	defer tx.Rollback()
+
+	if err := checkCategoryExists(ctx, tx, input.CategoryID); err != nil {
+		return domain.MaterialType{}, err
+	}
+
+	mt, err := scanMaterialType(tx.QueryRowContext(ctx, `
+		INSERT INTO material_types (id, name, description, image_url, category_id, tags)
+		VALUES ($1, $2, $3, $4, $5, $6)
+		RETURNING id, name, description, image_url, archived_at, category_id, tags
+	`, id, input.Name, input.Description, input.ImageURL, nullString(input.CategoryID), pq.Array(nonNilTags(input.Tags))))
+	if err != nil {
+		return domain.MaterialType{}, err
+	}
+	if err := recordAudit(ctx, tx, AuditActionCreate, AuditEntityMaterialType, mt.ID, nil, mt); err != nil {
+		return domain.MaterialType{}, err
+	}
+	if err := tx.Commit(); err != nil {
+		return domain.MaterialType{}, err
+	}
 	return mt, nil
 }
 
-// UpdateMaterialType updates an existing material type
-func (s *Store) UpdateMaterialType(ctx context.Context, id, name, description string) (domain.MaterialType, error) {
-	var mt domain.MaterialType
-	err := s.db.QueryRowContext(ctx, `
+// UpdateMaterialType updates an existing material type. A nil CategoryID or
+// Tags leaves the current value unchanged.
+func (s *Store) UpdateMaterialType(ctx context.Context, id string, input domain.UpdateMaterialTypeInput) (domain.MaterialType, error) {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return domain.MaterialType{}, err
+	}
+	defer tx.Rollback()
+
+	before, err := getMaterialTypeForUpdate(ctx, tx, id)
+	if err != nil {
+		return domain.MaterialType{}, err
+	}
+
+	categoryID := before.CategoryID
+	if input.CategoryID != nil {
+		categoryID = *input.CategoryID
+		if err := checkCategoryExists(ctx, tx, categoryID); err != nil {
+			return domain.MaterialType{}, err
+		}
+	}
+	tags := before.Tags
+	if input.Tags != nil {
+		tags = input.Tags
+	}
+
+	mt, err := scanMaterialType(tx.QueryRowContext(ctx, `
 		UPDATE material_types
-		SET name = $2, description = $3
+		SET name = $2, description = $3, category_id = $4, tags = $5
 		WHERE id = $1
-		RETURNING id, name, description, image_url
-	`, id, name, description).Scan(&mt.ID, &mt.Name, &mt.Description, &mt.ImageURL)
+		RETURNING id, name, description, image_url, archived_at, category_id, tags
+	`, id, input.Name, input.Description, nullString(categoryID), pq.Array(nonNilTags(tags))))
 	if err != nil {
 		return domain.MaterialType{}, err
 	}
+	if err := recordAudit(ctx, tx, AuditActionUpdate, AuditEntityMaterialType, mt.ID, before, mt); err != nil {
+		return domain.MaterialType{}, err
+	}
+	if err := tx.Commit(); err != nil {
+		return domain.MaterialType{}, err
+	}
 	return mt, nil
 }
 
 // UpdateMaterialTypeImage updates only the image URL of a material type
 func (s *Store) UpdateMaterialTypeImage(ctx context.Context, id, imageURL string) error {
-	_, err := s.db.ExecContext(ctx, `
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	before, err := getMaterialTypeForUpdate(ctx, tx, id)
+	if err != nil {
+		return err
+	}
+	if _, err := tx.ExecContext(ctx, `
 		UPDATE material_types
 		SET image_url = $2
 		WHERE id = $1
-	`, id, imageURL)
-	return err
+	`, id, imageURL); err != nil {
+		return err
+	}
+	after := before
+	after.ImageURL = imageURL
+	if err := recordAudit(ctx, tx, AuditActionUpdate, AuditEntityMaterialType, id, before, after); err != nil {
+		return err
+	}
+	return tx.Commit()
 }
 
-// DeleteMaterialType deletes a material type by ID
+// ArchiveMaterialType retires a material type so it can no longer be requested
+func (s *Store) ArchiveMaterialType(ctx context.Context, id string) (domain.MaterialType, error) {
+	return s.setMaterialTypeArchived(ctx, id, true)
+}
+
+// RestoreMaterialType makes an archived material type requestable again
+func (s *Store) RestoreMaterialType(ctx context.Context, id string) (domain.MaterialType, error) {
+	return s.setMaterialTypeArchived(ctx, id, false)
+}
+
+func (s *Store) setMaterialTypeArchived(ctx context.Context, id string, archived bool) (domain.MaterialType, error) {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return domain.MaterialType{}, err
+	}
+	defer tx.Rollback()
+
+	before, err := getMaterialTypeForUpdate(ctx, tx, id)
+	if err != nil {
+		return domain.MaterialType{}, err
+	}
+
+	action := AuditActionRestore
+	query := `
+		UPDATE material_types
+		SET archived_at = NULL
+		WHERE id = $1
+		RETURNING id, name, description, image_url, archived_at, category_id, tags
+	`
+	if archived {
+		action = AuditActionArchive
+		query = `
+			UPDATE material_types
+			SET archived_at = COALESCE(archived_at, now())
+			WHERE id = $1
+			RETURNING id, name, description, image_url, archived_at, category_id, tags
+		`
+	}
+
+	mt, err := scanMaterialType(tx.QueryRowContext(ctx, query, id))
+	if err != nil {
+		return domain.MaterialType{}, err
+	}
+	if err := recordAudit(ctx, tx, action, AuditEntityMaterialType, id, before, mt); err != nil {
+		return domain.MaterialType{}, err
+	}
+	if err := tx.Commit(); err != nil {
+		return domain.MaterialType{}, err
+	}
+	return mt, nil
+}
+
+// DeleteMaterialType hard-deletes a material type by ID. It refuses with a
+// MaterialTypeInUseError when requests, stock or kits still reference the type.
 func (s *Store) DeleteMaterialType(ctx context.Context, id string) error {
-	_, err := s.db.ExecContext(ctx, `
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	before, err := getMaterialTypeForUpdate(ctx, tx, id)
+	if err != nil {
+		return err
+	}
+
+	var inUse MaterialTypeInUseError
+	if err := tx.QueryRowContext(ctx, `
+		SELECT
+			(SELECT COUNT(DISTINCT request_id) FROM request_items WHERE material_type_id = $1),
+			(SELECT COUNT(*) FROM material_available WHERE material_type_id = $1),
+			(SELECT COUNT(*) FROM kit_items WHERE material_type_id = $1)
+	`, id).Scan(&inUse.RequestCount, &inUse.StockCount, &inUse.KitCount); err != nil {
+		return err
+	}
+	if inUse.RequestCount > 0 || inUse.StockCount > 0 || inUse.KitCount > 0 {
+		return inUse
+	}
+
+	if _, err := tx.ExecContext(ctx, `
 		DELETE FROM material_types
 		WHERE id = $1
-	`, id)
-	return err
+	`, id); err != nil {
+		return err
+	}
+	if err := recordAudit(ctx, tx, AuditActionDelete, AuditEntityMaterialType, id, before, nil); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// getMaterialTypeForUpdate loads and locks a material type row inside a transaction
+func getMaterialTypeForUpdate(ctx context.Context, tx *sql.Tx, id string) (domain.MaterialType, error) {
+	mt, err := scanMaterialType(tx.QueryRowContext(ctx, `
+		SELECT id, name, description, image_url, archived_at, category_id, tags
+		FROM material_types
+		WHERE id = $1
+		FOR UPDATE
+	`, id))
+	if errors.Is(err, sql.ErrNoRows) {
+		return domain.MaterialType{}, ErrMaterialTypeNotFound
+	}
+	return mt, err
+}
+
+func nonNilTags(tags []string) []string {
+	if tags == nil {
+		return []string{}
+	}
+	return tags
+}
+
+// checkMaterialTypesRequestable verifies that every ID refers to an existing,
+// non-archived material type. Rows are share-locked so they cannot be archived
+// concurrently with the request insert.
+func checkMaterialTypesRequestable(ctx context.Context, tx *sql.Tx, ids []string) error {
+	rows, err := tx.QueryContext(ctx, `
+		SELECT id
+		FROM material_types
+		WHERE id = ANY($1) AND archived_at IS NULL
+		FOR SHARE
+	`, pq.Array(ids))
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	found := map[string]bool{}
+	for rows.Next() {
+		var id string
+		if err := rows.Scan(&id); err != nil {
+			return err
+		}
+		found[id] = true
+	}
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	var missing []string
+	for _, id := range ids {
+		if !found[id] {
+			missing = append(missing, id)
+		}
+	}
+	if len(missing) > 0 {
+		sort.Strings(missing)
+		return UnavailableMaterialTypesError{IDs: missing}
+	}
+	return nil
 }
@@ -0,0 +1,48 @@
+package db
+
+import (
+	"context"
+	"time"
+
+	"organization_backend/internal/ratelimit"
+)
+
+// Take implements ratelimit.Store so that several server instances share
+// their rate limits. The bucket row is locked while it is updated.
+func (s *Store) Take(ctx context.Context, key string, limit ratelimit.Limit, n int) (ratelimit.Result, error) {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return ratelimit.Result{}, err
+	}
+	defer tx.Rollback()
+
+	var tokens float64
+	var updatedAt, now time.Time
+	if err := tx.QueryRowContext(ctx, `
+		INSERT INTO rate_limit_buckets (key, tokens, updated_at) VALUES ($1, $2, now())
+		ON CONFLICT (key) DO UPDATE SET key = EXCLUDED.key
+		RETURNING tokens, updated_at, now()
+	`, key, float64(limit.Burst)).Scan(&tokens, &updatedAt, &now); err != nil {
+		return ratelimit.Result{}, err
+	}
+
+	tokens, result := limit.Refill(tokens, now.Sub(updatedAt), n)
+	if _, err := tx.ExecContext(ctx, `
+		UPDATE rate_limit_buckets SET tokens = $2, updated_at = $3 WHERE key = $1
+	`, key, tokens, now); err != nil {
+		return ratelimit.Result{}, err
+	}
+	return result, tx.Commit()
+}
+
+// DeleteIdleRateLimitBuckets removes buckets unused for longer than idle;
+// they would be full again anyway
+func (s *Store) DeleteIdleRateLimitBuckets(ctx context.Context, idle time.Duration) (int64, error) {
+	res, err := s.db.ExecContext(ctx, `
+		DELETE FROM rate_limit_buckets WHERE updated_at < now() - $1 * interval '1 second'
+	`, idle.Seconds())
+	if err != nil {
+		return 0, err
+	}
+	return res.RowsAffected()
+}
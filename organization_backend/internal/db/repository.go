@@ -0,0 +1,45 @@
+package db
+
+import (
+	"context"
+
+	"organization_backend/internal/domain"
+
+	"github.com/workos/workos-go/v4/pkg/usermanagement"
+)
+
+// RequestRepository stores requests. Looking up a request that does not
+// exist returns sql.ErrNoRows, changing one returns ErrRequestNotFound.
+type RequestRepository interface {
+	CreateRequest(ctx context.Context, input CreateRequestInput) (domain.Request, error)
+	GetRequestByID(ctx context.Context, id string) (domain.Request, error)
+	ListRequests(ctx context.Context, params ListRequestsParams) (ListRequestsResult, error)
+	SetRequestStatus(ctx context.Context, requestID, status string) (domain.Request, error)
+	SetRequestDistributionCenter(ctx context.Context, requestID, centerID string) (domain.Request, error)
+	GetStatusHistoryForRequests(ctx context.Context, requestIDs []string) (map[string][]domain.StatusChange, error)
+}
+
+// UserRepository stores the users logging in. Looking up a user that does
+// not exist returns sql.ErrNoRows.
+type UserRepository interface {
+	GetOrCreateUserByWorkOSUser(ctx context.Context, workosUser *usermanagement.User) (domain.Customer, error)
+	GetUserByID(ctx context.Context, id string) (domain.Customer, error)
+}
+
+// RequestNotifier announces created, changed and deleted requests. Updates
+// are queued per subscriber and dropped while the queue is full; Unsubscribe
+// closes the queue.
+type RequestNotifier interface {
+	Subscribe(ctx context.Context) (int, <-chan RequestUpdate)
+	Unsubscribe(id int)
+}
+
+var (
+	_ RequestRepository = (*Store)(nil)
+	_ UserRepository    = (*Store)(nil)
+	_ RequestNotifier   = (*Notifier)(nil)
+
+	_ RequestRepository = (*MemoryStore)(nil)
+	_ UserRepository    = (*MemoryStore)(nil)
+	_ RequestNotifier   = (*MemoryNotifier)(nil)
+)
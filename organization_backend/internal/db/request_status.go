@@ -0,0 +1,68 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+
+	"organization_backend/internal/domain"
+)
+
+// SetRequestStatus moves a request to another status. The change is added
+// to the status history and announced to subscribers by the table triggers.
+func (s *Store) SetRequestStatus(ctx context.Context, requestID, status string) (domain.Request, error) {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return domain.Request{}, err
+	}
+	defer tx.Rollback()
+
+	var before string
+	err = tx.QueryRowContext(ctx, `
+		SELECT status FROM requests WHERE id::text = $1 FOR UPDATE
+	`, requestID).Scan(&before)
+	if errors.Is(err, sql.ErrNoRows) {
+		return domain.Request{}, ErrRequestNotFound
+	}
+	if err != nil {
+		return domain.Request{}, err
+	}
+
+	if _, err := tx.ExecContext(ctx, `
+		UPDATE requests SET status = $2 WHERE id = $1
+	`, requestID, status); err != nil {
+		return domain.Request{}, err
+	}
+	type requestStatus struct {
+		Status string `json:"status"`
+	}
+	if err := recordAudit(ctx, tx, AuditActionUpdate, AuditEntityRequest, requestID,
+		requestStatus{before}, requestStatus{status}); err != nil {
+		return domain.Request{}, err
+	}
+	if err := tx.Commit(); err != nil {
+		return domain.Request{}, err
+	}
+	return s.GetRequestByID(ctx, requestID)
+}
+
+// NotifyRequestChanged sends the change notification of a request again,
+// e.g. when subscribers missed an update. The payload matches the one sent
+// by the requests_notify_change trigger.
+func (s *Store) NotifyRequestChanged(ctx context.Context, requestID string) error {
+	var sent int
+	if err := s.db.QueryRowContext(ctx, `
+		SELECT count(pg_notify('requests_channel', json_build_object(
+			'request_id', id,
+			'action', 'UPDATE',
+			'updated_at', updated_at
+		)::text))
+		FROM requests WHERE id::text = $1
+	`, requestID).Scan(&sent); err != nil {
+		return err
+	}
+	if sent == 0 {
+		return ErrRequestNotFound
+	}
+	return nil
+}
@@ -0,0 +1,460 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"strings"
+
+	"organization_backend/internal/domain"
+)
+
+var (
+	// ErrSchoolNotFound is returned when a school does not exist
+	ErrSchoolNotFound = errors.New("school not found")
+	// ErrAddressNotFound is returned when an address does not exist or belongs to another school
+	ErrAddressNotFound = errors.New("address not found")
+	// ErrContactNotFound is returned when a contact does not exist or belongs to another school
+	ErrContactNotFound = errors.New("contact not found")
+	// ErrUserNotFound is returned when no user matches
+	ErrUserNotFound = errors.New("user not found")
+	// ErrNotSchoolMember is returned when a request is made for a school the user does not belong to
+	ErrNotSchoolMember = errors.New("user is not a member of the school")
+	// ErrSchoolRequired is returned when a user belongs to several schools and
+	// a request does not say which one it is for
+	ErrSchoolRequired = errors.New("school required")
+	// ErrLastOwner is returned when the last owner of a school would be removed or demoted
+	ErrLastOwner = errors.New("school needs at least one owner")
+)
+
+type ListSchoolsParams struct {
+	// UserID restricts the list to schools the user is a member of
+	UserID string
+	Query  string
+	Limit  int
+}
+
+// ListSchools returns schools ordered by name without addresses, contacts and members
+func (s *Store) ListSchools(ctx context.Context, params ListSchoolsParams) ([]domain.School, error) {
+	limit := params.Limit
+	if limit <= 0 || limit > 200 {
+		limit = 50
+	}
+	args := []any{}
+	where := []string{"TRUE"}
+	if params.UserID != "" {
+		args = append(args, params.UserID)
+		where = append(where, fmt.Sprintf("id IN (SELECT school_id FROM school_members WHERE user_id = $%d)", len(args)))
+	}
+	if q := strings.TrimSpace(params.Query); q != "" {
+		args = append(args, "%"+q+"%")
+		where = append(where, fmt.Sprintf("name ILIKE $%d", len(args)))
+	}
+	args = append(args, limit)
+
+	rows, err := s.db.QueryContext(ctx, fmt.Sprintf(`
+		SELECT id, name, created_at, updated_at
+		FROM schools
+		WHERE %s
+		ORDER BY name ASC, id ASC
+		LIMIT $%d
+	`, strings.Join(where, " AND "), len(args)), args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	result := []domain.School{}
+	for rows.Next() {
+		var school domain.School
+		if err := rows.Scan(&school.ID, &school.Name, &school.CreatedAt, &school.UpdatedAt); err != nil {
+			return nil, err
+		}
+		result = append(result, school)
+	}
+	return result, rows.Err()
+}
+
+// GetSchool returns a school with its addresses, contacts and members
+func (s *Store) GetSchool(ctx context.Context, id string) (domain.School, error) {
+	return getSchool(ctx, s.db, id, false)
+}
+
+// SchoolRole returns the role of a user in a school, or an empty string when
+// the user is not a member
+func (s *Store) SchoolRole(ctx context.Context, schoolID, userID string) (string, error) {
+	var role string
+	err := s.db.QueryRowContext(ctx, `
+		SELECT role FROM school_members WHERE school_id = $1 AND user_id = $2
+	`, schoolID, userID).Scan(&role)
+	if errors.Is(err, sql.ErrNoRows) {
+		return "", nil
+	}
+	return role, err
+}
+
+// CreateSchool creates a school with the given user as its owner
+func (s *Store) CreateSchool(ctx context.Context, name, ownerID string) (domain.School, error) {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return domain.School{}, err
+	}
+	defer tx.Rollback()
+
+	id, err := createSchool(ctx, tx, name, ownerID)
+	if err != nil {
+		return domain.School{}, err
+	}
+	school, err := getSchool(ctx, tx, id, false)
+	if err != nil {
+		return domain.School{}, err
+	}
+	if err := recordAudit(ctx, tx, AuditActionCreate, AuditEntitySchool, id, nil, school); err != nil {
+		return domain.School{}, err
+	}
+	if err := tx.Commit(); err != nil {
+		return domain.School{}, err
+	}
+	return school, nil
+}
+
+func createSchool(ctx context.Context, tx *sql.Tx, name, ownerID string) (string, error) {
+	var id string
+	if err := tx.QueryRowContext(ctx, `
+		INSERT INTO schools (name) VALUES ($1) RETURNING id
+	`, name).Scan(&id); err != nil {
+		return "", err
+	}
+	if _, err := tx.ExecContext(ctx, `
+		INSERT INTO school_members (school_id, user_id, role) VALUES ($1, $2, $3)
+	`, id, ownerID, domain.SchoolRoleOwner); err != nil {
+		return "", err
+	}
+	return id, nil
+}
+
+// UpdateSchool renames a school
+func (s *Store) UpdateSchool(ctx context.Context, id, name string) (domain.School, error) {
+	return s.mutateSchool(ctx, id, func(tx *sql.Tx) error {
+		_, err := tx.ExecContext(ctx, `UPDATE schools SET name = $2 WHERE id = $1`, id, name)
+		return err
+	})
+}
+
+// AddSchoolAddress adds an unverified address to a school
+func (s *Store) AddSchoolAddress(ctx context.Context, schoolID string, input domain.AddressInput) (domain.School, error) {
+	return s.mutateSchool(ctx, schoolID, func(tx *sql.Tx) error {
+		_, err := insertSchoolAddress(ctx, tx, schoolID, input)
+		return err
+	})
+}
+
+func insertSchoolAddress(ctx context.Context, tx *sql.Tx, schoolID string, input domain.AddressInput) (string, error) {
+	var id string
+	err := tx.QueryRowContext(ctx, `
+		INSERT INTO addresses (school_id, label, line1, line2, city, zip_code)
+		VALUES ($1, $2, $3, $4, $5, $6)
+		RETURNING id
+	`, schoolID, input.Label, input.Line1, input.Line2, input.City, input.ZipCode).Scan(&id)
+	return id, err
+}
+
+// UpdateSchoolAddress edits an address. Changing anything but the label
+// clears the verification.
+func (s *Store) UpdateSchoolAddress(ctx context.Context, schoolID, addressID string, input domain.AddressInput) (domain.School, error) {
+	return s.mutateSchool(ctx, schoolID, func(tx *sql.Tx) error {
+		res, err := tx.ExecContext(ctx, `
+			UPDATE addresses
+			SET label = $3, line1 = $4, line2 = $5, city = $6, zip_code = $7,
+			    verified_at = CASE WHEN (line1, line2, city, zip_code) = ($4, $5, $6, $7) THEN verified_at END
+			WHERE id = $1 AND school_id = $2
+		`, addressID, schoolID, input.Label, input.Line1, input.Line2, input.City, input.ZipCode)
+		return expectRow(res, err, ErrAddressNotFound)
+	})
+}
+
+// DeleteSchoolAddress removes an address. Requests keep their copy of it.
+func (s *Store) DeleteSchoolAddress(ctx context.Context, schoolID, addressID string) (domain.School, error) {
+	return s.mutateSchool(ctx, schoolID, func(tx *sql.Tx) error {
+		res, err := tx.ExecContext(ctx, `DELETE FROM addresses WHERE id = $1 AND school_id = $2`, addressID, schoolID)
+		return expectRow(res, err, ErrAddressNotFound)
+	})
+}
+
+// SetSchoolAddressVerified marks an address as verified or unverified
+func (s *Store) SetSchoolAddressVerified(ctx context.Context, schoolID, addressID string, verified bool) (domain.School, error) {
+	return s.mutateSchool(ctx, schoolID, func(tx *sql.Tx) error {
+		res, err := tx.ExecContext(ctx, `
+			UPDATE addresses SET verified_at = CASE WHEN $3 THEN COALESCE(verified_at, now()) END
+			WHERE id = $1 AND school_id = $2
+		`, addressID, schoolID, verified)
+		return expectRow(res, err, ErrAddressNotFound)
+	})
+}
+
+// AddSchoolContact adds a contact person to a school
+func (s *Store) AddSchoolContact(ctx context.Context, schoolID string, input domain.SchoolContactInput) (domain.School, error) {
+	return s.mutateSchool(ctx, schoolID, func(tx *sql.Tx) error {
+		_, err := tx.ExecContext(ctx, `
+			INSERT INTO school_contacts (school_id, name, email, phone, role)
+			VALUES ($1, $2, $3, $4, $5)
+		`, schoolID, input.Name, input.Email, input.Phone, input.Role)
+		return err
+	})
+}
+
+// UpdateSchoolContact edits a contact person
+func (s *Store) UpdateSchoolContact(ctx context.Context, schoolID, contactID string, input domain.SchoolContactInput) (domain.School, error) {
+	return s.mutateSchool(ctx, schoolID, func(tx *sql.Tx) error {
+		res, err := tx.ExecContext(ctx, `
+			UPDATE school_contacts SET name = $3, email = $4, phone = $5, role = $6
+			WHERE id = $1 AND school_id = $2
+		`, contactID, schoolID, input.Name, input.Email, input.Phone, input.Role)
+		return expectRow(res, err, ErrContactNotFound)
+	})
+}
+
+// DeleteSchoolContact removes a contact person
+func (s *Store) DeleteSchoolContact(ctx context.Context, schoolID, contactID string) (domain.School, error) {
+	return s.mutateSchool(ctx, schoolID, func(tx *sql.Tx) error {
+		res, err := tx.ExecContext(ctx, `DELETE FROM school_contacts WHERE id = $1 AND school_id = $2`, contactID, schoolID)
+		return expectRow(res, err, ErrContactNotFound)
+	})
+}
+
+// SetSchoolMember adds the user with the given email to a school or changes
+// their role
+func (s *Store) SetSchoolMember(ctx context.Context, schoolID, email, role string) (domain.School, error) {
+	return s.mutateSchool(ctx, schoolID, func(tx *sql.Tx) error {
+		var userID string
+		err := tx.QueryRowContext(ctx, `SELECT id FROM users WHERE lower(email) = lower($1)`, email).Scan(&userID)
+		if errors.Is(err, sql.ErrNoRows) {
+			return ErrUserNotFound
+		}
+		if err != nil {
+			return err
+		}
+		if _, err := tx.ExecContext(ctx, `
+			INSERT INTO school_members (school_id, user_id, role) VALUES ($1, $2, $3)
+			ON CONFLICT (school_id, user_id) DO UPDATE SET role = EXCLUDED.role
+		`, schoolID, userID, role); err != nil {
+			return err
+		}
+		return checkSchoolHasOwner(ctx, tx, schoolID)
+	})
+}
+
+// RemoveSchoolMember removes a user from a school. Their requests stay with the school.
+func (s *Store) RemoveSchoolMember(ctx context.Context, schoolID, userID string) (domain.School, error) {
+	return s.mutateSchool(ctx, schoolID, func(tx *sql.Tx) error {
+		res, err := tx.ExecContext(ctx, `DELETE FROM school_members WHERE school_id = $1 AND user_id = $2`, schoolID, userID)
+		if err := expectRow(res, err, ErrUserNotFound); err != nil {
+			return err
+		}
+		return checkSchoolHasOwner(ctx, tx, schoolID)
+	})
+}
+
+func checkSchoolHasOwner(ctx context.Context, tx *sql.Tx, schoolID string) error {
+	var owners int
+	if err := tx.QueryRowContext(ctx, `
+		SELECT count(*) FROM school_members WHERE school_id = $1 AND role = $2
+	`, schoolID, domain.SchoolRoleOwner).Scan(&owners); err != nil {
+		return err
+	}
+	if owners == 0 {
+		return ErrLastOwner
+	}
+	return nil
+}
+
+// mutateSchool runs fn in a transaction with the school row locked and
+// records the school before and after as one audit entry
+func (s *Store) mutateSchool(ctx context.Context, id string, fn func(tx *sql.Tx) error) (domain.School, error) {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return domain.School{}, err
+	}
+	defer tx.Rollback()
+
+	before, err := getSchool(ctx, tx, id, true)
+	if err != nil {
+		return domain.School{}, err
+	}
+	if err := fn(tx); err != nil {
+		return domain.School{}, err
+	}
+	after, err := getSchool(ctx, tx, id, false)
+	if err != nil {
+		return domain.School{}, err
+	}
+	if err := recordAudit(ctx, tx, AuditActionUpdate, AuditEntitySchool, id, before, after); err != nil {
+		return domain.School{}, err
+	}
+	if err := tx.Commit(); err != nil {
+		return domain.School{}, err
+	}
+	return after, nil
+}
+
+func expectRow(res sql.Result, err error, notFound error) error {
+	if err != nil {
+		return err
+	}
+	if n, err := res.RowsAffected(); err != nil {
+		return err
+	} else if n == 0 {
+		return notFound
+	}
+	return nil
+}
+
+func getSchool(ctx context.Context, q queryer, id string, forUpdate bool) (domain.School, error) {
+	query := `SELECT id, name, created_at, updated_at FROM schools WHERE id = $1`
+	if forUpdate {
+		query += ` FOR UPDATE`
+	}
+	var school domain.School
+	err := q.QueryRowContext(ctx, query, id).Scan(&school.ID, &school.Name, &school.CreatedAt, &school.UpdatedAt)
+	if errors.Is(err, sql.ErrNoRows) {
+		return domain.School{}, ErrSchoolNotFound
+	}
+	if err != nil {
+		return domain.School{}, err
+	}
+
+	if school.Addresses, err = listSchoolAddresses(ctx, q, id); err != nil {
+		return domain.School{}, err
+	}
+
+	school.Contacts = []domain.SchoolContact{}
+	rows, err := q.QueryContext(ctx, `
+		SELECT id, name, email, phone, role FROM school_contacts
+		WHERE school_id = $1 ORDER BY name, id
+	`, id)
+	if err != nil {
+		return domain.School{}, err
+	}
+	for rows.Next() {
+		var c domain.SchoolContact
+		if err := rows.Scan(&c.ID, &c.Name, &c.Email, &c.Phone, &c.Role); err != nil {
+			rows.Close()
+			return domain.School{}, err
+		}
+		school.Contacts = append(school.Contacts, c)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return domain.School{}, err
+	}
+
+	school.Members = []domain.SchoolMember{}
+	rows, err = q.QueryContext(ctx, `
+		SELECT u.id, u.name, u.email, m.role
+		FROM school_members m
+		JOIN users u ON u.id = m.user_id
+		WHERE m.school_id = $1
+		ORDER BY u.name, u.id
+	`, id)
+	if err != nil {
+		return domain.School{}, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var m domain.SchoolMember
+		if err := rows.Scan(&m.UserID, &m.Name, &m.Email, &m.Role); err != nil {
+			return domain.School{}, err
+		}
+		school.Members = append(school.Members, m)
+	}
+	return school, rows.Err()
+}
+
+func listSchoolAddresses(ctx context.Context, q queryer, schoolID string) ([]domain.Address, error) {
+	rows, err := q.QueryContext(ctx, `
+		SELECT `+addressColumns+`
+		FROM addresses
+		WHERE school_id = $1
+		ORDER BY created_at, id
+	`, schoolID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	addresses := []domain.Address{}
+	for rows.Next() {
+		a, err := scanAddress(rows)
+		if err != nil {
+			return nil, err
+		}
+		addresses = append(addresses, a)
+	}
+	return addresses, rows.Err()
+}
+
+// resolveRequestSchool picks the school a new request belongs to. Users that
+// belong to exactly one school don't have to name it; users without a school
+// get one named after the shipping recipient.
+func resolveRequestSchool(ctx context.Context, tx *sql.Tx, user userRow, input CreateRequestInput) (string, error) {
+	if input.SchoolID != "" {
+		var member bool
+		if err := tx.QueryRowContext(ctx, `
+			SELECT EXISTS (SELECT 1 FROM school_members WHERE school_id = $1 AND user_id = $2)
+		`, input.SchoolID, user.ID).Scan(&member); err != nil {
+			return "", err
+		}
+		if !member {
+			return "", ErrNotSchoolMember
+		}
+		return input.SchoolID, nil
+	}
+
+	rows, err := tx.QueryContext(ctx, `SELECT school_id FROM school_members WHERE user_id = $1 LIMIT 2`, user.ID)
+	if err != nil {
+		return "", err
+	}
+	var schoolIDs []string
+	for rows.Next() {
+		var id string
+		if err := rows.Scan(&id); err != nil {
+			rows.Close()
+			return "", err
+		}
+		schoolIDs = append(schoolIDs, id)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return "", err
+	}
+	switch len(schoolIDs) {
+	case 1:
+		return schoolIDs[0], nil
+	case 0:
+	default:
+		return "", ErrSchoolRequired
+	}
+
+	name := input.ShippingCustomerName
+	if name == "" {
+		name = user.Name
+	}
+	id, err := createSchool(ctx, tx, name, user.ID)
+	if err != nil {
+		return "", err
+	}
+	if _, err := insertSchoolAddress(ctx, tx, id, domain.AddressInput{
+		Line1:   input.ShippingAddressLine1,
+		Line2:   input.ShippingAddressLine2,
+		City:    input.ShippingCity,
+		ZipCode: input.ShippingZipCode,
+	}); err != nil {
+		return "", err
+	}
+	school, err := getSchool(ctx, tx, id, false)
+	if err != nil {
+		return "", err
+	}
+	return id, recordAudit(ctx, tx, AuditActionCreate, AuditEntitySchool, id, nil, school)
+}
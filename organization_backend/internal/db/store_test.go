@@ -0,0 +1,41 @@
+package db_test
+
+import (
+	"context"
+	"os"
+	"testing"
+
+	"organization_backend/internal/db"
+	"organization_backend/internal/db/dbtest"
+)
+
+// TestStoreContract runs the contract tests against the PostgreSQL database
+// in TEST_DATABASE_URL after migrating it. The tests add requests, users and
+// material types with unique IDs, so do not point it at a production
+// database.
+func TestStoreContract(t *testing.T) {
+	url := os.Getenv("TEST_DATABASE_URL")
+	if url == "" {
+		t.Skip("TEST_DATABASE_URL is not set")
+	}
+	conn, err := db.Open(url, db.PoolConfig{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	if err := db.Migrate(context.Background(), conn); err != nil {
+		t.Fatal(err)
+	}
+
+	store := db.NewStore(conn)
+	notifier := db.NewNotifier(url, db.NotifierConfig{BufferSize: 16})
+	ctx, cancel := context.WithCancel(context.Background())
+	t.Cleanup(cancel)
+	if err := notifier.Start(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	dbtest.Run(t, func(t *testing.T) dbtest.Backend {
+		return dbtest.Backend{Requests: store, Users: store, Notifier: notifier, Fixtures: store}
+	})
+}
@@ -0,0 +1,192 @@
+package db
+
+import (
+	"context"
+	"database/sql/driver"
+	"regexp"
+	"strings"
+
+	"organization_backend/internal/tracing"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// maxTracedStatementLength truncates long statements in spans
+const maxTracedStatementLength = 2000
+
+// tracedConnector wraps the PostgreSQL connector so that every statement
+// sent over the pool is recorded as a span of the caller's trace
+type tracedConnector struct {
+	base driver.Connector
+}
+
+func (c tracedConnector) Connect(ctx context.Context) (driver.Conn, error) {
+	conn, err := c.base.Connect(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return &tracedConn{Conn: conn}, nil
+}
+
+func (c tracedConnector) Driver() driver.Driver {
+	return c.base.Driver()
+}
+
+// tracedConn passes every optional driver interface on to the wrapped
+// connection and returns driver.ErrSkip where it lacks one, so database/sql
+// falls back as it would without the wrapper
+type tracedConn struct {
+	driver.Conn
+}
+
+func (c *tracedConn) QueryContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Rows, error) {
+	queryer, ok := c.Conn.(driver.QueryerContext)
+	if !ok {
+		return nil, driver.ErrSkip
+	}
+	ctx, span := startQuerySpan(ctx, query)
+	defer span.End()
+	rows, err := queryer.QueryContext(ctx, query, args)
+	recordQueryError(span, err)
+	return rows, err
+}
+
+func (c *tracedConn) ExecContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Result, error) {
+	execer, ok := c.Conn.(driver.ExecerContext)
+	if !ok {
+		return nil, driver.ErrSkip
+	}
+	ctx, span := startQuerySpan(ctx, query)
+	defer span.End()
+	result, err := execer.ExecContext(ctx, query, args)
+	recordQueryError(span, err)
+	return result, err
+}
+
+func (c *tracedConn) PrepareContext(ctx context.Context, query string) (driver.Stmt, error) {
+	if preparer, ok := c.Conn.(driver.ConnPrepareContext); ok {
+		return preparer.PrepareContext(ctx, query)
+	}
+	return c.Conn.Prepare(query)
+}
+
+func (c *tracedConn) BeginTx(ctx context.Context, opts driver.TxOptions) (driver.Tx, error) {
+	beginner, ok := c.Conn.(driver.ConnBeginTx)
+	if !ok {
+		return nil, driver.ErrSkip
+	}
+	_, span := tracing.Tracer().Start(ctx, "BEGIN", trace.WithSpanKind(trace.SpanKindClient), trace.WithAttributes(
+		attribute.String("db.system", "postgresql"),
+		attribute.String("db.operation.name", "BEGIN"),
+	))
+	defer span.End()
+	tx, err := beginner.BeginTx(ctx, opts)
+	recordQueryError(span, err)
+	if err != nil {
+		return nil, err
+	}
+	return &tracedTx{Tx: tx, ctx: ctx}, nil
+}
+
+func (c *tracedConn) Ping(ctx context.Context) error {
+	if pinger, ok := c.Conn.(driver.Pinger); ok {
+		return pinger.Ping(ctx)
+	}
+	return nil
+}
+
+func (c *tracedConn) ResetSession(ctx context.Context) error {
+	if resetter, ok := c.Conn.(driver.SessionResetter); ok {
+		return resetter.ResetSession(ctx)
+	}
+	return nil
+}
+
+func (c *tracedConn) IsValid() bool {
+	if validator, ok := c.Conn.(driver.Validator); ok {
+		return validator.IsValid()
+	}
+	return true
+}
+
+func (c *tracedConn) CheckNamedValue(nv *driver.NamedValue) error {
+	if checker, ok := c.Conn.(driver.NamedValueChecker); ok {
+		return checker.CheckNamedValue(nv)
+	}
+	return driver.ErrSkip
+}
+
+// tracedTx records the end of a transaction in the trace it began in
+type tracedTx struct {
+	driver.Tx
+	ctx context.Context
+}
+
+func (t *tracedTx) Commit() error {
+	return t.traced("COMMIT", t.Tx.Commit)
+}
+
+func (t *tracedTx) Rollback() error {
+	return t.traced("ROLLBACK", t.Tx.Rollback)
+}
+
+func (t *tracedTx) traced(operation string, fn func() error) error {
+	_, span := tracing.Tracer().Start(t.ctx, operation, trace.WithSpanKind(trace.SpanKindClient), trace.WithAttributes(
+		attribute.String("db.system", "postgresql"),
+		attribute.String("db.operation.name", operation),
+	))
+	defer span.End()
+	err := fn()
+	recordQueryError(span, err)
+	return err
+}
+
+func startQuerySpan(ctx context.Context, query string) (context.Context, trace.Span) {
+	statement := sanitizeSQL(query)
+	operation := sqlOperation(statement)
+	return tracing.Tracer().Start(ctx, operation, trace.WithSpanKind(trace.SpanKindClient), trace.WithAttributes(
+		attribute.String("db.system", "postgresql"),
+		attribute.String("db.operation.name", operation),
+		attribute.String("db.query.text", statement),
+	))
+}
+
+func recordQueryError(span trace.Span, err error) {
+	if err != driver.ErrSkip {
+		tracing.RecordError(span, err)
+	}
+}
+
+var (
+	sqlStringLiteral  = regexp.MustCompile(`'(?:[^']|'')*'`)
+	sqlNumericLiteral = regexp.MustCompile(`\$?\b\d+(?:\.\d+)?\b`)
+	sqlWhitespace     = regexp.MustCompile(`\s+`)
+)
+
+// sanitizeSQL replaces literals in a statement with ? so that spans never
+// contain values; parameters ($1) are kept since they carry no data
+func sanitizeSQL(query string) string {
+	s := sqlStringLiteral.ReplaceAllString(query, "?")
+	s = sqlNumericLiteral.ReplaceAllStringFunc(s, func(m string) string {
+		if strings.HasPrefix(m, "$") {
+			return m
+		}
+		return "?"
+	})
+	s = strings.TrimSpace(sqlWhitespace.ReplaceAllString(s, " "))
+	if len(s) > maxTracedStatementLength {
+		s = s[:maxTracedStatementLength] + "..."
+	}
+	return s
+}
+
+// sqlOperation returns the first keyword of a statement, e.g. SELECT
+func sqlOperation(statement string) string {
+	operation, _, _ := strings.Cut(statement, " ")
+	operation = strings.ToUpper(strings.Trim(operation, "("))
+	if operation == "" {
+		return "QUERY"
+	}
+	return operation
+}
@@ -0,0 +1,156 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+
+	"organization_backend/internal/domain"
+)
+
+// ErrUserDisabled is returned when a disabled user tries to log in
+var ErrUserDisabled = errors.New("user is disabled")
+
+// UserAccount is a user with the fields only operators manage
+type UserAccount struct {
+	domain.Customer
+	DistributionCenterID string     `json:"distributionCenterId,omitempty"`
+	DisabledAt           *time.Time `json:"disabledAt,omitempty"`
+}
+
+type ListUsersParams struct {
+	// AdminsOnly restricts the list to admins
+	AdminsOnly bool
+	// Query matches email and name case-insensitively
+	Query string
+}
+
+const userAccountColumns = `id, email, name, COALESCE(workos_user_id, ''), email_verified, is_admin, created_at,
+	distribution_center_id, disabled_at`
+
+func scanUserAccount(scanner interface {
+	Scan(dest ...any) error
+}) (UserAccount, error) {
+	var u UserAccount
+	var centerID sql.NullString
+	var disabledAt sql.NullTime
+	if err := scanner.Scan(&u.ID, &u.Email, &u.Name, &u.WorkOSUserID, &u.EmailVerified, &u.IsAdmin, &u.CreatedAt,
+		&centerID, &disabledAt); err != nil {
+		return UserAccount{}, err
+	}
+	u.DistributionCenterID = centerID.String
+	if disabledAt.Valid {
+		u.DisabledAt = &disabledAt.Time
+	}
+	return u, nil
+}
+
+// ListUsers returns users ordered by email
+func (s *Store) ListUsers(ctx context.Context, params ListUsersParams) ([]UserAccount, error) {
+	rows, err := s.db.QueryContext(ctx, `
+		SELECT `+userAccountColumns+`
+		FROM users
+		WHERE (NOT $1 OR is_admin)
+		  AND ($2 = '' OR email ILIKE '%' || $2 || '%' OR name ILIKE '%' || $2 || '%')
+		ORDER BY email ASC
+	`, params.AdminsOnly, params.Query)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	users := []UserAccount{}
+	for rows.Next() {
+		u, err := scanUserAccount(rows)
+		if err != nil {
+			return nil, err
+		}
+		users = append(users, u)
+	}
+	return users, rows.Err()
+}
+
+// FindUser returns the user with the given ID or email
+func (s *Store) FindUser(ctx context.Context, idOrEmail string) (UserAccount, error) {
+	return findUser(ctx, s.db, idOrEmail, false)
+}
+
+func findUser(ctx context.Context, q queryer, idOrEmail string, forUpdate bool) (UserAccount, error) {
+	query := `
+		SELECT ` + userAccountColumns + `
+		FROM users
+		WHERE id::text = $1 OR lower(email) = lower($1)`
+	if forUpdate {
+		query += ` FOR UPDATE`
+	}
+	u, err := scanUserAccount(q.QueryRowContext(ctx, query, idOrEmail))
+	if errors.Is(err, sql.ErrNoRows) {
+		return UserAccount{}, ErrUserNotFound
+	}
+	return u, err
+}
+
+// SetUserAdmin grants or revokes admin rights. Sessions issued before keep
+// their rights until they expire.
+func (s *Store) SetUserAdmin(ctx context.Context, idOrEmail string, admin bool) (UserAccount, error) {
+	return s.updateUser(ctx, idOrEmail, `UPDATE users SET is_admin = $2 WHERE id = $1`, admin)
+}
+
+// SetUserDisabled disables or re-enables a user. Disabled users cannot log
+// in and their calendar feed token is revoked, so a re-enabled user gets a
+// new feed URL. Sessions issued before stay valid until they expire.
+func (s *Store) SetUserDisabled(ctx context.Context, idOrEmail string, disabled bool) (UserAccount, error) {
+	return s.updateUser(ctx, idOrEmail, `
+		UPDATE users
+		SET disabled_at = CASE WHEN $2 THEN COALESCE(disabled_at, now()) END,
+		    calendar_token = CASE WHEN $2 THEN NULL ELSE calendar_token END
+		WHERE id = $1
+	`, disabled)
+}
+
+// SetUserDistributionCenter makes a user staff of a distribution center. An
+// empty centerID removes the assignment.
+func (s *Store) SetUserDistributionCenter(ctx context.Context, idOrEmail, centerID string) (UserAccount, error) {
+	if centerID != "" {
+		var exists bool
+		if err := s.db.QueryRowContext(ctx, `
+			SELECT EXISTS (SELECT 1 FROM distribution_centers WHERE id::text = $1)
+		`, centerID).Scan(&exists); err != nil {
+			return UserAccount{}, err
+		}
+		if !exists {
+			return UserAccount{}, ErrDistributionCenterNotFound
+		}
+	}
+	return s.updateUser(ctx, idOrEmail, `
+		UPDATE users SET distribution_center_id = $2 WHERE id = $1
+	`, sql.NullString{String: centerID, Valid: centerID != ""})
+}
+
+// updateUser runs query with the user's ID and value and audits the change
+func (s *Store) updateUser(ctx context.Context, idOrEmail, query string, value any) (UserAccount, error) {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return UserAccount{}, err
+	}
+	defer tx.Rollback()
+
+	before, err := findUser(ctx, tx, idOrEmail, true)
+	if err != nil {
+		return UserAccount{}, err
+	}
+	if _, err := tx.ExecContext(ctx, query, before.ID, value); err != nil {
+		return UserAccount{}, err
+	}
+	after, err := findUser(ctx, tx, before.ID, false)
+	if err != nil {
+		return UserAccount{}, err
+	}
+	if err := recordAudit(ctx, tx, AuditActionUpdate, AuditEntityUser, after.ID, before, after); err != nil {
+		return UserAccount{}, err
+	}
+	if err := tx.Commit(); err != nil {
+		return UserAccount{}, err
+	}
+	return after, nil
+}
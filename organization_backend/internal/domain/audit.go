@@ -0,0 +1,21 @@
+package domain
+
+import (
+	"encoding/json"
+	"time"
+)
+
+// AuditEntry records a single mutation performed on an entity
+type AuditEntry struct {
+	ID         string          `json:"id"`
+	ActorID    string          `json:"actorId,omitempty"`
+	ActorEmail string          `json:"actorEmail,omitempty"`
+	Action     string          `json:"action"`
+	EntityType string          `json:"entityType"`
+	EntityID   string          `json:"entityId"`
+	Before     json.RawMessage `json:"before,omitempty"`
+	After      json.RawMessage `json:"after,omitempty"`
+	RequestID  string          `json:"requestId,omitempty"`
+	IP         string          `json:"ip,omitempty"`
+	CreatedAt  time.Time       `json:"createdAt"`
+}
@@ -0,0 +1,11 @@
+package domain
+
+// Category groups material types in the catalog. Categories form a tree via
+// ParentID and are ordered by SortOrder within their parent.
+type Category struct {
+	ID        string     `json:"id"`
+	ParentID  string     `json:"parentId,omitempty"`
+	Name      string     `json:"name"`
+	SortOrder int        `json:"sortOrder"`
+	Children  []Category `json:"children,omitempty"`
+}
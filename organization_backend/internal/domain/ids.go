@@ -0,0 +1,43 @@
+package domain
+
+import (
+	"regexp"
+	"sort"
+	"strings"
+)
+
+var (
+	idInvalidChars = regexp.MustCompile(`[^a-z0-9_]`)
+	idUnderscores  = regexp.MustCompile(`_+`)
+)
+
+// NormalizeID creates a URL-friendly ID from a name. Material types,
+// categories and kits are identified by the normalized form of their name.
+func NormalizeID(name string) string {
+	// Convert to lowercase
+	id := strings.ToLower(name)
+	// Replace spaces with underscores
+	id = strings.ReplaceAll(id, " ", "_")
+	// Remove special characters, keep only alphanumeric and underscores
+	id = idInvalidChars.ReplaceAllString(id, "")
+	// Remove consecutive underscores
+	id = idUnderscores.ReplaceAllString(id, "_")
+	// Trim underscores from start and end
+	return strings.Trim(id, "_")
+}
+
+// NormalizeTags lowercases, trims, deduplicates and sorts tags
+func NormalizeTags(tags []string) []string {
+	seen := map[string]bool{}
+	result := []string{}
+	for _, tag := range tags {
+		tag = strings.ToLower(strings.TrimSpace(tag))
+		if tag == "" || seen[tag] {
+			continue
+		}
+		seen[tag] = true
+		result = append(result, tag)
+	}
+	sort.Strings(result)
+	return result
+}
@@ -0,0 +1,35 @@
+package domain
+
+import "time"
+
+// MaterialTypeImage is one image in a material type's ordered gallery.
+// The original upload is kept next to generated size variants.
+type MaterialTypeImage struct {
+	ID             string         `json:"id"`
+	MaterialTypeID string         `json:"materialTypeId"`
+	Position       int            `json:"position"`
+	AltText        string         `json:"altText"`
+	ContentHash    string         `json:"contentHash"`
+	OriginalURL    string         `json:"originalUrl"`
+	Variants       []ImageVariant `json:"variants"`
+	SrcSet         string         `json:"srcset"`
+	CreatedAt      time.Time      `json:"createdAt"`
+}
+
+// ImageVariant is a resized rendition of an image
+type ImageVariant struct {
+	Name   string `json:"name"`
+	URL    string `json:"url"`
+	Width  int    `json:"width"`
+	Height int    `json:"height"`
+}
+
+// Variant returns the variant with the given name, if present
+func (i MaterialTypeImage) Variant(name string) (ImageVariant, bool) {
+	for _, v := range i.Variants {
+		if v.Name == name {
+			return v, true
+		}
+	}
+	return ImageVariant{}, false
+}
@@ -0,0 +1,45 @@
+package domain
+
+// Kit bundles several material types, e.g. a complete CPR training set
+type Kit struct {
+	ID               string         `json:"id"`
+	Name             string         `json:"name"`
+	Description      string         `json:"description"`
+	DefaultClassSize int            `json:"defaultClassSize"`
+	Components       []KitComponent `json:"components"`
+	// Available is true when every component is available for the requested class size
+	Available bool `json:"available"`
+}
+
+// KitComponent is a material type within a kit. Quantity is needed for every
+// started group of PerParticipants; a PerParticipants of zero means Quantity
+// is fixed regardless of class size.
+type KitComponent struct {
+	MaterialTypeID  string `json:"materialTypeId"`
+	Quantity        int    `json:"quantity"`
+	PerParticipants int    `json:"perParticipants"`
+}
+
+// RequestKit records a kit added to a request and the items it expanded into
+type RequestKit struct {
+	KitID     string         `json:"kitId"`
+	ClassSize int            `json:"classSize"`
+	Items     map[string]int `json:"items"`
+}
+
+// Expand returns the material type quantities needed for the given class size
+func (k Kit) Expand(classSize int) map[string]int {
+	if classSize <= 0 {
+		classSize = k.DefaultClassSize
+	}
+	items := make(map[string]int, len(k.Components))
+	for _, c := range k.Components {
+		quantity := c.Quantity
+		if c.PerParticipants > 0 {
+			groups := (classSize + c.PerParticipants - 1) / c.PerParticipants
+			quantity = c.Quantity * groups
+		}
+		items[c.MaterialTypeID] += quantity
+	}
+	return items
+}
@@ -1,22 +1,37 @@
 package domain
 
-// MaterialType represents a type of material that can be requested
+import "time"
+
+// MaterialType represents a type of material that can be requested.
+// Archived material types are kept for historical requests but cannot be requested.
 type MaterialType struct {
-	ID             string `json:"id"`
-	Name           string `json:"name"`
-	Description    string `json:"description"`
-	ImageURL       string `json:"imageUrl"`
-	AvailableCount int    `json:"availableCount"`
+	ID             string     `json:"id"`
+	Name           string     `json:"name"`
+	Description    string     `json:"description"`
+	ImageURL       string     `json:"imageUrl"`
+	CategoryID     string     `json:"categoryId,omitempty"`
+	Tags           []string   `json:"tags"`
+	AvailableCount int        `json:"availableCount"`
+	ArchivedAt     *time.Time `json:"archivedAt,omitempty"`
+
+	// Images is only populated when fetching a single material type
+	Images []MaterialTypeImage `json:"images,omitempty"`
 }
 
 // CreateMaterialTypeInput contains fields for creating a new material type
 type CreateMaterialTypeInput struct {
-	Name        string `json:"name"`
-	Description string `json:"description"`
+	Name        string   `json:"name"`
+	Description string   `json:"description"`
+	ImageURL    string   `json:"imageUrl"`
+	CategoryID  string   `json:"categoryId"`
+	Tags        []string `json:"tags"`
 }
 
-// UpdateMaterialTypeInput contains fields for updating a material type
+// UpdateMaterialTypeInput contains fields for updating a material type.
+// Nil CategoryID or Tags leave the current value unchanged.
 type UpdateMaterialTypeInput struct {
-	Name        string `json:"name"`
-	Description string `json:"description"`
+	Name        string   `json:"name"`
+	Description string   `json:"description"`
+	CategoryID  *string  `json:"categoryId"`
+	Tags        []string `json:"tags"`
 }
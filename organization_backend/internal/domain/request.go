@@ -2,18 +2,25 @@ package domain
 
 import "time"
 
+// ShippingAddress is the snapshot of the address a request ships to.
+// AddressID names the saved address it was copied from, if any.
 type ShippingAddress struct {
-	Line1   string `json:"line1"`
-	Line2   string `json:"line2,omitempty"`
-	City    string `json:"city"`
-	ZipCode string `json:"zipCode"`
+	AddressID string `json:"addressId,omitempty"`
+	Line1     string `json:"line1"`
+	Line2     string `json:"line2,omitempty"`
+	City      string `json:"city"`
+	ZipCode   string `json:"zipCode"`
 }
 
 type Request struct {
 	ID                   string          `json:"id"`
 	Customer             Customer        `json:"customer"`
+	SchoolID             string          `json:"schoolId,omitempty"`
 	Items                map[string]int  `json:"items"`
+	Kits                 []RequestKit    `json:"kits,omitempty"`
 	DeliveryDate         time.Time       `json:"deliveryDate"`
+	ReturnDate           *time.Time      `json:"returnDate,omitempty"`
+	DistributionCenterID string          `json:"distributionCenterId,omitempty"`
 	Status               string          `json:"status"`
 	ShippingCustomerName string          `json:"shippingCustomerName"`
 	ShippingAddress      ShippingAddress `json:"shippingAddress"`
@@ -21,3 +28,9 @@ type Request struct {
 	UpdatedAt            time.Time       `json:"updatedAt"`
 	Metadata             map[string]any  `json:"metadata,omitempty"`
 }
+
+// StatusChange records when a request entered a status
+type StatusChange struct {
+	Status    string    `json:"status"`
+	ChangedAt time.Time `json:"changedAt"`
+}
@@ -0,0 +1,68 @@
+package domain
+
+import "time"
+
+// Roles of school members. Owners can edit the school and manage its members.
+const (
+	SchoolRoleOwner  = "owner"
+	SchoolRoleMember = "member"
+)
+
+// School is the organization requests are made for. Several users can be
+// members and share its requests and addresses.
+type School struct {
+	ID        string          `json:"id"`
+	Name      string          `json:"name"`
+	Addresses []Address       `json:"addresses"`
+	Contacts  []SchoolContact `json:"contacts"`
+	Members   []SchoolMember  `json:"members"`
+	CreatedAt time.Time       `json:"createdAt"`
+	UpdatedAt time.Time       `json:"updatedAt"`
+}
+
+// Address is a saved address of a school or, when SchoolID is empty, of a
+// single user. VerifiedAt is set once an admin confirmed it.
+type Address struct {
+	ID         string     `json:"id"`
+	SchoolID   string     `json:"schoolId,omitempty"`
+	Label      string     `json:"label"`
+	Line1      string     `json:"line1"`
+	Line2      string     `json:"line2,omitempty"`
+	City       string     `json:"city"`
+	ZipCode    string     `json:"zipCode"`
+	VerifiedAt *time.Time `json:"verifiedAt,omitempty"`
+}
+
+// SchoolContact is a contact person of a school who does not need a login
+type SchoolContact struct {
+	ID    string `json:"id"`
+	Name  string `json:"name"`
+	Email string `json:"email,omitempty"`
+	Phone string `json:"phone,omitempty"`
+	Role  string `json:"role,omitempty"`
+}
+
+// SchoolMember is a user belonging to a school
+type SchoolMember struct {
+	UserID string `json:"userId"`
+	Name   string `json:"name"`
+	Email  string `json:"email"`
+	Role   string `json:"role"`
+}
+
+// AddressInput contains the editable fields of an address
+type AddressInput struct {
+	Label   string `json:"label"`
+	Line1   string `json:"line1"`
+	Line2   string `json:"line2"`
+	City    string `json:"city"`
+	ZipCode string `json:"zipCode"`
+}
+
+// SchoolContactInput contains the editable fields of a contact person
+type SchoolContactInput struct {
+	Name  string `json:"name"`
+	Email string `json:"email"`
+	Phone string `json:"phone"`
+	Role  string `json:"role"`
+}
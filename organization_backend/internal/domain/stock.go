@@ -0,0 +1,15 @@
+package domain
+
+// DistributionCenter is a location that stocks material
+type DistributionCenter struct {
+	ID      string `json:"id"`
+	Name    string `json:"name"`
+	Address string `json:"address"`
+}
+
+// StockLevel is the amount of a material type held at a distribution center
+type StockLevel struct {
+	MaterialTypeID       string `json:"materialTypeId"`
+	DistributionCenterID string `json:"distributionCenterId"`
+	Amount               int    `json:"amount"`
+}
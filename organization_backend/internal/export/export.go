@@ -0,0 +1,195 @@
+// Package export writes tabular reports as CSV or XLSX while streaming rows,
+// so memory use does not grow with the number of rows.
+package export
+
+import (
+	"archive/zip"
+	"bufio"
+	"encoding/csv"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+)
+
+// Writer writes rows of cells. Cells may be strings or ints.
+type Writer interface {
+	WriteRow(cells []any) error
+	// Flush pushes buffered rows to the underlying writer
+	Flush() error
+	// Close finishes the document
+	Close() error
+}
+
+// Formats supported by New
+const (
+	FormatCSV  = "csv"
+	FormatXLSX = "xlsx"
+)
+
+// ContentType returns the MIME type of a format
+func ContentType(format string) string {
+	if format == FormatXLSX {
+		return "application/vnd.openxmlformats-officedocument.spreadsheetml.sheet"
+	}
+	return "text/csv; charset=utf-8"
+}
+
+// New returns a writer for the given format
+func New(w io.Writer, format string) (Writer, error) {
+	switch format {
+	case FormatCSV:
+		return NewCSV(w)
+	case FormatXLSX:
+		return NewXLSX(w)
+	default:
+		return nil, fmt.Errorf("unsupported export format %q", format)
+	}
+}
+
+type csvWriter struct {
+	w *csv.Writer
+}
+
+// NewCSV returns a CSV writer. A UTF-8 byte order mark is written first so
+// spreadsheet applications detect the encoding of umlauts correctly.
+func NewCSV(w io.Writer) (Writer, error) {
+	if _, err := io.WriteString(w, "\ufeff"); err != nil {
+		return nil, err
+	}
+	return &csvWriter{w: csv.NewWriter(w)}, nil
+}
+
+func (c *csvWriter) WriteRow(cells []any) error {
+	record := make([]string, len(cells))
+	for i, cell := range cells {
+		switch v := cell.(type) {
+		case int:
+			record[i] = strconv.Itoa(v)
+		case string:
+			record[i] = escapeFormula(v)
+		default:
+			record[i] = escapeFormula(fmt.Sprint(v))
+		}
+	}
+	return c.w.Write(record)
+}
+
+func (c *csvWriter) Flush() error {
+	c.w.Flush()
+	return c.w.Error()
+}
+
+func (c *csvWriter) Close() error {
+	return c.Flush()
+}
+
+// escapeFormula prefixes text that a spreadsheet would evaluate as a formula
+func escapeFormula(value string) string {
+	if value != "" && strings.ContainsRune("=+-@\t\r", rune(value[0])) {
+		return "'" + value
+	}
+	return value
+}
+
+type xlsxWriter struct {
+	zw   *zip.Writer
+	w    *bufio.Writer
+	rows int
+}
+
+const (
+	xlsxContentTypes = `<?xml version="1.0" encoding="UTF-8" standalone="yes"?>
+<Types xmlns="http://schemas.openxmlformats.org/package/2006/content-types">
+<Default Extension="rels" ContentType="application/vnd.openxmlformats-package.relationships+xml"/>
+<Default Extension="xml" ContentType="application/xml"/>
+<Override PartName="/xl/workbook.xml" ContentType="application/vnd.openxmlformats-officedocument.spreadsheetml.sheet.main+xml"/>
+<Override PartName="/xl/worksheets/sheet1.xml" ContentType="application/vnd.openxmlformats-officedocument.spreadsheetml.worksheet+xml"/>
+</Types>`
+	xlsxRootRels = `<?xml version="1.0" encoding="UTF-8" standalone="yes"?>
+<Relationships xmlns="http://schemas.openxmlformats.org/package/2006/relationships">
+<Relationship Id="rId1" Type="http://schemas.openxmlformats.org/officeDocument/2006/relationships/officeDocument" Target="xl/workbook.xml"/>
+</Relationships>`
+	xlsxWorkbook = `<?xml version="1.0" encoding="UTF-8" standalone="yes"?>
+<workbook xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main" xmlns:r="http://schemas.openxmlformats.org/officeDocument/2006/relationships">
+<sheets><sheet name="Export" sheetId="1" r:id="rId1"/></sheets>
+</workbook>`
+	xlsxWorkbookRels = `<?xml version="1.0" encoding="UTF-8" standalone="yes"?>
+<Relationships xmlns="http://schemas.openxmlformats.org/package/2006/relationships">
+<Relationship Id="rId1" Type="http://schemas.openxmlformats.org/officeDocument/2006/relationships/worksheet" Target="worksheets/sheet1.xml"/>
+</Relationships>`
+	xlsxSheetStart = `<?xml version="1.0" encoding="UTF-8" standalone="yes"?>
+<worksheet xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main"><sheetData>`
+	xlsxSheetEnd = `</sheetData></worksheet>`
+)
+
+// NewXLSX returns a writer producing a single-sheet workbook. Rows are
+// written to the sheet as they arrive using inline strings, so no shared
+// string table has to be kept in memory.
+func NewXLSX(w io.Writer) (Writer, error) {
+	zw := zip.NewWriter(w)
+	for _, part := range []struct{ name, body string }{
+		{"[Content_Types].xml", xlsxContentTypes},
+		{"_rels/.rels", xlsxRootRels},
+		{"xl/workbook.xml", xlsxWorkbook},
+		{"xl/_rels/workbook.xml.rels", xlsxWorkbookRels},
+	} {
+		f, err := zw.Create(part.name)
+		if err != nil {
+			return nil, err
+		}
+		if _, err := io.WriteString(f, part.body); err != nil {
+			return nil, err
+		}
+	}
+	sheet, err := zw.Create("xl/worksheets/sheet1.xml")
+	if err != nil {
+		return nil, err
+	}
+	x := &xlsxWriter{zw: zw, w: bufio.NewWriter(sheet)}
+	if _, err := x.w.WriteString(xlsxSheetStart); err != nil {
+		return nil, err
+	}
+	return x, nil
+}
+
+func (x *xlsxWriter) WriteRow(cells []any) error {
+	x.rows++
+	fmt.Fprintf(x.w, `<row r="%d">`, x.rows)
+	for _, cell := range cells {
+		switch v := cell.(type) {
+		case int:
+			fmt.Fprintf(x.w, `<c t="n"><v>%d</v></c>`, v)
+		default:
+			text, ok := cell.(string)
+			if !ok {
+				text = fmt.Sprint(cell)
+			}
+			x.w.WriteString(`<c t="inlineStr"><is><t xml:space="preserve">`)
+			if err := xml.EscapeText(x.w, []byte(text)); err != nil {
+				return err
+			}
+			x.w.WriteString(`</t></is></c>`)
+		}
+	}
+	_, err := x.w.WriteString(`</row>`)
+	return err
+}
+
+func (x *xlsxWriter) Flush() error {
+	if err := x.w.Flush(); err != nil {
+		return err
+	}
+	return x.zw.Flush()
+}
+
+func (x *xlsxWriter) Close() error {
+	if _, err := x.w.WriteString(xlsxSheetEnd); err != nil {
+		return err
+	}
+	if err := x.w.Flush(); err != nil {
+		return err
+	}
+	return x.zw.Close()
+}
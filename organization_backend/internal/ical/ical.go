@@ -0,0 +1,153 @@
+// Package ical writes iCalendar (RFC 5545) feeds.
+package ical
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+// Calendar is a VCALENDAR with its events
+type Calendar struct {
+	// ProdID identifies the product that created the feed
+	ProdID string
+	Name   string
+	// Location is announced as the default time zone of the feed. All-day
+	// events are computed in it by the caller.
+	Location *time.Location
+	Events   []Event
+}
+
+// Event is a VEVENT. Timed events are written in UTC so no VTIMEZONE
+// component is needed; all-day events use the dates of Start and End as-is.
+type Event struct {
+	// UID must stay the same when the event changes so clients replace it
+	UID         string
+	Summary     string
+	Description string
+	Location    string
+	URL         string
+	Start       time.Time
+	// End is exclusive; for all-day events it is the day after the last day
+	End    time.Time
+	AllDay bool
+	// Stamp is the time the event was last modified
+	Stamp time.Time
+	// Sequence increases whenever the event changes
+	Sequence int
+	// Status is TENTATIVE, CONFIRMED or CANCELLED
+	Status string
+}
+
+// ContentType is the MIME type of iCalendar documents
+const ContentType = "text/calendar; charset=utf-8"
+
+const (
+	utcLayout  = "20060102T150405Z"
+	dateLayout = "20060102"
+	// maxLineOctets is the line length limit of RFC 5545 section 3.1,
+	// excluding the line break
+	maxLineOctets = 75
+)
+
+// Write encodes the calendar
+func Write(w io.Writer, cal Calendar) error {
+	lw := &lineWriter{w: bufio.NewWriter(w)}
+	lw.line("BEGIN:VCALENDAR")
+	lw.line("VERSION:2.0")
+	lw.line("PRODID:" + cal.ProdID)
+	lw.line("CALSCALE:GREGORIAN")
+	lw.line("METHOD:PUBLISH")
+	if cal.Name != "" {
+		lw.line("X-WR-CALNAME:" + escapeText(cal.Name))
+	}
+	if cal.Location != nil {
+		lw.line("X-WR-TIMEZONE:" + cal.Location.String())
+	}
+	for _, event := range cal.Events {
+		lw.line("BEGIN:VEVENT")
+		lw.line("UID:" + escapeText(event.UID))
+		lw.line("DTSTAMP:" + event.Stamp.UTC().Format(utcLayout))
+		lw.line("LAST-MODIFIED:" + event.Stamp.UTC().Format(utcLayout))
+		lw.line(fmt.Sprintf("SEQUENCE:%d", event.Sequence))
+		if event.AllDay {
+			lw.line("DTSTART;VALUE=DATE:" + event.Start.Format(dateLayout))
+			lw.line("DTEND;VALUE=DATE:" + event.End.Format(dateLayout))
+		} else {
+			lw.line("DTSTART:" + event.Start.UTC().Format(utcLayout))
+			lw.line("DTEND:" + event.End.UTC().Format(utcLayout))
+		}
+		lw.line("SUMMARY:" + escapeText(event.Summary))
+		if event.Description != "" {
+			lw.line("DESCRIPTION:" + escapeText(event.Description))
+		}
+		if event.Location != "" {
+			lw.line("LOCATION:" + escapeText(event.Location))
+		}
+		if event.URL != "" {
+			lw.line("URL:" + event.URL)
+		}
+		if event.Status != "" {
+			lw.line("STATUS:" + event.Status)
+		}
+		lw.line("TRANSP:TRANSPARENT")
+		lw.line("END:VEVENT")
+	}
+	lw.line("END:VCALENDAR")
+	if lw.err != nil {
+		return lw.err
+	}
+	return lw.w.Flush()
+}
+
+// escapeText escapes a TEXT property value (RFC 5545 section 3.3.11)
+func escapeText(value string) string {
+	var b strings.Builder
+	for _, r := range value {
+		switch r {
+		case '\\', ';', ',':
+			b.WriteRune('\\')
+			b.WriteRune(r)
+		case '\n':
+			b.WriteString(`\n`)
+		case '\r':
+		default:
+			b.WriteRune(r)
+		}
+	}
+	return b.String()
+}
+
+// lineWriter writes content lines terminated by CRLF, folding lines longer
+// than 75 octets without splitting UTF-8 sequences
+type lineWriter struct {
+	w   *bufio.Writer
+	err error
+}
+
+func (l *lineWriter) line(content string) {
+	if l.err != nil {
+		return
+	}
+	limit := maxLineOctets
+	for len(content) > limit {
+		cut := limit
+		for cut > 0 && !utf8.RuneStart(content[cut]) {
+			cut--
+		}
+		l.write(content[:cut] + "\r\n ")
+		content = content[cut:]
+		// Continuation lines start with a space that counts towards the limit
+		limit = maxLineOctets - 1
+	}
+	l.write(content + "\r\n")
+}
+
+func (l *lineWriter) write(s string) {
+	if l.err == nil {
+		_, l.err = l.w.WriteString(s)
+	}
+}
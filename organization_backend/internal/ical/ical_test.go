@@ -0,0 +1,137 @@
+package ical
+
+import (
+	"bufio"
+	"bytes"
+	"strings"
+	"testing"
+	"time"
+	"unicode/utf8"
+)
+
+func TestWrite(t *testing.T) {
+	description := strings.Repeat("Größenübersicht für Schülerinnen und Schüler; Maße, Gewichte ", 4) +
+		"\nRückgabe bis Freitag\\Montag"
+	cal := Calendar{
+		ProdID:   "-//Test//Ausleihe//DE",
+		Name:     "Ausleihen, Schule",
+		Location: time.UTC,
+		Events: []Event{{
+			UID:         "lieferung-1@example.org",
+			Summary:     "Lieferung: Mikroskope",
+			Description: description,
+			Start:       time.Date(2031, time.May, 4, 0, 0, 0, 0, time.UTC),
+			End:         time.Date(2031, time.May, 5, 0, 0, 0, 0, time.UTC),
+			AllDay:      true,
+			Stamp:       time.Date(2031, time.April, 1, 9, 30, 0, 0, time.UTC),
+			Sequence:    2,
+			Status:      "CONFIRMED",
+		}},
+	}
+	var buf bytes.Buffer
+	if err := Write(&buf, cal); err != nil {
+		t.Fatal(err)
+	}
+	out := buf.String()
+
+	if !strings.HasSuffix(out, "END:VCALENDAR\r\n") {
+		t.Errorf("output does not end with a CRLF terminated END:VCALENDAR: %q", out[max(0, len(out)-30):])
+	}
+	if strings.Count(out, "\n") != strings.Count(out, "\r\n") {
+		t.Error("output contains line feeds without carriage return")
+	}
+	lines := strings.Split(strings.TrimSuffix(out, "\r\n"), "\r\n")
+	folded := 0
+	for i, line := range lines {
+		if len(line) > maxLineOctets {
+			t.Errorf("line %d has %d octets: %q", i, len(line), line)
+		}
+		if !utf8.ValidString(line) {
+			t.Errorf("line %d splits a UTF-8 sequence: %q", i, line)
+		}
+		if strings.HasPrefix(line, " ") {
+			folded++
+		}
+	}
+	if folded < 3 {
+		t.Errorf("description was folded into %d continuation lines, want at least 3", folded)
+	}
+
+	unfolded := map[string]string{}
+	for _, line := range strings.Split(strings.ReplaceAll(out, "\r\n ", ""), "\r\n") {
+		if name, value, ok := strings.Cut(line, ":"); ok {
+			unfolded[name] = value
+		}
+	}
+	want := map[string]string{
+		"DESCRIPTION":        strings.Repeat(`Größenübersicht für Schülerinnen und Schüler\; Maße\, Gewichte `, 4) + `\nRückgabe bis Freitag\\Montag`,
+		"X-WR-CALNAME":       `Ausleihen\, Schule`,
+		"SUMMARY":            "Lieferung: Mikroskope",
+		"DTSTART;VALUE=DATE": "20310504",
+		"DTEND;VALUE=DATE":   "20310505",
+		"DTSTAMP":            "20310401T093000Z",
+		"SEQUENCE":           "2",
+	}
+	for name, value := range want {
+		if unfolded[name] != value {
+			t.Errorf("%s = %q, want %q", name, unfolded[name], value)
+		}
+	}
+}
+
+func TestLineFolding(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string
+	}{
+		{"short", "SUMMARY:Lieferung"},
+		{"exactly 75 octets", "SUMMARY:" + strings.Repeat("a", 67)},
+		{"ascii", "DESCRIPTION:" + strings.Repeat("abcdefghij", 20)},
+		{"two-octet runes", "DESCRIPTION:" + strings.Repeat("ä", 100)},
+		{"three-octet runes", "DESCRIPTION:" + strings.Repeat("€", 70)},
+		{"four-octet runes", "DESCRIPTION:" + strings.Repeat("🔬", 50)},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var buf bytes.Buffer
+			lw := &lineWriter{w: bufio.NewWriter(&buf)}
+			lw.line(tt.content)
+			if err := lw.w.Flush(); err != nil {
+				t.Fatal(err)
+			}
+			out := buf.String()
+			lines := strings.Split(strings.TrimSuffix(out, "\r\n"), "\r\n")
+			for i, line := range lines {
+				if i > 0 && !strings.HasPrefix(line, " ") {
+					t.Errorf("continuation line %d does not start with a space: %q", i, line)
+				}
+				if len(line) > maxLineOctets || !utf8.ValidString(line) {
+					t.Errorf("line %d has %d octets or splits a rune: %q", i, len(line), line)
+				}
+			}
+			if len(tt.content) <= maxLineOctets && len(lines) != 1 {
+				t.Errorf("content of %d octets was folded into %d lines", len(tt.content), len(lines))
+			}
+			if got := strings.ReplaceAll(strings.TrimSuffix(out, "\r\n"), "\r\n ", ""); got != tt.content {
+				t.Errorf("unfolded = %q, want %q", got, tt.content)
+			}
+		})
+	}
+}
+
+func TestEscapeText(t *testing.T) {
+	tests := []struct {
+		in, want string
+	}{
+		{"Schulweg 1", "Schulweg 1"},
+		{"a;b,c", `a\;b\,c`},
+		{`C:\Ablage`, `C:\\Ablage`},
+		{"erste\r\nzweite\nZeile", `erste\nzweite\nZeile`},
+		{"Größe: ß", "Größe: ß"},
+	}
+	for _, tt := range tests {
+		if got := escapeText(tt.in); got != tt.want {
+			t.Errorf("escapeText(%q) = %q, want %q", tt.in, got, tt.want)
+		}
+	}
+}
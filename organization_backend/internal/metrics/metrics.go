@@ -0,0 +1,153 @@
+package metrics
+
+import (
+	"database/sql"
+	"strconv"
+	"time"
+)
+
+// sizeBuckets are upload size buckets in bytes, from 64 KiB to 256 MiB
+var sizeBuckets = []float64{64 << 10, 256 << 10, 1 << 20, 4 << 20, 16 << 20, 64 << 20, 256 << 20}
+
+// Metrics are the instruments of the server. The methods of a nil *Metrics
+// record nothing, so components work without metrics.
+type Metrics struct {
+	Registry *Registry
+
+	// HTTPRequestDuration observes request latency by method, route pattern
+	// and status
+	HTTPRequestDuration *HistogramVec
+	// SSEStreams counts open event streams by kind
+	SSEStreams *GaugeVec
+	// UploadSize observes the size of uploaded files by kind
+	UploadSize *HistogramVec
+
+	// NotificationsReceived counts request notifications from PostgreSQL
+	NotificationsReceived *CounterVec
+	// NotificationsDropped counts updates not delivered to a subscriber
+	// because its queue was full
+	NotificationsDropped *CounterVec
+	// Subscribers counts the subscribers of the notifier
+	Subscribers *GaugeVec
+
+	// JobRuns counts background job runs by job and outcome
+	JobRuns *CounterVec
+	// JobDuration observes how long background jobs run
+	JobDuration *HistogramVec
+}
+
+// New returns the server metrics registered in a new registry
+func New() *Metrics {
+	r := NewRegistry()
+	return &Metrics{
+		Registry: r,
+		HTTPRequestDuration: r.NewHistogramVec("http_request_duration_seconds",
+			"Duration of HTTP requests by method, route pattern and status.",
+			DefaultBuckets, "method", "route", "status"),
+		SSEStreams: r.NewGaugeVec("sse_streams_active",
+			"Open server-sent event streams by kind.", "stream"),
+		UploadSize: r.NewHistogramVec("upload_size_bytes",
+			"Size of uploaded files in bytes by kind.", sizeBuckets, "kind"),
+		NotificationsReceived: r.NewCounterVec("notifier_notifications_received_total",
+			"Request notifications received from PostgreSQL."),
+		NotificationsDropped: r.NewCounterVec("notifier_updates_dropped_total",
+			"Request updates dropped because a subscriber's queue was full."),
+		Subscribers: r.NewGaugeVec("notifier_subscribers",
+			"Active subscribers to request updates."),
+		JobRuns: r.NewCounterVec("job_runs_total",
+			"Background job runs by job and outcome.", "job", "outcome"),
+		JobDuration: r.NewHistogramVec("job_duration_seconds",
+			"Duration of background job runs.", DefaultBuckets, "job"),
+	}
+}
+
+// ObserveHTTP records a served request
+func (m *Metrics) ObserveHTTP(method, route string, status int, d time.Duration) {
+	if m == nil {
+		return
+	}
+	m.HTTPRequestDuration.Observe(d.Seconds(), method, route, strconv.Itoa(status))
+}
+
+// StreamOpened and StreamClosed track open event streams of a kind
+func (m *Metrics) StreamOpened(stream string) {
+	if m != nil {
+		m.SSEStreams.Inc(stream)
+	}
+}
+
+func (m *Metrics) StreamClosed(stream string) {
+	if m != nil {
+		m.SSEStreams.Dec(stream)
+	}
+}
+
+// ObserveUpload records the size of an uploaded file of a kind
+func (m *Metrics) ObserveUpload(kind string, size int64) {
+	if m != nil {
+		m.UploadSize.Observe(float64(size), kind)
+	}
+}
+
+// NotificationReceived counts a notification from PostgreSQL
+func (m *Metrics) NotificationReceived() {
+	if m != nil {
+		m.NotificationsReceived.Inc()
+	}
+}
+
+// NotificationDropped counts an update dropped for a slow subscriber
+func (m *Metrics) NotificationDropped() {
+	if m != nil {
+		m.NotificationsDropped.Inc()
+	}
+}
+
+// SubscribersChanged adds delta to the number of notifier subscribers
+func (m *Metrics) SubscribersChanged(delta int) {
+	if m != nil {
+		m.Subscribers.Add(float64(delta))
+	}
+}
+
+// ObserveJob records a job run that started at start and ended with err
+func (m *Metrics) ObserveJob(job string, start time.Time, err error) {
+	if m == nil {
+		return
+	}
+	outcome := "success"
+	if err != nil {
+		outcome = "failure"
+	}
+	m.JobRuns.Inc(job, outcome)
+	m.JobDuration.Observe(time.Since(start).Seconds(), job)
+}
+
+// RegisterDBStats exposes the connection pool statistics of db
+func (m *Metrics) RegisterDBStats(db *sql.DB) {
+	if m == nil {
+		return
+	}
+	gauge := func(name, help string, fn func(sql.DBStats) float64) {
+		m.Registry.NewGaugeFunc(name, help, func() float64 { return fn(db.Stats()) })
+	}
+	counter := func(name, help string, fn func(sql.DBStats) float64) {
+		m.Registry.NewCounterFunc(name, help, func() float64 { return fn(db.Stats()) })
+	}
+	gauge("db_pool_max_open_connections", "Maximum number of open connections to the database.",
+		func(s sql.DBStats) float64 { return float64(s.MaxOpenConnections) })
+	gauge("db_pool_open_connections", "Established connections, both in use and idle.",
+		func(s sql.DBStats) float64 { return float64(s.OpenConnections) })
+	gauge("db_pool_in_use_connections", "Connections currently in use.",
+		func(s sql.DBStats) float64 { return float64(s.InUse) })
+	gauge("db_pool_idle_connections", "Idle connections.",
+		func(s sql.DBStats) float64 { return float64(s.Idle) })
+	counter("db_pool_wait_count_total", "Connections waited for.",
+		func(s sql.DBStats) float64 { return float64(s.WaitCount) })
+	counter("db_pool_wait_duration_seconds_total", "Time blocked waiting for a connection.",
+		func(s sql.DBStats) float64 { return s.WaitDuration.Seconds() })
+	counter("db_pool_max_idle_closed_total", "Connections closed because of the idle limit.",
+		func(s sql.DBStats) float64 { return float64(s.MaxIdleClosed) })
+	counter("db_pool_max_lifetime_closed_total", "Connections closed because of their maximum lifetime.",
+		func(s sql.DBStats) float64 { return float64(s.MaxLifetimeClosed) })
+}
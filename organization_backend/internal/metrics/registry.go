@@ -0,0 +1,373 @@
+// Package metrics collects counters, gauges and histograms and exposes them
+// in the Prometheus text format. It implements only what the server uses:
+// metric vectors with fixed label names and gauges read from a function at
+// scrape time.
+package metrics
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+)
+
+// DefaultBuckets are latency buckets in seconds
+var DefaultBuckets = []float64{0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10}
+
+// Registry holds the metrics of a process
+type Registry struct {
+	mu      sync.Mutex
+	metrics map[string]metric
+}
+
+type metric interface {
+	write(w *bufio.Writer, name string)
+	help() string
+	kind() string
+}
+
+// NewRegistry returns an empty registry
+func NewRegistry() *Registry {
+	return &Registry{metrics: map[string]metric{}}
+}
+
+func (r *Registry) register(name string, m metric) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if _, ok := r.metrics[name]; ok {
+		panic("metrics: duplicate metric " + name)
+	}
+	r.metrics[name] = m
+}
+
+// WriteTo writes all metrics sorted by name in the Prometheus text format
+func (r *Registry) WriteTo(w io.Writer) (int64, error) {
+	r.mu.Lock()
+	names := make([]string, 0, len(r.metrics))
+	for name := range r.metrics {
+		names = append(names, name)
+	}
+	metrics := make(map[string]metric, len(r.metrics))
+	for name, m := range r.metrics {
+		metrics[name] = m
+	}
+	r.mu.Unlock()
+	sort.Strings(names)
+
+	cw := &countingWriter{w: w}
+	bw := bufio.NewWriter(cw)
+	for _, name := range names {
+		m := metrics[name]
+		fmt.Fprintf(bw, "# HELP %s %s\n", name, escapeHelp(m.help()))
+		fmt.Fprintf(bw, "# TYPE %s %s\n", name, m.kind())
+		m.write(bw, name)
+	}
+	err := bw.Flush()
+	return cw.n, err
+}
+
+// Handler serves the metrics in the Prometheus text format
+func (r *Registry) Handler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+		_, _ = r.WriteTo(w)
+	})
+}
+
+// vec holds the series of a metric by their label values
+type vec[T any] struct {
+	helpText string
+	labels   []string
+	newValue func() *T
+
+	mu     sync.RWMutex
+	series map[string]*T
+	values map[string][]string
+}
+
+func newVec[T any](help string, labels []string, newValue func() *T) *vec[T] {
+	return &vec[T]{
+		helpText: help,
+		labels:   labels,
+		newValue: newValue,
+		series:   map[string]*T{},
+		values:   map[string][]string{},
+	}
+}
+
+func (v *vec[T]) with(values []string) *T {
+	if len(values) != len(v.labels) {
+		panic(fmt.Sprintf("metrics: got %d label values for %d labels", len(values), len(v.labels)))
+	}
+	key := strings.Join(values, "\xff")
+	v.mu.RLock()
+	s, ok := v.series[key]
+	v.mu.RUnlock()
+	if ok {
+		return s
+	}
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	if s, ok := v.series[key]; ok {
+		return s
+	}
+	s = v.newValue()
+	v.series[key] = s
+	v.values[key] = append([]string(nil), values...)
+	return s
+}
+
+// each calls fn for every series sorted by label values
+func (v *vec[T]) each(fn func(labels string, s *T)) {
+	v.mu.RLock()
+	keys := make([]string, 0, len(v.series))
+	for key := range v.series {
+		keys = append(keys, key)
+	}
+	v.mu.RUnlock()
+	sort.Strings(keys)
+	for _, key := range keys {
+		v.mu.RLock()
+		s, values := v.series[key], v.values[key]
+		v.mu.RUnlock()
+		fn(formatLabels(v.labels, values), s)
+	}
+}
+
+func (v *vec[T]) help() string { return v.helpText }
+
+// CounterVec is a counter partitioned by labels
+type CounterVec struct {
+	*vec[atomicFloat]
+}
+
+// NewCounterVec registers a counter. Counter names should end in _total.
+func (r *Registry) NewCounterVec(name, help string, labels ...string) *CounterVec {
+	c := &CounterVec{newVec(help, labels, func() *atomicFloat { return new(atomicFloat) })}
+	r.register(name, c)
+	return c
+}
+
+// Add adds delta, which must not be negative, to the series of values
+func (c *CounterVec) Add(delta float64, values ...string) {
+	if c == nil || delta < 0 {
+		return
+	}
+	c.with(values).add(delta)
+}
+
+// Inc adds one to the series of values
+func (c *CounterVec) Inc(values ...string) {
+	c.Add(1, values...)
+}
+
+func (c *CounterVec) kind() string { return "counter" }
+
+func (c *CounterVec) write(w *bufio.Writer, name string) {
+	c.each(func(labels string, v *atomicFloat) {
+		fmt.Fprintf(w, "%s%s %s\n", name, labels, formatFloat(v.load()))
+	})
+}
+
+// GaugeVec is a value that goes up and down, partitioned by labels
+type GaugeVec struct {
+	*vec[atomicFloat]
+}
+
+// NewGaugeVec registers a gauge
+func (r *Registry) NewGaugeVec(name, help string, labels ...string) *GaugeVec {
+	g := &GaugeVec{newVec(help, labels, func() *atomicFloat { return new(atomicFloat) })}
+	r.register(name, g)
+	return g
+}
+
+// Add adds delta to the series of values
+func (g *GaugeVec) Add(delta float64, values ...string) {
+	if g == nil {
+		return
+	}
+	g.with(values).add(delta)
+}
+
+// Inc adds one to the series of values
+func (g *GaugeVec) Inc(values ...string) { g.Add(1, values...) }
+
+// Dec subtracts one from the series of values
+func (g *GaugeVec) Dec(values ...string) { g.Add(-1, values...) }
+
+func (g *GaugeVec) kind() string { return "gauge" }
+
+func (g *GaugeVec) write(w *bufio.Writer, name string) {
+	g.each(func(labels string, v *atomicFloat) {
+		fmt.Fprintf(w, "%s%s %s\n", name, labels, formatFloat(v.load()))
+	})
+}
+
+// HistogramVec counts observations in buckets, partitioned by labels
+type HistogramVec struct {
+	*vec[histogram]
+	buckets []float64
+}
+
+type histogram struct {
+	mu     sync.Mutex
+	counts []uint64
+	count  uint64
+	sum    float64
+}
+
+// NewHistogramVec registers a histogram with the given upper bucket bounds
+// in increasing order; an implicit +Inf bucket is added
+func (r *Registry) NewHistogramVec(name, help string, buckets []float64, labels ...string) *HistogramVec {
+	if !sort.Float64sAreSorted(buckets) {
+		panic("metrics: histogram buckets of " + name + " are not sorted")
+	}
+	h := &HistogramVec{buckets: buckets}
+	h.vec = newVec(help, labels, func() *histogram { return &histogram{counts: make([]uint64, len(buckets))} })
+	r.register(name, h)
+	return h
+}
+
+// Observe records value in the series of values
+func (h *HistogramVec) Observe(value float64, values ...string) {
+	if h == nil {
+		return
+	}
+	s := h.with(values)
+	i := sort.SearchFloat64s(h.buckets, value)
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if i < len(s.counts) {
+		s.counts[i]++
+	}
+	s.count++
+	s.sum += value
+}
+
+func (h *HistogramVec) kind() string { return "histogram" }
+
+func (h *HistogramVec) write(w *bufio.Writer, name string) {
+	h.each(func(labels string, s *histogram) {
+		s.mu.Lock()
+		counts := append([]uint64(nil), s.counts...)
+		count, sum := s.count, s.sum
+		s.mu.Unlock()
+
+		var cumulative uint64
+		for i, bound := range h.buckets {
+			cumulative += counts[i]
+			fmt.Fprintf(w, "%s_bucket%s %d\n", name, withLabel(labels, "le", formatFloat(bound)), cumulative)
+		}
+		fmt.Fprintf(w, "%s_bucket%s %d\n", name, withLabel(labels, "le", "+Inf"), count)
+		fmt.Fprintf(w, "%s_sum%s %s\n", name, labels, formatFloat(sum))
+		fmt.Fprintf(w, "%s_count%s %d\n", name, labels, count)
+	})
+}
+
+// funcMetric reads its value when scraped
+type funcMetric struct {
+	helpText string
+	typ      string
+	fn       func() float64
+}
+
+// NewGaugeFunc registers a gauge whose value is read from fn when scraped
+func (r *Registry) NewGaugeFunc(name, help string, fn func() float64) {
+	r.register(name, &funcMetric{helpText: help, typ: "gauge", fn: fn})
+}
+
+// NewCounterFunc registers a counter whose value is read from fn when
+// scraped. fn must never return a smaller value than before.
+func (r *Registry) NewCounterFunc(name, help string, fn func() float64) {
+	r.register(name, &funcMetric{helpText: help, typ: "counter", fn: fn})
+}
+
+func (f *funcMetric) help() string { return f.helpText }
+func (f *funcMetric) kind() string { return f.typ }
+
+func (f *funcMetric) write(w *bufio.Writer, name string) {
+	fmt.Fprintf(w, "%s %s\n", name, formatFloat(f.fn()))
+}
+
+// atomicFloat is a float64 updated without locks
+type atomicFloat struct {
+	bits atomic.Uint64
+}
+
+func (f *atomicFloat) add(delta float64) {
+	for {
+		old := f.bits.Load()
+		if f.bits.CompareAndSwap(old, math.Float64bits(math.Float64frombits(old)+delta)) {
+			return
+		}
+	}
+}
+
+func (f *atomicFloat) load() float64 {
+	return math.Float64frombits(f.bits.Load())
+}
+
+func formatLabels(names, values []string) string {
+	if len(names) == 0 {
+		return ""
+	}
+	var b strings.Builder
+	b.WriteByte('{')
+	for i, name := range names {
+		if i > 0 {
+			b.WriteByte(',')
+		}
+		b.WriteString(name)
+		b.WriteString(`="`)
+		b.WriteString(escapeLabel(values[i]))
+		b.WriteByte('"')
+	}
+	b.WriteByte('}')
+	return b.String()
+}
+
+// withLabel appends a label to formatted labels
+func withLabel(labels, name, value string) string {
+	pair := name + `="` + escapeLabel(value) + `"`
+	if labels == "" {
+		return "{" + pair + "}"
+	}
+	return labels[:len(labels)-1] + "," + pair + "}"
+}
+
+func formatFloat(v float64) string {
+	switch {
+	case math.IsInf(v, 1):
+		return "+Inf"
+	case math.IsInf(v, -1):
+		return "-Inf"
+	case math.IsNaN(v):
+		return "NaN"
+	}
+	return strconv.FormatFloat(v, 'g', -1, 64)
+}
+
+var (
+	labelEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+	helpEscaper  = strings.NewReplacer(`\`, `\\`, "\n", `\n`)
+)
+
+func escapeLabel(s string) string { return labelEscaper.Replace(s) }
+func escapeHelp(s string) string  { return helpEscaper.Replace(s) }
+
+type countingWriter struct {
+	w io.Writer
+	n int64
+}
+
+func (c *countingWriter) Write(p []byte) (int, error) {
+	n, err := c.w.Write(p)
+	c.n += int64(n)
+	return n, err
+}
@@ -0,0 +1,264 @@
+// Package packingslip renders printable packing slips for requests as PDF.
+// Each slip starts on a new page and contains the shipping address, the
+// items to pack with a thumbnail, a QR code linking to the request and the
+// instructions for returning the material.
+package packingslip
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"time"
+
+	"github.com/go-pdf/fpdf"
+	"rsc.io/qr"
+
+	"organization_backend/internal/domain"
+)
+
+// Image is a thumbnail in a format the PDF renderer can embed
+type Image struct {
+	Data []byte
+	// Type is "JPG" or "PNG"
+	Type string
+}
+
+// Item is one line of the packing list
+type Item struct {
+	MaterialTypeID string
+	Name           string
+	Quantity       int
+	// Image is optional
+	Image *Image
+}
+
+// Slip is the content of one packing slip
+type Slip struct {
+	Request domain.Request
+	Items   []Item
+	// URL is encoded in the QR code and should open the request
+	URL string
+}
+
+// Page layout in millimetres
+const (
+	margin       = 15.0
+	qrSize       = 32.0
+	rowHeight    = 14.0
+	thumbSize    = 12.0
+	footerHeight = 30.0
+)
+
+// returnInstructions are printed at the end of every slip
+var returnInstructions = []string{
+	"Bitte geben Sie das Material nach dem Einsatz vollständig und gereinigt zurück.",
+	"Legen Sie diese Packliste der Rückgabe bei, damit wir die Lieferung zuordnen können.",
+	"Fehlende oder beschädigte Teile vermerken Sie bitte in der Spalte \"Gepackt\".",
+	"Den Rückgabetermin finden Sie oben auf dieser Packliste und in Ihrer Anfrage (QR-Code).",
+}
+
+var statusLabels = map[string]string{
+	"pending":  "Offen",
+	"inAction": "In Bearbeitung",
+	"returned": "Zurückgegeben",
+}
+
+// Render writes all slips into one PDF document. Dates are printed in loc.
+func Render(w io.Writer, slips []Slip, loc *time.Location) error {
+	if loc == nil {
+		loc = time.UTC
+	}
+	pdf := fpdf.New("P", "mm", "A4", "")
+	pdf.SetMargins(margin, margin, margin)
+	pdf.SetAutoPageBreak(true, margin+footerHeight)
+	pdf.SetTitle("Packliste", true)
+	pdf.SetCreator("organization_backend", true)
+	pdf.AliasNbPages("{nb}")
+	tr := pdf.UnicodeTranslatorFromDescriptor("")
+
+	current := -1
+	pdf.SetFooterFunc(func() {
+		if current < 0 {
+			return
+		}
+		pageWidth, pageHeight := pdf.GetPageSize()
+		y := pageHeight - margin - footerHeight + 8
+		pdf.SetFont("Helvetica", "", 9)
+		pdf.SetDrawColor(0, 0, 0)
+		half := (pageWidth - 2*margin - 10) / 2
+		pdf.Line(margin, y+10, margin+half, y+10)
+		pdf.Line(margin+half+10, y+10, pageWidth-margin, y+10)
+		pdf.SetXY(margin, y+11)
+		pdf.CellFormat(half, 5, tr("Gepackt von / Datum"), "", 0, "L", false, 0, "")
+		pdf.SetXY(margin+half+10, y+11)
+		pdf.CellFormat(half, 5, tr("Empfangen von / Datum"), "", 0, "L", false, 0, "")
+		pdf.SetXY(margin, pageHeight-margin)
+		pdf.SetFont("Helvetica", "", 8)
+		pdf.SetTextColor(120, 120, 120)
+		footer := fmt.Sprintf("Anfrage %s · Seite %d/{nb}", slips[current].Request.ID, pdf.PageNo())
+		pdf.CellFormat(pageWidth-2*margin, 4, tr(footer), "", 0, "C", false, 0, "")
+		pdf.SetTextColor(0, 0, 0)
+	})
+
+	images := map[string]string{}
+	for i, slip := range slips {
+		current = i
+		pdf.AddPage()
+		if err := renderSlip(pdf, tr, slip, loc, images); err != nil {
+			return fmt.Errorf("request %s: %w", slip.Request.ID, err)
+		}
+	}
+	if len(slips) == 0 {
+		pdf.AddPage()
+		pdf.SetFont("Helvetica", "", 12)
+		pdf.CellFormat(0, 10, tr("Keine Anfragen für diesen Tag."), "", 1, "L", false, 0, "")
+	}
+	return pdf.Output(w)
+}
+
+// renderSlip draws one slip starting at the top of the current page. images
+// maps material type IDs to registered image names so thumbnails shared by
+// several slips are embedded once.
+func renderSlip(pdf *fpdf.Fpdf, tr func(string) string, slip Slip, loc *time.Location, images map[string]string) error {
+	req := slip.Request
+	pageWidth, _ := pdf.GetPageSize()
+	contentWidth := pageWidth - 2*margin
+
+	if slip.URL != "" {
+		code, err := qr.Encode(slip.URL, qr.M)
+		if err != nil {
+			return fmt.Errorf("encode qr code: %w", err)
+		}
+		name := "qr-" + req.ID
+		pdf.RegisterImageOptionsReader(name, fpdf.ImageOptions{ImageType: "PNG"}, bytes.NewReader(code.PNG()))
+		if err := pdf.Error(); err != nil {
+			return err
+		}
+		pdf.ImageOptions(name, pageWidth-margin-qrSize, margin, qrSize, qrSize, false, fpdf.ImageOptions{ImageType: "PNG"}, 0, slip.URL)
+	}
+
+	textWidth := contentWidth - qrSize - 5
+	pdf.SetFont("Helvetica", "B", 18)
+	pdf.CellFormat(textWidth, 9, tr("Packliste / Lieferschein"), "", 1, "L", false, 0, "")
+	pdf.SetFont("Helvetica", "", 10)
+	pdf.CellFormat(textWidth, 5, tr("Anfrage: "+req.ID), "", 1, "L", false, 0, "")
+	pdf.CellFormat(textWidth, 5, tr("Lieferdatum: "+req.DeliveryDate.In(loc).Format("02.01.2006")), "", 1, "L", false, 0, "")
+	if req.ReturnDate != nil {
+		pdf.CellFormat(textWidth, 5, tr("Rückgabe bis: "+req.ReturnDate.In(loc).Format("02.01.2006")), "", 1, "L", false, 0, "")
+	}
+	status := statusLabels[req.Status]
+	if status == "" {
+		status = req.Status
+	}
+	pdf.CellFormat(textWidth, 5, tr("Status: "+status), "", 1, "L", false, 0, "")
+	pdf.SetY(margin + qrSize + 5)
+
+	// Address and orderer side by side
+	half := (contentWidth - 10) / 2
+	top := pdf.GetY()
+	pdf.SetFont("Helvetica", "B", 11)
+	pdf.CellFormat(half, 6, tr("Lieferadresse"), "", 2, "L", false, 0, "")
+	pdf.SetFont("Helvetica", "", 11)
+	address := []string{req.ShippingCustomerName, req.ShippingAddress.Line1, req.ShippingAddress.Line2,
+		req.ShippingAddress.ZipCode + " " + req.ShippingAddress.City}
+	for _, line := range address {
+		if line == "" || line == " " {
+			continue
+		}
+		pdf.CellFormat(half, 5.5, tr(line), "", 2, "L", false, 0, "")
+	}
+	bottom := pdf.GetY()
+
+	pdf.SetXY(margin+half+10, top)
+	pdf.SetFont("Helvetica", "B", 11)
+	pdf.CellFormat(half, 6, tr("Besteller"), "", 2, "L", false, 0, "")
+	pdf.SetFont("Helvetica", "", 11)
+	for _, line := range []string{req.Customer.Name, req.Customer.Email} {
+		if line != "" {
+			pdf.CellFormat(half, 5.5, tr(line), "", 2, "L", false, 0, "")
+		}
+	}
+	if pdf.GetY() > bottom {
+		bottom = pdf.GetY()
+	}
+	pdf.SetXY(margin, bottom+6)
+
+	if len(req.Kits) > 0 {
+		pdf.SetFont("Helvetica", "", 10)
+		kits := "Enthaltene Sets:"
+		for i, kit := range req.Kits {
+			if i > 0 {
+				kits += ","
+			}
+			kits += fmt.Sprintf(" %s (%d Kinder)", kit.KitID, kit.ClassSize)
+		}
+		pdf.MultiCell(contentWidth, 5, tr(kits), "", "L", false)
+		pdf.Ln(2)
+	}
+
+	// Item table
+	columns := []struct {
+		title string
+		width float64
+		align string
+	}{
+		{"", thumbSize + 4, "L"},
+		{"Material", contentWidth - thumbSize - 4 - 25 - 25, "L"},
+		{"Menge", 25, "R"},
+		{"Gepackt", 25, "C"},
+	}
+	header := func() {
+		pdf.SetFont("Helvetica", "B", 10)
+		pdf.SetFillColor(235, 235, 235)
+		for _, col := range columns {
+			pdf.CellFormat(col.width, 7, tr(col.title), "B", 0, col.align, true, 0, "")
+		}
+		pdf.Ln(-1)
+		pdf.SetFont("Helvetica", "", 10)
+	}
+	header()
+
+	_, pageHeight := pdf.GetPageSize()
+	_, _, _, breakMargin := pdf.GetMargins()
+	for _, item := range slip.Items {
+		if pdf.GetY()+rowHeight > pageHeight-breakMargin {
+			pdf.AddPage()
+			header()
+		}
+		x, y := pdf.GetX(), pdf.GetY()
+		if item.Image != nil {
+			name, ok := images[item.MaterialTypeID]
+			if !ok {
+				name = "mt-" + item.MaterialTypeID
+				pdf.RegisterImageOptionsReader(name, fpdf.ImageOptions{ImageType: item.Image.Type}, bytes.NewReader(item.Image.Data))
+				if pdf.Err() {
+					// A broken thumbnail should not prevent printing the slip
+					pdf.ClearError()
+					name = ""
+				}
+				images[item.MaterialTypeID] = name
+			}
+			if name != "" {
+				pdf.ImageOptions(name, x+1, y+1, thumbSize, thumbSize, false, fpdf.ImageOptions{ImageType: item.Image.Type}, 0, "")
+			}
+		}
+		pdf.SetXY(x+columns[0].width, y)
+		pdf.CellFormat(columns[1].width, rowHeight, tr(item.Name), "B", 0, "L", false, 0, "")
+		pdf.CellFormat(columns[2].width, rowHeight, fmt.Sprintf("%d", item.Quantity), "B", 0, "R", false, 0, "")
+		pdf.CellFormat(columns[3].width, rowHeight, "", "B", 0, "C", false, 0, "")
+		box := 5.0
+		pdf.Rect(x+columns[0].width+columns[1].width+columns[2].width+(columns[3].width-box)/2, y+(rowHeight-box)/2, box, box, "D")
+		pdf.Line(x, y+rowHeight, x+columns[0].width, y+rowHeight)
+		pdf.SetXY(x, y+rowHeight)
+	}
+
+	// Return instructions
+	pdf.Ln(8)
+	pdf.SetFont("Helvetica", "B", 12)
+	pdf.CellFormat(contentWidth, 7, tr("Rückgabe"), "", 1, "L", false, 0, "")
+	pdf.SetFont("Helvetica", "", 10)
+	for i, line := range returnInstructions {
+		pdf.MultiCell(contentWidth, 5, tr(fmt.Sprintf("%d. %s", i+1, line)), "", "L", false)
+	}
+	return pdf.Error()
+}
@@ -0,0 +1,92 @@
+//go:build ignore
+
+// gen converts the GeoNames postal code export for Germany (DE.zip or the
+// DE.txt it contains) into the dataset embedded by package postal.
+package main
+
+import (
+	"archive/zip"
+	"bufio"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"sort"
+	"strings"
+)
+
+func main() {
+	in := flag.String("in", "DE.zip", "GeoNames export to read, DE.zip or DE.txt")
+	out := flag.String("out", "de.tsv", "dataset to write")
+	flag.Parse()
+
+	f, err := openExport(*in)
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer f.Close()
+
+	seen := map[string]bool{}
+	var lines []string
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		fields := strings.Split(scanner.Text(), "\t")
+		if len(fields) < 3 || fields[0] != "DE" {
+			continue
+		}
+		line := strings.TrimSpace(fields[1]) + "\t" + strings.TrimSpace(fields[2])
+		if !seen[line] {
+			seen[line] = true
+			lines = append(lines, line)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		log.Fatal(err)
+	}
+	sort.Strings(lines)
+
+	w, err := os.Create(*out)
+	if err != nil {
+		log.Fatal(err)
+	}
+	bw := bufio.NewWriter(w)
+	fmt.Fprintln(bw, "# German postal codes and their places, generated from GeoNames (CC BY 4.0) by gen.go")
+	fmt.Fprintln(bw, "# coverage: complete")
+	for _, line := range lines {
+		fmt.Fprintln(bw, line)
+	}
+	if err := bw.Flush(); err != nil {
+		log.Fatal(err)
+	}
+	if err := w.Close(); err != nil {
+		log.Fatal(err)
+	}
+	log.Printf("wrote %d places to %s", len(lines), *out)
+}
+
+// openExport opens DE.txt, reading it from the archive when path is a zip file
+func openExport(path string) (io.ReadCloser, error) {
+	if !strings.HasSuffix(strings.ToLower(path), ".zip") {
+		return os.Open(path)
+	}
+	archive, err := zip.OpenReader(path)
+	if err != nil {
+		return nil, err
+	}
+	for _, file := range archive.File {
+		if file.Name == "DE.txt" {
+			rc, err := file.Open()
+			if err != nil {
+				archive.Close()
+				return nil, err
+			}
+			return struct {
+				io.Reader
+				io.Closer
+			}{rc, archive}, nil
+		}
+	}
+	archive.Close()
+	return nil, fmt.Errorf("%s has no DE.txt", path)
+}
@@ -0,0 +1,134 @@
+// Package postal validates German postal codes and the city they belong to
+// against an embedded dataset.
+//
+// The dataset lists the places of each postal code. It is generated from the
+// GeoNames postal code export with gen.go, which make postal-data downloads
+// and runs:
+//
+//	curl -O https://download.geonames.org/export/zip/DE.zip
+//	go run gen.go -in DE.zip -out de.tsv
+//
+// Unless the dataset declares "# coverage: complete", codes missing from it
+// are only checked for their format and region so that addresses are never
+// rejected because of gaps in the data.
+package postal
+
+import (
+	"bufio"
+	_ "embed"
+	"errors"
+	"strings"
+	"sync"
+)
+
+//go:embed de.tsv
+var dataset string
+
+var (
+	// ErrInvalidZipCode is returned for codes that are not five digits of an assigned region
+	ErrInvalidZipCode = errors.New("invalid postal code")
+	// ErrUnknownZipCode is returned for well-formed codes missing from a complete dataset
+	ErrUnknownZipCode = errors.New("unknown postal code")
+	// ErrCityMismatch is returned when the city is not a place of the postal code
+	ErrCityMismatch = errors.New("city does not match postal code")
+)
+
+// unassignedRegions are the leading two digits no postal code starts with
+var unassignedRegions = map[string]bool{"00": true, "05": true, "43": true, "62": true}
+
+var (
+	loadOnce sync.Once
+	places   map[string][]string
+	complete bool
+)
+
+func load() {
+	places = map[string][]string{}
+	scanner := bufio.NewScanner(strings.NewReader(dataset))
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" {
+			continue
+		}
+		if strings.HasPrefix(line, "#") {
+			if strings.TrimSpace(strings.TrimPrefix(line, "#")) == "coverage: complete" {
+				complete = true
+			}
+			continue
+		}
+		zip, place, ok := strings.Cut(line, "\t")
+		if !ok {
+			continue
+		}
+		places[zip] = append(places[zip], place)
+	}
+}
+
+// NormalizeZipCode strips whitespace and a "D-" or "DE-" country prefix
+func NormalizeZipCode(zip string) string {
+	zip = strings.ToUpper(strings.Join(strings.Fields(zip), ""))
+	for _, prefix := range []string{"DE-", "D-"} {
+		if strings.HasPrefix(zip, prefix) {
+			return zip[len(prefix):]
+		}
+	}
+	return zip
+}
+
+// Places returns the places of a postal code known to the dataset
+func Places(zip string) []string {
+	loadOnce.Do(load)
+	return places[NormalizeZipCode(zip)]
+}
+
+// Validate checks that zip is a German postal code and city one of its places.
+// City names are compared ignoring case, umlaut spelling and punctuation, and
+// a city matches a place sharing its main word, so "Frankfurt" and
+// "Frankfurt a. M." both match "Frankfurt am Main".
+func Validate(zip, city string) error {
+	zip = NormalizeZipCode(zip)
+	if len(zip) != 5 || strings.Trim(zip, "0123456789") != "" || unassignedRegions[zip[:2]] {
+		return ErrInvalidZipCode
+	}
+	known := Places(zip)
+	if len(known) == 0 {
+		if complete {
+			return ErrUnknownZipCode
+		}
+		return nil
+	}
+
+	word := mainWord(city)
+	if word == "" {
+		return ErrCityMismatch
+	}
+	for _, place := range known {
+		if mainWord(place) == word {
+			return nil
+		}
+	}
+	return ErrCityMismatch
+}
+
+// namePrefixes are skipped when looking for the main word of a city name
+var namePrefixes = map[string]bool{"bad": true, "sankt": true, "st": true}
+
+var cityReplacer = strings.NewReplacer(
+	"ä", "ae", "ö", "oe", "ü", "ue", "ß", "ss",
+	"-", " ", ".", " ", ",", " ", "(", " ", ")", " ", "/", " ",
+)
+
+// mainWord returns the first word of a city name that is not a prefix like
+// "Bad", lower-cased and with umlauts spelled out
+func mainWord(city string) string {
+	words := strings.Fields(cityReplacer.Replace(strings.ToLower(city)))
+	for _, word := range words {
+		if !namePrefixes[word] {
+			return word
+		}
+	}
+	if len(words) > 0 {
+		return words[0]
+	}
+	return ""
+}
@@ -0,0 +1,65 @@
+package postal
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestValidate(t *testing.T) {
+	tests := []struct {
+		name string
+		zip  string
+		city string
+		want error
+	}{
+		{"valid pair", "20095", "Hamburg", nil},
+		{"country prefix and spaces", " D-20095 ", "Hamburg", nil},
+		{"umlaut", "80331", "München", nil},
+		{"umlaut spelled out", "80331", "Muenchen", nil},
+		{"upper case umlaut", "50667", "KÖLN", nil},
+		{"mismatched city", "20095", "Dresden", ErrCityMismatch},
+		{"empty city", "20095", "", ErrCityMismatch},
+		{"too short", "2009", "Hamburg", ErrInvalidZipCode},
+		{"letters", "2009A", "Hamburg", ErrInvalidZipCode},
+		{"unassigned region", "05123", "Hamburg", ErrInvalidZipCode},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := Validate(tt.zip, tt.city); !errors.Is(err, tt.want) {
+				t.Errorf("Validate(%q, %q) = %v, want %v", tt.zip, tt.city, err, tt.want)
+			}
+		})
+	}
+}
+
+func TestValidateUnknownZipCode(t *testing.T) {
+	loadOnce.Do(load)
+	defer func(c bool) { complete = c }(complete)
+
+	// 99999 is well-formed but not assigned
+	complete = false
+	if err := Validate("99999", "Irgendwo"); err != nil {
+		t.Errorf("unknown code with partial coverage returned %v, want nil", err)
+	}
+	complete = true
+	if err := Validate("99999", "Irgendwo"); !errors.Is(err, ErrUnknownZipCode) {
+		t.Errorf("unknown code with complete coverage returned %v, want ErrUnknownZipCode", err)
+	}
+}
+
+func TestMainWord(t *testing.T) {
+	tests := []struct {
+		a, b string
+	}{
+		{"Gießen", "Giessen"},
+		{"Göttingen", "goettingen"},
+		{"Frankfurt a. M.", "Frankfurt am Main"},
+		{"Bad Homburg v. d. Höhe", "Homburg"},
+		{"St. Ingbert", "Sankt Ingbert"},
+	}
+	for _, tt := range tests {
+		if a, b := mainWord(tt.a), mainWord(tt.b); a != b {
+			t.Errorf("mainWord(%q) = %q, mainWord(%q) = %q, want equal", tt.a, a, tt.b, b)
+		}
+	}
+}
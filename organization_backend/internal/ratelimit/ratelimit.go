@@ -0,0 +1,105 @@
+// Package ratelimit implements token bucket rate limits. Buckets live in a
+// Store, which is either in memory for a single instance or shared between
+// instances, see db.Store.TakeRateLimitToken.
+package ratelimit
+
+import (
+	"context"
+	"math"
+	"sync"
+	"time"
+)
+
+// Limit describes a token bucket: it holds up to Burst tokens and refills
+// Burst tokens every Per
+type Limit struct {
+	Burst int
+	Per   time.Duration
+}
+
+// PerMinute returns a limit of n requests per minute with bursts of up to n
+func PerMinute(n int) Limit {
+	return Limit{Burst: n, Per: time.Minute}
+}
+
+// Enabled reports whether the limit restricts anything
+func (l Limit) Enabled() bool {
+	return l.Burst > 0 && l.Per > 0
+}
+
+// Result is the outcome of taking tokens from a bucket
+type Result struct {
+	Allowed bool
+	// RetryAfter is how long until the next token is available when not allowed
+	RetryAfter time.Duration
+}
+
+// Store holds token buckets
+type Store interface {
+	// Take removes n tokens from the bucket key if available. With n == 0 it
+	// only reports whether a token is available.
+	Take(ctx context.Context, key string, limit Limit, n int) (Result, error)
+}
+
+// Refill computes the state of a bucket that had tokens elapsed ago and
+// takes n tokens from it. It returns the tokens left in the bucket, which
+// are unchanged apart from the refill when the take is not allowed.
+func (l Limit) Refill(tokens float64, elapsed time.Duration, n int) (float64, Result) {
+	rate := float64(l.Burst) / l.Per.Seconds()
+	if elapsed > 0 {
+		tokens = math.Min(float64(l.Burst), tokens+elapsed.Seconds()*rate)
+	}
+	need := math.Max(float64(n), 1)
+	if tokens >= need {
+		return tokens - float64(n), Result{Allowed: true}
+	}
+	wait := time.Duration((need - tokens) / rate * float64(time.Second))
+	return tokens, Result{RetryAfter: wait}
+}
+
+// idleBucketTTL is how long unused buckets are kept by the memory store
+const idleBucketTTL = time.Hour
+
+type bucket struct {
+	tokens  float64
+	updated time.Time
+}
+
+// Memory is a Store for a single instance
+type Memory struct {
+	mu        sync.Mutex
+	buckets   map[string]*bucket
+	lastPrune time.Time
+	now       func() time.Time
+}
+
+// NewMemory returns an empty in-memory store
+func NewMemory() *Memory {
+	return &Memory{buckets: map[string]*bucket{}, now: time.Now}
+}
+
+// Take implements Store
+func (m *Memory) Take(ctx context.Context, key string, limit Limit, n int) (Result, error) {
+	now := m.now()
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if now.Sub(m.lastPrune) > idleBucketTTL {
+		for k, b := range m.buckets {
+			if now.Sub(b.updated) > idleBucketTTL {
+				delete(m.buckets, k)
+			}
+		}
+		m.lastPrune = now
+	}
+
+	b, ok := m.buckets[key]
+	if !ok {
+		b = &bucket{tokens: float64(limit.Burst), updated: now}
+		m.buckets[key] = b
+	}
+	tokens, result := limit.Refill(b.tokens, now.Sub(b.updated), n)
+	b.tokens = tokens
+	b.updated = now
+	return result, nil
+}
@@ -0,0 +1,95 @@
+package ratelimit
+
+import (
+	"context"
+	"math"
+	"testing"
+	"time"
+)
+
+func TestLimitRefill(t *testing.T) {
+	// One token per second, up to three
+	limit := Limit{Burst: 3, Per: 3 * time.Second}
+	tests := []struct {
+		name       string
+		tokens     float64
+		elapsed    time.Duration
+		n          int
+		wantTokens float64
+		want       Result
+	}{
+		{"full bucket", 3, 0, 1, 2, Result{Allowed: true}},
+		{"last token", 1, 0, 1, 0, Result{Allowed: true}},
+		{"exhausted", 0, 0, 1, 0, Result{RetryAfter: time.Second}},
+		{"partly refilled", 0, 500 * time.Millisecond, 1, 0.5, Result{RetryAfter: 500 * time.Millisecond}},
+		{"refilled", 0, 2 * time.Second, 1, 1, Result{Allowed: true}},
+		{"refill capped at burst", 1, time.Hour, 1, 2, Result{Allowed: true}},
+		{"several tokens", 1.5, 0, 2, 1.5, Result{RetryAfter: 500 * time.Millisecond}},
+		{"peek available", 1, 0, 0, 1, Result{Allowed: true}},
+		{"peek exhausted", 0.25, 0, 0, 0.25, Result{RetryAfter: 750 * time.Millisecond}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tokens, result := limit.Refill(tt.tokens, tt.elapsed, tt.n)
+			if math.Abs(tokens-tt.wantTokens) > 1e-9 {
+				t.Errorf("tokens = %v, want %v", tokens, tt.wantTokens)
+			}
+			if result.Allowed != tt.want.Allowed || (result.RetryAfter-tt.want.RetryAfter).Abs() > time.Millisecond {
+				t.Errorf("result = %+v, want %+v", result, tt.want)
+			}
+		})
+	}
+}
+
+func TestMemoryTake(t *testing.T) {
+	ctx := context.Background()
+	now := time.Date(2031, time.May, 4, 8, 0, 0, 0, time.UTC)
+	m := NewMemory()
+	m.now = func() time.Time { return now }
+	// One token every 30 seconds, up to two
+	limit := PerMinute(2)
+
+	steps := []struct {
+		name  string
+		after time.Duration
+		key   string
+		n     int
+		want  Result
+	}{
+		{"first of burst", 0, "a", 1, Result{Allowed: true}},
+		{"second of burst", 0, "a", 1, Result{Allowed: true}},
+		{"burst exhausted", 0, "a", 1, Result{RetryAfter: 30 * time.Second}},
+		{"other key has its own bucket", 0, "b", 1, Result{Allowed: true}},
+		{"half refilled", 15 * time.Second, "a", 1, Result{RetryAfter: 15 * time.Second}},
+		{"peek before refill", 0, "a", 0, Result{RetryAfter: 15 * time.Second}},
+		{"peek after refill", 15 * time.Second, "a", 0, Result{Allowed: true}},
+		{"peek takes nothing", 0, "a", 1, Result{Allowed: true}},
+		{"exhausted again", 0, "a", 1, Result{RetryAfter: 30 * time.Second}},
+		{"idle bucket is full", 2 * time.Hour, "a", 2, Result{Allowed: true}},
+	}
+	for _, step := range steps {
+		now = now.Add(step.after)
+		got, err := m.Take(ctx, step.key, limit, step.n)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got.Allowed != step.want.Allowed || (got.RetryAfter-step.want.RetryAfter).Abs() > time.Millisecond {
+			t.Errorf("%s: Take = %+v, want %+v", step.name, got, step.want)
+		}
+	}
+}
+
+func TestLimitEnabled(t *testing.T) {
+	for _, tt := range []struct {
+		limit Limit
+		want  bool
+	}{
+		{PerMinute(10), true},
+		{PerMinute(0), false},
+		{Limit{Burst: 5}, false},
+	} {
+		if got := tt.limit.Enabled(); got != tt.want {
+			t.Errorf("%+v.Enabled() = %t, want %t", tt.limit, got, tt.want)
+		}
+	}
+}
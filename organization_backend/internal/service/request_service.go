@@ -6,15 +6,18 @@ import (
 	"strings"
 	"time"
 
+	"github.com/google/uuid"
+
 	"organization_backend/internal/db"
 	"organization_backend/internal/domain"
+	"organization_backend/internal/postal"
 )
 
 type RequestService struct {
-	store *db.Store
+	store db.RequestRepository
 }
 
-func NewRequestService(store *db.Store) *RequestService {
+func NewRequestService(store db.RequestRepository) *RequestService {
 	return &RequestService{store: store}
 }
 
@@ -23,12 +26,23 @@ type CreateRequestPayload struct {
 	CustomerEmail        string         `json:"customerEmail"`
 	CustomerName         string         `json:"customerName"`
 	CustomerToken        string         `json:"customerToken"`
+	SchoolID             string         `json:"schoolId"`
 	DeliveryDate         time.Time      `json:"deliveryDate"`
+	ReturnDate           *time.Time     `json:"returnDate"`
 	Status               string         `json:"status"`
 	ShippingCustomerName string         `json:"shippingCustomerName"`
 	ShippingAddress      AddressPayload `json:"shippingAddress"`
-	Items                map[string]int `json:"items"`
-	Metadata             map[string]any `json:"metadata"`
+	// ShippingAddressID selects a saved address instead of ShippingAddress
+	ShippingAddressID string         `json:"shippingAddressId"`
+	Items             map[string]int `json:"items"`
+	Kits              []KitPayload   `json:"kits"`
+	Metadata          map[string]any `json:"metadata"`
+}
+
+// KitPayload adds a kit to a request. ClassSize defaults to the kit's default class size.
+type KitPayload struct {
+	KitID     string `json:"kitId"`
+	ClassSize int    `json:"classSize"`
 }
 
 type AddressPayload struct {
@@ -62,21 +76,54 @@ func (s *RequestService) CreateRequest(ctx context.Context, payload CreateReques
 		status = "pending"
 	}
 
-	return s.store.CreateRequest(ctx, db.CreateRequestInput{
+	kits := make([]domain.RequestKit, 0, len(payload.Kits))
+	for _, kit := range payload.Kits {
+		kits = append(kits, domain.RequestKit{KitID: strings.TrimSpace(kit.KitID), ClassSize: kit.ClassSize})
+	}
+
+	req, err := s.store.CreateRequest(ctx, db.CreateRequestInput{
 		CustomerID:           payload.CustomerID,
 		CustomerEmail:        payload.CustomerEmail,
 		CustomerName:         payload.CustomerName,
 		CustomerToken:        payload.CustomerToken,
+		SchoolID:             payload.SchoolID,
 		DeliveryDate:         payload.DeliveryDate,
+		ReturnDate:           payload.ReturnDate,
 		Status:               status,
 		ShippingCustomerName: payload.ShippingCustomerName,
 		ShippingAddressLine1: payload.ShippingAddress.Line1,
 		ShippingAddressLine2: payload.ShippingAddress.Line2,
 		ShippingCity:         payload.ShippingAddress.City,
-		ShippingZipCode:      payload.ShippingAddress.ZipCode,
+		ShippingZipCode:      postal.NormalizeZipCode(payload.ShippingAddress.ZipCode),
+		ShippingAddressID:    payload.ShippingAddressID,
 		Items:                payload.Items,
+		Kits:                 kits,
 		Metadata:             payload.Metadata,
 	})
+	if errors.Is(err, db.ErrNotSchoolMember) {
+		return domain.Request{}, ValidationErrors{Errors: []ValidationError{{Field: "schoolId", Message: "not a member of this school"}}}
+	}
+	if errors.Is(err, db.ErrSchoolRequired) {
+		return domain.Request{}, ValidationErrors{Errors: []ValidationError{{Field: "schoolId", Message: "required for members of several schools"}}}
+	}
+	if errors.Is(err, db.ErrAddressNotFound) {
+		return domain.Request{}, ValidationErrors{Errors: []ValidationError{{Field: "shippingAddressId", Message: "address not found"}}}
+	}
+	if errors.Is(err, db.ErrAddressSchoolMismatch) {
+		return domain.Request{}, ValidationErrors{Errors: []ValidationError{{Field: "shippingAddressId", Message: "address belongs to another school"}}}
+	}
+	if errors.Is(err, db.ErrKitNotFound) {
+		return domain.Request{}, ValidationErrors{Errors: []ValidationError{{Field: "kits", Message: "kit not found"}}}
+	}
+	var unavailable db.UnavailableMaterialTypesError
+	if errors.As(err, &unavailable) {
+		validation = make([]ValidationError, 0, len(unavailable.IDs))
+		for _, id := range unavailable.IDs {
+			validation = append(validation, ValidationError{Field: "items." + id, Message: "material type not available"})
+		}
+		return domain.Request{}, ValidationErrors{Errors: validation}
+	}
+	return req, err
 }
 
 func (s *RequestService) GetRequestByID(ctx context.Context, id string) (domain.Request, error) {
@@ -90,6 +137,31 @@ func (s *RequestService) ListRequests(ctx context.Context, params db.ListRequest
 	return s.store.ListRequests(ctx, params)
 }
 
+// ValidateAddress checks the required fields of an address and that the
+// postal code exists and matches the city. Field names are prefixed with prefix.
+func ValidateAddress(prefix, line1, city, zipCode string) []ValidationError {
+	var errorsOut []ValidationError
+	if strings.TrimSpace(line1) == "" {
+		errorsOut = append(errorsOut, ValidationError{Field: prefix + ".line1", Message: "required"})
+	}
+	if strings.TrimSpace(city) == "" {
+		errorsOut = append(errorsOut, ValidationError{Field: prefix + ".city", Message: "required"})
+	}
+	if strings.TrimSpace(zipCode) == "" {
+		errorsOut = append(errorsOut, ValidationError{Field: prefix + ".zipCode", Message: "required"})
+	}
+	if len(errorsOut) > 0 {
+		return errorsOut
+	}
+	switch err := postal.Validate(zipCode, city); {
+	case errors.Is(err, postal.ErrCityMismatch):
+		errorsOut = append(errorsOut, ValidationError{Field: prefix + ".city", Message: "does not match zipCode"})
+	case err != nil:
+		errorsOut = append(errorsOut, ValidationError{Field: prefix + ".zipCode", Message: "not a valid German postal code"})
+	}
+	return errorsOut
+}
+
 func validateCreate(payload CreateRequestPayload) []ValidationError {
 	var errorsOut []ValidationError
 	if payload.Status != "" {
@@ -108,20 +180,43 @@ func validateCreate(payload CreateRequestPayload) []ValidationError {
 	if payload.ShippingCustomerName == "" {
 		errorsOut = append(errorsOut, ValidationError{Field: "shippingCustomerName", Message: "required"})
 	}
-	if payload.ShippingAddress.Line1 == "" {
-		errorsOut = append(errorsOut, ValidationError{Field: "shippingAddress.line1", Message: "required"})
-	}
-	if payload.ShippingAddress.City == "" {
-		errorsOut = append(errorsOut, ValidationError{Field: "shippingAddress.city", Message: "required"})
+	if payload.SchoolID != "" {
+		if _, err := uuid.Parse(payload.SchoolID); err != nil {
+			errorsOut = append(errorsOut, ValidationError{Field: "schoolId", Message: "not a member of this school"})
+		}
 	}
-	if payload.ShippingAddress.ZipCode == "" {
-		errorsOut = append(errorsOut, ValidationError{Field: "shippingAddress.zipCode", Message: "required"})
+	if payload.ShippingAddressID != "" {
+		if _, err := uuid.Parse(payload.ShippingAddressID); err != nil {
+			errorsOut = append(errorsOut, ValidationError{Field: "shippingAddressId", Message: "address not found"})
+		}
+	} else {
+		errorsOut = append(errorsOut, ValidateAddress("shippingAddress", payload.ShippingAddress.Line1, payload.ShippingAddress.City, payload.ShippingAddress.ZipCode)...)
 	}
 	if payload.DeliveryDate.IsZero() {
 		errorsOut = append(errorsOut, ValidationError{Field: "deliveryDate", Message: "required"})
 	}
-	if len(payload.Items) == 0 {
-		errorsOut = append(errorsOut, ValidationError{Field: "items", Message: "at least one item required"})
+	if payload.ReturnDate != nil && payload.ReturnDate.Before(payload.DeliveryDate) {
+		errorsOut = append(errorsOut, ValidationError{Field: "returnDate", Message: "must not be before deliveryDate"})
+	}
+	if len(payload.Items) == 0 && len(payload.Kits) == 0 {
+		errorsOut = append(errorsOut, ValidationError{Field: "items", Message: "at least one item or kit required"})
+	}
+	seenKits := map[string]bool{}
+	for _, kit := range payload.Kits {
+		kitID := strings.TrimSpace(kit.KitID)
+		if kitID == "" {
+			errorsOut = append(errorsOut, ValidationError{Field: "kits", Message: "kitId required"})
+			break
+		}
+		if seenKits[kitID] {
+			errorsOut = append(errorsOut, ValidationError{Field: "kits", Message: "kit listed more than once"})
+			break
+		}
+		seenKits[kitID] = true
+		if kit.ClassSize < 0 {
+			errorsOut = append(errorsOut, ValidationError{Field: "kits", Message: "classSize must not be negative"})
+			break
+		}
 	}
 	for materialID, qty := range payload.Items {
 		if strings.TrimSpace(materialID) == "" {
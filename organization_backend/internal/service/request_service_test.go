@@ -0,0 +1,88 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"organization_backend/internal/db"
+	"organization_backend/internal/domain"
+)
+
+func TestCreateRequest(t *testing.T) {
+	ctx := context.Background()
+	store := db.NewMemoryStore(nil)
+	if _, err := store.CreateMaterialType(ctx, "mikroskop", domain.CreateMaterialTypeInput{Name: "Mikroskop"}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := store.CreateMaterialType(ctx, "globus", domain.CreateMaterialTypeInput{Name: "Globus"}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := store.ArchiveMaterialType(ctx, "globus"); err != nil {
+		t.Fatal(err)
+	}
+	s := NewRequestService(store)
+
+	payload := func(items map[string]int) CreateRequestPayload {
+		return CreateRequestPayload{
+			CustomerEmail:        "lehrerin@example.org",
+			CustomerName:         "Erika Mustermann",
+			DeliveryDate:         time.Date(2031, time.May, 4, 8, 0, 0, 0, time.UTC),
+			ShippingCustomerName: "Grundschule am Park",
+			ShippingAddress:      AddressPayload{Line1: "Parkweg 3", City: "Hamburg", ZipCode: "20095"},
+			Items:                items,
+		}
+	}
+
+	req, err := s.CreateRequest(ctx, payload(map[string]int{"mikroskop": 2}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if req.Status != "pending" || req.Items["mikroskop"] != 2 {
+		t.Errorf("request has status %q and items %v, want pending with 2 mikroskop", req.Status, req.Items)
+	}
+	got, err := s.GetRequestByID(ctx, req.ID)
+	if err != nil || got.ID != req.ID {
+		t.Errorf("GetRequestByID = %s, %v, want %s", got.ID, err, req.ID)
+	}
+
+	tests := []struct {
+		name   string
+		items  map[string]int
+		kits   []KitPayload
+		school string
+		want   []ValidationError
+	}{
+		{"archived material type", map[string]int{"mikroskop": 1, "globus": 1}, nil, "",
+			[]ValidationError{{Field: "items.globus", Message: "material type not available"}}},
+		{"unknown material type", map[string]int{"teleskop": 1}, nil, "",
+			[]ValidationError{{Field: "items.teleskop", Message: "material type not available"}}},
+		{"unknown kit", nil, []KitPayload{{KitID: "sternwarte"}}, "",
+			[]ValidationError{{Field: "kits", Message: "kit not found"}}},
+		{"no items", nil, nil, "",
+			[]ValidationError{{Field: "items", Message: "at least one item or kit required"}}},
+		{"malformed school", map[string]int{"mikroskop": 1}, nil, "grundschule",
+			[]ValidationError{{Field: "schoolId", Message: "not a member of this school"}}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p := payload(tt.items)
+			p.Kits = tt.kits
+			p.SchoolID = tt.school
+			_, err := s.CreateRequest(ctx, p)
+			var validation ValidationErrors
+			if !errors.As(err, &validation) {
+				t.Fatalf("got %v, want validation errors", err)
+			}
+			if len(validation.Errors) != len(tt.want) {
+				t.Fatalf("got %v, want %v", validation.Errors, tt.want)
+			}
+			for i := range tt.want {
+				if validation.Errors[i] != tt.want[i] {
+					t.Errorf("error %d = %v, want %v", i, validation.Errors[i], tt.want[i])
+				}
+			}
+		})
+	}
+}
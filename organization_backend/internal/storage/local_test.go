@@ -0,0 +1,77 @@
+package storage
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestLocal(t *testing.T) {
+	s, err := NewLocal(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	testDriver(t, s)
+}
+
+func TestLocalStaysInRoot(t *testing.T) {
+	ctx := context.Background()
+	parent := t.TempDir()
+	root := filepath.Join(parent, "uploads")
+	s, err := NewLocal(root)
+	if err != nil {
+		t.Fatal(err)
+	}
+	outside := filepath.Join(parent, "secret.txt")
+	if err := os.WriteFile(outside, []byte("secret"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, key := range []string{"../secret.txt", "images/../../secret.txt", "./secret.txt"} {
+		if err := s.Put(ctx, key, strings.NewReader("x"), 1, "text/plain"); err == nil {
+			t.Errorf("Put(%q) was accepted", key)
+		}
+		if err := s.Delete(ctx, key); err == nil {
+			t.Errorf("Delete(%q) was accepted", key)
+		}
+		if _, err := s.Stat(ctx, key); err == nil {
+			t.Errorf("Stat(%q) found an object", key)
+		}
+	}
+	if data, err := os.ReadFile(outside); err != nil || string(data) != "secret" {
+		t.Errorf("file outside the root = %q, %v, want it untouched", data, err)
+	}
+
+	// A leading slash is not an absolute path
+	if err := s.Put(ctx, "/images/a.png", strings.NewReader("png"), 3, "image/png"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(filepath.Join(root, "images", "a.png")); err != nil {
+		t.Errorf("key with a leading slash was not stored below the root: %v", err)
+	}
+}
+
+func TestLocalKeyFromURL(t *testing.T) {
+	s := &Local{root: t.TempDir()}
+	tests := []struct {
+		url  string
+		key  string
+		want bool
+	}{
+		{"/uploads/images/a/original.png", "images/a/original.png", true},
+		{"/uploads/", "", false},
+		{"/static/images/a.png", "", false},
+		{"https://cdn.example.org/uploads/a.png", "", false},
+	}
+	for _, tt := range tests {
+		key, ok := s.KeyFromURL(tt.url)
+		if key != tt.key || ok != tt.want {
+			t.Errorf("KeyFromURL(%q) = %q, %t, want %q, %t", tt.url, key, ok, tt.key, tt.want)
+		}
+	}
+	if got := s.PublicURL("images/a.png"); got != "/uploads/images/a.png" {
+		t.Errorf("PublicURL = %q, want /uploads/images/a.png", got)
+	}
+}
@@ -0,0 +1,221 @@
+package storage
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestS3(t *testing.T) {
+	server := httptest.NewServer(newFakeS3())
+	t.Cleanup(server.Close)
+	s, err := NewS3(context.Background(), S3Config{
+		Endpoint:        strings.TrimPrefix(server.URL, "http://"),
+		Region:          "us-east-1",
+		Bucket:          "uploads",
+		AccessKeyID:     "test",
+		SecretAccessKey: "testtesttest",
+		PublicURL:       "https://cdn.example.org/files/",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	testDriver(t, s)
+
+	for url, want := range map[string]string{
+		"https://cdn.example.org/files/images/a.png": "images/a.png",
+		"/uploads/images/a.png":                      "images/a.png",
+	} {
+		if key, ok := s.KeyFromURL(url); !ok || key != want {
+			t.Errorf("KeyFromURL(%q) = %q, %t, want %q", url, key, ok, want)
+		}
+	}
+	if got := s.PublicURL("images/a.png"); got != "https://cdn.example.org/files/images/a.png" {
+		t.Errorf("PublicURL = %q, want the CDN URL", got)
+	}
+
+	presigned, err := s.PresignedURL(context.Background(), "images/a.png", time.Minute)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(presigned, server.URL+"/uploads/images/a.png?") || !strings.Contains(presigned, "X-Amz-Signature=") {
+		t.Errorf("PresignedURL = %q, want a signed URL of the object", presigned)
+	}
+}
+
+// TestS3Server runs the driver tests against the S3-compatible server in
+// TEST_S3_ENDPOINT, e.g. a MinIO container. The bucket is created when it
+// does not exist, and the tests only touch keys below a unique prefix.
+func TestS3Server(t *testing.T) {
+	endpoint := os.Getenv("TEST_S3_ENDPOINT")
+	if endpoint == "" {
+		t.Skip("TEST_S3_ENDPOINT is not set")
+	}
+	bucket := os.Getenv("TEST_S3_BUCKET")
+	if bucket == "" {
+		bucket = "storage-test"
+	}
+	s, err := NewS3(context.Background(), S3Config{
+		Endpoint:        endpoint,
+		Region:          os.Getenv("TEST_S3_REGION"),
+		Bucket:          bucket,
+		AccessKeyID:     os.Getenv("TEST_S3_ACCESS_KEY"),
+		SecretAccessKey: os.Getenv("TEST_S3_SECRET_KEY"),
+		UseSSL:          os.Getenv("TEST_S3_USE_SSL") == "true",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	testDriver(t, s)
+}
+
+// fakeS3 serves the path-style bucket and object requests the driver makes,
+// without checking signatures
+type fakeS3 struct {
+	mu      sync.Mutex
+	buckets map[string]map[string]fakeObject
+}
+
+type fakeObject struct {
+	data        []byte
+	contentType string
+	modified    time.Time
+}
+
+func newFakeS3() *fakeS3 {
+	return &fakeS3{buckets: map[string]map[string]fakeObject{}}
+}
+
+func (f *fakeS3) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	bucket, key, _ := strings.Cut(strings.TrimPrefix(r.URL.Path, "/"), "/")
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	objects, exists := f.buckets[bucket]
+
+	switch {
+	case key == "" && r.Method == http.MethodPut:
+		if !exists {
+			f.buckets[bucket] = map[string]fakeObject{}
+		}
+	case !exists:
+		writeS3Error(w, r, http.StatusNotFound, "NoSuchBucket")
+	case key == "" && r.Method == http.MethodHead:
+	case key == "" && r.Method == http.MethodGet:
+		f.list(w, bucket, objects, r.URL.Query().Get("prefix"))
+	case r.Method == http.MethodPut:
+		data, err := readPayload(r)
+		if err != nil {
+			writeS3Error(w, r, http.StatusBadRequest, "IncompleteBody")
+			return
+		}
+		objects[key] = fakeObject{data: data, contentType: r.Header.Get("Content-Type"), modified: time.Now().UTC()}
+		w.Header().Set("ETag", etag(data))
+	case r.Method == http.MethodGet || r.Method == http.MethodHead:
+		obj, ok := objects[key]
+		if !ok {
+			writeS3Error(w, r, http.StatusNotFound, "NoSuchKey")
+			return
+		}
+		w.Header().Set("Content-Type", obj.contentType)
+		w.Header().Set("Content-Length", strconv.Itoa(len(obj.data)))
+		w.Header().Set("Last-Modified", obj.modified.Format(http.TimeFormat))
+		w.Header().Set("ETag", etag(obj.data))
+		if r.Method == http.MethodGet {
+			w.Write(obj.data)
+		}
+	case r.Method == http.MethodDelete:
+		delete(objects, key)
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		writeS3Error(w, r, http.StatusNotImplemented, "NotImplemented")
+	}
+}
+
+func (f *fakeS3) list(w http.ResponseWriter, bucket string, objects map[string]fakeObject, prefix string) {
+	type content struct {
+		Key          string
+		LastModified string
+		ETag         string
+		Size         int
+		StorageClass string
+	}
+	result := struct {
+		XMLName     xml.Name `xml:"http://s3.amazonaws.com/doc/2006-03-01/ ListBucketResult"`
+		Name        string
+		Prefix      string
+		KeyCount    int
+		MaxKeys     int
+		IsTruncated bool
+		Contents    []content
+	}{Name: bucket, Prefix: prefix, MaxKeys: 1000}
+	for key, obj := range objects {
+		if strings.HasPrefix(key, prefix) {
+			result.Contents = append(result.Contents, content{
+				Key:          key,
+				LastModified: obj.modified.Format("2006-01-02T15:04:05.000Z"),
+				ETag:         etag(obj.data),
+				Size:         len(obj.data),
+				StorageClass: "STANDARD",
+			})
+		}
+	}
+	sort.Slice(result.Contents, func(i, j int) bool { return result.Contents[i].Key < result.Contents[j].Key })
+	result.KeyCount = len(result.Contents)
+	w.Header().Set("Content-Type", "application/xml")
+	xml.NewEncoder(w).Encode(result)
+}
+
+func writeS3Error(w http.ResponseWriter, r *http.Request, status int, code string) {
+	w.Header().Set("Content-Type", "application/xml")
+	w.WriteHeader(status)
+	if r.Method != http.MethodHead {
+		fmt.Fprintf(w, "<Error><Code>%s</Code><Message>%s</Message><Resource>%s</Resource><RequestId>fake</RequestId></Error>",
+			code, code, r.URL.Path)
+	}
+}
+
+func etag(data []byte) string {
+	return fmt.Sprintf("%q", fmt.Sprintf("%x", len(data)))
+}
+
+// readPayload returns the object data of a PUT, decoding the aws-chunked
+// encoding clients use for streaming signatures
+func readPayload(r *http.Request) ([]byte, error) {
+	if !strings.HasPrefix(r.Header.Get("X-Amz-Content-Sha256"), "STREAMING-") {
+		return io.ReadAll(r.Body)
+	}
+	var data bytes.Buffer
+	reader := bufio.NewReader(r.Body)
+	for {
+		header, err := reader.ReadString('\n')
+		if err != nil {
+			return nil, err
+		}
+		sizeHex, _, _ := strings.Cut(strings.TrimSpace(header), ";")
+		size, err := strconv.ParseInt(sizeHex, 16, 64)
+		if err != nil {
+			return nil, err
+		}
+		if size == 0 {
+			return data.Bytes(), nil
+		}
+		if _, err := io.CopyN(&data, reader, size); err != nil {
+			return nil, err
+		}
+		if _, err := reader.Discard(2); err != nil {
+			return nil, err
+		}
+	}
+}
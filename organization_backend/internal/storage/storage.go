@@ -0,0 +1,122 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+)
+
+// ErrNotFound is returned when an object does not exist
+var ErrNotFound = errors.New("object not found")
+
+// ObjectInfo describes a stored object
+type ObjectInfo struct {
+	Key          string
+	Size         int64
+	ContentType  string
+	LastModified time.Time
+}
+
+// Storage stores uploaded files as blobs addressed by slash-separated keys
+type Storage interface {
+	Put(ctx context.Context, key string, r io.Reader, size int64, contentType string) error
+	Get(ctx context.Context, key string) (io.ReadCloser, ObjectInfo, error)
+	// Stat describes an object without reading it
+	Stat(ctx context.Context, key string) (ObjectInfo, error)
+	Delete(ctx context.Context, key string) error
+	// DeletePrefix removes every object whose key starts with prefix
+	DeletePrefix(ctx context.Context, prefix string) error
+	List(ctx context.Context, prefix string) ([]ObjectInfo, error)
+	// PresignedURL returns a time-limited direct download URL, or an empty
+	// string when the driver has no direct download support
+	PresignedURL(ctx context.Context, key string, expiry time.Duration) (string, error)
+	// PublicURL returns the URL stored in the database for a key
+	PublicURL(key string) string
+	// KeyFromURL reverses PublicURL
+	KeyFromURL(url string) (string, bool)
+}
+
+// Config selects and configures a storage driver
+type Config struct {
+	// Driver is "local" (default) or "s3"
+	Driver    string
+	LocalPath string
+	S3        S3Config
+	// PresignExpiry enables redirects to presigned download URLs for drivers
+	// that support them; zero streams files through the API instead
+	PresignExpiry time.Duration
+}
+
+// LocalRoot returns the directory the local driver stores files in, or an
+// empty string when cfg selects another driver
+func (cfg Config) LocalRoot() string {
+	switch cfg.Driver {
+	case "", "local":
+		if cfg.LocalPath == "" {
+			return "uploads"
+		}
+		return cfg.LocalPath
+	default:
+		return ""
+	}
+}
+
+// New creates the storage driver selected by cfg
+func New(ctx context.Context, cfg Config) (Storage, error) {
+	switch cfg.Driver {
+	case "", "local":
+		return NewLocal(cfg.LocalRoot())
+	case "s3":
+		return NewS3(ctx, cfg.S3)
+	default:
+		return nil, fmt.Errorf("unknown storage driver %q", cfg.Driver)
+	}
+}
+
+// probePrefix holds the objects written by Probe
+const probePrefix = "healthcheck/"
+
+// Probe checks that s accepts writes by storing and removing a small object
+func Probe(ctx context.Context, s Storage) error {
+	key := fmt.Sprintf("%sprobe-%d", probePrefix, time.Now().UnixNano())
+	if err := s.Put(ctx, key, strings.NewReader("ok"), 2, "text/plain"); err != nil {
+		return fmt.Errorf("write probe: %w", err)
+	}
+	if err := s.Delete(ctx, key); err != nil {
+		return fmt.Errorf("delete probe: %w", err)
+	}
+	return nil
+}
+
+// UploadsURLPrefix is the path under which the server exposes stored files
+const UploadsURLPrefix = "/uploads/"
+
+// keyFromURL strips any of the given prefixes from url
+func keyFromURL(url string, prefixes ...string) (string, bool) {
+	for _, prefix := range prefixes {
+		if prefix == "" {
+			continue
+		}
+		if key, ok := strings.CutPrefix(url, prefix); ok && key != "" {
+			return key, true
+		}
+	}
+	return "", false
+}
+
+// cleanKey rejects keys that could escape the storage root
+func cleanKey(key string) (string, error) {
+	key = strings.TrimPrefix(key, "/")
+	if key == "" {
+		return "", errors.New("empty key")
+	}
+	for _, part := range strings.Split(key, "/") {
+		if part == "" || part == "." || part == ".." {
+			return "", errors.New("invalid key")
+		}
+	}
+	return key, nil
+}
@@ -0,0 +1,112 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"io"
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/google/uuid"
+)
+
+// testDriver runs the behaviour every driver shares. Keys are written below
+// a unique prefix, so s may hold other objects.
+func testDriver(t *testing.T, s Storage) {
+	ctx := context.Background()
+	prefix := "test-" + uuid.NewString()[:8] + "/"
+	put := func(key, content, contentType string) {
+		t.Helper()
+		if err := s.Put(ctx, key, strings.NewReader(content), int64(len(content)), contentType); err != nil {
+			t.Fatalf("Put(%s): %v", key, err)
+		}
+	}
+	original := prefix + "images/a/original.png"
+	thumb := prefix + "images/a/thumb.webp"
+	slip := prefix + "slips/2031-05.pdf"
+	put(original, "first", "image/png")
+	put(original, "png data", "image/png")
+	put(thumb, "webp", "image/webp")
+	put(slip, "pdf", "application/pdf")
+
+	body, info, err := s.Get(ctx, original)
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, err := io.ReadAll(body)
+	body.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(data) != "png data" || info.Size != 8 || info.ContentType != "image/png" {
+		t.Errorf("Get(%s) = %q, %+v, want the overwritten png data", original, data, info)
+	}
+	if info, err := s.Stat(ctx, thumb); err != nil || info.Size != 4 {
+		t.Errorf("Stat(%s) = %+v, %v, want 4 bytes", thumb, info, err)
+	}
+
+	missing := prefix + "images/missing.png"
+	if _, _, err := s.Get(ctx, missing); !errors.Is(err, ErrNotFound) {
+		t.Errorf("Get of a missing object returned %v, want ErrNotFound", err)
+	}
+	if _, err := s.Stat(ctx, missing); !errors.Is(err, ErrNotFound) {
+		t.Errorf("Stat of a missing object returned %v, want ErrNotFound", err)
+	}
+
+	if keys := listKeys(t, s, prefix+"images/"); len(keys) != 2 || keys[0] != original || keys[1] != thumb {
+		t.Errorf("List(images/) = %v, want %s and %s", keys, original, thumb)
+	}
+	if keys := listKeys(t, s, prefix); len(keys) != 3 {
+		t.Errorf("List(%s) = %v, want 3 keys", prefix, keys)
+	}
+
+	if key, ok := s.KeyFromURL(s.PublicURL(original)); !ok || key != original {
+		t.Errorf("KeyFromURL(PublicURL(%s)) = %q, %t", original, key, ok)
+	}
+	if _, ok := s.KeyFromURL("https://elsewhere.example.org/image.png"); ok {
+		t.Error("KeyFromURL accepted a foreign URL")
+	}
+
+	for _, key := range []string{"../escape.txt", prefix + "../../escape.txt", prefix + "a//b", ""} {
+		if err := s.Put(ctx, key, strings.NewReader("x"), 1, "text/plain"); err == nil {
+			t.Errorf("Put(%q) was accepted", key)
+		}
+		if _, _, err := s.Get(ctx, key); !errors.Is(err, ErrNotFound) {
+			t.Errorf("Get(%q) returned %v, want ErrNotFound", key, err)
+		}
+	}
+
+	if err := s.Delete(ctx, thumb); err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err := s.Get(ctx, thumb); !errors.Is(err, ErrNotFound) {
+		t.Errorf("Get of a deleted object returned %v, want ErrNotFound", err)
+	}
+	if err := s.Delete(ctx, thumb); err != nil {
+		t.Errorf("deleting a missing object returned %v", err)
+	}
+	if err := s.DeletePrefix(ctx, prefix+"images/"); err != nil {
+		t.Fatal(err)
+	}
+	if keys := listKeys(t, s, prefix); len(keys) != 1 || keys[0] != slip {
+		t.Errorf("after DeletePrefix(images/) List = %v, want only %s", keys, slip)
+	}
+	if err := s.Delete(ctx, slip); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func listKeys(t *testing.T, s Storage, prefix string) []string {
+	t.Helper()
+	objects, err := s.List(context.Background(), prefix)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keys := make([]string, 0, len(objects))
+	for _, obj := range objects {
+		keys = append(keys, obj.Key)
+	}
+	sort.Strings(keys)
+	return keys
+}
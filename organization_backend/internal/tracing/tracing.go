@@ -0,0 +1,125 @@
+// Package tracing sets up OpenTelemetry. Init installs the W3C trace context
+// propagator and, unless tracing is disabled, a tracer provider exporting
+// batches of spans to stdout or to an OTLP/HTTP collector. Code creates spans
+// with Tracer and the otel API, so standard instrumentation such as otelhttp
+// records into the same traces. Without a provider spans are not recorded,
+// but incoming trace context is still passed on.
+package tracing
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"os"
+	"strings"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/exporters/stdout/stdouttrace"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// scopeName is reported as the instrumentation scope of our own spans
+const scopeName = "organization_backend"
+
+// Config selects how spans are sampled and exported
+type Config struct {
+	// Exporter is "none", "stdout" or "otlp"
+	Exporter string
+	// Endpoint is the OTLP/HTTP traces URL, e.g. http://localhost:4318/v1/traces
+	Endpoint string
+	// Headers are sent with every OTLP export, e.g. for authentication
+	Headers map[string]string
+	// ServiceName is reported as the service.name resource attribute
+	ServiceName string
+	// SampleRatio is the share of new traces that are recorded; traces
+	// started by callers follow the caller's decision
+	SampleRatio float64
+}
+
+// Init installs the global propagator and tracer provider. The returned
+// function flushes queued spans and stops the provider.
+func Init(cfg Config) (func(context.Context) error, error) {
+	otel.SetTextMapPropagator(propagation.NewCompositeTextMapPropagator(
+		propagation.TraceContext{}, propagation.Baggage{},
+	))
+
+	var exporter sdktrace.SpanExporter
+	var err error
+	switch cfg.Exporter {
+	case "none":
+		return func(context.Context) error { return nil }, nil
+	case "stdout":
+		exporter, err = stdouttrace.New(stdouttrace.WithWriter(os.Stdout))
+	case "otlp":
+		if cfg.Endpoint == "" {
+			return nil, fmt.Errorf("tracing: otlp exporter needs an endpoint")
+		}
+		exporter, err = otlptracehttp.New(context.Background(),
+			otlptracehttp.WithEndpointURL(cfg.Endpoint),
+			otlptracehttp.WithHeaders(cfg.Headers),
+		)
+	default:
+		return nil, fmt.Errorf("tracing: unknown exporter %q", cfg.Exporter)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("tracing: %w", err)
+	}
+
+	res, err := resource.Merge(resource.Default(), resource.NewSchemaless(
+		attribute.String("service.name", cfg.ServiceName),
+	))
+	if err != nil {
+		return nil, fmt.Errorf("tracing: %w", err)
+	}
+	provider := sdktrace.NewTracerProvider(
+		sdktrace.WithBatcher(exporter),
+		sdktrace.WithResource(res),
+		sdktrace.WithSampler(sdktrace.ParentBased(sdktrace.TraceIDRatioBased(cfg.SampleRatio))),
+	)
+	otel.SetTracerProvider(provider)
+	otel.SetErrorHandler(otel.ErrorHandlerFunc(func(err error) {
+		slog.Warn("tracing failed", "error", err)
+	}))
+	return provider.Shutdown, nil
+}
+
+// Tracer returns the tracer of the global provider for our own spans
+func Tracer() trace.Tracer {
+	return otel.Tracer(scopeName)
+}
+
+// RecordError records err on span and marks the span as failed
+func RecordError(span trace.Span, err error) {
+	if err == nil {
+		return
+	}
+	span.RecordError(err)
+	span.SetStatus(codes.Error, err.Error())
+}
+
+// TraceIDFromContext returns the hex trace ID of ctx, or "" without one
+func TraceIDFromContext(ctx context.Context) string {
+	if sc := trace.SpanContextFromContext(ctx); sc.HasTraceID() {
+		return sc.TraceID().String()
+	}
+	return ""
+}
+
+// ParseHeaders parses OTLP headers given as key=value pairs
+func ParseHeaders(pairs []string) (map[string]string, error) {
+	headers := make(map[string]string, len(pairs))
+	for _, pair := range pairs {
+		key, value, ok := strings.Cut(pair, "=")
+		if !ok || strings.TrimSpace(key) == "" {
+			return nil, fmt.Errorf("header %q is not key=value", pair)
+		}
+		headers[strings.TrimSpace(key)] = strings.TrimSpace(value)
+	}
+	return headers, nil
+}
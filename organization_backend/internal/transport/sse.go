@@ -3,9 +3,13 @@ package transport
 import (
 	"fmt"
 	"net/http"
+	"time"
 )
 
-func Stream(w http.ResponseWriter, r *http.Request, events <-chan []byte) {
+// Stream writes events to w until the request ends or events is closed.
+// While idle a comment is sent every heartbeat so that proxies do not close
+// the connection; zero disables heartbeats.
+func Stream(w http.ResponseWriter, r *http.Request, events <-chan []byte, heartbeat time.Duration) {
 	w.Header().Set("Content-Type", "text/event-stream")
 	w.Header().Set("Cache-Control", "no-cache")
 	w.Header().Set("Connection", "keep-alive")
@@ -16,11 +20,21 @@ func Stream(w http.ResponseWriter, r *http.Request, events <-chan []byte) {
 		return
 	}
 
+	var ping <-chan time.Time
+	if heartbeat > 0 {
+		ticker := time.NewTicker(heartbeat)
+		defer ticker.Stop()
+		ping = ticker.C
+	}
+
 	flusher.Flush()
 	for {
 		select {
 		case <-r.Context().Done():
 			return
+		case <-ping:
+			fmt.Fprint(w, ": ping\n\n")
+			flusher.Flush()
 		case payload, ok := <-events:
 			if !ok {
 				return
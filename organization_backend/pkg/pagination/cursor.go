@@ -36,3 +36,29 @@ func Decode(encoded string) (Cursor, error) {
 	}
 	return Cursor{Time: ts, ID: parts[1]}, nil
 }
+
+// KeyCursor points after a row in a listing ordered by a string key and ID
+type KeyCursor struct {
+	Key string
+	ID  string
+}
+
+func EncodeKey(cursor KeyCursor) string {
+	raw := fmt.Sprintf("%s|%s", cursor.ID, cursor.Key)
+	return base64.StdEncoding.EncodeToString([]byte(raw))
+}
+
+func DecodeKey(encoded string) (KeyCursor, error) {
+	if encoded == "" {
+		return KeyCursor{}, errors.New("empty cursor")
+	}
+	data, err := base64.StdEncoding.DecodeString(encoded)
+	if err != nil {
+		return KeyCursor{}, err
+	}
+	parts := strings.SplitN(string(data), "|", 2)
+	if len(parts) != 2 {
+		return KeyCursor{}, errors.New("invalid cursor")
+	}
+	return KeyCursor{ID: parts[0], Key: parts[1]}, nil
+}